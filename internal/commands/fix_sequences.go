@@ -6,6 +6,8 @@ import (
 	"sort"
 	"strings"
 
+	"ministry-mapper/internal/handlers"
+
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/spf13/cobra"
@@ -292,9 +294,9 @@ func (p *mapPlan) sortColumns() {
 			return p.OldSeq[a] < p.OldSeq[b]
 		}
 		if p.Descending {
-			return naturalLess(b, a)
+			return handlers.NaturalLess(b, a)
 		}
-		return naturalLess(a, b)
+		return handlers.NaturalLess(a, b)
 	})
 }
 
@@ -321,7 +323,7 @@ func detectDirection(order []string, oldSeq map[string]int) (descending, unclear
 
 	var up, down int
 	for i := 1; i < len(settled); i++ {
-		if naturalLess(settled[i-1], settled[i]) {
+		if handlers.NaturalLess(settled[i-1], settled[i]) {
 			up++
 		} else {
 			down++
@@ -412,40 +414,6 @@ func describeNew(plan *mapPlan, group []string) string {
 	return strings.Join(parts, ", ")
 }
 
-// naturalLess orders codes the way a person reads them: digit runs compare
-// numerically so "9" precedes "10", and "10" precedes "10A".
-func naturalLess(a, b string) bool {
-	i, j := 0, 0
-	for i < len(a) && j < len(b) {
-		if isDigit(a[i]) && isDigit(b[j]) {
-			si, sj := i, j
-			for i < len(a) && isDigit(a[i]) {
-				i++
-			}
-			for j < len(b) && isDigit(b[j]) {
-				j++
-			}
-			na := strings.TrimLeft(a[si:i], "0")
-			nb := strings.TrimLeft(b[sj:j], "0")
-			if len(na) != len(nb) {
-				return len(na) < len(nb)
-			}
-			if na != nb {
-				return na < nb
-			}
-			continue
-		}
-		if a[i] != b[j] {
-			return a[i] < b[j]
-		}
-		i++
-		j++
-	}
-	return len(a)-i < len(b)-j
-}
-
-func isDigit(c byte) bool { return c >= '0' && c <= '9' }
-
 func truncate(s string, max int) string {
 	if len(s) <= max {
 		return s
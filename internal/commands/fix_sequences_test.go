@@ -19,34 +19,6 @@ func rowsOf(floors int, pairs ...any) []codeSequence {
 	return rows
 }
 
-func TestNaturalLess(t *testing.T) {
-	ordered := []struct{ a, b string }{
-		{"9", "10"},        // numeric, not lexical
-		{"10", "10A"},      // bare number before its suffixed neighbour
-		{"10A", "10B"},     // suffix order
-		{"2A", "2B"},       // ditto with a leading digit
-		{"05", "7"},        // leading zeros ignored
-		{"4301", "4303"},   // the reported case
-		{"20A", "20B"},     // Tiong Poh style
-		{"1-9", "1-10"},    // hyphenated flats compare numerically
-		{"E-2-1", "E-2-2"}, // block-prefixed flats
-		{"K1", "K2"},
-	}
-
-	for _, c := range ordered {
-		if !naturalLess(c.a, c.b) {
-			t.Errorf("naturalLess(%q, %q) = false, want true", c.a, c.b)
-		}
-		if naturalLess(c.b, c.a) {
-			t.Errorf("naturalLess(%q, %q) = true, want false", c.b, c.a)
-		}
-	}
-
-	if naturalLess("10", "10") {
-		t.Error("naturalLess should be false for equal codes")
-	}
-}
-
 func TestDetectDirection(t *testing.T) {
 	cases := []struct {
 		name           string
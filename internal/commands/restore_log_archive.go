@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"ministry-mapper/internal/jobs"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+var archiveMonthRegex = regexp.MustCompile(`^\d{4}-\d{2}$`)
+
+// NewRestoreLogArchive builds the `restore-log-archive` console command, which
+// loads one month of an archived audit log into a scratch collection so it can
+// be inspected in the dashboard without touching the live log.
+func NewRestoreLogArchive(app core.App) *cobra.Command {
+	var into string
+
+	command := &cobra.Command{
+		Use:   "restore-log-archive <collection> <YYYY-MM>",
+		Short: "Load an archived audit log month into a scratch collection",
+		Long: "Reads the archive the log retention job wrote for <collection> and month\n" +
+			"<YYYY-MM> and inserts its rows into a new collection, named\n" +
+			"<collection>_archive_<YYYYMM> unless --into is given. The scratch collection\n" +
+			"has no API rules, so only superusers can read it; delete it when done.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runRestoreLogArchive(app, args[0], args[1], into)
+		},
+	}
+
+	command.Flags().StringVar(&into, "into", "", "name of the scratch collection to create")
+
+	return command
+}
+
+func runRestoreLogArchive(app core.App, collection, month, into string) error {
+	if !jobs.IsRetainedLog(collection) {
+		return fmt.Errorf("%s is not an archived audit log", collection)
+	}
+	if !archiveMonthRegex.MatchString(month) {
+		return fmt.Errorf("month must be YYYY-MM, got %q", month)
+	}
+	if into == "" {
+		into = fmt.Sprintf("%s_archive_%s", collection, strings.ReplaceAll(month, "-", ""))
+	}
+	if _, err := app.FindCollectionByNameOrId(into); err == nil {
+		return fmt.Errorf("collection %s already exists; pass --into to choose another name", into)
+	}
+
+	key := jobs.LogArchiveKey(collection, month)
+	rows, err := jobs.ReadLogArchive(app, key)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", key, err)
+	}
+	if len(rows) == 0 {
+		fmt.Printf("%s is empty, nothing to restore.\n", key)
+		return nil
+	}
+
+	columns := map[string]bool{}
+	for _, row := range rows {
+		for column := range row {
+			if column != "id" {
+				columns[column] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(columns))
+	for column := range columns {
+		names = append(names, column)
+	}
+	sort.Strings(names)
+
+	// Every column is restored as text: the scratch copy is for reading, and
+	// text keeps relation ids, dates and JSON exactly as they were archived.
+	scratch := core.NewBaseCollection(into)
+	for _, column := range names {
+		scratch.Fields.Add(&core.TextField{Name: column})
+	}
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		if err := txApp.Save(scratch); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			params := make(dbx.Params, len(row))
+			for column, value := range row {
+				params[column] = value
+			}
+			if _, err := txApp.DB().Insert(into, params).Execute(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %d row(s) from %s into %s.\n", len(rows), key, into)
+	return nil
+}
@@ -0,0 +1,92 @@
+//go:build testdata
+
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"ministry-mapper/internal/jobs"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func insertAddressLog(t testing.TB, app core.App, id, created string) {
+	t.Helper()
+	_, err := app.DB().Insert("addresses_log", dbx.Params{
+		"id": id, "address": "testalpha01a001", "congregation": "testcongalpha01",
+		"territory": "testterralpha01", "map": "testmapalpha01a",
+		"old_status": "not_done", "new_status": "done", "changed_by": "Field Worker",
+		"created": created, "updated": created,
+	}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreLogArchive_LoadsAPrunedMonth(t *testing.T) {
+	app, err := tests.NewTestApp("../../test_pb_data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+	t.Setenv("LOG_RETENTION_ADDRESSES_LOG_DAYS", "30")
+
+	insertAddressLog(t, app, "restorelog00001", "2026-01-05 10:00:00.000Z")
+	insertAddressLog(t, app, "restorelog00002", "2026-01-20 10:00:00.000Z")
+
+	if err := jobs.RunLogRetention(app, time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.FindRecordById("addresses_log", "restorelog00001"); err == nil {
+		t.Fatal("January rows should have been pruned before the restore")
+	}
+
+	if err := runRestoreLogArchive(app, "addresses_log", "2026-01", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []struct {
+		Id        string `db:"id"`
+		NewStatus string `db:"new_status"`
+		ChangedBy string `db:"changed_by"`
+		Created   string `db:"created"`
+	}
+	if err := app.DB().NewQuery("SELECT id, new_status, changed_by, created FROM addresses_log_archive_202601 ORDER BY created").All(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Id != "restorelog00001" || rows[1].Id != "restorelog00002" {
+		t.Fatalf("unexpected scratch rows: %+v", rows)
+	}
+	if rows[0].NewStatus != "done" || rows[0].ChangedBy != "Field Worker" || rows[0].Created != "2026-01-05 10:00:00.000Z" {
+		t.Errorf("scratch row should keep the archived values, got %+v", rows[0])
+	}
+
+	// The live log is left as the retention job left it.
+	if _, err := app.FindRecordById("addresses_log", "restorelog00001"); err == nil {
+		t.Error("restore must not write rows back into the live log")
+	}
+
+	if err := runRestoreLogArchive(app, "addresses_log", "2026-01", ""); err == nil {
+		t.Error("restoring into an existing scratch collection should fail")
+	}
+}
+
+func TestRestoreLogArchive_RejectsOtherCollections(t *testing.T) {
+	app, err := tests.NewTestApp("../../test_pb_data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Cleanup()
+
+	for _, collection := range []string{"users", "addresses", "../addresses_log", ""} {
+		if err := runRestoreLogArchive(app, collection, "2026-01", "scratch_copy"); err == nil {
+			t.Errorf("collection %q: want an error", collection)
+		}
+	}
+	if _, err := app.FindCollectionByNameOrId("scratch_copy"); err == nil {
+		t.Error("a rejected restore must not create the scratch collection")
+	}
+}
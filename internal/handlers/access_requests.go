@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// accessRequestMaxPending caps how many congregations one user can have
+// outstanding requests with, so a guessed-at code cannot flood administrators.
+const accessRequestMaxPending = 3
+
+const roleActionAccessDenied = "access_denied"
+
+type CreateAccessRequestRequest struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ListAccessRequestsRequest struct {
+	Congregation string `json:"congregation"`
+	Status       string `json:"status"`
+}
+
+type DecideAccessRequestRequest struct {
+	Request  string `json:"request"`
+	Decision string `json:"decision"`
+	Role     string `json:"role"`
+}
+
+type accessRequestEntry struct {
+	Id        string `db:"id"         json:"id"`
+	User      string `db:"user"       json:"user"`
+	Name      string `db:"name"       json:"name"`
+	Email     string `db:"email"      json:"email"`
+	Message   string `db:"message"    json:"message"`
+	Status    string `db:"status"     json:"status"`
+	Role      string `db:"role"       json:"role"`
+	DecidedBy string `db:"decided_by" json:"decided_by"`
+	Created   string `db:"created"    json:"created"`
+}
+
+// HandleCreateAccessRequest lets a signed-in user ask to join the congregation
+// with the given code. Administrators see pending requests in their digest
+// and through /access/requests.
+func HandleCreateAccessRequest(e *core.RequestEvent, app core.App) error {
+	data := CreateAccessRequestRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	code := strings.TrimSpace(data.Code)
+	if code == "" {
+		return apis.NewBadRequestError("code is required", nil)
+	}
+	message := strings.TrimSpace(data.Message)
+	if len(message) > 500 {
+		return apis.NewBadRequestError("message must be 500 characters or fewer", nil)
+	}
+
+	var congregation struct {
+		Id   string `db:"id"`
+		Name string `db:"name"`
+	}
+	err := app.DB().NewQuery("SELECT id, name FROM congregations WHERE LOWER(code) = LOWER({:code}) LIMIT 1").
+		Bind(dbx.Params{"code": code}).One(&congregation)
+	if err != nil {
+		return apis.NewNotFoundError("No congregation has that code", nil)
+	}
+
+	if AuthorizeByRole(app, e.Auth.Id, congregation.Id) {
+		return apis.NewBadRequestError("You already have access to this congregation", nil)
+	}
+
+	pending, err := app.FindRecordsByFilter("access_requests", "user = {:user} && status = 'pending'", "", 0, 0,
+		dbx.Params{"user": e.Auth.Id})
+	if err != nil {
+		return newServerError(err)
+	}
+	for _, request := range pending {
+		if request.GetString("congregation") == congregation.Id {
+			return apis.NewBadRequestError("You already have a pending request for this congregation", nil)
+		}
+	}
+	if len(pending) >= accessRequestMaxPending {
+		return apis.NewBadRequestError(fmt.Sprintf("You can have at most %d pending access requests", accessRequestMaxPending), nil)
+	}
+
+	collection, err := app.FindCachedCollectionByNameOrId("access_requests")
+	if err != nil {
+		return newServerError(err)
+	}
+	request := core.NewRecord(collection)
+	request.Set("congregation", congregation.Id)
+	request.Set("user", e.Auth.Id)
+	request.Set("message", message)
+	request.Set("status", "pending")
+	if err := app.Save(request); err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusCreated, map[string]any{
+		"id":           request.Id,
+		"congregation": congregation.Name,
+		"status":       "pending",
+	})
+}
+
+// HandleListAccessRequests lists a congregation's access requests newest
+// first, optionally narrowed to one status.
+func HandleListAccessRequests(e *core.RequestEvent, app core.App) error {
+	data := ListAccessRequestsRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" {
+		return apis.NewBadRequestError("congregation is required", nil)
+	}
+	if !AuthorizeByRole(app, e.Auth.Id, data.Congregation, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+
+	filter := "r.congregation = {:congregation}"
+	params := dbx.Params{"congregation": data.Congregation}
+	if data.Status != "" {
+		filter += " AND r.status = {:status}"
+		params["status"] = data.Status
+	}
+
+	entries := []accessRequestEntry{}
+	err := app.DB().NewQuery(`
+		SELECT r.id, r.user, COALESCE(u.name, '') AS name, COALESCE(u.email, '') AS email,
+		       COALESCE(r.message, '') AS message, r.status, COALESCE(r.role, '') AS role,
+		       COALESCE(d.name, '') AS decided_by, r.created
+		FROM access_requests r
+		LEFT JOIN users u ON u.id = r.user
+		LEFT JOIN users d ON d.id = r.decided_by
+		WHERE ` + filter + `
+		ORDER BY r.created DESC
+	`).Bind(params).All(&entries)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusOK, entries)
+}
+
+// HandleDecideAccessRequest approves or denies a pending access request.
+// Approval grants the requester role (read_only unless given) and clears their
+// unprovisioned_* stamps so processUnprovisionedUsers stops warning them.
+func HandleDecideAccessRequest(e *core.RequestEvent, app core.App) error {
+	data := DecideAccessRequestRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Request == "" {
+		return apis.NewBadRequestError("request is required", nil)
+	}
+	if data.Decision != "approve" && data.Decision != "deny" {
+		return apis.NewBadRequestError("decision must be approve or deny", nil)
+	}
+	role := data.Role
+	if role == "" {
+		role = "read_only"
+	}
+	if !assignableRoles[role] {
+		return apis.NewBadRequestError("role must be read_only, conductor or administrator", nil)
+	}
+
+	request, err := app.FindRecordById("access_requests", data.Request)
+	if err != nil {
+		return apis.NewNotFoundError("Access request not found", nil)
+	}
+	congregation := request.GetString("congregation")
+	userId := request.GetString("user")
+	if !AuthorizeByRole(app, e.Auth.Id, congregation, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+
+	granted := false
+	err = app.RunInTransaction(func(txApp core.App) error {
+		fresh, err := txApp.FindRecordById("access_requests", request.Id)
+		if err != nil {
+			return err
+		}
+		if status := fresh.GetString("status"); status != "pending" {
+			return apis.NewBadRequestError(fmt.Sprintf("Access request is already %s", status), nil)
+		}
+
+		if data.Decision == "approve" {
+			role, granted, err = grantRoleIfMissing(txApp, userId, congregation, role)
+			if err != nil {
+				return err
+			}
+			fresh.Set("status", "approved")
+			fresh.Set("role", role)
+		} else {
+			fresh.Set("status", "denied")
+		}
+		fresh.Set("decided_by", e.Auth.Id)
+		fresh.Set("decided_at", time.Now().UTC())
+		return txApp.Save(fresh)
+	})
+	if err != nil {
+		return wrapTransactionError(err)
+	}
+
+	switch {
+	case granted:
+		writeRoleLogEntry(app, congregation, userId, "granted", "", role, e.Auth.Id, "")
+	case data.Decision == "deny":
+		writeRoleLogEntry(app, congregation, userId, roleActionAccessDenied, "", "", e.Auth.Id, "")
+	}
+
+	response := map[string]any{"status": "denied"}
+	if data.Decision == "approve" {
+		response = map[string]any{"status": "approved", "role": role}
+	}
+	return e.JSON(http.StatusOK, response)
+}
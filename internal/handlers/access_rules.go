@@ -0,0 +1,126 @@
+package handlers
+
+import "github.com/pocketbase/pocketbase/core"
+
+// accessScope is the record an access decision is about, with the
+// congregation, territory and map its access is scoped by.
+type accessScope struct {
+	Record       string
+	Congregation string
+	Territory    string
+	Map          string
+}
+
+// accessRule is how one collection decides whether a record may be viewed or
+// edited. The API hooks, the custom routes and HandlePermissionExplain all
+// decide through the same rule, so an explanation cannot drift from what is
+// enforced.
+type accessRule struct {
+	// Role decides for a signed-in user.
+	Role      func(app core.App, userId string, s accessScope) bool
+	RoleNeeds string
+	// Link decides for a link-id; nil when links never qualify.
+	Link      func(app core.App, linkId string, s accessScope) bool
+	LinkNeeds string
+}
+
+// allow runs the rule for a request: a link-id takes precedence over any role
+// whenever one is present.
+func (r accessRule) allow(app core.App, auth *core.Record, linkId string, s accessScope) bool {
+	if linkId != "" {
+		return r.Link != nil && r.Link(app, linkId, s)
+	}
+	return auth != nil && r.Role(app, auth.Id, s)
+}
+
+func anyMapRole(app core.App, userId string, s accessScope) bool {
+	return s.Map != "" && authorizeUserForMap(app, userId, s.Map)
+}
+
+func liveMapLink(app core.App, linkId string, s accessScope) bool {
+	return s.Map != "" && AuthorizeLinkAccess(app, linkId, s.Map)
+}
+
+// mapAccessRule covers map content open to anyone working the map: viewing
+// it, and the /address/* routes that read and update addresses.
+var mapAccessRule = accessRule{
+	Role:      anyMapRole,
+	RoleNeeds: "any role covering the map's territory",
+	Link:      liveMapLink,
+	LinkNeeds: "a live link for the map",
+}
+
+// viewRules and editRules hold the rule for each collection with an access
+// check of its own. Message creation follows viewRules: anyone who may read a
+// map's messages may post to it.
+var viewRules = map[string]accessRule{
+	"congregations": {
+		Role: func(app core.App, userId string, s accessScope) bool {
+			return AuthorizeByRole(app, userId, s.Congregation)
+		},
+		RoleNeeds: "any role in the congregation",
+		Link: func(app core.App, linkId string, s accessScope) bool {
+			return AuthorizeLinkForCongregation(app, linkId, s.Congregation)
+		},
+		LinkNeeds: "a live link in the congregation",
+	},
+	"territories": {
+		Role: func(app core.App, userId string, s accessScope) bool {
+			return AuthorizeTerritoryByRole(app, userId, s.Territory)
+		},
+		RoleNeeds: "any role covering the territory",
+		LinkNeeds: "a role: links do not grant territory access",
+	},
+	"maps":            mapAccessRule,
+	"messages":        mapAccessRule,
+	"addresses":       mapAccessRule,
+	"address_options": mapAccessRule,
+	"assignments": {
+		Role:      anyMapRole,
+		RoleNeeds: "any role covering the map's territory",
+		Link: func(app core.App, linkId string, s accessScope) bool {
+			return linkId == s.Record
+		},
+		LinkNeeds: "the link to be this assignment",
+	},
+}
+
+var editRules = map[string]accessRule{
+	"congregations": {
+		Role: func(app core.App, userId string, s accessScope) bool {
+			return AuthorizeByRole(app, userId, s.Congregation, "administrator")
+		},
+		RoleNeeds: "a congregation-wide administrator role",
+		LinkNeeds: "a role: links cannot edit congregations",
+	},
+	"territories": {
+		Role: func(app core.App, userId string, s accessScope) bool {
+			return s.Territory != "" && AuthorizeTerritoryByRole(app, userId, s.Territory, "administrator")
+		},
+		RoleNeeds: "an administrator role covering the territory",
+		LinkNeeds: "a role: links do not grant territory access",
+	},
+	"maps": {
+		Role: func(app core.App, userId string, s accessScope) bool {
+			return s.Territory != "" && AuthorizeTerritoryByRole(app, userId, s.Territory, "administrator")
+		},
+		RoleNeeds: "an administrator role covering the map's territory",
+		LinkNeeds: "a role: links cannot edit or delete maps",
+	},
+	"messages": {
+		Role: func(app core.App, userId string, s accessScope) bool {
+			return s.Map != "" && AuthorizeMapByRole(app, userId, s.Map, "administrator")
+		},
+		RoleNeeds: "an administrator role covering the map's territory",
+		LinkNeeds: "a role: links cannot edit or delete messages",
+	},
+	"assignments": {
+		Role: func(app core.App, userId string, s accessScope) bool {
+			return s.Map != "" && AuthorizeMapByRole(app, userId, s.Map, "administrator", "conductor")
+		},
+		RoleNeeds: "an administrator or conductor role covering the map's territory",
+		LinkNeeds: "a role: links cannot edit assignments",
+	},
+	"addresses":       mapAccessRule,
+	"address_options": mapAccessRule,
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// AccountPolicy holds the day thresholds of the inactive-user and
+// unprovisioned-user lifecycles. A zero field means "use the default".
+type AccountPolicy struct {
+	InactivityWarnDays         int `db:"inactivity_warn_days"          json:"inactivity_warn_days"`
+	InactivityFinalWarnDays    int `db:"inactivity_final_warn_days"    json:"inactivity_final_warn_days"`
+	InactivityDisableDays      int `db:"inactivity_disable_days"       json:"inactivity_disable_days"`
+	UnprovisionedWarnDays      int `db:"unprovisioned_warn_days"       json:"unprovisioned_warn_days"`
+	UnprovisionedFinalWarnDays int `db:"unprovisioned_final_warn_days" json:"unprovisioned_final_warn_days"`
+	UnprovisionedDisableDays   int `db:"unprovisioned_disable_days"    json:"unprovisioned_disable_days"`
+}
+
+// DefaultAccountPolicy is the policy of a congregation that sets none of the
+// thresholds, and of users who belong to no congregation.
+var DefaultAccountPolicy = AccountPolicy{
+	InactivityWarnDays:         91,
+	InactivityFinalWarnDays:    152,
+	InactivityDisableDays:      183,
+	UnprovisionedWarnDays:      3,
+	UnprovisionedFinalWarnDays: 6,
+	UnprovisionedDisableDays:   7,
+}
+
+// WithDefaults fills every unset threshold from DefaultAccountPolicy.
+func (p AccountPolicy) WithDefaults() AccountPolicy {
+	orDefault := func(v, d int) int {
+		if v <= 0 {
+			return d
+		}
+		return v
+	}
+	d := DefaultAccountPolicy
+	return AccountPolicy{
+		InactivityWarnDays:         orDefault(p.InactivityWarnDays, d.InactivityWarnDays),
+		InactivityFinalWarnDays:    orDefault(p.InactivityFinalWarnDays, d.InactivityFinalWarnDays),
+		InactivityDisableDays:      orDefault(p.InactivityDisableDays, d.InactivityDisableDays),
+		UnprovisionedWarnDays:      orDefault(p.UnprovisionedWarnDays, d.UnprovisionedWarnDays),
+		UnprovisionedFinalWarnDays: orDefault(p.UnprovisionedFinalWarnDays, d.UnprovisionedFinalWarnDays),
+		UnprovisionedDisableDays:   orDefault(p.UnprovisionedDisableDays, d.UnprovisionedDisableDays),
+	}
+}
+
+// Stricter returns the smaller of each threshold of p and o, both of which
+// must have defaults applied. Ordering within each lifecycle is preserved:
+// if both policies warn before they disable, so does the result.
+func (p AccountPolicy) Stricter(o AccountPolicy) AccountPolicy {
+	return AccountPolicy{
+		InactivityWarnDays:         min(p.InactivityWarnDays, o.InactivityWarnDays),
+		InactivityFinalWarnDays:    min(p.InactivityFinalWarnDays, o.InactivityFinalWarnDays),
+		InactivityDisableDays:      min(p.InactivityDisableDays, o.InactivityDisableDays),
+		UnprovisionedWarnDays:      min(p.UnprovisionedWarnDays, o.UnprovisionedWarnDays),
+		UnprovisionedFinalWarnDays: min(p.UnprovisionedFinalWarnDays, o.UnprovisionedFinalWarnDays),
+		UnprovisionedDisableDays:   min(p.UnprovisionedDisableDays, o.UnprovisionedDisableDays),
+	}
+}
+
+// CongregationAccountPolicy reads a congregation's policy, defaults applied.
+func CongregationAccountPolicy(congregation *core.Record) AccountPolicy {
+	return AccountPolicy{
+		InactivityWarnDays:         congregation.GetInt("inactivity_warn_days"),
+		InactivityFinalWarnDays:    congregation.GetInt("inactivity_final_warn_days"),
+		InactivityDisableDays:      congregation.GetInt("inactivity_disable_days"),
+		UnprovisionedWarnDays:      congregation.GetInt("unprovisioned_warn_days"),
+		UnprovisionedFinalWarnDays: congregation.GetInt("unprovisioned_final_warn_days"),
+		UnprovisionedDisableDays:   congregation.GetInt("unprovisioned_disable_days"),
+	}.WithDefaults()
+}
+
+// ValidateCongregationAccountPolicy rejects a congregation whose effective
+// thresholds would disable an account before warning about it. The per-field
+// bounds are enforced by the fields themselves. It should be called from
+// OnRecordValidate("congregations").
+func ValidateCongregationAccountPolicy(e *core.RecordEvent) error {
+	p := CongregationAccountPolicy(e.Record)
+	if p.InactivityWarnDays >= p.InactivityFinalWarnDays || p.InactivityFinalWarnDays >= p.InactivityDisableDays {
+		return apis.NewBadRequestError("Inactivity thresholds must satisfy warn < final warn < disable days", nil)
+	}
+	if p.UnprovisionedWarnDays >= p.UnprovisionedFinalWarnDays || p.UnprovisionedFinalWarnDays >= p.UnprovisionedDisableDays {
+		return apis.NewBadRequestError("Unprovisioned thresholds must satisfy warn < final warn < disable days", nil)
+	}
+	return e.Next()
+}
+
+// AccountPolicyAction is one step processInactiveUsers or
+// processUnprovisionedUsers would take for a user.
+type AccountPolicyAction struct {
+	User          string   `json:"user"`
+	Name          string   `json:"name"`
+	Email         string   `json:"email"`
+	Lifecycle     string   `json:"lifecycle"`
+	Action        string   `json:"action"`
+	Days          int      `json:"days"`
+	Congregations []string `json:"-"`
+}
+
+// AccountPlanFn lists the actions the account jobs would take if they ran at
+// the given time. Injected from the jobs package to avoid an import cycle.
+type AccountPlanFn func(app core.App, at time.Time) ([]AccountPolicyAction, error)
+
+type AccountPolicyDryRunRequest struct {
+	Congregation string `json:"congregation"`
+}
+
+// HandleAccountPolicyDryRun lists who in the congregation the account jobs
+// would warn, disable or delete on their next daily run, without doing it.
+// A user's effective policy may be stricter than this congregation's own if
+// they also belong to another.
+func HandleAccountPolicyDryRun(e *core.RequestEvent, app core.App, plan AccountPlanFn) error {
+	data := AccountPolicyDryRunRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" {
+		return apis.NewBadRequestError("congregation is required", nil)
+	}
+	if !AuthorizeByRole(app, e.Auth.Id, data.Congregation, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+	congregation, err := app.FindRecordById("congregations", data.Congregation)
+	if err != nil {
+		return apis.NewNotFoundError("Congregation not found", nil)
+	}
+
+	at := time.Now().UTC().Add(24 * time.Hour)
+	actions, err := plan(app, at)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	matching := []AccountPolicyAction{}
+	for _, action := range actions {
+		for _, c := range action.Congregations {
+			if c == data.Congregation {
+				matching = append(matching, action)
+				break
+			}
+		}
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"as_of":   at.Format(time.RFC3339),
+		"policy":  CongregationAccountPolicy(congregation),
+		"actions": matching,
+	})
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import "testing"
+
+func TestAccountPolicyWithDefaults(t *testing.T) {
+	got := AccountPolicy{InactivityDisableDays: 60}.WithDefaults()
+
+	want := DefaultAccountPolicy
+	want.InactivityDisableDays = 60
+	if got != want {
+		t.Errorf("WithDefaults() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAccountPolicyStricter(t *testing.T) {
+	strict := AccountPolicy{
+		InactivityWarnDays: 30, InactivityFinalWarnDays: 45, InactivityDisableDays: 60,
+		UnprovisionedWarnDays: 5, UnprovisionedFinalWarnDays: 10, UnprovisionedDisableDays: 14,
+	}
+	loose := AccountPolicy{
+		InactivityWarnDays: 300, InactivityFinalWarnDays: 330, InactivityDisableDays: 365,
+		UnprovisionedWarnDays: 1, UnprovisionedFinalWarnDays: 2, UnprovisionedDisableDays: 3,
+	}
+
+	want := AccountPolicy{
+		InactivityWarnDays: 30, InactivityFinalWarnDays: 45, InactivityDisableDays: 60,
+		UnprovisionedWarnDays: 1, UnprovisionedFinalWarnDays: 2, UnprovisionedDisableDays: 3,
+	}
+	if got := strict.Stricter(loose); got != want {
+		t.Errorf("Stricter() = %+v, want %+v", got, want)
+	}
+	if got := loose.Stricter(strict); got != want {
+		t.Errorf("Stricter() should be symmetric, got %+v", got)
+	}
+}
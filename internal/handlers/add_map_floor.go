@@ -1,9 +1,9 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
 
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
 )
@@ -11,12 +11,21 @@ import (
 // AddMapFloorRequest uses a pointer for AddHigher so an omitted field is
 // rejected rather than silently defaulting to "add a floor below".
 type AddMapFloorRequest struct {
-	AddHigher *bool  `json:"add_higher"`
-	Map       string `json:"map"`
+	AddHigher   *bool  `json:"add_higher"`
+	Map         string `json:"map"`
+	CodePattern string `json:"code_pattern"`
+}
+
+// floorCode is one unit to create on the new floor.
+type floorCode struct {
+	Code     string
+	Sequence int
 }
 
 // HandleMapFloor adds a new floor to a map by copying the address codes of the
-// current highest (or lowest, per add_higher) floor onto the new floor.
+// current highest (or lowest, per add_higher) floor onto the new floor. With a
+// code_pattern the new floor gets the pattern's codes instead, for floors laid
+// out differently from their neighbours (e.g. a penthouse or a basement).
 func HandleMapFloor(e *core.RequestEvent, app core.App) error {
 	data := AddMapFloorRequest{}
 	if err := e.BindBody(&data); err != nil {
@@ -37,7 +46,7 @@ func HandleMapFloor(e *core.RequestEvent, app core.App) error {
 		return apis.NewNotFoundError("Error fetching map data", nil)
 	}
 
-	if !AuthorizeByRole(app, e.Auth.Id, mapData.GetString("congregation"), "administrator") {
+	if !AuthorizeMapByRole(app, e.Auth.Id, mapData.Id, "administrator") {
 		return apis.NewForbiddenError("Administrator access required", nil)
 	}
 
@@ -56,11 +65,33 @@ func HandleMapFloor(e *core.RequestEvent, app core.App) error {
 		return apis.NewNotFoundError("Error fetching floor", nil)
 	}
 
-	addresses, err := fetchMapAddressCodes(app, mapId, floor)
-	if err != nil {
-		return apis.NewNotFoundError("Error fetching addresses", nil)
+	var codes []floorCode
+	if data.CodePattern != "" {
+		patternCodes, err := expandCodePattern(data.CodePattern)
+		if err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		codes, err = assignFloorSequences(app, mapId, patternCodes)
+		if err != nil {
+			return apis.NewNotFoundError("Error fetching addresses", nil)
+		}
+	} else {
+		addresses, err := fetchMapAddressCodes(app, mapId, floor)
+		if err != nil {
+			return apis.NewNotFoundError("Error fetching addresses", nil)
+		}
+		for _, address := range addresses {
+			codes = append(codes, floorCode{Code: address.GetString("code"), Sequence: address.GetInt("sequence")})
+		}
 	}
 
+	source := "floor_copy"
+	if data.CodePattern != "" {
+		source = "admin"
+	}
+	congregation := mapData.GetString("congregation")
+	territory := mapData.GetString("territory")
+
 	err = app.RunInTransaction(func(txApp core.App) error {
 		if add_higher {
 			floor++
@@ -83,16 +114,16 @@ func HandleMapFloor(e *core.RequestEvent, app core.App) error {
 
 		createdBy := e.Auth.GetString("name")
 
-		for _, address := range addresses {
+		for _, code := range codes {
 			record := core.NewRecord(addressCollection)
-			record.Set("code", address.Get("code"))
+			record.Set("code", code.Code)
 			record.Set("floor", floor)
-			record.Set("congregation", address.Get("congregation"))
+			record.Set("congregation", congregation)
 			record.Set("map", mapId)
 			record.Set("status", "not_done")
-			record.Set("territory", address.Get("territory"))
-			record.Set("sequence", address.Get("sequence"))
-			record.Set("source", "floor_copy")
+			record.Set("territory", territory)
+			record.Set("sequence", code.Sequence)
+			record.Set("source", source)
 			record.Set("created_by", createdBy)
 
 			if err := txApp.SaveNoValidate(record); err != nil {
@@ -101,7 +132,7 @@ func HandleMapFloor(e *core.RequestEvent, app core.App) error {
 			aoRec := core.NewRecord(aoCollection)
 			aoRec.Set("address", record.Id)
 			aoRec.Set("option", defaultType.Id)
-			aoRec.Set("congregation", fmt.Sprintf("%v", address.Get("congregation")))
+			aoRec.Set("congregation", congregation)
 			aoRec.Set("map", mapId)
 			if err := txApp.SaveNoValidate(aoRec); err != nil {
 				return err
@@ -113,7 +144,51 @@ func HandleMapFloor(e *core.RequestEvent, app core.App) error {
 	if err != nil {
 		return newServerError(err)
 	}
+	floorCodes := make([]string, len(codes))
+	for i, code := range codes {
+		floorCodes[i] = code.Code
+	}
+	writeStructureLog(app, congregation, structureFloorAdded, "map", mapId, authID(e.Auth), map[string]any{
+		"floor": floor,
+		"codes": floorCodes,
+	})
+
 	ProcessMapAggregates(mapId, app)
 
 	return e.String(http.StatusOK, "Map floor updated successfully")
 }
+
+// assignFloorSequences keeps the map's invariant that a code holds one
+// sequence across all floors: codes already on the map reuse theirs, and new
+// codes follow the current highest sequence in NaturalLess order.
+func assignFloorSequences(app core.App, mapId string, codes []string) ([]floorCode, error) {
+	var existing []struct {
+		Code     string `db:"code"`
+		Sequence int    `db:"sequence"`
+	}
+	err := app.DB().NewQuery("SELECT code, MIN(sequence) AS sequence FROM addresses WHERE map = {:map} GROUP BY code").
+		Bind(dbx.Params{"map": mapId}).All(&existing)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]int, len(existing))
+	next := -1
+	for _, row := range existing {
+		known[row.Code] = row.Sequence
+		if row.Sequence > next {
+			next = row.Sequence
+		}
+	}
+
+	result := make([]floorCode, 0, len(codes))
+	for _, code := range codes {
+		seq, ok := known[code]
+		if !ok {
+			next++
+			seq = next
+		}
+		result = append(result, floorCode{Code: code, Sequence: seq})
+	}
+	return result, nil
+}
@@ -30,7 +30,7 @@ func HandleMapAdd(e *core.RequestEvent, app core.App) error {
 		return apis.NewNotFoundError("Error fetching map data", nil)
 	}
 
-	if !AuthorizeByRole(app, e.Auth.Id, mapData.GetString("congregation"), "administrator") {
+	if !AuthorizeMapByRole(app, e.Auth.Id, mapData.Id, "administrator") {
 		return apis.NewForbiddenError("Administrator access required", nil)
 	}
 
@@ -69,17 +69,11 @@ func HandleMapAdd(e *core.RequestEvent, app core.App) error {
 		codes = append(codes, code)
 	}
 
-	// Codes already in the DB are skipped, not rejected.
-	var validCodes []string
-	var existingCodes []string
-
-	for _, code := range codes {
-		if _, err := fetchAddressByCode(app, code, mapId); err != nil {
-			validCodes = append(validCodes, code)
-		} else {
-			existingCodes = append(existingCodes, code)
-		}
+	result, err := addMapCodes(app, mapData, codes, e.Auth.GetString("name"), authID(e.Auth))
+	if err != nil {
+		return err
 	}
+	validCodes, existingCodes := result.Inserted, result.Existing
 
 	if len(validCodes) == 0 {
 		return e.JSON(http.StatusOK, map[string]interface{}{
@@ -93,14 +87,61 @@ func HandleMapAdd(e *core.RequestEvent, app core.App) error {
 		})
 	}
 
+	totalInserted := len(validCodes) * len(result.Floors)
+
+	return e.JSON(http.StatusOK, map[string]interface{}{
+		"success":           true,
+		"codes_requested":   len(codes),
+		"codes_inserted":    len(validCodes),
+		"codes_skipped":     len(existingCodes),
+		"addresses_created": totalInserted,
+		"existing_codes":    existingCodes,
+		"message": fmt.Sprintf(
+			"%d codes processed (%d addresses created), %d skipped (already exist)",
+			len(validCodes),
+			totalInserted,
+			len(existingCodes),
+		),
+	})
+}
+
+// addCodesResult reports which codes addMapCodes created and which it skipped
+// because they were already on the map.
+type addCodesResult struct {
+	Inserted []string
+	Existing []string
+	Floors   []int
+}
+
+// addMapCodes creates an address per code on every floor of mapData, skipping
+// codes the map already has, then logs the change and refreshes aggregates.
+// codes must already be validated. Shared by HandleMapAdd and approved change
+// requests.
+func addMapCodes(app core.App, mapData *core.Record, codes []string, createdBy, changedBy string) (addCodesResult, error) {
+	mapId := mapData.Id
+	result := addCodesResult{}
+
+	// Codes already in the DB are skipped, not rejected.
+	for _, code := range codes {
+		if _, err := fetchAddressByCode(app, code, mapId); err != nil {
+			result.Inserted = append(result.Inserted, code)
+		} else {
+			result.Existing = append(result.Existing, code)
+		}
+	}
+	if len(result.Inserted) == 0 {
+		return result, nil
+	}
+
 	floors, err := fetchMapFloors(app, mapId)
 	if err != nil {
-		return apis.NewNotFoundError("Error fetching floors", nil)
+		return result, apis.NewNotFoundError("Error fetching floors", nil)
 	}
+	result.Floors = floors
 
 	defaultCode, err := fetchDefaultCongregationOption(app, mapData.GetString("congregation"))
 	if err != nil {
-		return apis.NewNotFoundError("Error fetching default code", nil)
+		return result, apis.NewNotFoundError("Error fetching default code", nil)
 	}
 
 	err = app.RunInTransaction(func(txApp core.App) error {
@@ -123,9 +164,7 @@ func HandleMapAdd(e *core.RequestEvent, app core.App) error {
 			return err
 		}
 
-		createdBy := e.Auth.GetString("name")
-
-		for _, code := range validCodes {
+		for _, code := range result.Inserted {
 			currentSequence++
 			for _, floor := range floors {
 				record := core.NewRecord(collection)
@@ -156,25 +195,15 @@ func HandleMapAdd(e *core.RequestEvent, app core.App) error {
 	})
 
 	if err != nil {
-		return newServerError(err)
+		return result, newServerError(err)
 	}
 
-	ProcessMapAggregates(mapId, app)
+	writeStructureLog(app, mapData.GetString("congregation"), structureCodesAdded, "map", mapId, changedBy, map[string]any{
+		"codes":  result.Inserted,
+		"floors": floors,
+	})
 
-	totalInserted := len(validCodes) * len(floors)
+	ProcessMapAggregates(mapId, app)
 
-	return e.JSON(http.StatusOK, map[string]interface{}{
-		"success":           true,
-		"codes_requested":   len(codes),
-		"codes_inserted":    len(validCodes),
-		"codes_skipped":     len(existingCodes),
-		"addresses_created": totalInserted,
-		"existing_codes":    existingCodes,
-		"message": fmt.Sprintf(
-			"%d codes processed (%d addresses created), %d skipped (already exist)",
-			len(validCodes),
-			totalInserted,
-			len(existingCodes),
-		),
-	})
+	return result, nil
 }
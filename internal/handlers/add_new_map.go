@@ -18,6 +18,8 @@ type NewMapRequest struct {
 	Congregation string `json:"congregation"`
 	Coordinates  string `json:"coordinates"`
 	Sequence     string `json:"sequence"`
+	CodePattern  string `json:"code_pattern"`
+	FloorPattern string `json:"floor_pattern"`
 }
 
 func HandleNewMap(c *core.RequestEvent, app core.App) error {
@@ -45,25 +47,52 @@ func HandleNewMap(c *core.RequestEvent, app core.App) error {
 		return apis.NewBadRequestError("name is required", nil)
 	}
 
-	if !isValidSequence(data.Sequence) {
-		return apis.NewBadRequestError("Invalid sequence format", nil)
+	// A code pattern replaces the literal sequence list and is numbered in
+	// natural order; the literal list keeps the order it was typed in.
+	var sequenceArray []string
+	if data.CodePattern != "" {
+		codes, err := expandCodePattern(data.CodePattern)
+		if err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		sequenceArray = codes
+	} else {
+		if !isValidSequence(data.Sequence) {
+			return apis.NewBadRequestError("Invalid sequence format", nil)
+		}
+		sequenceArray = strings.Split(data.Sequence, ",")
 	}
 
 	if mapType != "single" && mapType != "multi" {
 		return apis.NewBadRequestError("Invalid map type", nil)
 	}
 
-	if floors < 1 {
-		return apis.NewBadRequestError("floors must be at least 1", nil)
+	var floorLevels []int
+	if data.FloorPattern != "" {
+		levels, err := expandFloorPattern(data.FloorPattern)
+		if err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		floorLevels = levels
+	} else {
+		if floors < 1 {
+			return apis.NewBadRequestError("floors must be at least 1", nil)
+		}
+		for i := 1; i <= floors; i++ {
+			floorLevels = append(floorLevels, i)
+		}
 	}
 
-	if mapType == "single" && floors != 1 {
+	if mapType == "single" && len(floorLevels) != 1 {
 		return apis.NewBadRequestError("Invalid floor for single map", nil)
 	}
 
-	if !AuthorizeByRole(app, c.Auth.Id, congregation, "administrator") {
+	if !AuthorizeTerritoryByRole(app, c.Auth.Id, territory, "administrator") {
 		return apis.NewForbiddenError("Administrator access required", nil)
 	}
+	if getTerritoryCongregation(app, territory) != congregation {
+		return apis.NewBadRequestError("Invalid territory", nil)
+	}
 
 	option, err := fetchDefaultCongregationOption(app, congregation)
 	if err != nil {
@@ -71,7 +100,6 @@ func HandleNewMap(c *core.RequestEvent, app core.App) error {
 		return apis.NewNotFoundError("Error fetching default congregation option", nil)
 	}
 
-	sequenceArray := strings.Split(data.Sequence, ",")
 	maxSeq, err := fetchTerritoryMaxSequence(app, territory)
 	if err != nil {
 		log.Println("Error fetching max sequence:", err)
@@ -109,9 +137,9 @@ func HandleNewMap(c *core.RequestEvent, app core.App) error {
 
 		createdBy := c.Auth.GetString("name")
 
-		for i := 1; i <= floors; i++ {
+		for _, floor := range floorLevels {
 			for index, seq := range sequenceArray {
-				address := createNewAddressRecord(addressCollection, seq, territory, i, index, mapRecord.Id, congregation, createdBy)
+				address := createNewAddressRecord(addressCollection, seq, territory, floor, index, mapRecord.Id, congregation, createdBy)
 				if err := txApp.SaveNoValidate(address); err != nil {
 					log.Println("Error saving address record:", err)
 					return err
@@ -135,6 +163,14 @@ func HandleNewMap(c *core.RequestEvent, app core.App) error {
 		return newServerError(err)
 	}
 
+	writeStructureLog(app, congregation, structureMapCreated, "map", mapRecord.Id, authID(c.Auth), map[string]any{
+		"territory":   territory,
+		"description": name,
+		"type":        mapType,
+		"floors":      floorLevels,
+		"codes":       sequenceArray,
+	})
+
 	ResetMapTerritory(mapRecord.Id, app)
 	return c.JSON(200, mapRecord)
 }
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	auditDefaultPerPage = 50
+	auditMaxPerPage     = 500
+	// auditCSVLimit caps a single export; narrow the time range for more.
+	auditCSVLimit = 50000
+)
+
+// auditSources maps each log collection to the SELECT that normalises it into
+// the shared event shape. Every branch filters on congregation itself so the
+// per-collection indexes are used before the UNION.
+//
+// addresses_log.changed_by holds the publisher's display name (addresses are
+// updated through share links by people without accounts), so address events
+// carry an actor name but no actor_id.
+var auditSources = map[string]string{
+	"address": `
+		SELECT l.id, 'address' AS source, l.created, l.congregation,
+		       '' AS actor_id, COALESCE(l.changed_by, '') AS actor,
+		       'status_changed' AS action, 'address' AS entity_type, l.address AS entity_id,
+		       json_object('map', l.map, 'territory', l.territory,
+		                   'old_status', l.old_status, 'new_status', l.new_status) AS details
+		FROM addresses_log l
+		WHERE l.congregation = {:congregation}`,
+	"assignment": `
+		SELECT l.id, 'assignment' AS source, l.created, l.congregation,
+		       COALESCE(l.changed_by, '') AS actor_id, COALESCE(u.name, '') AS actor,
+		       l.action, 'map' AS entity_type, l.map AS entity_id,
+		       json_object('assignment', l.assignment, 'user', l.user, 'publisher', l.publisher,
+		                   'type', l.type, 'expiry_date', l.expiry_date) AS details
+		FROM assignments_log l
+		LEFT JOIN users u ON u.id = l.changed_by
+		WHERE l.congregation = {:congregation}`,
+	"role": `
+		SELECT l.id, 'role' AS source, l.created, l.congregation,
+		       COALESCE(l.changed_by, '') AS actor_id, COALESCE(u.name, '') AS actor,
+		       l.action, 'user' AS entity_type, l.user AS entity_id,
+		       json_object('old_role', l.old_role, 'new_role', l.new_role,
+		                   'invitation', l.invitation) AS details
+		FROM roles_log l
+		LEFT JOIN users u ON u.id = l.changed_by
+		WHERE l.congregation = {:congregation}`,
+	"structure": `
+		SELECT l.id, 'structure' AS source, l.created, l.congregation,
+		       COALESCE(l.changed_by, '') AS actor_id, COALESCE(u.name, '') AS actor,
+		       l.action, l.target_type AS entity_type, l.target AS entity_id,
+		       COALESCE(l.diff, '{}') AS details
+		FROM structure_log l
+		LEFT JOIN users u ON u.id = l.changed_by
+		WHERE l.congregation = {:congregation}`,
+}
+
+// auditSourceOrder keeps the generated UNION stable.
+var auditSourceOrder = []string{"address", "assignment", "role", "structure"}
+
+type AuditQueryRequest struct {
+	Congregation string   `json:"congregation"`
+	Sources      []string `json:"sources"`
+	Actor        string   `json:"actor"`
+	Entity       string   `json:"entity"`
+	EntityType   string   `json:"entity_type"`
+	Action       string   `json:"action"`
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	Page         int      `json:"page"`
+	PerPage      int      `json:"per_page"`
+	Format       string   `json:"format"`
+}
+
+// AuditEvent is one entry of the merged audit stream.
+type AuditEvent struct {
+	Id         string        `db:"id"          json:"id"`
+	Source     string        `db:"source"      json:"source"`
+	Created    string        `db:"created"     json:"created"`
+	ActorId    string        `db:"actor_id"    json:"actor_id"`
+	Actor      string        `db:"actor"       json:"actor"`
+	Action     string        `db:"action"      json:"action"`
+	EntityType string        `db:"entity_type" json:"entity_type"`
+	EntityId   string        `db:"entity_id"   json:"entity_id"`
+	Details    types.JSONRaw `db:"details"     json:"details"`
+}
+
+// HandleAuditQuery returns addresses_log, assignments_log, roles_log and
+// structure_log merged into one newest-first stream for a congregation.
+//
+// Filters are optional: sources limits which logs are read; actor matches the
+// actor's user id or display name; entity matches the affected record's id;
+// from/to bound created (from inclusive, to exclusive; RFC 3339 or
+// YYYY-MM-DD). With format "csv" every matching event (up to auditCSVLimit)
+// is returned as a CSV attachment instead of a JSON page.
+func HandleAuditQuery(e *core.RequestEvent, app core.App) error {
+	data := AuditQueryRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" {
+		return apis.NewBadRequestError("congregation is required", nil)
+	}
+	if data.Format != "" && data.Format != "json" && data.Format != "csv" {
+		return apis.NewBadRequestError("format must be json or csv", nil)
+	}
+	if !AuthorizeByRole(app, e.Auth.Id, data.Congregation, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+
+	sources := data.Sources
+	if len(sources) == 0 {
+		sources = auditSourceOrder
+	}
+	branches := make([]string, 0, len(sources))
+	for _, source := range auditSourceOrder {
+		for _, wanted := range sources {
+			if wanted == source {
+				branches = append(branches, auditSources[source])
+				break
+			}
+		}
+	}
+	if len(branches) != len(sources) {
+		return apis.NewBadRequestError("sources may only contain address, assignment, role or structure", nil)
+	}
+
+	params := dbx.Params{"congregation": data.Congregation}
+	var conditions []string
+	if data.Actor != "" {
+		conditions = append(conditions, "(e.actor_id = {:actor} OR e.actor = {:actor})")
+		params["actor"] = data.Actor
+	}
+	if data.Entity != "" {
+		conditions = append(conditions, "e.entity_id = {:entity}")
+		params["entity"] = data.Entity
+	}
+	if data.EntityType != "" {
+		conditions = append(conditions, "e.entity_type = {:entity_type}")
+		params["entity_type"] = data.EntityType
+	}
+	if data.Action != "" {
+		conditions = append(conditions, "e.action = {:action}")
+		params["action"] = data.Action
+	}
+	for _, bound := range []struct {
+		value, name, op string
+	}{{data.From, "from", ">="}, {data.To, "to", "<"}} {
+		if bound.value == "" {
+			continue
+		}
+		ts, err := parseAuditTime(bound.value)
+		if err != nil {
+			return apis.NewBadRequestError(fmt.Sprintf("%s must be an RFC 3339 timestamp or YYYY-MM-DD", bound.name), nil)
+		}
+		conditions = append(conditions, fmt.Sprintf("e.created %s {:%s}", bound.op, bound.name))
+		params[bound.name] = ts
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	from := "FROM (" + strings.Join(branches, "\nUNION ALL\n") + "\n) e " + where
+
+	if data.Format == "csv" {
+		events := []AuditEvent{}
+		params["limit"] = auditCSVLimit
+		err := app.DB().NewQuery("SELECT e.* " + from + " ORDER BY e.created DESC, e.id LIMIT {:limit}").
+			Bind(params).All(&events)
+		if err != nil {
+			return newServerError(err)
+		}
+		return writeAuditCSV(e, data.Congregation, events)
+	}
+
+	page := data.Page
+	if page < 1 {
+		page = 1
+	}
+	perPage := data.PerPage
+	if perPage <= 0 {
+		perPage = auditDefaultPerPage
+	}
+	if perPage > auditMaxPerPage {
+		perPage = auditMaxPerPage
+	}
+
+	var total struct {
+		N int `db:"n"`
+	}
+	if err := app.DB().NewQuery("SELECT COUNT(*) AS n " + from).Bind(params).One(&total); err != nil {
+		return newServerError(err)
+	}
+
+	events := []AuditEvent{}
+	params["limit"] = perPage
+	params["offset"] = (page - 1) * perPage
+	err := app.DB().NewQuery("SELECT e.* " + from + " ORDER BY e.created DESC, e.id LIMIT {:limit} OFFSET {:offset}").
+		Bind(params).All(&events)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"page":        page,
+		"per_page":    perPage,
+		"total_items": total.N,
+		"items":       events,
+	})
+}
+
+// parseAuditTime accepts a full timestamp or a bare date and returns it in the
+// format PocketBase stores autodate fields in, so string comparison in SQL
+// orders correctly.
+func parseAuditTime(value string) (string, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, value)
+		if err != nil {
+			return "", err
+		}
+	}
+	return t.UTC().Format(types.DefaultDateLayout), nil
+}
+
+func writeAuditCSV(e *core.RequestEvent, congregation string, events []AuditEvent) error {
+	filename := fmt.Sprintf("audit-%s-%s.csv", congregation, time.Now().UTC().Format("20060102"))
+	e.Response.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	e.Response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	e.Response.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(e.Response)
+	w.Write([]string{"created", "source", "action", "actor", "actor_id", "entity_type", "entity_id", "details"})
+	for _, event := range events {
+		w.Write([]string{
+			csvCell(event.Created),
+			csvCell(event.Source),
+			csvCell(event.Action),
+			csvCell(event.Actor),
+			csvCell(event.ActorId),
+			csvCell(event.EntityType),
+			csvCell(event.EntityId),
+			csvCell(string(event.Details)),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// csvCell stops spreadsheet apps from evaluating a cell as a formula. Actor
+// names and details can come from link-id publishers, so a leading =, +, -,
+// @, tab or carriage return is escaped with an apostrophe.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
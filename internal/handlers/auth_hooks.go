@@ -12,55 +12,58 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 )
 
-// authOrLink authorizes via link-id (if present) or role. Link-id takes precedence.
-func authOrLink(e *core.RecordRequestEvent, app core.App) error {
+// authOrLink authorizes via link-id (if present) or role under rule, scoped
+// to the record's map. Link-id takes precedence.
+func authOrLink(e *core.RecordRequestEvent, app core.App, rule accessRule) error {
 	if e.HasSuperuserAuth() {
 		return e.Next()
 	}
-
-	rec := e.Record
-	mapId := rec.GetString("map")
-
-	linkId := e.Request.Header.Get("link-id")
-	if linkId != "" {
-		if mapId != "" && AuthorizeLinkAccess(app, linkId, mapId) {
-			return e.Next()
-		}
-		return apis.NewForbiddenError("Unauthorized", nil)
-	}
-
-	congId := rec.GetString("congregation")
-	if e.Auth != nil && congId != "" && AuthorizeByRole(app, e.Auth.Id, congId) {
+	scope := accessScope{Record: e.Record.Id, Map: e.Record.GetString("map")}
+	if rule.allow(app, e.Auth, e.Request.Header.Get("link-id"), scope) {
 		return e.Next()
 	}
-
 	return apis.NewForbiddenError("Unauthorized", nil)
 }
 
-// adminOnly authorizes if the user is an administrator for the congregation.
+// adminOnly authorizes if the user is an unscoped administrator for the congregation.
 func adminOnly(e *core.RecordRequestEvent, app core.App, congId string) error {
-	if e.HasSuperuserAuth() {
-		return e.Next()
-	}
-	if e.Auth == nil {
-		return apis.NewForbiddenError("Auth required", nil)
-	}
-	if !AuthorizeByRole(app, e.Auth.Id, congId, "administrator") {
-		return apis.NewForbiddenError("Administrator access required", nil)
-	}
-	return e.Next()
+	return requireRole(e, func() bool {
+		return AuthorizeByRole(app, e.Auth.Id, congId, "administrator")
+	}, "Administrator access required")
+}
+
+// roleForTerritories authorizes if the user passes rule's role check in
+// every one of the territories.
+func roleForTerritories(e *core.RecordRequestEvent, app core.App, rule accessRule, territoryIds ...string) error {
+	return requireRole(e, func() bool {
+		for _, territoryId := range territoryIds {
+			if !rule.Role(app, e.Auth.Id, accessScope{Record: e.Record.Id, Territory: territoryId}) {
+				return false
+			}
+		}
+		return len(territoryIds) > 0
+	}, "Administrator access required")
+}
+
+// roleOnly authorizes if the user passes rule's role check on scope. Links
+// never qualify.
+func roleOnly(e *core.RecordRequestEvent, app core.App, rule accessRule, scope accessScope, msg string) error {
+	return requireRole(e, func() bool {
+		return rule.Role(app, e.Auth.Id, scope)
+	}, msg)
 }
 
-// adminOrConductor authorizes if the user is an administrator or conductor for the congregation.
-func adminOrConductor(e *core.RecordRequestEvent, app core.App, congId string) error {
+// requireRole advances the hook chain for superusers and for auth users
+// passing check, and otherwise fails with msg.
+func requireRole(e *core.RecordRequestEvent, check func() bool, msg string) error {
 	if e.HasSuperuserAuth() {
 		return e.Next()
 	}
 	if e.Auth == nil {
 		return apis.NewForbiddenError("Auth required", nil)
 	}
-	if !AuthorizeByRole(app, e.Auth.Id, congId, "administrator", "conductor") {
-		return apis.NewForbiddenError("Administrator or conductor access required", nil)
+	if !check() {
+		return apis.NewForbiddenError(msg, nil)
 	}
 	return e.Next()
 }
@@ -183,7 +186,9 @@ func validateSubscription(app core.App, auth *core.Record, collName string, sub
 	return !filterEscapesMapScope(app, collName, clientFilter, allowed)
 }
 
-// hasRoleAnywhere checks if the user holds one of the given roles in any congregation.
+// hasRoleAnywhere checks if the user holds one of the given roles, unscoped,
+// in any congregation. Territory-scoped roles don't count: they grant nothing
+// over users or assignments outside their territories.
 func hasRoleAnywhere(app core.App, userId string, roles ...string) bool {
 	var v struct {
 		V int `db:"v"`
@@ -196,8 +201,8 @@ func hasRoleAnywhere(app core.App, userId string, roles ...string) bool {
 		placeholders[i] = "{:" + key + "}"
 	}
 	err := app.DB().NewQuery(`
-		SELECT 1 as v FROM roles
-		WHERE user = {:userId} AND role IN (` + strings.Join(placeholders, ", ") + `)
+		SELECT 1 as v FROM roles r
+		WHERE r.user = {:userId} AND r.role IN (` + strings.Join(placeholders, ", ") + `) AND ` + unscopedRoleSQL + `
 		LIMIT 1
 	`).Bind(params).One(&v)
 	return err == nil
@@ -258,23 +263,26 @@ func authorizeView(e *core.RecordRequestEvent, authCheck func() bool, linkCheck
 	return e.Next()
 }
 
-// linkMapListAuth validates map access for LIST requests.
-// If link-id is present it takes precedence and must be valid; otherwise role check is used.
-// All map IDs present in the filter must be authorized.
+// viewByRule validates a VIEW request against rule.
+func viewByRule(e *core.RecordRequestEvent, app core.App, rule accessRule, scope accessScope) error {
+	return authorizeView(e,
+		func() bool { return rule.Role(app, e.Auth.Id, scope) },
+		func(linkId string) bool { return rule.Link != nil && rule.Link(app, linkId, scope) },
+	)
+}
+
+// linkMapListAuth validates map access for LIST requests through
+// authorizeMapSubscription, which realtime subscriptions use too.
 func linkMapListAuth(e *core.RecordsListRequestEvent, app core.App) error {
-	mapIds := uniqueStrings(extractIdsFromFilter(mapIdPattern, e.Request.URL.Query().Get("filter")))
-	if err := authorizeList(e,
-		func() bool { return len(mapIds) > 0 && authorizeUserForMaps(app, e.Auth.Id, mapIds) },
-		// A link-id is scoped to exactly one map; reject multi-map filters.
-		func(linkId string) bool { return len(mapIds) == 1 && AuthorizeLinkAccess(app, linkId, mapIds[0]) },
-	); err != nil {
-		return err
-	}
 	if e.HasSuperuserAuth() {
 		return e.Next()
 	}
+	linkId := e.Request.Header.Get("link-id")
+	if !authorizeMapSubscription(app, e.Auth, linkId, e.Request.URL.Query().Get("filter")) {
+		return apis.NewForbiddenError("Unauthorized", nil)
+	}
 
-	keep, err := mapScopeKeep(app, e.Auth, e.Request.Header.Get("link-id"))
+	keep, err := mapScopeKeep(app, e.Auth, linkId)
 	if err != nil {
 		return apis.NewForbiddenError("Unauthorized", nil)
 	}
@@ -302,6 +310,13 @@ func RegisterAuthHooks(app core.App) {
 			}
 			collName = strings.SplitN(collName, "/", 2)[0]
 
+			if collName == instructionTopic {
+				if validateInstructionSubscription(app, sub) {
+					filtered = append(filtered, sub)
+				}
+				continue
+			}
+
 			if !protectedCollections[collName] {
 				filtered = append(filtered, sub)
 				continue
@@ -353,7 +368,7 @@ func RegisterAuthHooks(app core.App) {
 			return apis.NewForbiddenError("Unauthorized", nil)
 		}
 
-		keep, err := congregationScopeKeep(app, e.Auth.Id)
+		keep, err := mapIdScopeKeep(app, e.Auth.Id)
 		if err != nil {
 			return apis.NewForbiddenError("Unauthorized", nil)
 		}
@@ -378,7 +393,7 @@ func RegisterAuthHooks(app core.App) {
 			return apis.NewForbiddenError("Unauthorized", nil)
 		}
 
-		keep, err := congregationScopeKeep(app, e.Auth.Id)
+		keep, err := territoryScopeKeep(app, e.Auth.Id)
 		if err != nil {
 			return apis.NewForbiddenError("Unauthorized", nil)
 		}
@@ -388,28 +403,12 @@ func RegisterAuthHooks(app core.App) {
 
 	// address_options VIEW: validate role or link-id for the record's map.
 	app.OnRecordViewRequest("address_options").BindFunc(func(e *core.RecordRequestEvent) error {
-		mapId := e.Record.GetString("map")
-		return authorizeView(e,
-			func() bool {
-				return authorizeUserForMap(app, e.Auth.Id, mapId)
-			},
-			func(linkId string) bool {
-				return mapId != "" && AuthorizeLinkAccess(app, linkId, mapId)
-			},
-		)
+		return viewByRule(e, app, viewRules["address_options"], accessScope{Record: e.Record.Id, Map: e.Record.GetString("map")})
 	})
 
 	// maps VIEW: validate role or link-id for this map.
 	app.OnRecordViewRequest("maps").BindFunc(func(e *core.RecordRequestEvent) error {
-		return authorizeView(e,
-			func() bool {
-				congId := e.Record.GetString("congregation")
-				return congId != "" && AuthorizeByRole(app, e.Auth.Id, congId)
-			},
-			func(linkId string) bool {
-				return AuthorizeLinkAccess(app, linkId, e.Record.Id)
-			},
-		)
+		return viewByRule(e, app, viewRules["maps"], accessScope{Record: e.Record.Id, Map: e.Record.Id})
 	})
 
 	// users LIST: only administrators can list users.
@@ -428,14 +427,7 @@ func RegisterAuthHooks(app core.App) {
 
 	// congregations VIEW: validate role or link-id for the congregation.
 	app.OnRecordViewRequest("congregations").BindFunc(func(e *core.RecordRequestEvent) error {
-		return authorizeView(e,
-			func() bool {
-				return AuthorizeByRole(app, e.Auth.Id, e.Record.Id)
-			},
-			func(linkId string) bool {
-				return AuthorizeLinkForCongregation(app, linkId, e.Record.Id)
-			},
-		)
+		return viewByRule(e, app, viewRules["congregations"], accessScope{Record: e.Record.Id, Congregation: e.Record.Id})
 	})
 
 	// options LIST: validate auth user has role in every congregation in the filter,
@@ -574,11 +566,7 @@ func RegisterAuthHooks(app core.App) {
 
 	// assignments VIEW: link-id takes precedence when present; otherwise role check.
 	app.OnRecordViewRequest("assignments").BindFunc(func(e *core.RecordRequestEvent) error {
-		congId := e.Record.GetString("congregation")
-		return authorizeView(e,
-			func() bool { return congId != "" && AuthorizeByRole(app, e.Auth.Id, congId) },
-			func(linkId string) bool { return linkId == e.Record.Id },
-		)
+		return viewByRule(e, app, viewRules["assignments"], accessScope{Record: e.Record.Id, Map: e.Record.GetString("map")})
 	})
 
 	// --- Create/Update/Delete hooks (pre-operation authorization) ---
@@ -589,24 +577,26 @@ func RegisterAuthHooks(app core.App) {
 	// /address/* routes, not this generic API — their createRule/updateRule/
 	// deleteRule are superuser-only, so hooks registered here would never run.)
 	app.OnRecordCreateRequest("messages").BindFunc(func(e *core.RecordRequestEvent) error {
-		return authOrLink(e, app)
+		return authOrLink(e, app, viewRules["messages"])
 	})
 
 	// Pattern B: Administrator only
-	// maps update/delete
+	// maps update/delete — an administrator scoped to territories must cover
+	// the map's territory, and on update the territory it is moved to as well.
 	app.OnRecordUpdateRequest("maps").BindFunc(func(e *core.RecordRequestEvent) error {
-		return adminOnly(e, app, getCongId(e, true))
+		territoryIds := uniqueStrings([]string{e.Record.Original().GetString("territory"), e.Record.GetString("territory")})
+		return roleForTerritories(e, app, editRules["maps"], territoryIds...)
 	})
 	app.OnRecordDeleteRequest("maps").BindFunc(func(e *core.RecordRequestEvent) error {
-		return adminOnly(e, app, getCongId(e, true))
+		return roleForTerritories(e, app, editRules["maps"], e.Record.Original().GetString("territory"))
 	})
 
 	// messages update/delete
 	app.OnRecordUpdateRequest("messages").BindFunc(func(e *core.RecordRequestEvent) error {
-		return adminOnly(e, app, getCongId(e, true))
+		return roleOnly(e, app, editRules["messages"], accessScope{Record: e.Record.Id, Map: e.Record.Original().GetString("map")}, "Administrator access required")
 	})
 	app.OnRecordDeleteRequest("messages").BindFunc(func(e *core.RecordRequestEvent) error {
-		return adminOnly(e, app, getCongId(e, true))
+		return roleOnly(e, app, editRules["messages"], accessScope{Record: e.Record.Id, Map: e.Record.Original().GetString("map")}, "Administrator access required")
 	})
 
 	// roles create/update/delete
@@ -625,23 +615,23 @@ func RegisterAuthHooks(app core.App) {
 		return adminOnly(e, app, getCongId(e, false))
 	})
 	app.OnRecordUpdateRequest("territories").BindFunc(func(e *core.RecordRequestEvent) error {
-		return adminOnly(e, app, getCongId(e, true))
+		return roleForTerritories(e, app, editRules["territories"], e.Record.Id)
 	})
 	app.OnRecordDeleteRequest("territories").BindFunc(func(e *core.RecordRequestEvent) error {
-		return adminOnly(e, app, getCongId(e, true))
+		return roleForTerritories(e, app, editRules["territories"], e.Record.Id)
 	})
 
 	// congregations update — congregation ID is the record ID itself
 	app.OnRecordUpdateRequest("congregations").BindFunc(func(e *core.RecordRequestEvent) error {
-		return adminOnly(e, app, e.Record.Id)
+		return roleOnly(e, app, editRules["congregations"], accessScope{Record: e.Record.Id, Congregation: e.Record.Id}, "Administrator access required")
 	})
 
-	// Pattern C: Administrator or conductor
+	// Pattern C: Administrator or conductor covering the map
 	// assignments create/delete
 	app.OnRecordCreateRequest("assignments").BindFunc(func(e *core.RecordRequestEvent) error {
-		return adminOrConductor(e, app, getCongId(e, false))
+		return roleOnly(e, app, editRules["assignments"], accessScope{Record: e.Record.Id, Map: e.Record.GetString("map")}, "Administrator or conductor access required")
 	})
 	app.OnRecordDeleteRequest("assignments").BindFunc(func(e *core.RecordRequestEvent) error {
-		return adminOrConductor(e, app, getCongId(e, true))
+		return roleOnly(e, app, editRules["assignments"], accessScope{Record: e.Record.Id, Map: e.Record.Original().GetString("map")}, "Administrator or conductor access required")
 	})
 }
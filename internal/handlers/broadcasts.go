@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/routine"
+	"github.com/pocketbase/pocketbase/tools/subscriptions"
+)
+
+// instructionTopic prefixes the realtime topic a publisher's app subscribes
+// to for broadcasts: "instructions/<link-id>".
+const instructionTopic = "instructions"
+
+type BroadcastInstructionRequest struct {
+	Scope   string `json:"scope"`
+	Target  string `json:"target"`
+	Message string `json:"message"`
+}
+
+type BroadcastRequest struct {
+	Broadcast string `json:"broadcast"`
+}
+
+// instructionPayload is what a subscribed publisher receives, and what
+// /instruction/pending returns for broadcasts they have not acknowledged.
+type instructionPayload struct {
+	Id      string `db:"id"      json:"id"`
+	Message string `db:"message" json:"message"`
+	Sender  string `db:"sender"  json:"sender"`
+	Created string `db:"created" json:"created"`
+}
+
+type broadcastReceiptEntry struct {
+	LinkId         string `db:"link_id"         json:"link_id"`
+	Publisher      string `db:"publisher"       json:"publisher"`
+	Map            string `db:"map"             json:"map"`
+	MapName        string `db:"map_name"        json:"map_name"`
+	AcknowledgedAt string `db:"acknowledged_at" json:"acknowledged_at"`
+}
+
+type liveAssignment struct {
+	Id        string `db:"id"`
+	Map       string `db:"map"`
+	Publisher string `db:"publisher"`
+}
+
+// authorizeBroadcastTarget checks the caller may broadcast to, and read the
+// receipts of, target: an administrator or conductor covering the map or
+// territory, or a congregation-wide one for the congregation. Returns the
+// target's congregation.
+func authorizeBroadcastTarget(e *core.RequestEvent, app core.App, scope, target string) (string, error) {
+	roles := []string{"administrator", "conductor"}
+	var congregation string
+	var allowed bool
+	switch scope {
+	case "map":
+		m, err := fetchMapData(app, target)
+		if err != nil {
+			return "", apis.NewNotFoundError("Map not found", nil)
+		}
+		congregation = m.GetString("congregation")
+		allowed = e.HasSuperuserAuth() || AuthorizeMapByRole(app, e.Auth.Id, target, roles...)
+	case "territory":
+		congregation = getTerritoryCongregation(app, target)
+		if congregation == "" {
+			return "", apis.NewNotFoundError("Territory not found", nil)
+		}
+		allowed = e.HasSuperuserAuth() || AuthorizeTerritoryByRole(app, e.Auth.Id, target, roles...)
+	case "congregation":
+		if _, err := app.FindRecordById("congregations", target); err != nil {
+			return "", apis.NewNotFoundError("Congregation not found", nil)
+		}
+		congregation = target
+		allowed = e.HasSuperuserAuth() || AuthorizeByRole(app, e.Auth.Id, target, roles...)
+	default:
+		return "", apis.NewBadRequestError("scope must be map, territory or congregation", nil)
+	}
+	if !allowed {
+		return "", apis.NewForbiddenError("Administrator or conductor access required", nil)
+	}
+	return congregation, nil
+}
+
+// fetchLiveAssignments returns the unexpired assignments on the maps scope
+// and target cover.
+func fetchLiveAssignments(app core.App, scope, target string) ([]liveAssignment, error) {
+	column := map[string]string{"map": "m.id", "territory": "m.territory", "congregation": "m.congregation"}[scope]
+	assignments := []liveAssignment{}
+	err := app.DB().NewQuery(`
+		SELECT a.id, a.map, COALESCE(a.publisher, '') AS publisher
+		FROM assignments a
+		JOIN maps m ON m.id = a.map
+		WHERE ` + column + ` = {:target} AND a.expiry_date > datetime('now')
+		ORDER BY a.created
+	`).Bind(dbx.Params{"target": target}).All(&assignments)
+	return assignments, err
+}
+
+// HandleBroadcastInstruction pushes an instruction straight to every publisher
+// holding a live link on a map, a territory or the congregation, over the
+// realtime topic "instructions/<link-id>". A receipt is kept per link so
+// /instruction/status can show who has acknowledged it, and publishers who
+// were offline pick it up from /instruction/pending. Links with a push
+// subscription also get a Web Push notification, titled by pushTitle.
+func HandleBroadcastInstruction(e *core.RequestEvent, app core.App, pushTitle InstructionPushTitleFn) error {
+	data := BroadcastInstructionRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	message := strings.TrimSpace(data.Message)
+	if data.Scope == "" || data.Target == "" || message == "" {
+		return apis.NewBadRequestError("scope, target and message are required", nil)
+	}
+	if len(message) > 2000 {
+		return apis.NewBadRequestError("message must be 2000 characters or fewer", nil)
+	}
+
+	congregation, err := authorizeBroadcastTarget(e, app, data.Scope, data.Target)
+	if err != nil {
+		return err
+	}
+
+	assignments, err := fetchLiveAssignments(app, data.Scope, data.Target)
+	if err != nil {
+		return newServerError(err)
+	}
+	if len(assignments) == 0 {
+		return apis.NewBadRequestError("No live assignments to broadcast to", nil)
+	}
+
+	broadcastsCol, err := app.FindCachedCollectionByNameOrId("broadcasts")
+	if err != nil {
+		return newServerError(err)
+	}
+	receiptsCol, err := app.FindCachedCollectionByNameOrId("broadcast_receipts")
+	if err != nil {
+		return newServerError(err)
+	}
+
+	broadcast := core.NewRecord(broadcastsCol)
+	err = app.RunInTransaction(func(txApp core.App) error {
+		broadcast.Set("congregation", congregation)
+		broadcast.Set("scope", data.Scope)
+		broadcast.Set("target", data.Target)
+		broadcast.Set("message", message)
+		broadcast.Set("created_by", authID(e.Auth))
+		broadcast.Set("sender", e.Auth.GetString("name"))
+		if err := txApp.Save(broadcast); err != nil {
+			return err
+		}
+		for _, a := range assignments {
+			receipt := core.NewRecord(receiptsCol)
+			receipt.Set("broadcast", broadcast.Id)
+			receipt.Set("congregation", congregation)
+			receipt.Set("assignment", a.Id)
+			receipt.Set("link_id", a.Id)
+			receipt.Set("map", a.Map)
+			receipt.Set("publisher", a.Publisher)
+			if err := txApp.Save(receipt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return wrapTransactionError(err)
+	}
+
+	delivered := pushInstruction(app, broadcast, assignments)
+	pushInstructionToLinks(app, broadcast, assignments, pushTitle)
+
+	return e.JSON(http.StatusCreated, map[string]any{
+		"id":         broadcast.Id,
+		"recipients": len(assignments),
+		"delivered":  delivered,
+	})
+}
+
+// pushInstruction sends broadcast to every connected client subscribed to the
+// topic of one of assignments, returning how many links it reached.
+func pushInstruction(app core.App, broadcast *core.Record, assignments []liveAssignment) int {
+	payload, err := json.Marshal(instructionPayload{
+		Id:      broadcast.Id,
+		Message: broadcast.GetString("message"),
+		Sender:  broadcast.GetString("sender"),
+		Created: broadcast.GetDateTime("created").String(),
+	})
+	if err != nil {
+		log.Printf("pushInstruction: could not encode broadcast %s: %v", broadcast.Id, err)
+		return 0
+	}
+
+	topics := make(map[string]bool, len(assignments))
+	for _, a := range assignments {
+		topics[instructionTopic+"/"+a.Id] = true
+	}
+	reached := map[string]bool{}
+	for _, client := range app.SubscriptionsBroker().Clients() {
+		if client.IsDiscarded() {
+			continue
+		}
+		for topic := range topics {
+			if client.HasSubscription(topic) {
+				// Send blocks until the client's SSE loop reads the message,
+				// so it runs off the request as PocketBase's own broadcasts do.
+				message := subscriptions.Message{Name: topic, Data: payload}
+				routine.FireAndForget(func() { client.Send(message) })
+				reached[topic] = true
+			}
+		}
+	}
+	return len(reached)
+}
+
+// validateInstructionSubscription allows a realtime subscription to
+// "instructions/<link-id>" only while that link is live. The link-id is the
+// publisher's credential, as it is for the map itself.
+func validateInstructionSubscription(app core.App, sub string) bool {
+	linkId := strings.TrimPrefix(sub, instructionTopic+"/")
+	if linkId == sub || linkId == "" || strings.ContainsAny(linkId, "/?") {
+		return false
+	}
+	assignment, err := app.FindRecordById("assignments", linkId)
+	return err == nil && assignment.GetDateTime("expiry_date").Time().After(time.Now())
+}
+
+// liveLinkFromRequest returns the assignment behind the request's link-id,
+// or an error when it is missing or expired.
+func liveLinkFromRequest(c *core.RequestEvent, app core.App) (*core.Record, error) {
+	linkId := c.Request.Header.Get("link-id")
+	if linkId == "" {
+		return nil, apis.NewUnauthorizedError("link-id header is required", nil)
+	}
+	assignment, err := app.FindRecordById("assignments", linkId)
+	if err != nil || !assignment.GetDateTime("expiry_date").Time().After(time.Now()) {
+		return nil, apis.NewForbiddenError("Unauthorized", nil)
+	}
+	return assignment, nil
+}
+
+// HandlePendingInstructions returns the broadcasts sent to the request's
+// link-id that it has not acknowledged yet, oldest first.
+func HandlePendingInstructions(c *core.RequestEvent, app core.App) error {
+	assignment, err := liveLinkFromRequest(c, app)
+	if err != nil {
+		return err
+	}
+
+	pending := []instructionPayload{}
+	err = app.DB().NewQuery(`
+		SELECT b.id, b.message, COALESCE(b.sender, '') AS sender, b.created
+		FROM broadcast_receipts r
+		JOIN broadcasts b ON b.id = r.broadcast
+		WHERE r.link_id = {:link} AND COALESCE(r.acknowledged_at, '') = ''
+		ORDER BY b.created
+	`).Bind(dbx.Params{"link": assignment.Id}).All(&pending)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	return c.JSON(http.StatusOK, pending)
+}
+
+// HandleAcknowledgeInstruction records that the publisher behind the
+// request's link-id has seen a broadcast. Acknowledging again is a no-op.
+func HandleAcknowledgeInstruction(c *core.RequestEvent, app core.App) error {
+	data := BroadcastRequest{}
+	if err := c.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Broadcast == "" {
+		return apis.NewBadRequestError("broadcast is required", nil)
+	}
+	assignment, err := liveLinkFromRequest(c, app)
+	if err != nil {
+		return err
+	}
+
+	receipt, err := app.FindFirstRecordByFilter("broadcast_receipts", "broadcast = {:broadcast} && link_id = {:link}",
+		dbx.Params{"broadcast": data.Broadcast, "link": assignment.Id})
+	if err != nil {
+		return apis.NewNotFoundError("Broadcast not found", nil)
+	}
+	if receipt.GetDateTime("acknowledged_at").IsZero() {
+		receipt.Set("acknowledged_at", time.Now().UTC())
+		if err := app.Save(receipt); err != nil {
+			return newServerError(err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"acknowledged_at": receipt.GetDateTime("acknowledged_at"),
+	})
+}
+
+// HandleInstructionStatus lists every link a broadcast was sent to with when,
+// if at all, its publisher acknowledged it. Available to whoever could have
+// sent the broadcast.
+func HandleInstructionStatus(e *core.RequestEvent, app core.App) error {
+	data := BroadcastRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Broadcast == "" {
+		return apis.NewBadRequestError("broadcast is required", nil)
+	}
+	broadcast, err := app.FindRecordById("broadcasts", data.Broadcast)
+	if err != nil {
+		return apis.NewNotFoundError("Broadcast not found", nil)
+	}
+	if _, err := authorizeBroadcastTarget(e, app, broadcast.GetString("scope"), broadcast.GetString("target")); err != nil {
+		return err
+	}
+
+	receipts := []broadcastReceiptEntry{}
+	err = app.DB().NewQuery(`
+		SELECT r.link_id, COALESCE(r.publisher, '') AS publisher, COALESCE(r.map, '') AS map,
+		       COALESCE(m.description, '') AS map_name, COALESCE(r.acknowledged_at, '') AS acknowledged_at
+		FROM broadcast_receipts r
+		LEFT JOIN maps m ON m.id = r.map
+		WHERE r.broadcast = {:broadcast}
+		ORDER BY m.description, r.publisher
+	`).Bind(dbx.Params{"broadcast": broadcast.Id}).All(&receipts)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	acknowledged := 0
+	for _, r := range receipts {
+		if r.AcknowledgedAt != "" {
+			acknowledged++
+		}
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"id":           broadcast.Id,
+		"message":      broadcast.GetString("message"),
+		"created":      broadcast.GetDateTime("created"),
+		"recipients":   len(receipts),
+		"acknowledged": acknowledged,
+		"receipts":     receipts,
+	})
+}
@@ -0,0 +1,516 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Kinds of change request a publisher can raise.
+const (
+	changeAddCode    = "add_code"
+	changeRemoveCode = "remove_code"
+	changeRenameCode = "rename_code"
+	changeFlagDNC    = "flag_dnc"
+)
+
+// ChangeRequestNotifierFn emails a requester that their change request was
+// decided. Injected from the jobs package at registration time to avoid
+// import cycles.
+type ChangeRequestNotifierFn func(app core.App, user, request, mapRecord *core.Record) error
+
+type CreateChangeRequestRequest struct {
+	Map     string `json:"map"`
+	Kind    string `json:"kind"`
+	Code    string `json:"code"`
+	NewCode string `json:"new_code"`
+	Floor   int    `json:"floor"`
+	Note    string `json:"note"`
+}
+
+type ListChangeRequestsRequest struct {
+	Congregation string `json:"congregation"`
+	Status       string `json:"status"`
+}
+
+type DecideChangeRequestRequest struct {
+	Request  string `json:"request"`
+	Decision string `json:"decision"`
+	Note     string `json:"note"`
+}
+
+type changeRequestEntry struct {
+	Id          string `db:"id"            json:"id"`
+	Map         string `db:"map"           json:"map"`
+	MapName     string `db:"map_name"      json:"map_name"`
+	Kind        string `db:"kind"          json:"kind"`
+	Code        string `db:"code"          json:"code"`
+	NewCode     string `db:"new_code"      json:"new_code"`
+	Floor       int    `db:"floor"         json:"floor"`
+	Note        string `db:"note"          json:"note"`
+	RequestedBy string `db:"requested_by"  json:"requested_by"`
+	Message     string `db:"message"       json:"message"`
+	Status      string `db:"status"        json:"status"`
+	DecidedBy   string `db:"decided_by"    json:"decided_by"`
+	Decision    string `db:"decision_note" json:"decision_note"`
+	Created     string `db:"created"       json:"created"`
+}
+
+// describeChange renders a change request as one line, used as the text of
+// the message thread it opens.
+func describeChange(kind, code, newCode string, floor int) string {
+	switch kind {
+	case changeAddCode:
+		return fmt.Sprintf("add code %s", code)
+	case changeRemoveCode:
+		return fmt.Sprintf("remove code %s", code)
+	case changeRenameCode:
+		return fmt.Sprintf("rename code %s to %s", code, newCode)
+	}
+	return fmt.Sprintf("mark %s on floor %d as do not call", code, floor)
+}
+
+// DescribeChangeRequest renders a change_requests record as one line, e.g.
+// "rename code 12-05 to 12-05A".
+func DescribeChangeRequest(request *core.Record) string {
+	return describeChange(request.GetString("kind"), request.GetString("code"),
+		request.GetString("new_code"), request.GetInt("floor"))
+}
+
+// validateChangeRequest checks a new request against the map as it stands, so
+// publishers learn straight away about a code that is already there or gone.
+// Approval checks again, since the map may have changed in between.
+func validateChangeRequest(app core.App, data CreateChangeRequestRequest) error {
+	if !codeFormatRegex.MatchString(data.Code) {
+		return apis.NewBadRequestError("code must contain only alphanumeric characters and hyphens", nil)
+	}
+	_, err := fetchAddressByCode(app, data.Code, data.Map)
+	exists := err == nil
+
+	switch data.Kind {
+	case changeAddCode:
+		if exists {
+			return apis.NewBadRequestError(fmt.Sprintf("Code '%s' is already on this map", data.Code), nil)
+		}
+	case changeRemoveCode:
+		if !exists {
+			return apis.NewBadRequestError(fmt.Sprintf("Code '%s' is not on this map", data.Code), nil)
+		}
+	case changeRenameCode:
+		if !exists {
+			return apis.NewBadRequestError(fmt.Sprintf("Code '%s' is not on this map", data.Code), nil)
+		}
+		if !codeFormatRegex.MatchString(data.NewCode) {
+			return apis.NewBadRequestError("new_code must contain only alphanumeric characters and hyphens", nil)
+		}
+		if _, err := fetchAddressByCode(app, data.NewCode, data.Map); err == nil {
+			return apis.NewBadRequestError(fmt.Sprintf("Code '%s' is already on this map", data.NewCode), nil)
+		}
+	case changeFlagDNC:
+		if _, err := fetchAddressByCodeAndFloor(app, data.Map, data.Code, data.Floor); err != nil {
+			return apis.NewBadRequestError(fmt.Sprintf("No address %s on floor %d", data.Code, data.Floor), nil)
+		}
+	default:
+		return apis.NewBadRequestError("kind must be add_code, remove_code, rename_code or flag_dnc", nil)
+	}
+	return nil
+}
+
+func fetchAddressByCodeAndFloor(app core.App, mapId, code string, floor int) (*core.Record, error) {
+	return app.FindFirstRecordByFilter("addresses", "map = {:map} && code = {:code} && floor = {:floor}",
+		dbx.Params{"map": mapId, "code": code, "floor": floor})
+}
+
+// HandleCreateChangeRequest lets a publisher ask administrators to correct
+// their map: add, remove or rename a code, or flag an address do-not-call.
+// Open to link-id publishers and any role covering the map. The request opens
+// a message thread on the map, which brings it into the messages digest and
+// is where the decision is posted back.
+func HandleCreateChangeRequest(c *core.RequestEvent, app core.App) error {
+	data := CreateChangeRequestRequest{}
+	if err := c.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	data.Code = strings.TrimSpace(data.Code)
+	data.NewCode = strings.TrimSpace(data.NewCode)
+	data.Note = strings.TrimSpace(data.Note)
+	if data.Map == "" || data.Code == "" {
+		return apis.NewBadRequestError("map and code are required", nil)
+	}
+	if len(data.Note) > 500 {
+		return apis.NewBadRequestError("note must be 500 characters or fewer", nil)
+	}
+	if data.Kind == changeRenameCode && data.NewCode == "" {
+		return apis.NewBadRequestError("new_code is required to rename a code", nil)
+	}
+
+	mapData, err := fetchMapData(app, data.Map)
+	if err != nil {
+		return apis.NewNotFoundError("Map not found", nil)
+	}
+	if !AuthorizeMapAccess(c, app, mapData.Id) {
+		return apis.NewForbiddenError("Unauthorized", nil)
+	}
+	if err := validateChangeRequest(app, data); err != nil {
+		return err
+	}
+	if data.Kind != changeRenameCode {
+		data.NewCode = ""
+	}
+	if data.Kind != changeFlagDNC {
+		data.Floor = 0
+	}
+
+	duplicate, err := app.FindAllRecords("change_requests", dbx.HashExp{
+		"map":      data.Map,
+		"kind":     data.Kind,
+		"code":     data.Code,
+		"new_code": data.NewCode,
+		"floor":    data.Floor,
+		"status":   "pending",
+	})
+	if err != nil {
+		return newServerError(err)
+	}
+	if len(duplicate) > 0 {
+		return apis.NewBadRequestError("The same change is already waiting for an administrator", nil)
+	}
+
+	messagesCol, err := app.FindCachedCollectionByNameOrId("messages")
+	if err != nil {
+		return newServerError(err)
+	}
+	requestsCol, err := app.FindCachedCollectionByNameOrId("change_requests")
+	if err != nil {
+		return newServerError(err)
+	}
+
+	actor := resolveActor(c, app)
+	congregation := mapData.GetString("congregation")
+	text := "Change request: " + describeChange(data.Kind, data.Code, data.NewCode, data.Floor)
+	if data.Note != "" {
+		text += "\n" + data.Note
+	}
+
+	request := core.NewRecord(requestsCol)
+	err = app.RunInTransaction(func(txApp core.App) error {
+		message := core.NewRecord(messagesCol)
+		message.Set("congregation", congregation)
+		message.Set("map", mapData.Id)
+		message.Set("message", text)
+		message.Set("created_by", actor)
+		message.Set("type", messageTypeForRequest(c, txApp, mapData.Id))
+		if err := txApp.Save(message); err != nil {
+			return err
+		}
+
+		request.Set("congregation", congregation)
+		request.Set("map", mapData.Id)
+		request.Set("assignment", c.Request.Header.Get("link-id"))
+		request.Set("requested_by", actor)
+		request.Set("requested_by_user", authID(c.Auth))
+		request.Set("kind", data.Kind)
+		request.Set("code", data.Code)
+		request.Set("new_code", data.NewCode)
+		request.Set("floor", data.Floor)
+		request.Set("note", data.Note)
+		request.Set("message", message.Id)
+		request.Set("status", "pending")
+		return txApp.Save(request)
+	})
+	if err != nil {
+		return wrapTransactionError(err)
+	}
+
+	return c.JSON(http.StatusCreated, map[string]any{
+		"id":      request.Id,
+		"message": request.GetString("message"),
+		"status":  "pending",
+	})
+}
+
+// HandleListChangeRequests lists a congregation's change requests newest
+// first, optionally narrowed to one status. Administrators scoped to some
+// territories only see requests for maps in them.
+func HandleListChangeRequests(e *core.RequestEvent, app core.App) error {
+	data := ListChangeRequestsRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" {
+		return apis.NewBadRequestError("congregation is required", nil)
+	}
+
+	filter := "cr.congregation = {:congregation}"
+	params := dbx.Params{"congregation": data.Congregation}
+	if !e.HasSuperuserAuth() {
+		// Any administrator role, congregation-wide or scoped, opens the queue.
+		if !authorizeRole(app, e.Auth.Id, data.Congregation, "1 = 1", dbx.Params{}, []string{"administrator"}) {
+			return apis.NewForbiddenError("Administrator access required", nil)
+		}
+		filter += ` AND EXISTS (SELECT 1 FROM roles r WHERE r.user = {:userId}
+			AND r.congregation = cr.congregation AND r.role = 'administrator'
+			AND ` + roleCoversTerritorySQL("m.territory") + `)`
+		params["userId"] = e.Auth.Id
+	}
+	if data.Status != "" {
+		filter += " AND cr.status = {:status}"
+		params["status"] = data.Status
+	}
+
+	entries := []changeRequestEntry{}
+	err := app.DB().NewQuery(`
+		SELECT cr.id, cr.map, COALESCE(m.description, '') AS map_name, cr.kind, cr.code,
+		       COALESCE(cr.new_code, '') AS new_code, COALESCE(cr.floor, 0) AS floor,
+		       COALESCE(cr.note, '') AS note, COALESCE(cr.requested_by, '') AS requested_by,
+		       COALESCE(cr.message, '') AS message, cr.status, COALESCE(d.name, '') AS decided_by,
+		       COALESCE(cr.decision_note, '') AS decision_note, cr.created
+		FROM change_requests cr
+		JOIN maps m ON m.id = cr.map
+		LEFT JOIN users d ON d.id = cr.decided_by
+		WHERE ` + filter + `
+		ORDER BY cr.created DESC
+	`).Bind(params).All(&entries)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusOK, entries)
+}
+
+// HandleDecideChangeRequest approves or denies a pending change request.
+// Approval applies the change with the same code as the matching
+// administrator route (/map/code/add, /map/code/delete) so the structure log,
+// aggregates and safeguards such as keeping a map's last code are identical;
+// if the change can no longer be applied the request stays pending and the
+// error is returned. Either way the decision is posted as a reply to the
+// request's message thread, which is then resolved, and requesters with an
+// account are emailed.
+func HandleDecideChangeRequest(e *core.RequestEvent, app core.App, notify ChangeRequestNotifierFn) error {
+	data := DecideChangeRequestRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Request == "" {
+		return apis.NewBadRequestError("request is required", nil)
+	}
+	if data.Decision != "approve" && data.Decision != "deny" {
+		return apis.NewBadRequestError("decision must be approve or deny", nil)
+	}
+	data.Note = strings.TrimSpace(data.Note)
+	if len(data.Note) > 500 {
+		return apis.NewBadRequestError("note must be 500 characters or fewer", nil)
+	}
+
+	request, err := app.FindRecordById("change_requests", data.Request)
+	if err != nil {
+		return apis.NewNotFoundError("Change request not found", nil)
+	}
+	mapData, err := fetchMapData(app, request.GetString("map"))
+	if err != nil {
+		return apis.NewNotFoundError("Map not found", nil)
+	}
+	if !e.HasSuperuserAuth() && !AuthorizeMapByRole(app, e.Auth.Id, mapData.Id, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+
+	status := "denied"
+	if data.Decision == "approve" {
+		status = "approved"
+	}
+
+	// Claim the request before applying it so two administrators approving
+	// at once cannot both apply the change.
+	err = app.RunInTransaction(func(txApp core.App) error {
+		fresh, err := txApp.FindRecordById("change_requests", request.Id)
+		if err != nil {
+			return err
+		}
+		if current := fresh.GetString("status"); current != "pending" {
+			return apis.NewBadRequestError(fmt.Sprintf("Change request is already %s", current), nil)
+		}
+		fresh.Set("status", status)
+		fresh.Set("decided_by", authID(e.Auth))
+		fresh.Set("decided_at", time.Now().UTC())
+		fresh.Set("decision_note", data.Note)
+		return txApp.Save(fresh)
+	})
+	if err != nil {
+		return wrapTransactionError(err)
+	}
+
+	if status == "approved" {
+		if err := applyChangeRequest(app, request, mapData, e.Auth); err != nil {
+			request.Set("status", "pending")
+			request.Set("decided_by", "")
+			request.Set("decided_at", nil)
+			request.Set("decision_note", "")
+			if saveErr := app.Save(request); saveErr != nil {
+				sentry.CaptureException(saveErr)
+				log.Printf("HandleDecideChangeRequest: could not reopen request %s: %v", request.Id, saveErr)
+			}
+			return err
+		}
+	}
+
+	request, err = app.FindRecordById("change_requests", request.Id)
+	if err != nil {
+		return newServerError(err)
+	}
+	replyToChangeRequest(app, request, e.Auth)
+
+	emailSent := false
+	if user := changeRequestUser(app, request); user != nil {
+		emailSent = true
+		if err := notify(app, user, request, mapData); err != nil {
+			emailSent = false
+			sentry.CaptureException(err)
+			log.Printf("HandleDecideChangeRequest: could not email requester of %s: %v", request.Id, err)
+		}
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"status":     status,
+		"email_sent": emailSent,
+	})
+}
+
+// applyChangeRequest carries out an approved request as admin.
+func applyChangeRequest(app core.App, request, mapData *core.Record, admin *core.Record) error {
+	code := request.GetString("code")
+	actorName := admin.GetString("name")
+	switch request.GetString("kind") {
+	case changeAddCode:
+		if !codeFormatRegex.MatchString(code) {
+			return apis.NewBadRequestError("code must contain only alphanumeric characters and hyphens", nil)
+		}
+		result, err := addMapCodes(app, mapData, []string{code}, actorName, authID(admin))
+		if err != nil {
+			return err
+		}
+		if len(result.Inserted) == 0 {
+			return apis.NewBadRequestError(fmt.Sprintf("Code '%s' is already on this map", code), nil)
+		}
+		return nil
+	case changeRemoveCode:
+		if _, err := fetchAddressByCode(app, code, mapData.Id); err != nil {
+			return apis.NewBadRequestError(fmt.Sprintf("Code '%s' is not on this map", code), nil)
+		}
+		return deleteMapCode(app, mapData, code, authID(admin))
+	case changeRenameCode:
+		return renameMapCode(app, mapData, code, request.GetString("new_code"), authID(admin))
+	case changeFlagDNC:
+		address, err := fetchAddressByCodeAndFloor(app, mapData.Id, code, request.GetInt("floor"))
+		if err != nil {
+			return apis.NewBadRequestError(fmt.Sprintf("No address %s on floor %d", code, request.GetInt("floor")), nil)
+		}
+		address.Set("status", "do_not_call")
+		address.Set("dnc_time", time.Now().UTC().Format(time.RFC3339))
+		address.Set("updated_by", actorName)
+		if err := app.SaveNoValidate(address); err != nil {
+			return newServerError(err)
+		}
+		return nil
+	}
+	return apis.NewBadRequestError("Unknown change request kind", nil)
+}
+
+// renameMapCode gives every address for code on mapData the code newCode,
+// keeping its sequence, floors and history.
+func renameMapCode(app core.App, mapData *core.Record, code, newCode, changedBy string) error {
+	if !codeFormatRegex.MatchString(newCode) {
+		return apis.NewBadRequestError("new_code must contain only alphanumeric characters and hyphens", nil)
+	}
+	if _, err := fetchAddressByCode(app, newCode, mapData.Id); err == nil {
+		return apis.NewBadRequestError(fmt.Sprintf("Code '%s' is already on this map", newCode), nil)
+	}
+	addressRecords, err := fetchAddressesByCode(app, code, mapData.Id)
+	if err != nil || len(addressRecords) == 0 {
+		return apis.NewBadRequestError(fmt.Sprintf("Code '%s' is not on this map", code), nil)
+	}
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, addressRecord := range addressRecords {
+			addressRecord.Set("code", newCode)
+			if err := txApp.SaveNoValidate(addressRecord); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return newServerError(err)
+	}
+
+	writeStructureLog(app, mapData.GetString("congregation"), structureCodeRenamed, "map", mapData.Id, changedBy, map[string]any{
+		"code": fromTo(code, newCode),
+	})
+	return nil
+}
+
+// replyToChangeRequest posts the decision on the request's message thread and
+// resolves the thread, so a link-id publisher sees the outcome on their map.
+func replyToChangeRequest(app core.App, request, admin *core.Record) {
+	root, err := app.FindRecordById("messages", request.GetString("message"))
+	if err != nil {
+		return
+	}
+
+	text := "Not applied: " + DescribeChangeRequest(request)
+	if request.GetString("status") == "approved" {
+		text = "Done: " + DescribeChangeRequest(request)
+	}
+	if note := request.GetString("decision_note"); note != "" {
+		text += "\n" + note
+	}
+
+	collection, err := app.FindCachedCollectionByNameOrId("messages")
+	if err == nil {
+		reply := core.NewRecord(collection)
+		reply.Set("parent", root.Id)
+		reply.Set("congregation", root.GetString("congregation"))
+		reply.Set("map", root.GetString("map"))
+		reply.Set("message", text)
+		reply.Set("created_by", admin.GetString("name"))
+		reply.Set("type", "administrator")
+		err = app.Save(reply)
+	}
+	if err == nil {
+		// Resolved after the reply is saved: the reply would reopen it.
+		root, err = app.FindRecordById("messages", root.Id)
+	}
+	if err == nil {
+		root.Set("resolved_at", time.Now().UTC())
+		root.Set("resolved_by", authID(admin))
+		err = app.Save(root)
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		log.Printf("replyToChangeRequest: could not reply to message %s: %v", request.GetString("message"), err)
+	}
+}
+
+// changeRequestUser returns the account that raised a request: the signed-in
+// requester, else the account behind the assignment it was raised through.
+// It is nil for anonymous link-id publishers.
+func changeRequestUser(app core.App, request *core.Record) *core.Record {
+	if user, err := app.FindRecordById("users", request.GetString("requested_by_user")); err == nil {
+		return user
+	}
+	assignment, err := app.FindRecordById("assignments", request.GetString("assignment"))
+	if err != nil || assignment.GetString("user") == "" {
+		return nil
+	}
+	user, err := app.FindRecordById("users", assignment.GetString("user"))
+	if err != nil {
+		return nil
+	}
+	return user
+}
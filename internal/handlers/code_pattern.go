@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Code patterns describe the unit codes (or floors) of a building in one line
+// instead of listing every code. A pattern is a comma-separated list of terms:
+//
+//	7            a single code
+//	1..12        a numeric range; prefixes and suffixes carry over: A1..A12, 1A..12A
+//	01..12       zero-padding follows the start value: 01, 02 ... 12
+//	1A..1D       a letter range on the last character: 1A, 1B, 1C, 1D
+//	1..20/2      a range with a step: 1, 3, 5 ... 19
+//	!4           excludes a code, or a range (!10..19), wherever it appears
+//
+// Floor patterns use the same terms over whole numbers, so basements are
+// negative ("-2..-1,1..12,!4,!13"). Floor 0 is never produced, matching how
+// adding a floor below 1 skips straight to -1.
+//
+// Expanded codes are ordered with NaturalLess and numbered 0..N-1, the same
+// order fix-sequences repairs maps into, so a generated map never needs it.
+
+// maxPatternCodes caps what a single pattern can expand to. It is well above
+// any real building and stops a typo like 1..100000 creating a runaway map.
+const maxPatternCodes = 1000
+
+// maxPatternFloors is the floor-pattern equivalent of maxPatternCodes.
+const maxPatternFloors = 200
+
+type PreviewCodePatternRequest struct {
+	CodePattern  string `json:"code_pattern"`
+	FloorPattern string `json:"floor_pattern"`
+}
+
+type PatternCode struct {
+	Code     string `json:"code"`
+	Sequence int    `json:"sequence"`
+}
+
+// HandlePreviewCodePattern expands a code pattern (and optionally a floor
+// pattern) without writing anything, so the map form can show what will be
+// created before it is submitted.
+func HandlePreviewCodePattern(e *core.RequestEvent, app core.App) error {
+	data := PreviewCodePatternRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.CodePattern == "" && data.FloorPattern == "" {
+		return apis.NewBadRequestError("code_pattern or floor_pattern is required", nil)
+	}
+
+	response := map[string]interface{}{}
+
+	if data.CodePattern != "" {
+		codes, err := expandCodePattern(data.CodePattern)
+		if err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		preview := make([]PatternCode, len(codes))
+		for i, code := range codes {
+			preview[i] = PatternCode{Code: code, Sequence: i}
+		}
+		response["codes"] = preview
+	}
+
+	if data.FloorPattern != "" {
+		floors, err := expandFloorPattern(data.FloorPattern)
+		if err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		response["floors"] = floors
+	}
+
+	return e.JSON(http.StatusOK, response)
+}
+
+// expandCodePattern returns the codes a pattern describes, de-duplicated and
+// in NaturalLess order.
+func expandCodePattern(pattern string) ([]string, error) {
+	include := map[string]bool{}
+	exclude := map[string]bool{}
+
+	for _, raw := range strings.Split(pattern, ",") {
+		term := strings.TrimSpace(raw)
+		negate := strings.HasPrefix(term, "!")
+		term = strings.TrimPrefix(term, "!")
+		if term == "" {
+			return nil, fmt.Errorf("empty term in pattern '%s'", pattern)
+		}
+
+		codes, err := expandCodeTerm(term)
+		if err != nil {
+			return nil, err
+		}
+
+		target := include
+		if negate {
+			target = exclude
+		}
+		for _, code := range codes {
+			if !codeFormatRegex.MatchString(code) {
+				return nil, fmt.Errorf("'%s' must contain only alphanumeric characters and hyphens", code)
+			}
+			target[code] = true
+		}
+		if len(include) > maxPatternCodes {
+			return nil, fmt.Errorf("pattern expands to more than %d codes", maxPatternCodes)
+		}
+	}
+
+	codes := make([]string, 0, len(include))
+	for code := range include {
+		if !exclude[code] {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("pattern '%s' produces no codes", pattern)
+	}
+
+	sort.Slice(codes, func(i, j int) bool { return NaturalLess(codes[i], codes[j]) })
+	return codes, nil
+}
+
+func expandCodeTerm(term string) ([]string, error) {
+	start, end, step, isRange, err := splitRangeTerm(term)
+	if err != nil || !isRange {
+		return []string{term}, err
+	}
+
+	startPrefix, startDigits, startSuffix := splitLastNumber(start)
+	endPrefix, endDigits, endSuffix := splitLastNumber(end)
+
+	if startDigits != "" && endDigits != "" && startPrefix == endPrefix && startSuffix == endSuffix {
+		from, err := strconv.Atoi(startDigits)
+		if err != nil {
+			return nil, fmt.Errorf("number '%s' in range '%s' is too large", startDigits, term)
+		}
+		to, err := strconv.Atoi(endDigits)
+		if err != nil {
+			return nil, fmt.Errorf("number '%s' in range '%s' is too large", endDigits, term)
+		}
+		if rangeCount(from, to, step) > maxPatternCodes {
+			return nil, fmt.Errorf("range '%s' expands to more than %d codes", term, maxPatternCodes)
+		}
+		width := 0
+		if len(startDigits) > 1 && startDigits[0] == '0' {
+			width = len(startDigits)
+		}
+		var codes []string
+		for _, n := range stepRange(from, to, step) {
+			codes = append(codes, fmt.Sprintf("%s%0*d%s", startPrefix, width, n, startSuffix))
+		}
+		return codes, nil
+	}
+
+	if len(start) == len(end) && start[:len(start)-1] == end[:len(end)-1] {
+		from, to := start[len(start)-1], end[len(end)-1]
+		if isLetter(from) && isLetter(to) && isUpper(from) == isUpper(to) {
+			stem := start[:len(start)-1]
+			var codes []string
+			for _, n := range stepRange(int(from), int(to), step) {
+				codes = append(codes, stem+string(rune(n)))
+			}
+			return codes, nil
+		}
+	}
+
+	return nil, fmt.Errorf("range '%s' must vary only in its last number or letter", term)
+}
+
+// expandFloorPattern returns the floors a floor pattern describes in
+// ascending order, without floor 0.
+func expandFloorPattern(pattern string) ([]int, error) {
+	include := map[int]bool{}
+	exclude := map[int]bool{}
+
+	for _, raw := range strings.Split(pattern, ",") {
+		term := strings.TrimSpace(raw)
+		negate := strings.HasPrefix(term, "!")
+		term = strings.TrimPrefix(term, "!")
+		if term == "" {
+			return nil, fmt.Errorf("empty term in floor pattern '%s'", pattern)
+		}
+
+		start, end, step, isRange, err := splitRangeTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		if !isRange {
+			end = start
+		}
+		from, err := strconv.Atoi(start)
+		if err != nil {
+			return nil, fmt.Errorf("floor '%s' must be a whole number", start)
+		}
+		to, err := strconv.Atoi(end)
+		if err != nil {
+			return nil, fmt.Errorf("floor '%s' must be a whole number", end)
+		}
+		if rangeCount(from, to, step) > maxPatternFloors {
+			return nil, fmt.Errorf("floor pattern expands to more than %d floors", maxPatternFloors)
+		}
+
+		target := include
+		if negate {
+			target = exclude
+		}
+		for _, floor := range stepRange(from, to, step) {
+			if floor != 0 {
+				target[floor] = true
+			}
+		}
+		if len(include) > maxPatternFloors {
+			return nil, fmt.Errorf("floor pattern expands to more than %d floors", maxPatternFloors)
+		}
+	}
+
+	floors := make([]int, 0, len(include))
+	for floor := range include {
+		if !exclude[floor] {
+			floors = append(floors, floor)
+		}
+	}
+	if len(floors) == 0 {
+		return nil, fmt.Errorf("floor pattern '%s' produces no floors", pattern)
+	}
+
+	sort.Ints(floors)
+	return floors, nil
+}
+
+// splitRangeTerm splits "start..end/step". A term without ".." is not a range
+// and is returned whole as start.
+func splitRangeTerm(term string) (start, end string, step int, isRange bool, err error) {
+	step = 1
+	start, end, isRange = strings.Cut(term, "..")
+	if !isRange {
+		return term, "", step, false, nil
+	}
+
+	if body, rawStep, hasStep := strings.Cut(end, "/"); hasStep {
+		step, err = strconv.Atoi(rawStep)
+		if err != nil || step < 1 {
+			return "", "", 0, false, fmt.Errorf("step in '%s' must be a positive whole number", term)
+		}
+		end = body
+	}
+
+	if start == "" || end == "" {
+		return "", "", 0, false, fmt.Errorf("range '%s' needs both a start and an end", term)
+	}
+	return start, end, step, true, nil
+}
+
+// splitLastNumber splits a code around its last run of digits, so "A-07B"
+// becomes ("A-", "07", "B"). digits is empty when the code has none.
+func splitLastNumber(code string) (prefix, digits, suffix string) {
+	end := len(code)
+	for end > 0 && !isDigit(code[end-1]) {
+		end--
+	}
+	begin := end
+	for begin > 0 && isDigit(code[begin-1]) {
+		begin--
+	}
+	return code[:begin], code[begin:end], code[end:]
+}
+
+// rangeCount is how many values stepRange(from, to, step) yields. The
+// distance is taken as unsigned so bounds near the ends of int cannot
+// overflow.
+func rangeCount(from, to, step int) uint64 {
+	distance := uint64(to) - uint64(from)
+	if from > to {
+		distance = uint64(from) - uint64(to)
+	}
+	return distance/uint64(step) + 1
+}
+
+// stepRange counts from one bound to the other in either direction, so
+// "12..1" is as valid as "1..12". It stops before a step would pass the
+// bound, so ranges ending near the limits of int cannot wrap around. Callers
+// cap rangeCount first.
+func stepRange(from, to, step int) []int {
+	var values []int
+	if from <= to {
+		for n := from; ; n += step {
+			values = append(values, n)
+			if uint64(to)-uint64(n) < uint64(step) {
+				break
+			}
+		}
+	} else {
+		for n := from; ; n -= step {
+			values = append(values, n)
+			if uint64(n)-uint64(to) < uint64(step) {
+				break
+			}
+		}
+	}
+	return values
+}
+
+// NaturalLess orders codes the way a person reads them: digit runs compare
+// numerically so "9" precedes "10", and "10" precedes "10A".
+func NaturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			si, sj := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			na := strings.TrimLeft(a[si:i], "0")
+			nb := strings.TrimLeft(b[sj:j], "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			return a[i] < b[j]
+		}
+		i++
+		j++
+	}
+	return len(a)-i < len(b)-j
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isLetter(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
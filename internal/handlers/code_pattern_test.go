@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	ordered := []struct{ a, b string }{
+		{"9", "10"},        // numeric, not lexical
+		{"10", "10A"},      // bare number before its suffixed neighbour
+		{"10A", "10B"},     // suffix order
+		{"2A", "2B"},       // ditto with a leading digit
+		{"05", "7"},        // leading zeros ignored
+		{"4301", "4303"},   // the reported case
+		{"20A", "20B"},     // Tiong Poh style
+		{"1-9", "1-10"},    // hyphenated flats compare numerically
+		{"E-2-1", "E-2-2"}, // block-prefixed flats
+		{"K1", "K2"},
+	}
+
+	for _, c := range ordered {
+		if !NaturalLess(c.a, c.b) {
+			t.Errorf("NaturalLess(%q, %q) = false, want true", c.a, c.b)
+		}
+		if NaturalLess(c.b, c.a) {
+			t.Errorf("NaturalLess(%q, %q) = true, want false", c.b, c.a)
+		}
+	}
+
+	if NaturalLess("10", "10") {
+		t.Error("NaturalLess should be false for equal codes")
+	}
+}
+
+func TestExpandCodePattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		want    string
+	}{
+		{"1..5", "1 2 3 4 5"},
+		{"1..14,!4,!13", "1 2 3 5 6 7 8 9 10 11 12 14"},
+		{"01..03", "01 02 03"},
+		{"A1..A3", "A1 A2 A3"},
+		{"A-08..A-10", "A-08 A-09 A-10"},
+		{"1A..1C", "1A 1B 1C"},
+		{"a..c", "a b c"},
+		{"1..9/2", "1 3 5 7 9"},
+		{"10..19,!12..14", "10 11 15 16 17 18 19"},
+		{"5..1", "1 2 3 4 5"},
+		{"10,9,10A,2", "2 9 10 10A"},
+		{"1..3,2..4", "1 2 3 4"},
+		{"M1, M2", "M1 M2"},
+	}
+
+	for _, c := range cases {
+		got, err := expandCodePattern(c.pattern)
+		if err != nil {
+			t.Errorf("expandCodePattern(%q) error: %v", c.pattern, err)
+			continue
+		}
+		if joined := strings.Join(got, " "); joined != c.want {
+			t.Errorf("expandCodePattern(%q) = %q, want %q", c.pattern, joined, c.want)
+		}
+	}
+}
+
+func TestExpandCodePatternRejects(t *testing.T) {
+	cases := []struct {
+		pattern string
+		wantErr string
+	}{
+		{"", "empty term"},
+		{"1,,2", "empty term"},
+		{"1..", "needs both a start and an end"},
+		{"1..5/0", "step"},
+		{"A1..B3", "last number or letter"},
+		{"1A..2B", "last number or letter"},
+		{"1!", "alphanumeric"},
+		{"1..3,!1..3", "produces no codes"},
+		{"1..5000", "more than"},
+		{"1..9223372036854775807", "more than"},
+		{"99999999999999999998..99999999999999999999", "too large"},
+	}
+
+	for _, c := range cases {
+		_, err := expandCodePattern(c.pattern)
+		if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+			t.Errorf("expandCodePattern(%q) error = %v, want it to mention %q", c.pattern, err, c.wantErr)
+		}
+	}
+}
+
+func TestExpandFloorPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		want    []int
+	}{
+		{"1..3", []int{1, 2, 3}},
+		{"-2..-1,1..3", []int{-2, -1, 1, 2, 3}},
+		{"-1..2", []int{-1, 1, 2}},
+		{"1..14,!4,!13", []int{1, 2, 3, 5, 6, 7, 8, 9, 10, 11, 12, 14}},
+		{"7", []int{7}},
+	}
+
+	for _, c := range cases {
+		got, err := expandFloorPattern(c.pattern)
+		if err != nil {
+			t.Errorf("expandFloorPattern(%q) error: %v", c.pattern, err)
+			continue
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("expandFloorPattern(%q) = %v, want %v", c.pattern, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("expandFloorPattern(%q) = %v, want %v", c.pattern, got, c.want)
+				break
+			}
+		}
+	}
+
+	for _, bad := range []string{"B1", "0", "1..1000", "1..x", "-9223372036854775808..9223372036854775807/2"} {
+		if _, err := expandFloorPattern(bad); err == nil {
+			t.Errorf("expandFloorPattern(%q) should fail", bad)
+		}
+	}
+}
+
+func TestExpandPatternNearIntLimits(t *testing.T) {
+	codes, err := expandCodePattern("9223372036854775797..9223372036854775807/100")
+	if err != nil || len(codes) != 1 || codes[0] != "9223372036854775797" {
+		t.Errorf("expandCodePattern near MaxInt = %v, %v; want the single start code", codes, err)
+	}
+	codes, err = expandCodePattern("9223372036854775807..9223372036854775797/3")
+	if err != nil || len(codes) != 4 {
+		t.Errorf("descending expandCodePattern near MaxInt = %v, %v; want 4 codes", codes, err)
+	}
+
+	floors, err := expandFloorPattern("9223372036854775797..9223372036854775807/100")
+	if err != nil || len(floors) != 1 || floors[0] != 9223372036854775797 {
+		t.Errorf("expandFloorPattern near MaxInt = %v, %v; want the single start floor", floors, err)
+	}
+	floors, err = expandFloorPattern("-9223372036854775808..-9223372036854775800/4")
+	if err != nil || len(floors) != 3 {
+		t.Errorf("expandFloorPattern near MinInt = %v, %v; want 3 floors", floors, err)
+	}
+}
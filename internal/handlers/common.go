@@ -94,33 +94,73 @@ func fetchMapData(app core.App, mapId string) (*core.Record, error) {
 
 // AuthorizeByRole checks if userId has one of the specified roles in the given congregation.
 // If no allowedRoles are provided, any role grants access.
+//
+// A territory-scoped role counts as membership of its congregation (no
+// allowedRoles) but never satisfies a named role at congregation level: a
+// conductor scoped to two territories is not a conductor for the whole
+// congregation. Use AuthorizeTerritoryByRole or AuthorizeMapByRole for
+// actions on a single territory or map.
 func AuthorizeByRole(app core.App, userId string, congregationId string, allowedRoles ...string) bool {
-	var v struct {
-		V int `db:"v"`
+	scope := unscopedRoleSQL
+	if len(allowedRoles) == 0 {
+		scope = "1 = 1"
 	}
+	return authorizeRole(app, userId, congregationId, scope, dbx.Params{}, allowedRoles)
+}
 
-	if len(allowedRoles) == 0 {
-		err := app.DB().NewQuery(`
-			SELECT 1 as v FROM roles
-			WHERE user = {:userId} AND congregation = {:congId}
-			LIMIT 1
-		`).Bind(dbx.Params{"userId": userId, "congId": congregationId}).One(&v)
-		return err == nil
+// AuthorizeTerritoryByRole checks if userId has one of the specified roles
+// (any role if none are given) covering the territory: a congregation-wide
+// role in its congregation, or a role scoped to it.
+func AuthorizeTerritoryByRole(app core.App, userId string, territoryId string, allowedRoles ...string) bool {
+	congregationId := getTerritoryCongregation(app, territoryId)
+	if congregationId == "" {
+		return false
+	}
+	return authorizeRole(app, userId, congregationId, roleCoversTerritorySQL("{:territoryId}"),
+		dbx.Params{"territoryId": territoryId}, allowedRoles)
+}
+
+// AuthorizeMapByRole checks if userId has one of the specified roles (any
+// role if none are given) covering the map's territory.
+func AuthorizeMapByRole(app core.App, userId string, mapId string, allowedRoles ...string) bool {
+	var m struct {
+		Congregation string `db:"congregation"`
+		Territory    string `db:"territory"`
+	}
+	err := app.DB().NewQuery("SELECT congregation, territory FROM maps WHERE id = {:id}").
+		Bind(dbx.Params{"id": mapId}).One(&m)
+	if err != nil || m.Congregation == "" {
+		return false
 	}
+	return authorizeRole(app, userId, m.Congregation, roleCoversTerritorySQL("{:territoryId}"),
+		dbx.Params{"territoryId": m.Territory}, allowedRoles)
+}
 
-	params := dbx.Params{"userId": userId, "congId": congregationId}
-	placeholders := make([]string, len(allowedRoles))
-	for i, role := range allowedRoles {
-		key := fmt.Sprintf("role%d", i)
-		params[key] = role
-		placeholders[i] = "{:" + key + "}"
+// authorizeRole checks for a roles row r of userId in the congregation that
+// satisfies the scope condition and, if given, holds one of allowedRoles.
+func authorizeRole(app core.App, userId, congregationId, scope string, params dbx.Params, allowedRoles []string) bool {
+	var v struct {
+		V int `db:"v"`
+	}
+
+	params["userId"] = userId
+	params["congId"] = congregationId
+	roleCond := ""
+	if len(allowedRoles) > 0 {
+		placeholders := make([]string, len(allowedRoles))
+		for i, role := range allowedRoles {
+			key := fmt.Sprintf("role%d", i)
+			params[key] = role
+			placeholders[i] = "{:" + key + "}"
+		}
+		roleCond = fmt.Sprintf(" AND r.role IN (%s)", strings.Join(placeholders, ", "))
 	}
 
 	query := fmt.Sprintf(`
-		SELECT 1 as v FROM roles
-		WHERE user = {:userId} AND congregation = {:congId} AND role IN (%s)
+		SELECT 1 as v FROM roles r
+		WHERE r.user = {:userId} AND r.congregation = {:congId} AND %s%s
 		LIMIT 1
-	`, strings.Join(placeholders, ", "))
+	`, scope, roleCond)
 
 	err := app.DB().NewQuery(query).Bind(params).One(&v)
 	return err == nil
@@ -159,11 +199,7 @@ func AuthorizeMapAccess(c *core.RequestEvent, app core.App, mapId string) bool {
 	if c.HasSuperuserAuth() {
 		return true
 	}
-	linkId := c.Request.Header.Get("link-id")
-	if linkId != "" {
-		return AuthorizeLinkAccess(app, linkId, mapId)
-	}
-	return c.Auth != nil && authorizeUserForMap(app, c.Auth.Id, mapId)
+	return mapAccessRule.allow(app, c.Auth, c.Request.Header.Get("link-id"), accessScope{Map: mapId})
 }
 
 // resolveActor returns the identity to attribute an address change to, derived
@@ -184,22 +220,13 @@ func resolveActor(c *core.RequestEvent, app core.App) string {
 	return assignment.GetString("publisher")
 }
 
-// authorizeUserForMap checks if userId has any role in the map's congregation.
+// authorizeUserForMap checks if userId has any role covering the map.
 func authorizeUserForMap(app core.App, userId string, mapId string) bool {
-	var v struct {
-		V int `db:"v"`
-	}
-	err := app.DB().NewQuery(`
-		SELECT 1 as v FROM roles r
-		JOIN maps m ON m.congregation = r.congregation
-		WHERE m.id = {:mapId} AND r.user = {:userId}
-		LIMIT 1
-	`).Bind(dbx.Params{"mapId": mapId, "userId": userId}).One(&v)
-	return err == nil
+	return AuthorizeMapByRole(app, userId, mapId)
 }
 
-// authorizeUserForMaps checks if userId has a role in the congregation of every
-// map in mapIds using a single query. Returns true only if all maps are authorized.
+// authorizeUserForMaps checks if userId has a role covering every map in
+// mapIds using a single query. Returns true only if all maps are authorized.
 func authorizeUserForMaps(app core.App, userId string, mapIds []string) bool {
 	if len(mapIds) == 0 {
 		return false
@@ -223,7 +250,8 @@ func authorizeUserForMaps(app core.App, userId string, mapIds []string) bool {
 	err := app.DB().NewQuery(
 		`SELECT COUNT(DISTINCT m.id) as cnt FROM roles r
 		JOIN maps m ON m.congregation = r.congregation
-		WHERE m.id IN (` + strings.Join(placeholders, ",") + `) AND r.user = {:userId}`,
+		WHERE m.id IN (` + strings.Join(placeholders, ",") + `) AND r.user = {:userId}
+		  AND ` + roleCoversTerritorySQL("m.territory"),
 	).Bind(params).One(&result)
 	return err == nil && result.Cnt == len(unique)
 }
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// findOpenCoverageCycle returns the open cycle for a map (mapId set) or a
+// territory (mapId empty), or nil when there is none.
+func findOpenCoverageCycle(app core.App, scope, territory, mapId string) *core.Record {
+	cycle, err := app.FindFirstRecordByFilter(
+		"coverage_cycles",
+		"scope = {:scope} && territory = {:territory} && map = {:map} && ended_at = ''",
+		dbx.Params{"scope": scope, "territory": territory, "map": mapId},
+	)
+	if err != nil {
+		return nil
+	}
+	return cycle
+}
+
+func newCoverageCycle(app core.App, scope, congregation, territory, mapId, openedBy string) (*core.Record, error) {
+	collection, err := app.FindCachedCollectionByNameOrId("coverage_cycles")
+	if err != nil {
+		return nil, err
+	}
+
+	cycle := core.NewRecord(collection)
+	cycle.Set("congregation", congregation)
+	cycle.Set("territory", territory)
+	cycle.Set("map", mapId)
+	cycle.Set("scope", scope)
+	cycle.Set("opened_by", openedBy)
+	cycle.Set("started_at", time.Now().UTC())
+
+	if err := app.Save(cycle); err != nil {
+		return nil, err
+	}
+	return cycle, nil
+}
+
+// cycleRestart records the cycles one reset closed and opened, so restoring
+// the reset's snapshot can undo the boundary (see undoCycleRestart). Closed is
+// empty when nothing was open at the time.
+type cycleRestart struct {
+	Scope     string `json:"scope"`
+	Territory string `json:"territory"`
+	Map       string `json:"map"`
+	Closed    string `json:"closed"`
+	Opened    string `json:"opened"`
+}
+
+// restartCoverageCycle ends any open cycle with outcome "reset" and opens a
+// fresh one. Reset handlers call it inside their transaction so the cycle
+// boundary commits or rolls back with the reset itself.
+func restartCoverageCycle(txApp core.App, scope, congregation, territory, mapId string) (cycleRestart, error) {
+	restart := cycleRestart{Scope: scope, Territory: territory, Map: mapId}
+	if open := findOpenCoverageCycle(txApp, scope, territory, mapId); open != nil {
+		open.Set("ended_at", time.Now().UTC())
+		open.Set("outcome", "reset")
+		if err := txApp.Save(open); err != nil {
+			return restart, err
+		}
+		restart.Closed = open.Id
+	}
+	created, err := newCoverageCycle(txApp, scope, congregation, territory, mapId, "reset")
+	if err != nil {
+		return restart, err
+	}
+	restart.Opened = created.Id
+	return restart, nil
+}
+
+// undoCycleRestart reverses a reset's cycle boundary when its snapshot is
+// restored: the cycle the reset opened is dropped and the one it cut short is
+// reopened. Nothing changes once the new cycle has itself ended, since the
+// restored addresses then belong to it.
+//
+// held reports that no cycle was reopened, so the recalculation after the
+// restore must not open (or open and immediately complete) one in its place;
+// see coverageHoldKey.
+func undoCycleRestart(txApp core.App, restart cycleRestart) (held bool, err error) {
+	opened, err := txApp.FindRecordById("coverage_cycles", restart.Opened)
+	if err != nil || !opened.GetDateTime("ended_at").IsZero() {
+		return false, nil
+	}
+	if err := txApp.Delete(opened); err != nil {
+		return false, err
+	}
+
+	if restart.Closed == "" {
+		return true, nil
+	}
+	closed, err := txApp.FindRecordById("coverage_cycles", restart.Closed)
+	if err != nil || closed.GetString("outcome") != "reset" {
+		return true, nil
+	}
+	closed.Set("ended_at", "")
+	closed.Set("outcome", "")
+	return false, txApp.Save(closed)
+}
+
+// coverageHoldKey is the app store flag that pauses cycle tracking for a map
+// (mapId set) or territory while a snapshot restore recalculates it.
+func coverageHoldKey(territory, mapId string) string {
+	return "coverage_hold:" + territory + ":" + mapId
+}
+
+// trackCoverageCycle moves a map's or territory's cycle along after its
+// progress has been recalculated:
+//   - an open cycle closes once progress reaches 100%;
+//   - with no open cycle, activity below 100% opens one;
+//   - with no open cycle, a jump straight to 100% (a single-address map, say)
+//     opens and closes a cycle at once.
+//
+// Tracking is skipped while coverageHoldKey is set for the map or territory.
+// Failures are logged rather than returned: cycle history must never block
+// the aggregate update it piggybacks on.
+func trackCoverageCycle(app core.App, scope, congregation, territory, mapId string, prevProgress, progress int, active bool, breakdown map[string]any) {
+	if app.Store().Has(coverageHoldKey(territory, mapId)) {
+		return
+	}
+	err := app.RunInTransaction(func(txApp core.App) error {
+		open := findOpenCoverageCycle(txApp, scope, territory, mapId)
+		if open == nil {
+			if !active || (progress >= 100 && prevProgress >= 100) {
+				return nil
+			}
+			created, err := newCoverageCycle(txApp, scope, congregation, territory, mapId, "activity")
+			if err != nil || progress < 100 {
+				return err
+			}
+			open = created
+		} else if progress < 100 {
+			return nil
+		}
+
+		return closeCoverageCycle(txApp, open, breakdown)
+	})
+	if err != nil {
+		log.Printf("Error tracking %s coverage cycle (territory %s, map %s): %v", scope, territory, mapId, err)
+	}
+}
+
+// closeCoverageCycle stamps a completed cycle with its duration, the number
+// of distinct publishers who worked an address since it opened, and the final
+// status breakdown. Changes back to not_done are resets, not field work, so
+// they do not count towards publishers.
+func closeCoverageCycle(txApp core.App, cycle *core.Record, breakdown map[string]any) error {
+	now := time.Now().UTC()
+	startedAt := cycle.GetDateTime("started_at")
+
+	column, id := "territory", cycle.GetString("territory")
+	if cycle.GetString("scope") == "map" {
+		column, id = "map", cycle.GetString("map")
+	}
+
+	var publishers struct {
+		Count int `db:"count"`
+	}
+	err := txApp.DB().NewQuery(`
+		SELECT COUNT(DISTINCT changed_by) AS count
+		FROM addresses_log
+		WHERE ` + column + ` = {:id}
+		  AND created >= {:started}
+		  AND changed_by != ''
+		  AND new_status != 'not_done'
+	`).Bind(dbx.Params{"id": id, "started": startedAt.String()}).One(&publishers)
+	if err != nil {
+		return err
+	}
+
+	days := now.Sub(startedAt.Time()).Hours() / 24
+
+	cycle.Set("ended_at", now)
+	cycle.Set("outcome", "completed")
+	cycle.Set("duration_days", math.Round(days*10)/10)
+	cycle.Set("publishers", publishers.Count)
+	cycle.Set("breakdown", breakdown)
+
+	return txApp.Save(cycle)
+}
+
+// TerritoryCoverage summarises the completed coverage cycles of one territory.
+type TerritoryCoverage struct {
+	Territory      string  `db:"territory"       json:"territory"`
+	Code           string  `db:"code"            json:"code"`
+	Description    string  `db:"description"     json:"description"`
+	CyclesCovered  int     `db:"cycles_covered"  json:"cycles_covered"`
+	AverageDays    float64 `db:"average_days"    json:"average_days"`
+	LastCompleted  string  `db:"last_completed"  json:"last_completed"`
+	CurrentStarted string  `db:"current_started" json:"current_started"`
+}
+
+// TerritoryCoverageStats returns, for every territory in a congregation, how
+// many times it has been fully covered and the average number of days each
+// pass took, ordered by territory code. Used by /territory/coverage and the
+// monthly report.
+func TerritoryCoverageStats(app core.App, congregationId string) ([]TerritoryCoverage, error) {
+	stats := []TerritoryCoverage{}
+	err := app.DB().NewQuery(`
+		SELECT t.id AS territory, t.code, t.description,
+		       COUNT(c.id) AS cycles_covered,
+		       COALESCE(ROUND(AVG(c.duration_days), 1), 0) AS average_days,
+		       COALESCE(MAX(c.ended_at), '') AS last_completed,
+		       COALESCE((
+		           SELECT o.started_at FROM coverage_cycles o
+		           WHERE o.territory = t.id AND o.scope = 'territory' AND o.ended_at = ''
+		           LIMIT 1
+		       ), '') AS current_started
+		FROM territories t
+		LEFT JOIN coverage_cycles c
+		       ON c.territory = t.id AND c.scope = 'territory' AND c.outcome = 'completed'
+		WHERE t.congregation = {:congregation}
+		GROUP BY t.id
+		ORDER BY t.code
+	`).Bind(dbx.Params{"congregation": congregationId}).All(&stats)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+type TerritoryCoverageRequest struct {
+	Congregation string `json:"congregation"`
+}
+
+// HandleTerritoryCoverage returns TerritoryCoverageStats for a congregation.
+// Restricted to administrators and conductors, who plan territory coverage.
+func HandleTerritoryCoverage(e *core.RequestEvent, app core.App) error {
+	data := TerritoryCoverageRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" {
+		return apis.NewBadRequestError("congregation is required", nil)
+	}
+
+	if !AuthorizeByRole(app, e.Auth.Id, data.Congregation, "administrator", "conductor") {
+		return apis.NewForbiddenError("Administrator or conductor access required", nil)
+	}
+
+	stats, err := TerritoryCoverageStats(app, data.Congregation)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusOK, stats)
+}
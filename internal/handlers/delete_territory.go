@@ -9,10 +9,11 @@ import (
 )
 
 // HandleDeleteTerritory deletes a territory and all its child records atomically.
-// Child records (address_options, assignments, messages, addresses, maps) are deleted
-// via raw SQL to suppress cascade realtime events. The territory is deleted via
-// txApp.Delete inside the same transaction, which fires exactly one realtime event
-// after the transaction commits.
+// Child records (address_options, assignments, broadcast_receipts,
+// change_requests, message_reads, messages, addresses, maps) are deleted via raw
+// SQL to suppress cascade realtime events. The territory is deleted via
+// txApp.Delete inside the same transaction, which fires exactly one realtime
+// event after the transaction commits.
 func HandleDeleteTerritory(e *core.RequestEvent, app core.App) error {
 	requestInfo, _ := e.RequestInfo()
 	data := requestInfo.Body
@@ -26,15 +27,29 @@ func HandleDeleteTerritory(e *core.RequestEvent, app core.App) error {
 		return apis.NewNotFoundError("Territory not found", nil)
 	}
 
-	if !AuthorizeByRole(app, e.Auth.Id, territory.GetString("congregation"), "administrator", "conductor") {
+	if !AuthorizeTerritoryByRole(app, e.Auth.Id, territory.Id, "administrator", "conductor") {
 		return apis.NewForbiddenError("Administrator or conductor access required", nil)
 	}
 
+	var deletedMaps []struct {
+		Id          string `db:"id"          json:"id"`
+		Description string `db:"description" json:"description"`
+	}
+	if err := app.DB().NewQuery("SELECT id, description FROM maps WHERE territory = {:id}").
+		Bind(dbx.Params{"id": territoryId}).All(&deletedMaps); err != nil {
+		return newServerError(err)
+	}
+
 	err = app.RunInTransaction(func(txApp core.App) error {
 		params := dbx.Params{"id": territoryId}
 		for _, q := range []string{
 			"DELETE FROM address_options WHERE map IN (SELECT id FROM maps WHERE territory = {:id})",
+			// Raw deletes skip relation cascades, so link push subscriptions go first.
+			"DELETE FROM push_subscriptions WHERE assignment IN (SELECT id FROM assignments WHERE map IN (SELECT id FROM maps WHERE territory = {:id}))",
 			"DELETE FROM assignments WHERE map IN (SELECT id FROM maps WHERE territory = {:id})",
+			"DELETE FROM broadcast_receipts WHERE map IN (SELECT id FROM maps WHERE territory = {:id})",
+			"DELETE FROM change_requests WHERE map IN (SELECT id FROM maps WHERE territory = {:id})",
+			"DELETE FROM message_reads WHERE message IN (SELECT id FROM messages WHERE map IN (SELECT id FROM maps WHERE territory = {:id}))",
 			"DELETE FROM messages WHERE map IN (SELECT id FROM maps WHERE territory = {:id})",
 			"DELETE FROM addresses WHERE map IN (SELECT id FROM maps WHERE territory = {:id})",
 			"DELETE FROM maps WHERE territory = {:id}",
@@ -50,5 +65,11 @@ func HandleDeleteTerritory(e *core.RequestEvent, app core.App) error {
 		return newServerError(err)
 	}
 
+	writeStructureLog(app, territory.GetString("congregation"), structureTerritoryDeleted, "territory", territoryId, authID(e.Auth), map[string]any{
+		"code":        territory.GetString("code"),
+		"description": territory.GetString("description"),
+		"maps":        deletedMaps,
+	})
+
 	return e.JSON(http.StatusOK, "Territory deleted successfully")
 }
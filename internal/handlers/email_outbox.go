@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+type ListEmailFailuresRequest struct {
+	Congregation string `json:"congregation"`
+	Status       string `json:"status"`
+}
+
+type RetryEmailRequest struct {
+	Id string `json:"id"`
+}
+
+type emailFailureEntry struct {
+	Id            string        `db:"id"              json:"id"`
+	Congregation  string        `db:"congregation"    json:"congregation"`
+	Subject       string        `db:"subject"         json:"subject"`
+	Recipients    types.JSONRaw `db:"recipients"      json:"recipients"`
+	Status        string        `db:"status"          json:"status"`
+	Attempts      int           `db:"attempts"        json:"attempts"`
+	LastError     string        `db:"last_error"      json:"last_error"`
+	NextAttemptAt string        `db:"next_attempt_at" json:"next_attempt_at"`
+	Created       string        `db:"created"         json:"created"`
+	Updated       string        `db:"updated"         json:"updated"`
+}
+
+// authorizeEmailOutbox checks e may manage a congregation's queued emails:
+// its congregation-wide administrators, or superusers. System emails (no
+// congregation), such as account warnings, are for superusers only.
+func authorizeEmailOutbox(e *core.RequestEvent, app core.App, congregation string) bool {
+	if e.HasSuperuserAuth() {
+		return true
+	}
+	return congregation != "" && AuthorizeByRole(app, e.Auth.Id, congregation, "administrator")
+}
+
+// HandleListEmailFailures lists a congregation's queued emails that are
+// failing, newest first: dead-lettered ones, and ones still pending after a
+// failed attempt. status narrows the list to "dead" or "pending". Superusers
+// may leave congregation empty to list system emails.
+func HandleListEmailFailures(e *core.RequestEvent, app core.App) error {
+	data := ListEmailFailuresRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" && !e.HasSuperuserAuth() {
+		return apis.NewBadRequestError("congregation is required", nil)
+	}
+	if !authorizeEmailOutbox(e, app, data.Congregation) {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+
+	filter := "(status = 'dead' OR (status IN ('pending', 'sending') AND attempts > 0))"
+	switch data.Status {
+	case "":
+	case "dead":
+		filter = "status = 'dead'"
+	case "pending":
+		filter = "status IN ('pending', 'sending') AND attempts > 0"
+	default:
+		return apis.NewBadRequestError("status must be dead or pending", nil)
+	}
+
+	entries := []emailFailureEntry{}
+	err := app.DB().NewQuery(`
+		SELECT id, COALESCE(congregation, '') AS congregation, subject, recipients, status,
+		       COALESCE(attempts, 0) AS attempts, COALESCE(last_error, '') AS last_error,
+		       COALESCE(next_attempt_at, '') AS next_attempt_at, created, updated
+		FROM email_outbox
+		WHERE COALESCE(congregation, '') = {:congregation} AND ` + filter + `
+		ORDER BY created DESC
+		LIMIT 200
+	`).Bind(dbx.Params{"congregation": data.Congregation}).All(&entries)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusOK, entries)
+}
+
+// HandleRetryEmail puts a dead-lettered email back in the queue with a fresh
+// set of attempts, or brings a pending one's next attempt forward. The outbox
+// worker delivers it on its next run.
+func HandleRetryEmail(e *core.RequestEvent, app core.App) error {
+	data := RetryEmailRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Id == "" {
+		return apis.NewBadRequestError("id is required", nil)
+	}
+
+	email, err := app.FindRecordById("email_outbox", data.Id)
+	if err != nil {
+		return apis.NewNotFoundError("Email not found", nil)
+	}
+	if !authorizeEmailOutbox(e, app, email.GetString("congregation")) {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+
+	switch email.GetString("status") {
+	case "dead":
+		email.Set("attempts", 0)
+	case "pending":
+	default:
+		return apis.NewBadRequestError("Only dead or pending emails can be retried", nil)
+	}
+	email.Set("status", "pending")
+	email.Set("next_attempt_at", time.Now().UTC())
+	if err := app.Save(email); err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"id":     email.Id,
+		"status": "pending",
+	})
+}
@@ -158,6 +158,8 @@ func HandleGetLinkMap(c *core.RequestEvent, app core.App) error {
 		err := app.DB().NewQuery(`
 			SELECT 1 AS v FROM messages
 			WHERE map = {:map} AND type = 'administrator' AND pinned = 1
+			  AND (publish_at = '' OR published_at != '')
+			  AND (pin_until = '' OR pin_until > datetime('now'))
 			LIMIT 1
 		`).Bind(mapParams).One(&check)
 		pinnedCh <- pinnedResult{err == nil}
@@ -27,7 +27,7 @@ func HandleGetMapCodes(c *core.RequestEvent, app core.App) error {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Map not found"})
 	}
 
-	if !AuthorizeByRole(app, c.Auth.Id, mapRecord.GetString("congregation"), "administrator") {
+	if !AuthorizeMapByRole(app, c.Auth.Id, mapRecord.Id, "administrator") {
 		return apis.NewForbiddenError("Administrator access required", nil)
 	}
 
@@ -88,13 +88,13 @@ func HandleTerritoryQuicklink(c *core.RequestEvent, app core.App) error {
 	userId := c.Auth.Id
 
 	// The assignment minted below grants publisher access to the selected map, so
-	// the caller must hold a role in the territory's congregation. Any role is
-	// enough — read_only publishers legitimately use quicklinks.
+	// the caller must hold a role covering the territory. Any role is enough —
+	// read_only publishers legitimately use quicklinks.
 	congregationId := getTerritoryCongregation(app, territoryId)
 	if congregationId == "" {
 		return apis.NewNotFoundError("Territory not found", nil)
 	}
-	if !AuthorizeByRole(app, userId, congregationId) {
+	if !AuthorizeTerritoryByRole(app, userId, territoryId) {
 		return apis.NewForbiddenError("Unauthorized", nil)
 	}
 
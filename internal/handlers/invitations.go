@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	invitationDefaultDays = 7
+	invitationMaxDays     = 30
+	invitationTokenLength = 48
+)
+
+// Invitation events recorded in roles_log alongside granted/changed/revoked.
+const (
+	roleActionInvited           = "invited"
+	roleActionInvitationRevoked = "invitation_revoked"
+)
+
+// InvitationSenderFn emails an invitation link. Injected from the jobs package
+// at registration time to avoid import cycles; token is the plaintext token,
+// which is never stored.
+type InvitationSenderFn func(app core.App, invitation *core.Record, token string) error
+
+type CreateInvitationRequest struct {
+	Congregation  string `json:"congregation"`
+	Email         string `json:"email"`
+	Role          string `json:"role"`
+	ExpiresInDays int    `json:"expires_in_days"`
+}
+
+type RevokeInvitationRequest struct {
+	Invitation string `json:"invitation"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+type ListInvitationsRequest struct {
+	Congregation string `json:"congregation"`
+}
+
+type invitationEntry struct {
+	Id        string `db:"id"         json:"id"`
+	Email     string `db:"email"      json:"email"`
+	Role      string `db:"role"       json:"role"`
+	Status    string `db:"status"     json:"status"`
+	InvitedBy string `db:"invited_by" json:"invited_by"`
+	ExpiresAt string `db:"expires_at" json:"expires_at"`
+	Created   string `db:"created"    json:"created"`
+}
+
+func hashInvitationToken(token string) string {
+	return security.SHA256(token)
+}
+
+// invitationStatus reports why an invitation can or cannot be accepted.
+func invitationStatus(invitation *core.Record, now time.Time) string {
+	switch {
+	case !invitation.GetDateTime("accepted_at").IsZero():
+		return "accepted"
+	case !invitation.GetDateTime("revoked_at").IsZero():
+		return "revoked"
+	case !invitation.GetDateTime("expires_at").Time().After(now):
+		return "expired"
+	}
+	return "pending"
+}
+
+// HandleCreateInvitation creates an invitation for an email address to join a
+// congregation with a role and emails the invitee a tokenized link. Any
+// invitation still pending for the same address and congregation is revoked,
+// so re-inviting someone simply sends a fresh link.
+//
+// The invitation is kept when the email cannot be sent (email_sent is false in
+// the response); the administrator can revoke it or invite again.
+func HandleCreateInvitation(e *core.RequestEvent, app core.App, send InvitationSenderFn) error {
+	data := CreateInvitationRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	email := strings.ToLower(strings.TrimSpace(data.Email))
+	if data.Congregation == "" || email == "" || data.Role == "" {
+		return apis.NewBadRequestError("congregation, email and role are required", nil)
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return apis.NewBadRequestError("email is not a valid address", nil)
+	}
+	if !assignableRoles[data.Role] {
+		return apis.NewBadRequestError("role must be read_only, conductor or administrator", nil)
+	}
+	days := data.ExpiresInDays
+	if days == 0 {
+		days = invitationDefaultDays
+	}
+	if days < 0 || days > invitationMaxDays {
+		return apis.NewBadRequestError(fmt.Sprintf("expires_in_days must be between 1 and %d", invitationMaxDays), nil)
+	}
+	if !AuthorizeByRole(app, e.Auth.Id, data.Congregation, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+
+	if existing, err := app.FindAuthRecordByEmail("users", email); err == nil {
+		if AuthorizeByRole(app, existing.Id, data.Congregation) {
+			return apis.NewBadRequestError("This user already has a role in the congregation", nil)
+		}
+	}
+
+	collection, err := app.FindCachedCollectionByNameOrId("invitations")
+	if err != nil {
+		return newServerError(err)
+	}
+
+	now := time.Now().UTC()
+	token := security.RandomString(invitationTokenLength)
+	invitation := core.NewRecord(collection)
+	invitation.Set("congregation", data.Congregation)
+	invitation.Set("email", email)
+	invitation.Set("role", data.Role)
+	invitation.Set("token_hash", hashInvitationToken(token))
+	invitation.Set("invited_by", e.Auth.Id)
+	invitation.Set("expires_at", now.AddDate(0, 0, days))
+
+	var superseded []*core.Record
+	err = app.RunInTransaction(func(txApp core.App) error {
+		pending, err := txApp.FindRecordsByFilter(
+			"invitations",
+			"congregation = {:congregation} && email = {:email} && accepted_at = '' && revoked_at = '' && expires_at > {:now}",
+			"", 0, 0,
+			dbx.Params{"congregation": data.Congregation, "email": email, "now": now.Format(types.DefaultDateLayout)},
+		)
+		if err != nil {
+			return err
+		}
+		for _, previous := range pending {
+			previous.Set("revoked_at", now)
+			previous.Set("revoked_by", e.Auth.Id)
+			if err := txApp.Save(previous); err != nil {
+				return err
+			}
+		}
+		superseded = pending
+		return txApp.Save(invitation)
+	})
+	if err != nil {
+		return wrapTransactionError(err)
+	}
+
+	for _, previous := range superseded {
+		writeRoleLogEntry(app, data.Congregation, "", roleActionInvitationRevoked,
+			"", previous.GetString("role"), e.Auth.Id, previous.Id)
+	}
+	writeRoleLogEntry(app, data.Congregation, "", roleActionInvited, "", data.Role, e.Auth.Id, invitation.Id)
+
+	emailSent := true
+	if err := send(app, invitation, token); err != nil {
+		emailSent = false
+		sentry.CaptureException(err)
+		log.Printf("HandleCreateInvitation: could not email invitation %s: %v", invitation.Id, err)
+	}
+
+	return e.JSON(http.StatusCreated, map[string]any{
+		"id":         invitation.Id,
+		"email":      email,
+		"role":       data.Role,
+		"expires_at": invitation.GetDateTime("expires_at"),
+		"email_sent": emailSent,
+	})
+}
+
+// HandleRevokeInvitation withdraws a pending invitation so its link stops
+// working.
+func HandleRevokeInvitation(e *core.RequestEvent, app core.App) error {
+	data := RevokeInvitationRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Invitation == "" {
+		return apis.NewBadRequestError("invitation is required", nil)
+	}
+
+	invitation, err := app.FindRecordById("invitations", data.Invitation)
+	if err != nil {
+		return apis.NewNotFoundError("Invitation not found", nil)
+	}
+	congregation := invitation.GetString("congregation")
+	if !AuthorizeByRole(app, e.Auth.Id, congregation, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+	if status := invitationStatus(invitation, time.Now()); status != "pending" {
+		return apis.NewBadRequestError(fmt.Sprintf("Invitation is already %s", status), nil)
+	}
+
+	invitation.Set("revoked_at", time.Now().UTC())
+	invitation.Set("revoked_by", e.Auth.Id)
+	if err := app.Save(invitation); err != nil {
+		return newServerError(err)
+	}
+
+	writeRoleLogEntry(app, congregation, "", roleActionInvitationRevoked,
+		"", invitation.GetString("role"), e.Auth.Id, invitation.Id)
+
+	return e.JSON(http.StatusOK, map[string]any{"message": "Invitation revoked"})
+}
+
+// HandleListInvitations lists a congregation's invitations newest first with
+// their current status: pending, accepted, revoked or expired.
+func HandleListInvitations(e *core.RequestEvent, app core.App) error {
+	data := ListInvitationsRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" {
+		return apis.NewBadRequestError("congregation is required", nil)
+	}
+	if !AuthorizeByRole(app, e.Auth.Id, data.Congregation, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+
+	entries := []invitationEntry{}
+	err := app.DB().NewQuery(`
+		SELECT i.id, i.email, i.role,
+		       CASE
+		           WHEN COALESCE(i.accepted_at, '') != '' THEN 'accepted'
+		           WHEN COALESCE(i.revoked_at, '') != '' THEN 'revoked'
+		           WHEN i.expires_at <= {:now} THEN 'expired'
+		           ELSE 'pending'
+		       END AS status,
+		       COALESCE(u.name, '') AS invited_by, i.expires_at, i.created
+		FROM invitations i
+		LEFT JOIN users u ON u.id = i.invited_by
+		WHERE i.congregation = {:congregation}
+		ORDER BY i.created DESC
+	`).Bind(dbx.Params{
+		"congregation": data.Congregation,
+		"now":          time.Now().UTC().Format(types.DefaultDateLayout),
+	}).All(&entries)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusOK, entries)
+}
+
+// HandleAcceptInvitation grants the signed-in user the role named by an
+// invitation token. Holding the token proves the invitee received the email,
+// so the account's own address does not have to match the invited one.
+func HandleAcceptInvitation(e *core.RequestEvent, app core.App) error {
+	data := AcceptInvitationRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Token == "" {
+		return apis.NewBadRequestError("token is required", nil)
+	}
+
+	invitation, err := app.FindFirstRecordByData("invitations", "token_hash", hashInvitationToken(data.Token))
+	if err != nil {
+		return apis.NewNotFoundError("Invitation not found", nil)
+	}
+	if status := invitationStatus(invitation, time.Now()); status != "pending" {
+		return apis.NewBadRequestError(fmt.Sprintf("Invitation is %s", status), nil)
+	}
+
+	role, err := acceptInvitation(app, invitation, e.Auth.Id)
+	if err != nil {
+		return wrapTransactionError(err)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"congregation": invitation.GetString("congregation"),
+		"role":         role,
+	})
+}
+
+// AcceptPendingInvitations provisions a user from every pending invitation
+// sent to their email address. Only verified accounts qualify — Google OAuth
+// accounts are verified on creation, password signups once they confirm their
+// email — because matching on an unverified address would let anyone claim an
+// invitation by signing up with someone else's email.
+//
+// It is called on every successful authentication, so an invited user gets
+// their role the first time they sign in, whichever way they signed up.
+// Failures are reported, not returned: they must not block the login.
+func AcceptPendingInvitations(app core.App, user *core.Record) {
+	if !user.Verified() || user.Email() == "" {
+		return
+	}
+
+	pending, err := app.FindRecordsByFilter(
+		"invitations",
+		"email = {:email} && accepted_at = '' && revoked_at = '' && expires_at > {:now}",
+		"created", 0, 0,
+		dbx.Params{
+			"email": strings.ToLower(user.Email()),
+			"now":   time.Now().UTC().Format(types.DefaultDateLayout),
+		},
+	)
+	if err != nil {
+		sentry.CaptureException(err)
+		log.Printf("AcceptPendingInvitations: lookup failed for user %s: %v", user.Id, err)
+		return
+	}
+
+	for _, invitation := range pending {
+		if _, err := acceptInvitation(app, invitation, user.Id); err != nil {
+			sentry.CaptureException(err)
+			log.Printf("AcceptPendingInvitations: invitation %s for user %s: %v", invitation.Id, user.Id, err)
+		}
+	}
+}
+
+// acceptInvitation marks an invitation accepted by userId and grants its role,
+// returning the role the user now holds in the congregation. A user who
+// already has a role there keeps it.
+func acceptInvitation(app core.App, invitation *core.Record, userId string) (string, error) {
+	congregation := invitation.GetString("congregation")
+	var role string
+	var granted bool
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		// Re-read inside the transaction so two concurrent logins cannot both
+		// accept the same invitation.
+		fresh, err := txApp.FindRecordById("invitations", invitation.Id)
+		if err != nil {
+			return err
+		}
+		if status := invitationStatus(fresh, time.Now()); status != "pending" {
+			return apis.NewBadRequestError(fmt.Sprintf("Invitation is %s", status), nil)
+		}
+
+		role, granted, err = grantRoleIfMissing(txApp, userId, congregation, fresh.GetString("role"))
+		if err != nil {
+			return err
+		}
+
+		fresh.Set("accepted_at", time.Now().UTC())
+		fresh.Set("accepted_by", userId)
+		return txApp.Save(fresh)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if granted {
+		writeRoleLogEntry(app, congregation, userId, "granted", "", role,
+			invitation.GetString("invited_by"), invitation.Id)
+	}
+	return role, nil
+}
@@ -25,8 +25,22 @@ func LogRoleRevoked(e *core.RecordRequestEvent) {
 	writeRoleLog(e, "revoked", e.Record.GetString("role"), "")
 }
 
+// LogRoleExpired logs a role revoked by processRoleExpiry once its expires_at
+// passed. There is no acting user, so changed_by is left empty.
+func LogRoleExpired(app core.App, role *core.Record) {
+	writeRoleLogEntry(app, role.GetString("congregation"), role.GetString("user"),
+		"expired", role.GetString("role"), "", "", "")
+}
+
 func writeRoleLog(e *core.RecordRequestEvent, action, oldRole, newRole string) {
-	collection, err := e.App.FindCollectionByNameOrId("roles_log")
+	writeRoleLogEntry(e.App, e.Record.GetString("congregation"), e.Record.GetString("user"),
+		action, oldRole, newRole, authID(e.Auth), "")
+}
+
+// writeRoleLogEntry records a role event. invitation is set for events that
+// come from the invitation workflow and is empty otherwise.
+func writeRoleLogEntry(app core.App, congregation, user, action, oldRole, newRole, changedBy, invitation string) {
+	collection, err := app.FindCachedCollectionByNameOrId("roles_log")
 	if err != nil {
 		sentry.CaptureException(err)
 		log.Printf("Error finding roles_log collection: %v", err)
@@ -34,14 +48,15 @@ func writeRoleLog(e *core.RecordRequestEvent, action, oldRole, newRole string) {
 	}
 
 	logRecord := core.NewRecord(collection)
-	logRecord.Set("congregation", e.Record.Get("congregation"))
-	logRecord.Set("user", e.Record.Get("user"))
+	logRecord.Set("congregation", congregation)
+	logRecord.Set("user", user)
 	logRecord.Set("old_role", oldRole)
 	logRecord.Set("new_role", newRole)
 	logRecord.Set("action", action)
-	logRecord.Set("changed_by", authID(e.Auth))
+	logRecord.Set("changed_by", changedBy)
+	logRecord.Set("invitation", invitation)
 
-	if err := e.App.Save(logRecord); err != nil {
+	if err := app.Save(logRecord); err != nil {
 		sentry.CaptureException(err)
 		log.Printf("Error saving role log: %v", err)
 	}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Structural actions recorded in structure_log.
+const (
+	structureMapCreated       = "map_created"
+	structureMapMoved         = "map_moved"
+	structureMapsResequenced  = "maps_resequenced"
+	structureFloorAdded       = "floor_added"
+	structureFloorRemoved     = "floor_removed"
+	structureCodesAdded       = "codes_added"
+	structureCodeDeleted      = "code_deleted"
+	structureCodeRenamed      = "code_renamed"
+	structureCodesResequenced = "codes_resequenced"
+	structureTerritoryDeleted = "territory_deleted"
+	structureOptionsUpdated   = "options_updated"
+)
+
+// structureLogDefaultLimit and structureLogMaxLimit bound one page of
+// /structure/log.
+const (
+	structureLogDefaultLimit = 50
+	structureLogMaxLimit     = 500
+)
+
+// fromTo is the diff entry for a value that changed.
+func fromTo(from, to any) map[string]any {
+	return map[string]any{"from": from, "to": to}
+}
+
+// writeStructureLog records a structural edit. Like the other audit logs it is
+// written after the change commits and a failure is reported, not returned:
+// the edit has already happened and must not be reported as failed.
+func writeStructureLog(app core.App, congregation, action, targetType, target, changedBy string, diff map[string]any) {
+	collection, err := app.FindCachedCollectionByNameOrId("structure_log")
+	if err != nil {
+		sentry.CaptureException(err)
+		log.Printf("Error finding structure_log collection: %v", err)
+		return
+	}
+
+	logRecord := core.NewRecord(collection)
+	logRecord.Set("congregation", congregation)
+	logRecord.Set("action", action)
+	logRecord.Set("target_type", targetType)
+	logRecord.Set("target", target)
+	logRecord.Set("diff", diff)
+	logRecord.Set("changed_by", changedBy)
+
+	if err := app.Save(logRecord); err != nil {
+		sentry.CaptureException(err)
+		log.Printf("Error saving structure log: %v", err)
+	}
+}
+
+type StructureLogRequest struct {
+	Congregation string `json:"congregation"`
+	Target       string `json:"target"`
+	Action       string `json:"action"`
+	Before       string `json:"before"`
+	Limit        int    `json:"limit"`
+}
+
+type structureLogEntry struct {
+	Id         string        `db:"id"          json:"id"`
+	Action     string        `db:"action"      json:"action"`
+	TargetType string        `db:"target_type" json:"target_type"`
+	Target     string        `db:"target"      json:"target"`
+	Diff       types.JSONRaw `db:"diff"        json:"diff"`
+	ChangedBy  string        `db:"changed_by"  json:"changed_by"`
+	Created    string        `db:"created"     json:"created"`
+}
+
+// HandleStructureLog lists a congregation's structural audit entries newest
+// first, optionally narrowed to one target (map, territory or the
+// congregation itself) or action. before takes the created timestamp of the
+// last entry already seen, for paging back through history.
+func HandleStructureLog(e *core.RequestEvent, app core.App) error {
+	data := StructureLogRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" {
+		return apis.NewBadRequestError("congregation is required", nil)
+	}
+	if !AuthorizeByRole(app, e.Auth.Id, data.Congregation, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+
+	limit := data.Limit
+	if limit <= 0 {
+		limit = structureLogDefaultLimit
+	}
+	if limit > structureLogMaxLimit {
+		limit = structureLogMaxLimit
+	}
+
+	filter := "l.congregation = {:congregation}"
+	params := dbx.Params{"congregation": data.Congregation, "limit": limit}
+	if data.Target != "" {
+		filter += " AND l.target = {:target}"
+		params["target"] = data.Target
+	}
+	if data.Action != "" {
+		filter += " AND l.action = {:action}"
+		params["action"] = data.Action
+	}
+	if data.Before != "" {
+		filter += " AND l.created < {:before}"
+		params["before"] = data.Before
+	}
+
+	entries := []structureLogEntry{}
+	err := app.DB().NewQuery(`
+		SELECT l.id, l.action, l.target_type, l.target, l.diff,
+		       COALESCE(u.name, '') AS changed_by, l.created
+		FROM structure_log l
+		LEFT JOIN users u ON u.id = l.changed_by
+		WHERE ` + filter + `
+		ORDER BY l.created DESC
+		LIMIT {:limit}
+	`).Bind(params).All(&entries)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusOK, entries)
+}
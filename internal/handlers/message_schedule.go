@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// messageScheduled reports whether message is waiting for its publish_at
+// and has not been published by processMessageSchedule yet.
+func messageScheduled(message *core.Record) bool {
+	return !message.GetDateTime("publish_at").IsZero() && message.GetDateTime("published_at").IsZero()
+}
+
+// messageHiddenFromRequest reports whether c must not see message: link-id
+// publishers only see scheduled messages once they are published, matching
+// the messages list rule.
+func messageHiddenFromRequest(c *core.RequestEvent, message *core.Record) bool {
+	return c.Request.Header.Get("link-id") != "" && messageScheduled(message)
+}
+
+// ValidateMessageSchedule limits publish_at and pin_until to administrator
+// root messages, and requires a pin to outlast the scheduled publish. It
+// should be called from OnRecordValidate("messages").
+func ValidateMessageSchedule(e *core.RecordEvent) error {
+	publishAt := e.Record.GetDateTime("publish_at")
+	pinUntil := e.Record.GetDateTime("pin_until")
+	if publishAt.IsZero() && pinUntil.IsZero() {
+		return e.Next()
+	}
+	if e.Record.GetString("type") != "administrator" || e.Record.GetString("parent") != "" {
+		return apis.NewBadRequestError("Only administrator messages can be scheduled or pinned until a date", nil)
+	}
+	if !publishAt.IsZero() && !pinUntil.IsZero() && !pinUntil.After(publishAt) {
+		return apis.NewBadRequestError("pin_until must be after publish_at", nil)
+	}
+	return e.Next()
+}
+
+// ResetMessageSchedule clears published_at when publish_at moves, so the
+// message is held back and published again at the new time, and drops a
+// lapsed pin_until when a message is pinned again so the job does not
+// immediately unpin it. It should be called from OnRecordUpdate("messages").
+func ResetMessageSchedule(e *core.RecordEvent) {
+	original := e.Record.Original()
+	if !e.Record.GetDateTime("publish_at").Equal(original.GetDateTime("publish_at")) {
+		e.Record.Set("published_at", nil)
+	}
+	pinUntil := e.Record.GetDateTime("pin_until")
+	if e.Record.GetBool("pinned") && !original.GetBool("pinned") &&
+		pinUntil.Equal(original.GetDateTime("pin_until")) &&
+		!pinUntil.IsZero() && !pinUntil.Time().After(time.Now()) {
+		e.Record.Set("pin_until", nil)
+	}
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type ReplyMessageRequest struct {
+	Message string `json:"message"`
+	Text    string `json:"text"`
+}
+
+type MessageThreadRequest struct {
+	Message string `json:"message"`
+}
+
+type messageReceipt struct {
+	Reader string `db:"reader"  json:"reader"`
+	ReadAt string `db:"read_at" json:"read_at"`
+}
+
+type threadEntry struct {
+	Id        string           `db:"id"         json:"id"`
+	Message   string           `db:"message"    json:"message"`
+	CreatedBy string           `db:"created_by" json:"created_by"`
+	Type      string           `db:"type"       json:"type"`
+	Created   string           `db:"created"    json:"created"`
+	ReadBy    []messageReceipt `db:"-"          json:"read_by"`
+}
+
+// messageReader identifies who read a message: a signed-in user, or the
+// assignment behind a publisher's link-id.
+type messageReader struct {
+	User       string
+	Assignment string
+}
+
+// requestMessageReader returns the reader behind c, following the same
+// precedence as AuthorizeMapAccess: a link-id header wins over a token.
+// Superusers have no reader identity.
+func requestMessageReader(c *core.RequestEvent) (messageReader, bool) {
+	if linkId := c.Request.Header.Get("link-id"); linkId != "" {
+		return messageReader{Assignment: linkId}, true
+	}
+	if c.Auth != nil && c.Auth.Collection().Name == "users" {
+		return messageReader{User: c.Auth.Id}, true
+	}
+	return messageReader{}, false
+}
+
+// findThreadRoot loads the root of the thread messageId belongs to.
+func findThreadRoot(app core.App, messageId string) (*core.Record, error) {
+	message, err := app.FindRecordById("messages", messageId)
+	if err != nil {
+		return nil, err
+	}
+	if parent := message.GetString("parent"); parent != "" {
+		return app.FindRecordById("messages", parent)
+	}
+	return message, nil
+}
+
+// messageTypeForRequest returns the messages.type of a post made by c on
+// mapId: publisher for link-id access, otherwise the author's highest role
+// covering the map.
+func messageTypeForRequest(c *core.RequestEvent, app core.App, mapId string) string {
+	if c.Request.Header.Get("link-id") != "" || c.Auth == nil {
+		return "publisher"
+	}
+	if c.HasSuperuserAuth() || AuthorizeMapByRole(app, c.Auth.Id, mapId, "administrator") {
+		return "administrator"
+	}
+	if AuthorizeMapByRole(app, c.Auth.Id, mapId, "conductor") {
+		return "conductor"
+	}
+	return "publisher"
+}
+
+// HandleReplyMessage adds a reply to a message's thread. Replies to a reply
+// join the same thread, and a reply reopens a resolved thread (see
+// ReopenMessageThread). Open to link-id publishers and any role covering the
+// map; the reply's type follows the author's role, so administrators' replies
+// stay out of the messages digest.
+func HandleReplyMessage(c *core.RequestEvent, app core.App) error {
+	data := ReplyMessageRequest{}
+	if err := c.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	text := strings.TrimSpace(data.Text)
+	if data.Message == "" || text == "" {
+		return apis.NewBadRequestError("message and text are required", nil)
+	}
+
+	root, err := findThreadRoot(app, data.Message)
+	if err != nil || messageHiddenFromRequest(c, root) {
+		return apis.NewNotFoundError("Message not found", nil)
+	}
+	mapId := root.GetString("map")
+	if !AuthorizeMapAccess(c, app, mapId) {
+		return apis.NewForbiddenError("Unauthorized", nil)
+	}
+
+	collection, err := app.FindCachedCollectionByNameOrId("messages")
+	if err != nil {
+		return newServerError(err)
+	}
+	reply := core.NewRecord(collection)
+	reply.Set("parent", root.Id)
+	reply.Set("congregation", root.GetString("congregation"))
+	reply.Set("map", mapId)
+	reply.Set("message", text)
+	reply.Set("created_by", resolveActor(c, app))
+	reply.Set("type", messageTypeForRequest(c, app, mapId))
+	if err := app.Save(reply); err != nil {
+		return newServerError(err)
+	}
+
+	// The author has read their own reply.
+	if reader, ok := requestMessageReader(c); ok {
+		if _, err := markMessagesRead(app, reader, []string{reply.Id}); err != nil {
+			return newServerError(err)
+		}
+	}
+
+	return c.JSON(http.StatusCreated, map[string]any{
+		"id":     reply.Id,
+		"parent": root.Id,
+		"type":   reply.GetString("type"),
+	})
+}
+
+// HandleMarkThreadRead records that the caller read every message of a
+// thread. Receipts are per reader and written once; marking again only adds
+// receipts for replies posted since.
+func HandleMarkThreadRead(c *core.RequestEvent, app core.App) error {
+	data := MessageThreadRequest{}
+	if err := c.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Message == "" {
+		return apis.NewBadRequestError("message is required", nil)
+	}
+	root, err := findThreadRoot(app, data.Message)
+	if err != nil || messageHiddenFromRequest(c, root) {
+		return apis.NewNotFoundError("Message not found", nil)
+	}
+	if !AuthorizeMapAccess(c, app, root.GetString("map")) {
+		return apis.NewForbiddenError("Unauthorized", nil)
+	}
+	reader, ok := requestMessageReader(c)
+	if !ok {
+		return apis.NewBadRequestError("Only users and link-id publishers have read receipts", nil)
+	}
+
+	var ids []string
+	if err := app.DB().NewQuery("SELECT id FROM messages WHERE id = {:root} OR parent = {:root}").
+		Bind(dbx.Params{"root": root.Id}).Column(&ids); err != nil {
+		return newServerError(err)
+	}
+	marked, err := markMessagesRead(app, reader, ids)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"marked": marked})
+}
+
+// markMessagesRead writes a receipt for reader on each message it has not
+// read yet, returning how many were written.
+func markMessagesRead(app core.App, reader messageReader, messageIds []string) (int, error) {
+	if len(messageIds) == 0 {
+		return 0, nil
+	}
+	collection, err := app.FindCachedCollectionByNameOrId("message_reads")
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]any, len(messageIds))
+	for i, id := range messageIds {
+		ids[i] = id
+	}
+	var alreadyRead []string
+	err = app.DB().Select("message").From("message_reads").
+		Where(dbx.In("message", ids...)).
+		AndWhere(dbx.HashExp{"user": reader.User, "assignment": reader.Assignment}).
+		Column(&alreadyRead)
+	if err != nil {
+		return 0, err
+	}
+	skip := toSet(alreadyRead)
+
+	marked := 0
+	now := time.Now().UTC()
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, id := range messageIds {
+			if skip[id] {
+				continue
+			}
+			receipt := core.NewRecord(collection)
+			receipt.Set("message", id)
+			receipt.Set("user", reader.User)
+			receipt.Set("assignment", reader.Assignment)
+			receipt.Set("read_at", now)
+			if err := txApp.Save(receipt); err != nil {
+				return err
+			}
+			marked++
+		}
+		return nil
+	})
+	return marked, err
+}
+
+// HandleGetThread returns a thread's root message and its replies, oldest
+// first, each with who has read it and when.
+func HandleGetThread(c *core.RequestEvent, app core.App) error {
+	data := MessageThreadRequest{}
+	if err := c.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Message == "" {
+		return apis.NewBadRequestError("message is required", nil)
+	}
+	root, err := findThreadRoot(app, data.Message)
+	if err != nil || messageHiddenFromRequest(c, root) {
+		return apis.NewNotFoundError("Message not found", nil)
+	}
+	if !AuthorizeMapAccess(c, app, root.GetString("map")) {
+		return apis.NewForbiddenError("Unauthorized", nil)
+	}
+
+	entries := []threadEntry{}
+	err = app.DB().NewQuery(`
+		SELECT id, COALESCE(message, '') AS message, COALESCE(created_by, '') AS created_by,
+		       COALESCE(type, '') AS type, created
+		FROM messages
+		WHERE id = {:root} OR parent = {:root}
+		ORDER BY created, id
+	`).Bind(dbx.Params{"root": root.Id}).All(&entries)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	var receipts []struct {
+		Message string `db:"message"`
+		messageReceipt
+	}
+	err = app.DB().NewQuery(`
+		SELECT r.message, COALESCE(u.name, a.publisher, '') AS reader, r.read_at
+		FROM message_reads r
+		JOIN messages m ON m.id = r.message
+		LEFT JOIN users u ON u.id = r.user
+		LEFT JOIN assignments a ON a.id = r.assignment
+		WHERE m.id = {:root} OR m.parent = {:root}
+		ORDER BY r.read_at
+	`).Bind(dbx.Params{"root": root.Id}).All(&receipts)
+	if err != nil {
+		return newServerError(err)
+	}
+	byMessage := map[string][]messageReceipt{}
+	for _, r := range receipts {
+		byMessage[r.Message] = append(byMessage[r.Message], r.messageReceipt)
+	}
+	for i := range entries {
+		entries[i].ReadBy = byMessage[entries[i].Id]
+		if entries[i].ReadBy == nil {
+			entries[i].ReadBy = []messageReceipt{}
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"id":          root.Id,
+		"resolved_at": root.GetDateTime("resolved_at"),
+		"messages":    entries,
+	})
+}
+
+// HandleResolveThread marks a thread resolved so its messages leave the
+// messages digest. Requires a superuser or an administrator covering the
+// thread's map.
+func HandleResolveThread(e *core.RequestEvent, app core.App) error {
+	data := MessageThreadRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Message == "" {
+		return apis.NewBadRequestError("message is required", nil)
+	}
+	root, err := findThreadRoot(app, data.Message)
+	if err != nil {
+		return apis.NewNotFoundError("Message not found", nil)
+	}
+	if !e.HasSuperuserAuth() && !AuthorizeMapByRole(app, e.Auth.Id, root.GetString("map"), "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+	if !root.GetDateTime("resolved_at").IsZero() {
+		return apis.NewBadRequestError("Thread is already resolved", nil)
+	}
+
+	root.Set("resolved_at", time.Now().UTC())
+	root.Set("resolved_by", authID(e.Auth))
+	if err := app.Save(root); err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"id":          root.Id,
+		"resolved_at": root.GetDateTime("resolved_at"),
+	})
+}
+
+// ValidateMessageParent keeps threads one level deep and on one map: a
+// reply's parent must be a root message on the same map. It should be
+// called from OnRecordValidate("messages").
+func ValidateMessageParent(e *core.RecordEvent) error {
+	parentId := e.Record.GetString("parent")
+	if parentId == "" {
+		return e.Next()
+	}
+	if parentId == e.Record.Id {
+		return apis.NewBadRequestError("A message cannot reply to itself", nil)
+	}
+	parent, err := e.App.FindRecordById("messages", parentId)
+	if err != nil {
+		return apis.NewBadRequestError("Parent message not found", nil)
+	}
+	if parent.GetString("parent") != "" {
+		return apis.NewBadRequestError("Replies must point at the root message of the thread", nil)
+	}
+	if parent.GetString("map") != e.Record.GetString("map") {
+		return apis.NewBadRequestError("A reply must be on the same map as its thread", nil)
+	}
+	return e.Next()
+}
+
+// ReopenMessageThread clears the resolution of the thread a new reply was
+// posted to, so the reply reaches the next messages digest. It should be
+// called from OnRecordAfterCreateSuccess("messages").
+func ReopenMessageThread(e *core.RecordEvent) {
+	parentId := e.Record.GetString("parent")
+	if parentId == "" {
+		return
+	}
+	parent, err := e.App.FindRecordById("messages", parentId)
+	if err != nil || parent.GetDateTime("resolved_at").IsZero() {
+		return
+	}
+	parent.Set("resolved_at", nil)
+	parent.Set("resolved_by", nil)
+	if err := e.App.Save(parent); err != nil {
+		log.Printf("ReopenMessageThread: could not reopen message %s: %v", parentId, err)
+	}
+}
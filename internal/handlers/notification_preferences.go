@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// NotificationKinds are the digest emails a user can mute or batch.
+var NotificationKinds = []string{"messages", "instructions", "notes", "new_addresses", "access_requests", "auto_reset", "role_expiry"}
+
+// Delivery frequencies for the digests a user has not muted.
+const (
+	NotificationImmediate = "immediate"
+	NotificationDaily     = "daily"
+	NotificationWeekly    = "weekly"
+)
+
+const unsubscribeTokenLength = 40
+
+type NotificationPreferencesRequest struct {
+	Congregation string `json:"congregation"`
+}
+
+type UpdateNotificationPreferencesRequest struct {
+	Congregation string   `json:"congregation"`
+	Muted        []string `json:"muted"`
+	Frequency    string   `json:"frequency"`
+	QuietStart   string   `json:"quiet_start"`
+	QuietEnd     string   `json:"quiet_end"`
+}
+
+type UnsubscribeRequest struct {
+	Token string `json:"token"`
+	Kind  string `json:"kind"`
+}
+
+// EnsureNotificationPreference returns userId's notification preferences in
+// congregationId, creating the default row (every digest, immediately) with
+// a fresh unsubscribe token if there is none yet.
+func EnsureNotificationPreference(app core.App, userId, congregationId string) (*core.Record, error) {
+	existing, err := app.FindFirstRecordByFilter("notification_preferences",
+		"user = {:user} && congregation = {:congregation}",
+		dbx.Params{"user": userId, "congregation": congregationId})
+	if err == nil {
+		return existing, nil
+	}
+
+	collection, err := app.FindCachedCollectionByNameOrId("notification_preferences")
+	if err != nil {
+		return nil, err
+	}
+	record := core.NewRecord(collection)
+	record.Set("user", userId)
+	record.Set("congregation", congregationId)
+	record.Set("frequency", NotificationImmediate)
+	record.Set("unsubscribe_token", security.RandomString(unsubscribeTokenLength))
+	if err := app.Save(record); err != nil {
+		// Lost a race with another request creating the same row.
+		if existing, findErr := app.FindFirstRecordByFilter("notification_preferences",
+			"user = {:user} && congregation = {:congregation}",
+			dbx.Params{"user": userId, "congregation": congregationId}); findErr == nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+func notificationPreferenceResponse(congregationId string, record *core.Record) map[string]any {
+	response := map[string]any{
+		"congregation": congregationId,
+		"kinds":        NotificationKinds,
+		"muted":        []string{},
+		"frequency":    NotificationImmediate,
+		"quiet_start":  "",
+		"quiet_end":    "",
+	}
+	if record != nil {
+		response["muted"] = record.GetStringSlice("muted")
+		if frequency := record.GetString("frequency"); frequency != "" {
+			response["frequency"] = frequency
+		}
+		response["quiet_start"] = record.GetString("quiet_start")
+		response["quiet_end"] = record.GetString("quiet_end")
+	}
+	return response
+}
+
+// HandleGetNotificationPreferences returns the caller's notification
+// preferences in a congregation they hold a role in, or the defaults if they
+// never changed them.
+func HandleGetNotificationPreferences(e *core.RequestEvent, app core.App) error {
+	data := NotificationPreferencesRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" {
+		return apis.NewBadRequestError("congregation is required", nil)
+	}
+	if !AuthorizeByRole(app, e.Auth.Id, data.Congregation) {
+		return apis.NewForbiddenError("Unauthorized", nil)
+	}
+
+	record, err := app.FindFirstRecordByFilter("notification_preferences",
+		"user = {:user} && congregation = {:congregation}",
+		dbx.Params{"user": e.Auth.Id, "congregation": data.Congregation})
+	if err != nil {
+		record = nil
+	}
+
+	return e.JSON(http.StatusOK, notificationPreferenceResponse(data.Congregation, record))
+}
+
+// HandleUpdateNotificationPreferences replaces the caller's notification
+// preferences in a congregation they hold a role in. Quiet hours are both
+// set or both empty; they may span midnight (22:00 to 07:00).
+func HandleUpdateNotificationPreferences(e *core.RequestEvent, app core.App) error {
+	data := UpdateNotificationPreferencesRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" {
+		return apis.NewBadRequestError("congregation is required", nil)
+	}
+	for _, kind := range data.Muted {
+		if !slices.Contains(NotificationKinds, kind) {
+			return apis.NewBadRequestError("Unknown notification kind: "+kind, nil)
+		}
+	}
+	if data.Frequency == "" {
+		data.Frequency = NotificationImmediate
+	}
+	if data.Frequency != NotificationImmediate && data.Frequency != NotificationDaily && data.Frequency != NotificationWeekly {
+		return apis.NewBadRequestError("frequency must be immediate, daily or weekly", nil)
+	}
+	if (data.QuietStart == "") != (data.QuietEnd == "") {
+		return apis.NewBadRequestError("quiet_start and quiet_end must be set together", nil)
+	}
+	if data.QuietStart != "" {
+		if _, err := time.Parse("15:04", data.QuietStart); err != nil || len(data.QuietStart) != 5 {
+			return apis.NewBadRequestError("quiet_start must be HH:MM", nil)
+		}
+		if _, err := time.Parse("15:04", data.QuietEnd); err != nil || len(data.QuietEnd) != 5 {
+			return apis.NewBadRequestError("quiet_end must be HH:MM", nil)
+		}
+		if data.QuietStart == data.QuietEnd {
+			return apis.NewBadRequestError("quiet_start and quiet_end must differ", nil)
+		}
+	}
+	if !AuthorizeByRole(app, e.Auth.Id, data.Congregation) {
+		return apis.NewForbiddenError("Unauthorized", nil)
+	}
+
+	record, err := EnsureNotificationPreference(app, e.Auth.Id, data.Congregation)
+	if err != nil {
+		return newServerError(err)
+	}
+	record.Set("muted", data.Muted)
+	record.Set("frequency", data.Frequency)
+	record.Set("quiet_start", data.QuietStart)
+	record.Set("quiet_end", data.QuietEnd)
+	if err := app.Save(record); err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusOK, notificationPreferenceResponse(data.Congregation, record))
+}
+
+// HandleUnsubscribe mutes one digest kind, or every kind if none is given,
+// for the preferences identified by an unsubscribe token from a digest
+// email. It needs no sign-in: the token is the credential.
+func HandleUnsubscribe(e *core.RequestEvent, app core.App) error {
+	data := UnsubscribeRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Token == "" {
+		return apis.NewBadRequestError("token is required", nil)
+	}
+	if data.Kind != "" && !slices.Contains(NotificationKinds, data.Kind) {
+		return apis.NewBadRequestError("Unknown notification kind: "+data.Kind, nil)
+	}
+
+	record, err := app.FindFirstRecordByData("notification_preferences", "unsubscribe_token", data.Token)
+	if err != nil {
+		return apis.NewNotFoundError("Unsubscribe link not recognised", nil)
+	}
+
+	muted := record.GetStringSlice("muted")
+	if data.Kind == "" {
+		muted = NotificationKinds
+	} else if !slices.Contains(muted, data.Kind) {
+		muted = append(muted, data.Kind)
+	}
+	record.Set("muted", muted)
+	if err := app.Save(record); err != nil {
+		return newServerError(err)
+	}
+
+	congregationName := ""
+	if congregation, err := app.FindRecordById("congregations", record.GetString("congregation")); err == nil {
+		congregationName = congregation.GetString("name")
+	}
+	return e.JSON(http.StatusOK, map[string]any{
+		"congregation_name": congregationName,
+		"muted":             record.GetStringSlice("muted"),
+	})
+}
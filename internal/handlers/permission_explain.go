@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type PermissionExplainRequest struct {
+	User       string `json:"user"`
+	LinkId     string `json:"link_id"`
+	Collection string `json:"collection"`
+	Record     string `json:"record"`
+	Action     string `json:"action"`
+	Filter     string `json:"filter"`
+}
+
+// PermissionCheck is one step evaluated by HandlePermissionExplain.
+type PermissionCheck struct {
+	Check  string `json:"check"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// explainTarget is the record being explained and the congregation,
+// territory and map its access is decided by.
+type explainTarget struct {
+	Collection   string `json:"collection"`
+	Id           string `json:"id"`
+	Congregation string `json:"congregation"`
+	Territory    string `json:"territory"`
+	Map          string `json:"map"`
+}
+
+// explainableCollections lists the collections HandlePermissionExplain
+// understands, each with how its access is scoped.
+var explainableCollections = map[string]string{
+	"congregations":   "congregation",
+	"territories":     "territory",
+	"maps":            "map",
+	"addresses":       "map",
+	"address_options": "map",
+	"messages":        "map",
+	"assignments":     "map",
+}
+
+// HandlePermissionExplain reports, check by check, why a user or link-id can
+// or cannot view or edit a record, for troubleshooting "I can't see map X".
+// Each check runs the same access rule the record's API hooks and custom
+// routes use, so the decision matches what the subject would get.
+//
+// A filter, when given for a map-scoped collection (messages, addresses,
+// address_options), is also checked the way list and realtime requests are.
+//
+// Available to superusers and to administrators of the record's congregation.
+// Administrators can only explain users with a role in that congregation and
+// links it issued, so they cannot probe accounts elsewhere.
+func HandlePermissionExplain(e *core.RequestEvent, app core.App) error {
+	data := PermissionExplainRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Collection == "" || data.Record == "" {
+		return apis.NewBadRequestError("collection and record are required", nil)
+	}
+	if (data.User == "") == (data.LinkId == "") {
+		return apis.NewBadRequestError("Exactly one of user or link_id is required", nil)
+	}
+	if data.Action == "" {
+		data.Action = "view"
+	}
+	if data.Action != "view" && data.Action != "edit" {
+		return apis.NewBadRequestError("action must be view or edit", nil)
+	}
+	if _, ok := explainableCollections[data.Collection]; !ok {
+		return apis.NewBadRequestError("collection is not supported", nil)
+	}
+
+	target, err := resolveExplainTarget(app, data.Collection, data.Record)
+	if err != nil {
+		return apis.NewNotFoundError("Record not found", nil)
+	}
+	if !e.HasSuperuserAuth() && !AuthorizeByRole(app, e.Auth.Id, target.Congregation, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+	if !e.HasSuperuserAuth() && !subjectInCongregation(app, data, target.Congregation) {
+		return apis.NewNotFoundError("Subject not found in this congregation", nil)
+	}
+
+	checks := []PermissionCheck{{
+		Check:  "target",
+		Passed: true,
+		Detail: describeExplainTarget(target),
+	}}
+	if data.LinkId != "" {
+		checks = append(checks, explainLink(app, data.LinkId, target, data.Action)...)
+	} else {
+		checks = append(checks, explainUser(app, data.User, target, data.Action)...)
+	}
+	if data.Filter != "" {
+		checks = append(checks, explainFilter(app, data, target))
+	}
+
+	decision, reason := "allow", ""
+	for _, c := range checks {
+		if !c.Passed {
+			decision, reason = "deny", c.Detail
+			break
+		}
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"target":   target,
+		"action":   data.Action,
+		"checks":   checks,
+		"decision": decision,
+		"reason":   reason,
+	})
+}
+
+// subjectInCongregation reports whether the user holds a role in the
+// congregation, or the link was issued by it. Expired links still count so
+// their expiry can be explained.
+func subjectInCongregation(app core.App, data PermissionExplainRequest, congregation string) bool {
+	if data.LinkId != "" {
+		assignment, err := app.FindRecordById("assignments", data.LinkId)
+		return err == nil && assignment.GetString("congregation") == congregation
+	}
+	return AuthorizeByRole(app, data.User, congregation)
+}
+
+func resolveExplainTarget(app core.App, collection, id string) (explainTarget, error) {
+	t := explainTarget{Collection: collection, Id: id}
+	record, err := app.FindRecordById(collection, id)
+	if err != nil {
+		return t, err
+	}
+
+	switch explainableCollections[collection] {
+	case "congregation":
+		t.Congregation = record.Id
+	case "territory":
+		t.Congregation = record.GetString("congregation")
+		t.Territory = record.Id
+	case "map":
+		t.Map = record.Id
+		if collection != "maps" {
+			t.Map = record.GetString("map")
+		}
+		m, err := fetchMapData(app, t.Map)
+		if err != nil {
+			return t, err
+		}
+		t.Congregation = m.GetString("congregation")
+		t.Territory = m.GetString("territory")
+	}
+	return t, nil
+}
+
+func describeExplainTarget(t explainTarget) string {
+	parts := []string{fmt.Sprintf("%s %s", t.Collection, t.Id)}
+	if t.Map != "" && t.Map != t.Id {
+		parts = append(parts, "on map "+t.Map)
+	}
+	if t.Territory != "" && t.Territory != t.Id {
+		parts = append(parts, "in territory "+t.Territory)
+	}
+	if t.Congregation != t.Id {
+		parts = append(parts, "of congregation "+t.Congregation)
+	}
+	return strings.Join(parts, " ")
+}
+
+// explainUser evaluates the role path taken when a request carries no link-id.
+func explainUser(app core.App, userId string, t explainTarget, action string) []PermissionCheck {
+	checks := []PermissionCheck{}
+
+	user, err := app.FindRecordById("users", userId)
+	switch {
+	case err != nil:
+		return append(checks, PermissionCheck{"account", false, "User not found"})
+	case user.GetBool("disabled"):
+		checks = append(checks, PermissionCheck{"account", false, "Account is disabled and cannot sign in"})
+	default:
+		checks = append(checks, PermissionCheck{"account", true, "Account is enabled"})
+	}
+
+	var roles []struct {
+		Role        string `db:"role"`
+		Territories string `db:"territories"`
+	}
+	err = app.DB().NewQuery(`
+		SELECT role, COALESCE(territories, '') AS territories FROM roles
+		WHERE user = {:user} AND congregation = {:congregation}
+	`).Bind(dbx.Params{"user": userId, "congregation": t.Congregation}).All(&roles)
+	lookup := PermissionCheck{Check: "role_lookup"}
+	switch {
+	case err != nil:
+		lookup.Detail = "Role lookup failed: " + err.Error()
+	case len(roles) == 0:
+		lookup.Detail = "No role in congregation " + t.Congregation
+	default:
+		lookup.Passed = true
+		descriptions := make([]string, len(roles))
+		for i, r := range roles {
+			descriptions[i] = r.Role
+			if r.Territories != "" && r.Territories != "[]" {
+				descriptions[i] += " scoped to territories " + r.Territories
+			}
+		}
+		lookup.Detail = "Holds " + strings.Join(descriptions, ", ")
+	}
+	checks = append(checks, lookup)
+
+	member := AuthorizeByRole(app, userId, t.Congregation)
+	match := PermissionCheck{"congregation_match", member, "Member of congregation " + t.Congregation}
+	if !member {
+		match.Detail = "Not a member of congregation " + t.Congregation
+	}
+	checks = append(checks, match)
+
+	rule := explainRule(t, action)
+	passed, requirement := rule.Role(app, userId, t.scope()), rule.RoleNeeds
+	coverage := PermissionCheck{"role_coverage", passed, "Satisfies: " + requirement}
+	if !passed {
+		coverage.Detail = "Requires " + requirement
+	}
+	return append(checks, coverage)
+}
+
+// explainRule returns the rule the API hooks or custom routes apply to
+// action on t.
+func explainRule(t explainTarget, action string) accessRule {
+	if action == "edit" {
+		return editRules[t.Collection]
+	}
+	return viewRules[t.Collection]
+}
+
+func (t explainTarget) scope() accessScope {
+	return accessScope{Record: t.Id, Congregation: t.Congregation, Territory: t.Territory, Map: t.Map}
+}
+
+// explainLink evaluates the link-id path, which takes precedence over any
+// role whenever a request carries a link-id header.
+func explainLink(app core.App, linkId string, t explainTarget, action string) []PermissionCheck {
+	checks := []PermissionCheck{}
+
+	assignment, err := app.FindRecordById("assignments", linkId)
+	if err != nil {
+		return append(checks, PermissionCheck{"link_lookup", false, "No assignment with this link-id"})
+	}
+	expiry := assignment.GetDateTime("expiry_date").Time()
+	lookup := PermissionCheck{"link_lookup", true, fmt.Sprintf("Assignment for map %s, expires %s", assignment.GetString("map"), expiry.Format(time.RFC3339))}
+	checks = append(checks, lookup)
+	if !expiry.After(time.Now()) {
+		checks = append(checks, PermissionCheck{"link_expiry", false, "Link expired at " + expiry.Format(time.RFC3339)})
+	} else {
+		checks = append(checks, PermissionCheck{"link_expiry", true, "Link has not expired"})
+	}
+
+	rule := explainRule(t, action)
+	passed, requirement := rule.Link != nil && rule.Link(app, linkId, t.scope()), rule.LinkNeeds
+	grant := PermissionCheck{"link_coverage", passed, "Satisfies: " + requirement}
+	if !passed {
+		grant.Detail = "Requires " + requirement
+	}
+	return append(checks, grant)
+}
+
+// explainFilter checks a list or realtime filter the way linkMapListAuth and
+// validateSubscription do: every map it names must be authorized, and it
+// must not reach records outside the subject's maps.
+func explainFilter(app core.App, data PermissionExplainRequest, t explainTarget) PermissionCheck {
+	check := PermissionCheck{Check: "filter_scope"}
+	if !protectedCollections[t.Collection] {
+		check.Passed = true
+		check.Detail = "Filter scope is not enforced on " + t.Collection
+		return check
+	}
+
+	var auth *core.Record
+	if data.User != "" {
+		user, err := app.FindRecordById("users", data.User)
+		if err != nil {
+			check.Detail = "User not found"
+			return check
+		}
+		auth = user
+	}
+	if !authorizeMapSubscription(app, auth, data.LinkId, data.Filter) {
+		check.Detail = "Filter must name map = '<id>' for maps the subject may access (a single map for a link-id)"
+		return check
+	}
+	allowed, err := resolveMapScopeIDs(app, auth, data.LinkId)
+	if err != nil {
+		check.Detail = "Subject has no accessible maps"
+		return check
+	}
+	if filterEscapesMapScope(app, t.Collection, data.Filter, allowed) {
+		check.Detail = "Filter could match records on maps outside the subject's scope"
+		return check
+	}
+	check.Passed = true
+	check.Detail = "Filter stays within the subject's maps"
+	return check
+}
@@ -0,0 +1,552 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// roleActionErased is recorded in roles_log, without a user, for each
+// congregation an erased account belonged to.
+const roleActionErased = "erased"
+
+// personalDataSource describes where a collection attributes records to a
+// user. ByUser is a filter on the user's id or email. NameFields are free-text
+// fields holding a display name, and NamedBy is the filter, by id, for the
+// records whose NameFields name this user. Names are not unique, so a record
+// that carries the user's name without such a link is only a possible match
+// (see personalDataMatch).
+type personalDataSource struct {
+	Collection string
+	ByUser     string
+	NameFields []string
+	NamedBy    string
+}
+
+// personalDataSources lists everything attributable to a user. The export
+// bundles every ByUser record. Erasure pseudonymises NameFields on NamedBy
+// records and on the possible matches the confirming administrator picks, and
+// leaves ByUser relations to be unlinked by the account deletion.
+var personalDataSources = []personalDataSource{
+	{"roles", "user = {:user}", nil, ""},
+	{"roles_log", "user = {:user} || changed_by = {:user}", nil, ""},
+	{"access_requests", "user = {:user}", nil, ""},
+	{"erasure_requests", "user = {:user}", nil, ""},
+	{"invitations", "email = {:email} || invited_by = {:user} || accepted_by = {:user} || revoked_by = {:user}", nil, ""},
+	{"assignments", "user = {:user}", []string{"publisher"}, "user = {:user}"},
+	{"assignments_log", "user = {:user} || changed_by = {:user}", []string{"publisher"}, "user = {:user}"},
+	{"messages", "", []string{"created_by"}, ""},
+	{"message_reads", "user = {:user}", nil, ""},
+	{"change_requests", "decided_by = {:user} || requested_by_user = {:user} || assignment.user = {:user}", []string{"requested_by"}, "requested_by_user = {:user} || assignment.user = {:user}"},
+	{"broadcasts", "created_by = {:user}", []string{"sender"}, "created_by = {:user}"},
+	{"broadcast_receipts", "assignment.user = {:user}", []string{"publisher"}, "assignment.user = {:user}"},
+	{"addresses", "", []string{"created_by", "updated_by", "last_notes_updated_by"}, ""},
+	{"addresses_log", "", []string{"changed_by"}, ""},
+	{"structure_log", "changed_by = {:user}", nil, ""},
+	{"reset_snapshots", "created_by = {:user} || restored_by = {:user}", nil, ""},
+	{"notification_preferences", "user = {:user}", nil, ""},
+	{"push_subscriptions", "user = {:user}", nil, ""},
+}
+
+// personalDataMatch is a record carrying the user's display name in Fields,
+// within one of their congregations, with nothing tying it to the user by id.
+// It may belong to someone else of the same name, so it is reported without
+// its contents.
+type personalDataMatch struct {
+	Collection   string   `json:"collection"`
+	Id           string   `json:"id"`
+	Fields       []string `json:"fields"`
+	Congregation string   `json:"congregation"`
+	Created      string   `json:"created"`
+}
+
+type RequestErasureRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ListErasureRequestsRequest struct {
+	Congregation string `json:"congregation"`
+}
+
+type ConfirmErasureRequest struct {
+	Request string `json:"request"`
+	// Rewrite picks, from the request's name_matches, the records to
+	// pseudonymise.
+	Rewrite []struct {
+		Collection string `json:"collection"`
+		Id         string `json:"id"`
+	} `json:"rewrite"`
+}
+
+type erasureRequestEntry struct {
+	Id          string              `db:"id"           json:"id"`
+	User        string              `db:"user"         json:"user"`
+	Name        string              `db:"name"         json:"name"`
+	Email       string              `db:"email"        json:"email"`
+	Reason      string              `db:"reason"       json:"reason"`
+	Status      string              `db:"status"       json:"status"`
+	Pseudonym   string              `db:"pseudonym"    json:"pseudonym"`
+	DecidedBy   string              `db:"decided_by"   json:"decided_by"`
+	Created     string              `db:"created"      json:"created"`
+	Matches     types.JSONRaw       `db:"name_matches" json:"-"`
+	NameMatches []personalDataMatch `db:"-"            json:"name_matches"`
+}
+
+// personalDataCongregations returns the congregations a user's display name
+// is matched in: those they hold a role in or were assigned maps in.
+func personalDataCongregations(app core.App, userId string) ([]string, error) {
+	var rows []struct {
+		Congregation string `db:"congregation"`
+	}
+	err := app.DB().NewQuery(`
+		SELECT congregation FROM roles WHERE user = {:user}
+		UNION
+		SELECT congregation FROM assignments WHERE user = {:user} AND congregation != ''
+	`).Bind(dbx.Params{"user": userId}).All(&rows)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(rows))
+	for i, r := range rows {
+		ids[i] = r.Congregation
+	}
+	return ids, nil
+}
+
+func personalDataParams(user *core.Record) dbx.Params {
+	return dbx.Params{"user": user.Id, "email": user.Email()}
+}
+
+// findRecordIds returns the ids of the collection's records matching filter.
+func findRecordIds(app core.App, collection, filter string, params dbx.Params) (map[string]bool, error) {
+	ids := map[string]bool{}
+	if filter == "" {
+		return ids, nil
+	}
+	records, err := app.FindRecordsByFilter(collection, filter, "", 0, 0, params)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		ids[record.Id] = true
+	}
+	return ids, nil
+}
+
+// findNameMatches returns source's records carrying name in a NameField
+// within congregations, other than those matching linked, which are already
+// attributed to the user by id.
+func findNameMatches(app core.App, source personalDataSource, linked, name string, congregations []string, params dbx.Params) ([]personalDataMatch, error) {
+	matches := []personalDataMatch{}
+	if name == "" || len(congregations) == 0 || len(source.NameFields) == 0 {
+		return matches, nil
+	}
+
+	nameParams := dbx.Params{"name": name}
+	fields := make([]string, len(source.NameFields))
+	for i, field := range source.NameFields {
+		fields[i] = field + " = {:name}"
+	}
+	congs := make([]string, len(congregations))
+	for i, id := range congregations {
+		key := fmt.Sprintf("cong%d", i)
+		nameParams[key] = id
+		congs[i] = "congregation = {:" + key + "}"
+	}
+	filter := fmt.Sprintf("(%s) && (%s)", strings.Join(fields, " || "), strings.Join(congs, " || "))
+	found, err := app.FindRecordsByFilter(source.Collection, filter, "created", 0, 0, nameParams)
+	if err != nil {
+		return nil, err
+	}
+	skip, err := findRecordIds(app, source.Collection, linked, params)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range found {
+		if skip[record.Id] {
+			continue
+		}
+		match := personalDataMatch{
+			Collection:   source.Collection,
+			Id:           record.Id,
+			Congregation: record.GetString("congregation"),
+			Created:      record.GetDateTime("created").String(),
+		}
+		for _, field := range source.NameFields {
+			if record.GetString(field) == name {
+				match.Fields = append(match.Fields, field)
+			}
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+// HandleExportPersonalData returns, as one JSON document, the caller's
+// account and every record attributed to them by id or email. Records that
+// only carry their display name, within their congregations, may belong to
+// someone else of the same name: they are listed under possible_matches by
+// id alone, without their contents.
+func HandleExportPersonalData(e *core.RequestEvent, app core.App) error {
+	if e.Auth.Collection().Name != "users" {
+		return apis.NewBadRequestError("Only user accounts can export personal data", nil)
+	}
+	user := e.Auth
+	name := strings.TrimSpace(user.GetString("name"))
+
+	congregations, err := personalDataCongregations(app, user.Id)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	params := personalDataParams(user)
+	records := map[string][]map[string]any{}
+	possibleMatches := map[string][]personalDataMatch{}
+	for _, source := range personalDataSources {
+		items := []map[string]any{}
+		if source.ByUser != "" {
+			found, err := app.FindRecordsByFilter(source.Collection, source.ByUser, "created", 0, 0, params)
+			if err != nil {
+				return newServerError(err)
+			}
+			for _, record := range found {
+				items = append(items, record.PublicExport())
+			}
+		}
+		records[source.Collection] = items
+
+		if len(source.NameFields) > 0 {
+			matches, err := findNameMatches(app, source, source.ByUser, name, congregations, params)
+			if err != nil {
+				return newServerError(err)
+			}
+			possibleMatches[source.Collection] = matches
+		}
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"exported_at": time.Now().UTC().Format(time.RFC3339),
+		"account": map[string]any{
+			"id":         user.Id,
+			"name":       user.GetString("name"),
+			"email":      user.Email(),
+			"verified":   user.Verified(),
+			"disabled":   user.GetBool("disabled"),
+			"last_login": user.GetDateTime("last_login"),
+			"created":    user.GetDateTime("created"),
+		},
+		"matched_name":          name,
+		"matched_congregations": congregations,
+		"records":               records,
+		"possible_matches":      possibleMatches,
+	})
+}
+
+// HandleRequestErasure records the caller's request to have their account
+// erased, with the records that name them only by display name for the
+// confirming administrator to review. Nothing is removed until an
+// administrator of one of their congregations confirms it.
+func HandleRequestErasure(e *core.RequestEvent, app core.App) error {
+	if e.Auth.Collection().Name != "users" {
+		return apis.NewBadRequestError("Only user accounts can request erasure", nil)
+	}
+	data := RequestErasureRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	reason := strings.TrimSpace(data.Reason)
+	if len(reason) > 500 {
+		return apis.NewBadRequestError("reason must be 500 characters or fewer", nil)
+	}
+
+	if _, err := app.FindFirstRecordByFilter("erasure_requests", "user = {:user} && status = 'pending'",
+		dbx.Params{"user": e.Auth.Id}); err == nil {
+		return apis.NewBadRequestError("You already have a pending erasure request", nil)
+	}
+
+	congregations, err := userCongregationIDs(app, e.Auth.Id)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	matchCongregations, err := personalDataCongregations(app, e.Auth.Id)
+	if err != nil {
+		return newServerError(err)
+	}
+	name := strings.TrimSpace(e.Auth.GetString("name"))
+	matches := []personalDataMatch{}
+	for _, source := range personalDataSources {
+		found, err := findNameMatches(app, source, source.NamedBy, name, matchCongregations, personalDataParams(e.Auth))
+		if err != nil {
+			return newServerError(err)
+		}
+		matches = append(matches, found...)
+	}
+
+	collection, err := app.FindCachedCollectionByNameOrId("erasure_requests")
+	if err != nil {
+		return newServerError(err)
+	}
+	request := core.NewRecord(collection)
+	request.Set("user", e.Auth.Id)
+	request.Set("congregations", congregations)
+	request.Set("name_matches", matches)
+	request.Set("reason", reason)
+	request.Set("status", "pending")
+	if err := app.Save(request); err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusCreated, map[string]any{
+		"id":     request.Id,
+		"status": "pending",
+	})
+}
+
+// HandleCancelErasure withdraws the caller's pending erasure request.
+func HandleCancelErasure(e *core.RequestEvent, app core.App) error {
+	request, err := app.FindFirstRecordByFilter("erasure_requests", "user = {:user} && status = 'pending'",
+		dbx.Params{"user": e.Auth.Id})
+	if err != nil {
+		return apis.NewNotFoundError("No pending erasure request", nil)
+	}
+	request.Set("status", "cancelled")
+	request.Set("decided_by", e.Auth.Id)
+	request.Set("decided_at", time.Now().UTC())
+	if err := app.Save(request); err != nil {
+		return newServerError(err)
+	}
+	return e.JSON(http.StatusOK, map[string]any{"status": "cancelled"})
+}
+
+// HandleListErasureRequests lists the erasure requests of a congregation's
+// members, newest first, each with its name matches in that congregation.
+func HandleListErasureRequests(e *core.RequestEvent, app core.App) error {
+	data := ListErasureRequestsRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" {
+		return apis.NewBadRequestError("congregation is required", nil)
+	}
+	if !AuthorizeByRole(app, e.Auth.Id, data.Congregation, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+
+	entries := []erasureRequestEntry{}
+	err := app.DB().NewQuery(`
+		SELECT r.id, COALESCE(r.user, '') AS user, COALESCE(u.name, '') AS name, COALESCE(u.email, '') AS email,
+		       COALESCE(r.reason, '') AS reason, r.status, COALESCE(r.pseudonym, '') AS pseudonym,
+		       COALESCE(d.name, '') AS decided_by, r.created,
+		       COALESCE(r.name_matches, '[]') AS name_matches
+		FROM erasure_requests r
+		LEFT JOIN users u ON u.id = r.user
+		LEFT JOIN users d ON d.id = r.decided_by
+		WHERE EXISTS (SELECT 1 FROM json_each(r.congregations) c WHERE c.value = {:congregation})
+		ORDER BY r.created DESC
+	`).Bind(dbx.Params{"congregation": data.Congregation}).All(&entries)
+	if err != nil {
+		return newServerError(err)
+	}
+	for i := range entries {
+		var matches []personalDataMatch
+		if err := json.Unmarshal(entries[i].Matches, &matches); err != nil {
+			return newServerError(err)
+		}
+		entries[i].NameMatches = []personalDataMatch{}
+		for _, match := range matches {
+			if match.Congregation == data.Congregation {
+				entries[i].NameMatches = append(entries[i].NameMatches, match)
+			}
+		}
+	}
+
+	return e.JSON(http.StatusOK, entries)
+}
+
+// HandleConfirmErasure carries out a pending erasure request. Superusers may
+// confirm any request; administrators only those of their congregations'
+// members.
+//
+// In one transaction the user's display name is replaced by a random
+// pseudonym in every free-text attribution tied to them by id and in the name
+// matches listed in rewrite, invitations sent to their email are redacted,
+// and the account is deleted,
+// which removes their roles and access requests and unlinks every other
+// relation to them. Records are rewritten in place rather than deleted, so
+// aggregates, coverage cycle publisher counts and history stay intact; the
+// rewrite bypasses record hooks so no aggregate is recalculated.
+func HandleConfirmErasure(e *core.RequestEvent, app core.App) error {
+	data := ConfirmErasureRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Request == "" {
+		return apis.NewBadRequestError("request is required", nil)
+	}
+
+	request, err := app.FindRecordById("erasure_requests", data.Request)
+	if err != nil {
+		return apis.NewNotFoundError("Erasure request not found", nil)
+	}
+	congregations := request.GetStringSlice("congregations")
+	if !e.HasSuperuserAuth() {
+		authorized := false
+		for _, congregation := range congregations {
+			if AuthorizeByRole(app, e.Auth.Id, congregation, "administrator") {
+				authorized = true
+				break
+			}
+		}
+		if !authorized {
+			return apis.NewForbiddenError("Administrator access required", nil)
+		}
+	}
+	userId := request.GetString("user")
+	if userId == e.Auth.Id {
+		return apis.NewBadRequestError("Another administrator must confirm your own erasure", nil)
+	}
+
+	var matches []personalDataMatch
+	if err := request.UnmarshalJSONField("name_matches", &matches); err != nil {
+		return newServerError(err)
+	}
+	listed := make(map[string]personalDataMatch, len(matches))
+	for _, match := range matches {
+		listed[match.Collection+"/"+match.Id] = match
+	}
+	rewrite := make([]personalDataMatch, 0, len(data.Rewrite))
+	for _, ref := range data.Rewrite {
+		match, ok := listed[ref.Collection+"/"+ref.Id]
+		if !ok {
+			return apis.NewBadRequestError(fmt.Sprintf("%s %s is not one of the request's name matches", ref.Collection, ref.Id), nil)
+		}
+		if !e.HasSuperuserAuth() && !AuthorizeByRole(app, e.Auth.Id, match.Congregation, "administrator") {
+			return apis.NewForbiddenError("Administrator access required for every record in rewrite", nil)
+		}
+		rewrite = append(rewrite, match)
+	}
+
+	pseudonym := "Former member " + strings.ToUpper(security.RandomStringWithAlphabet(6, "0123456789abcdefghjkmnpqrstuvwxyz"))
+	err = app.RunInTransaction(func(txApp core.App) error {
+		fresh, err := txApp.FindRecordById("erasure_requests", request.Id)
+		if err != nil {
+			return err
+		}
+		if status := fresh.GetString("status"); status != "pending" {
+			return apis.NewBadRequestError(fmt.Sprintf("Erasure request is already %s", status), nil)
+		}
+		user, err := txApp.FindRecordById("users", userId)
+		if err != nil {
+			return apis.NewNotFoundError("User not found", nil)
+		}
+
+		if err := pseudonymiseUser(txApp, user, pseudonym, rewrite); err != nil {
+			return err
+		}
+		if err := txApp.Delete(user); err != nil {
+			return err
+		}
+
+		// The deletion unlinked user in the stored row; match it here.
+		fresh.Set("user", "")
+		fresh.Set("status", "completed")
+		fresh.Set("pseudonym", pseudonym)
+		fresh.Set("reason", "")
+		fresh.Set("name_matches", []personalDataMatch{})
+		fresh.Set("decided_by", authID(e.Auth))
+		fresh.Set("decided_at", time.Now().UTC())
+		return txApp.Save(fresh)
+	})
+	if err != nil {
+		return wrapTransactionError(err)
+	}
+
+	for _, congregation := range congregations {
+		writeRoleLogEntry(app, congregation, "", roleActionErased, "", "", authID(e.Auth), "")
+	}
+	log.Printf("HandleConfirmErasure: erased user %s as %q", userId, pseudonym)
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"status":    "completed",
+		"pseudonym": pseudonym,
+	})
+}
+
+// pseudonymiseUser rewrites user's name in every personalDataSources name
+// field tied to them by NamedBy and in the picked name matches, redacts
+// invitations addressed to their email and drops outbox emails addressed to
+// them alone. A match is only rewritten while its fields still hold the
+// user's name. It writes directly to the tables so no record hook fires,
+// except for the outbox deletes, which go through the app so stored
+// attachments are removed too.
+func pseudonymiseUser(txApp core.App, user *core.Record, pseudonym string, matches []personalDataMatch) error {
+	// Rows tied to the account carry its name even if it has changed since,
+	// so they are rewritten whatever they hold.
+	for _, source := range personalDataSources {
+		if source.NamedBy == "" {
+			continue
+		}
+		ids, err := findRecordIds(txApp, source.Collection, source.NamedBy, personalDataParams(user))
+		if err != nil {
+			return fmt.Errorf("find %s named by user: %w", source.Collection, err)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		in := make([]any, 0, len(ids))
+		for id := range ids {
+			in = append(in, id)
+		}
+		params := dbx.Params{}
+		for _, field := range source.NameFields {
+			params[field] = pseudonym
+		}
+		if _, err := txApp.DB().Update(source.Collection, params, dbx.In("id", in...)).Execute(); err != nil {
+			return fmt.Errorf("pseudonymise %s: %w", source.Collection, err)
+		}
+	}
+
+	name := strings.TrimSpace(user.GetString("name"))
+	if name != "" {
+		for _, match := range matches {
+			for _, field := range match.Fields {
+				_, err := txApp.DB().Update(match.Collection,
+					dbx.Params{field: pseudonym},
+					dbx.HashExp{"id": match.Id, field: name},
+				).Execute()
+				if err != nil {
+					return fmt.Errorf("pseudonymise %s.%s: %w", match.Collection, field, err)
+				}
+			}
+		}
+	}
+
+	if _, err := txApp.DB().Update("invitations", dbx.Params{"email": "erased@invalid.invalid"}, dbx.HashExp{"email": user.Email()}).Execute(); err != nil {
+		return fmt.Errorf("redact invitations: %w", err)
+	}
+
+	emails, err := txApp.FindAllRecords("email_outbox", dbx.NewExp(
+		"json_array_length(recipients) = 1 AND json_extract(recipients, '$[0].email') = {:email}",
+		dbx.Params{"email": user.Email()},
+	))
+	if err != nil {
+		return fmt.Errorf("find outbox emails: %w", err)
+	}
+	for _, email := range emails {
+		if err := txApp.Delete(email); err != nil {
+			return fmt.Errorf("delete outbox email %s: %w", email.Id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,504 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/routine"
+)
+
+// Push notification kinds, sent in the payload so the app can tell them apart.
+const (
+	PushInstruction      = "instruction"
+	PushAssignmentExpiry = "assignment_expiry"
+	PushMessages         = "messages"
+)
+
+const (
+	// pushTTL is how long a push service keeps a notification for a device
+	// that is offline.
+	pushTTL = 12 * time.Hour
+	// pushRecordSize is the aes128gcm record size. Payloads are kept well
+	// under it, in a single record.
+	pushRecordSize = 4096
+	pushBodyMax    = 500
+	vapidExpiry    = 12 * time.Hour
+)
+
+// errPushGone means the push service no longer knows the subscription; it
+// has been deleted.
+var errPushGone = errors.New("push subscription is gone")
+
+// PushNotification is the JSON payload the app's service worker receives.
+type PushNotification struct {
+	Kind  string            `json:"kind"`
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Tag   string            `json:"tag,omitempty"`
+	URL   string            `json:"url,omitempty"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+type PushKeys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// PushSubscribeRequest is the browser's PushSubscription.toJSON().
+type PushSubscribeRequest struct {
+	Endpoint string   `json:"endpoint"`
+	Keys     PushKeys `json:"keys"`
+}
+
+type PushUnsubscribeRequest struct {
+	Endpoint string `json:"endpoint"`
+}
+
+// vapidKeys is the server's application server key pair, from
+// VAPID_PRIVATE_KEY (the base64url raw P-256 scalar, as generated by
+// `npx web-push generate-vapid-keys`) and VAPID_SUBJECT (a mailto: or https:
+// contact for push services).
+type vapidKeys struct {
+	private *ecdsa.PrivateKey
+	public  string
+	subject string
+}
+
+// loadVAPIDKeys returns nil when push is not configured.
+func loadVAPIDKeys() (*vapidKeys, error) {
+	encoded := os.Getenv("VAPID_PRIVATE_KEY")
+	if encoded == "" {
+		return nil, nil
+	}
+	raw, err := decodeBase64URL(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("VAPID_PRIVATE_KEY: %w", err)
+	}
+	private, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("VAPID_PRIVATE_KEY: %w", err)
+	}
+	public, err := private.PublicKey.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	subject := os.Getenv("VAPID_SUBJECT")
+	if subject == "" {
+		subject = strings.TrimRight(os.Getenv("PB_APP_URL"), "/")
+	}
+	return &vapidKeys{
+		private: private,
+		public:  base64.RawURLEncoding.EncodeToString(public),
+		subject: subject,
+	}, nil
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers and
+// key generators differ.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// vapidAuthorization is the Authorization header for a push to endpoint: a
+// JWT signed with the server's key (RFC 8292), scoped to the push service's
+// origin.
+func vapidAuthorization(keys *vapidKeys, endpoint string, now time.Time) (string, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"aud": target.Scheme + "://" + target.Host,
+		"exp": now.Add(vapidExpiry).Unix(),
+		"sub": keys.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`)) +
+		"." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, keys.private, digest[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return "vapid t=" + unsigned + "." + base64.RawURLEncoding.EncodeToString(signature) + ", k=" + keys.public, nil
+}
+
+// encryptPushPayload encrypts plaintext for the browser owning p256dh and
+// auth, as a single aes128gcm record (RFC 8291).
+func encryptPushPayload(p256dh, auth string, plaintext []byte) ([]byte, error) {
+	uaRaw, err := decodeBase64URL(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("p256dh: %w", err)
+	}
+	authSecret, err := decodeBase64URL(auth)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return sealPushPayload(asPrivate, salt, uaRaw, authSecret, plaintext)
+}
+
+// sealPushPayload is encryptPushPayload with the sender's ephemeral key and
+// salt given.
+func sealPushPayload(asPrivate *ecdh.PrivateKey, salt, uaRaw, authSecret, plaintext []byte) ([]byte, error) {
+	uaPublic, err := ecdh.P256().NewPublicKey(uaRaw)
+	if err != nil {
+		return nil, fmt.Errorf("p256dh: %w", err)
+	}
+	asRaw := asPrivate.PublicKey().Bytes()
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := "WebPush: info\x00" + string(uaRaw) + string(asRaw)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 0x02 marks the last (here, only) record.
+	record := append(append([]byte{}, plaintext...), 0x02)
+	if len(record)+gcm.Overhead() > pushRecordSize {
+		return nil, errors.New("push payload is too large")
+	}
+
+	header := make([]byte, 0, 16+4+1+len(asRaw))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, pushRecordSize)
+	header = append(header, byte(len(asRaw)))
+	header = append(header, asRaw...)
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+// SendPush delivers n to one subscription. A subscription the push service
+// reports gone (404 or 410) is deleted and errPushGone returned.
+func SendPush(app core.App, subscription *core.Record, n PushNotification) error {
+	keys, err := loadVAPIDKeys()
+	if err != nil || keys == nil {
+		return errors.Join(errors.New("push notifications are not configured"), err)
+	}
+
+	n.Body = truncateRunes(n.Body, pushBodyMax)
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	body, err := encryptPushPayload(subscription.GetString("p256dh"), subscription.GetString("auth"), payload)
+	if err != nil {
+		return err
+	}
+
+	endpoint := subscription.GetString("endpoint")
+	authorization, err := vapidAuthorization(keys, endpoint, time.Now())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(pushTTL.Seconds())))
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		if err := app.Delete(subscription); err != nil {
+			log.Printf("SendPush: failed to delete gone subscription %s: %v", subscription.Id, err)
+		}
+		return errPushGone
+	default:
+		return fmt.Errorf("push service answered %d: %s", resp.StatusCode, snippet)
+	}
+}
+
+// truncateRunes shortens s to at most n characters without splitting one.
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// pushToSubscriptions sends n to each subscription, returning how many the
+// push services accepted. Failures are logged: a notification must never fail
+// the work that triggered it.
+func pushToSubscriptions(app core.App, subscriptions []*core.Record, n PushNotification) int {
+	sent := 0
+	for _, subscription := range subscriptions {
+		err := SendPush(app, subscription, n)
+		switch {
+		case err == nil:
+			sent++
+		case errors.Is(err, errPushGone):
+		default:
+			log.Printf("push: failed to send %s to subscription %s: %v", n.Kind, subscription.Id, err)
+		}
+	}
+	return sent
+}
+
+// PushEnabled reports whether VAPID keys are configured.
+func PushEnabled() bool {
+	keys, err := loadVAPIDKeys()
+	return err == nil && keys != nil
+}
+
+// PushToUsers sends n to every browser the given users subscribed.
+func PushToUsers(app core.App, userIds []string, n PushNotification) int {
+	if len(userIds) == 0 || !PushEnabled() {
+		return 0
+	}
+	ids := make([]any, len(userIds))
+	for i, id := range userIds {
+		ids[i] = id
+	}
+	subscriptions, err := app.FindAllRecords("push_subscriptions", dbx.In("user", ids...))
+	if err != nil {
+		log.Printf("PushToUsers: failed to find subscriptions: %v", err)
+		return 0
+	}
+	return pushToSubscriptions(app, subscriptions, n)
+}
+
+// PushToLinks sends n to every browser subscribed through one of the given
+// link-ids.
+func PushToLinks(app core.App, linkIds []string, n PushNotification) int {
+	if len(linkIds) == 0 || !PushEnabled() {
+		return 0
+	}
+	ids := make([]any, len(linkIds))
+	for i, id := range linkIds {
+		ids[i] = id
+	}
+	subscriptions, err := app.FindAllRecords("push_subscriptions", dbx.In("assignment", ids...))
+	if err != nil {
+		log.Printf("PushToLinks: failed to find subscriptions: %v", err)
+		return 0
+	}
+	return pushToSubscriptions(app, subscriptions, n)
+}
+
+// PushToMapLinks sends n to every browser subscribed through a live link on
+// the map.
+func PushToMapLinks(app core.App, mapId string, n PushNotification) int {
+	if !PushEnabled() {
+		return 0
+	}
+	assignments, err := fetchLiveAssignments(app, "map", mapId)
+	if err != nil {
+		log.Printf("PushToMapLinks: failed to find live links on map %s: %v", mapId, err)
+		return 0
+	}
+	linkIds := make([]string, len(assignments))
+	for i, a := range assignments {
+		linkIds[i] = a.Id
+	}
+	return PushToLinks(app, linkIds, n)
+}
+
+// InstructionPushTitleFn titles the push notification of a broadcast from
+// sender in the language of the congregation. Injected from the jobs package,
+// which holds the message catalogs, to avoid import cycles.
+type InstructionPushTitleFn func(app core.App, congregationId, sender string) string
+
+// pushInstructionToLinks sends a broadcast to the links' subscribed browsers
+// in the background, reaching publishers whose app is not open.
+func pushInstructionToLinks(app core.App, broadcast *core.Record, assignments []liveAssignment, title InstructionPushTitleFn) {
+	if !PushEnabled() {
+		return
+	}
+	linkIds := make([]string, len(assignments))
+	for i, a := range assignments {
+		linkIds[i] = a.Id
+	}
+	n := PushNotification{
+		Kind:  PushInstruction,
+		Title: title(app, broadcast.GetString("congregation"), broadcast.GetString("sender")),
+		Body:  broadcast.GetString("message"),
+		Tag:   "broadcast-" + broadcast.Id,
+		Data:  map[string]string{"broadcast": broadcast.Id},
+	}
+	routine.FireAndForget(func() {
+		PushToLinks(app, linkIds, n)
+	})
+}
+
+// pushSubscriptionOwner resolves who a /push/* request acts for: the link
+// behind a link-id header, which takes precedence as it does for the map, or
+// the signed-in user.
+func pushSubscriptionOwner(e *core.RequestEvent, app core.App) (field, id string, err error) {
+	if e.Request.Header.Get("link-id") != "" {
+		assignment, err := liveLinkFromRequest(e, app)
+		if err != nil {
+			return "", "", err
+		}
+		return "assignment", assignment.Id, nil
+	}
+	if e.Auth == nil || e.Auth.Collection().Name != "users" {
+		return "", "", apis.NewUnauthorizedError("Sign in or provide a link-id", nil)
+	}
+	return "user", e.Auth.Id, nil
+}
+
+// HandlePushKey returns the VAPID public key the app subscribes with
+// (applicationServerKey), or enabled false when push is not configured.
+func HandlePushKey(e *core.RequestEvent, app core.App) error {
+	keys, err := loadVAPIDKeys()
+	if err != nil {
+		log.Printf("HandlePushKey: %v", err)
+	}
+	if keys == nil {
+		return e.JSON(http.StatusOK, map[string]any{"enabled": false, "public_key": ""})
+	}
+	return e.JSON(http.StatusOK, map[string]any{"enabled": true, "public_key": keys.public})
+}
+
+// HandlePushSubscribe registers a browser's push subscription for the
+// signed-in user or, with a link-id header, for that link until it expires.
+// Registering an endpoint again moves it to the caller and refreshes its keys.
+func HandlePushSubscribe(e *core.RequestEvent, app core.App) error {
+	data := PushSubscribeRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if !PushEnabled() {
+		return apis.NewBadRequestError("Push notifications are not configured", nil)
+	}
+	target, err := url.Parse(data.Endpoint)
+	if err != nil || target.Host == "" || (target.Scheme != "https" && !(allowPrivateTargets() && target.Scheme == "http")) {
+		return apis.NewBadRequestError("endpoint must be an https URL", nil)
+	}
+	if raw, err := decodeBase64URL(data.Keys.P256dh); err != nil || len(raw) != 65 {
+		return apis.NewBadRequestError("keys.p256dh must be an uncompressed P-256 public key", nil)
+	} else if _, err := ecdh.P256().NewPublicKey(raw); err != nil {
+		return apis.NewBadRequestError("keys.p256dh must be an uncompressed P-256 public key", nil)
+	}
+	if raw, err := decodeBase64URL(data.Keys.Auth); err != nil || len(raw) != 16 {
+		return apis.NewBadRequestError("keys.auth must be a 16-byte secret", nil)
+	}
+
+	field, ownerId, err := pushSubscriptionOwner(e, app)
+	if err != nil {
+		return err
+	}
+
+	subscription, err := app.FindFirstRecordByData("push_subscriptions", "endpoint", data.Endpoint)
+	if err != nil {
+		collection, err := app.FindCachedCollectionByNameOrId("push_subscriptions")
+		if err != nil {
+			return newServerError(err)
+		}
+		subscription = core.NewRecord(collection)
+		subscription.Set("endpoint", data.Endpoint)
+	}
+	if subscription.GetString(field) != ownerId {
+		subscription.Set("expiry_warned_at", nil)
+	}
+	subscription.Set("user", "")
+	subscription.Set("assignment", "")
+	subscription.Set(field, ownerId)
+	subscription.Set("p256dh", data.Keys.P256dh)
+	subscription.Set("auth", data.Keys.Auth)
+	subscription.Set("user_agent", truncateRunes(e.Request.UserAgent(), 300))
+	if err := app.Save(subscription); err != nil {
+		return apis.NewBadRequestError("Invalid push subscription", err)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{"id": subscription.Id})
+}
+
+// HandlePushUnsubscribe removes the caller's subscription for a browser,
+// reporting whether there was one.
+func HandlePushUnsubscribe(e *core.RequestEvent, app core.App) error {
+	data := PushUnsubscribeRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Endpoint == "" {
+		return apis.NewBadRequestError("endpoint is required", nil)
+	}
+	field, ownerId, err := pushSubscriptionOwner(e, app)
+	if err != nil {
+		return err
+	}
+
+	subscription, err := app.FindFirstRecordByData("push_subscriptions", "endpoint", data.Endpoint)
+	if err != nil || subscription.GetString(field) != ownerId {
+		return e.JSON(http.StatusOK, map[string]any{"removed": false})
+	}
+	if err := app.Delete(subscription); err != nil {
+		return newServerError(err)
+	}
+	return e.JSON(http.StatusOK, map[string]any{"removed": true})
+}
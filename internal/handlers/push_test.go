@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := decodeBase64URL(s)
+	if err != nil {
+		t.Fatalf("decode %q: %v", s, err)
+	}
+	return b
+}
+
+// The worked example in RFC 8291, Appendix A.
+func TestSealPushPayload_MatchesRFC8291Example(t *testing.T) {
+	asPrivate, err := ecdh.P256().NewPrivateKey(mustDecode(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := sealPushPayload(
+		asPrivate,
+		mustDecode(t, "DGv6ra1nlYgDCS1FRnbzlw"),
+		mustDecode(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"),
+		mustDecode(t, "BTBZMqHH6r4Tts7J_aSIgg"),
+		[]byte("When I grow up, I want to be a watermelon"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if encoded := base64.RawURLEncoding.EncodeToString(got); encoded != want {
+		t.Errorf("ciphertext\n got %s\nwant %s", encoded, want)
+	}
+}
+
+func TestVapidAuthorization_SignsForThePushServiceOrigin(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := private.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VAPID_PRIVATE_KEY", base64.RawURLEncoding.EncodeToString(raw))
+	t.Setenv("VAPID_SUBJECT", "mailto:admin@example.com")
+	keys, err := loadVAPIDKeys()
+	if err != nil || keys == nil {
+		t.Fatalf("loadVAPIDKeys: %v", err)
+	}
+
+	now := time.Unix(1_800_000_000, 0)
+	header, err := vapidAuthorization(keys, "https://push.example.com/send/abc?x=1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, key, ok := strings.Cut(strings.TrimPrefix(header, "vapid t="), ", k=")
+	if !ok || key != keys.public {
+		t.Fatalf("header %q does not carry the public key", header)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q is not a JWT", token)
+	}
+	var claims struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(mustDecode(t, parts[1]), &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Aud != "https://push.example.com" || claims.Sub != "mailto:admin@example.com" || claims.Exp != now.Add(vapidExpiry).Unix() {
+		t.Errorf("claims: %+v", claims)
+	}
+
+	signature := mustDecode(t, parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if len(signature) != 64 || !ecdsa.Verify(&private.PublicKey, digest[:], r, s) {
+		t.Error("signature does not verify with the VAPID key")
+	}
+}
+
+func TestLoadVAPIDKeys_DisabledWithoutAKey(t *testing.T) {
+	t.Setenv("VAPID_PRIVATE_KEY", "")
+	if keys, err := loadVAPIDKeys(); keys != nil || err != nil {
+		t.Errorf("want push disabled, got %v, %v", keys, err)
+	}
+	if PushEnabled() {
+		t.Error("PushEnabled without a key")
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// roleActionReenabled is recorded in roles_log when an administrator re-enables
+// a member's disabled account.
+const roleActionReenabled = "reenabled"
+
+// UserReenabledNotifierFn emails a user that their account was re-enabled.
+// Injected from the jobs package at registration time to avoid import cycles.
+type UserReenabledNotifierFn func(app core.App, user, congregation, admin *core.Record) error
+
+type ReenableUserRequest struct {
+	Congregation string `json:"congregation"`
+	User         string `json:"user"`
+}
+
+// HandleReenableUser lets a congregation administrator re-enable a disabled
+// account that still holds a role in the congregation, typically one disabled
+// by processInactiveUsers.
+//
+// last_login is set to now so the inactivity clock restarts instead of the
+// next run disabling the account again, and all inactive and unprovisioned
+// warning stamps are cleared. The event is written to roles_log and the user
+// is emailed; the account stays enabled when the email cannot be sent
+// (email_sent is false in the response).
+func HandleReenableUser(e *core.RequestEvent, app core.App, notify UserReenabledNotifierFn) error {
+	data := ReenableUserRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" || data.User == "" {
+		return apis.NewBadRequestError("congregation and user are required", nil)
+	}
+	if !AuthorizeByRole(app, e.Auth.Id, data.Congregation, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+
+	role, err := app.FindFirstRecordByFilter(
+		"roles",
+		"user = {:user} && congregation = {:congregation}",
+		dbx.Params{"user": data.User, "congregation": data.Congregation},
+	)
+	if err != nil {
+		return apis.NewNotFoundError("User is not a member of this congregation", nil)
+	}
+	user, err := app.FindRecordById("users", data.User)
+	if err != nil {
+		return apis.NewNotFoundError("User is not a member of this congregation", nil)
+	}
+	if !user.GetBool("disabled") {
+		return apis.NewBadRequestError("Account is not disabled", nil)
+	}
+	congregation, err := app.FindRecordById("congregations", data.Congregation)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	user.Set("disabled", false)
+	user.Set("last_login", time.Now().UTC())
+	user.Set("inactive_warning_sent_at", nil)
+	user.Set("inactive_final_warning_sent_at", nil)
+	user.Set("unprovisioned_since", nil)
+	user.Set("unprovisioned_warning_sent_at", nil)
+	user.Set("unprovisioned_final_warning_sent_at", nil)
+	user.Set("admin_alerted_at", nil)
+	if err := app.SaveNoValidate(user); err != nil {
+		return newServerError(err)
+	}
+
+	writeRoleLogEntry(app, data.Congregation, data.User, roleActionReenabled,
+		"", role.GetString("role"), e.Auth.Id, "")
+
+	emailSent := true
+	if err := notify(app, user, congregation, e.Auth); err != nil {
+		emailSent = false
+		sentry.CaptureException(err)
+		log.Printf("HandleReenableUser: could not email user %s: %v", data.User, err)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"message":    "Account re-enabled",
+		"email_sent": emailSent,
+	})
+}
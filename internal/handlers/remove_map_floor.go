@@ -48,7 +48,7 @@ func HandleRemoveMapFloor(e *core.RequestEvent, app core.App) error {
 		return apis.NewNotFoundError("Error fetching map data", nil)
 	}
 
-	if !AuthorizeByRole(app, e.Auth.Id, mapData.GetString("congregation"), "administrator") {
+	if !AuthorizeMapByRole(app, e.Auth.Id, mapData.Id, "administrator") {
 		return apis.NewForbiddenError("Administrator access required", nil)
 	}
 
@@ -78,6 +78,15 @@ func HandleRemoveMapFloor(e *core.RequestEvent, app core.App) error {
 	if err != nil {
 		return newServerError(err)
 	}
+	removedCodes := make([]string, len(addresses))
+	for i, address := range addresses {
+		removedCodes[i] = address.GetString("code")
+	}
+	writeStructureLog(app, mapData.GetString("congregation"), structureFloorRemoved, "map", mapId, authID(e.Auth), map[string]any{
+		"floor": floor,
+		"codes": removedCodes,
+	})
+
 	ProcessMapAggregates(mapId, app)
 
 	return e.String(http.StatusOK, "Map floor deleted successfully")
@@ -10,7 +10,9 @@ import (
 )
 
 // HandleResetMap resets a map's 'not_home' and 'done' addresses back to 'not_done'
-// and recalculates aggregates afterwards.
+// and recalculates aggregates afterwards. The prior statuses are kept in a
+// reset snapshot so the reset can be undone (see HandleRestoreResetSnapshot),
+// and the map starts a new coverage cycle.
 type ResetMapRequest struct {
 	Map string `json:"map"`
 }
@@ -32,7 +34,7 @@ func HandleResetMap(e *core.RequestEvent, app core.App) error {
 		return apis.NewNotFoundError("Map not found", nil)
 	}
 
-	if !AuthorizeByRole(app, e.Auth.Id, mapData.GetString("congregation"), "administrator") {
+	if !AuthorizeMapByRole(app, e.Auth.Id, mapData.Id, "administrator") {
 		return apis.NewForbiddenError("Administrator access required", nil)
 	}
 
@@ -42,6 +44,26 @@ func HandleResetMap(e *core.RequestEvent, app core.App) error {
 		return apis.NewNotFoundError("Error fetching addresses", nil)
 	}
 
+	if err := BulkResetMap(app, mapData, records, userName, authID(e.Auth), true); err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusOK, "Map reset successfully")
+}
+
+// BulkResetMap flips the given addresses of one map back to not_done in a
+// single transaction, snapshotting their prior statuses first, and then
+// recalculates the map's aggregates. When newCycle is set the map also starts
+// a new coverage cycle; partial resets leave cycle tracking to the
+// recalculation. resetBy is stamped into updated_by and createdBy (a user ID,
+// or empty for system resets) onto the snapshot.
+//
+// Shared by HandleResetMap and the scheduled auto-reset job.
+func BulkResetMap(app core.App, mapData *core.Record, records []*core.Record, resetBy, createdBy string, newCycle bool) error {
+	mapId := mapData.Id
+	congregation := mapData.GetString("congregation")
+	territory := mapData.GetString("territory")
+
 	// Suppress per-address aggregate hook fires during the batch. The flag is
 	// checked by HandleAddressAggregateUpdate; defer clears it after the explicit
 	// ProcessMapAggregates call below so field-worker updates resume normally.
@@ -49,27 +71,37 @@ func HandleResetMap(e *core.RequestEvent, app core.App) error {
 	app.Store().Set(flagKey, true)
 	defer app.Store().Remove(flagKey)
 
-	err = app.RunInTransaction(func(txApp core.App) error {
+	err := app.RunInTransaction(func(txApp core.App) error {
+		var cycles []cycleRestart
+		if newCycle {
+			restart, err := restartCoverageCycle(txApp, "map", congregation, territory, mapId)
+			if err != nil {
+				return err
+			}
+			cycles = append(cycles, restart)
+		}
+		if err := saveResetSnapshot(txApp, "map", congregation, territory, mapId, createdBy, records, cycles); err != nil {
+			return err
+		}
 		for _, record := range records {
 			record.Set("status", "not_done")
 			record.Set("not_home_tries", 0)
-			record.Set("updated_by", userName)
+			record.Set("updated_by", resetBy)
 			if err := txApp.SaveNoValidate(record); err != nil {
 				return err
 			}
 		}
 		return nil
 	})
-
 	if err != nil {
-		return newServerError(err)
+		return err
 	}
 
 	if err := ProcessMapAggregates(mapId, app); err != nil {
 		log.Printf("Error recalculating aggregates for map %s: %v", mapId, err)
 	}
 
-	return e.JSON(http.StatusOK, "Map reset successfully")
+	return nil
 }
 
 // ResetMapTerritory processes the territory aggregates for a given map
@@ -84,6 +116,8 @@ func ResetMapTerritory(mapId string, app core.App) error {
 
 // HandleResetTerritory resets a territory's 'not_home' and 'done' addresses back
 // to 'not_done', then recalculates aggregates for each affected map and the territory.
+// Like HandleResetMap, it snapshots the prior statuses first, and it starts a
+// new coverage cycle for the territory and each affected map.
 type ResetTerritoryRequest struct {
 	Territory string `json:"territory"`
 }
@@ -105,7 +139,7 @@ func HandleResetTerritory(c *core.RequestEvent, app core.App) error {
 		return apis.NewNotFoundError("Territory not found", nil)
 	}
 
-	if !AuthorizeByRole(app, c.Auth.Id, territory.GetString("congregation"), "administrator", "conductor") {
+	if !AuthorizeTerritoryByRole(app, c.Auth.Id, territory.Id, "administrator", "conductor") {
 		return apis.NewForbiddenError("Administrator or conductor access required", nil)
 	}
 
@@ -133,6 +167,25 @@ func HandleResetTerritory(c *core.RequestEvent, app core.App) error {
 	}()
 
 	err = app.RunInTransaction(func(txApp core.App) error {
+		restart, err := restartCoverageCycle(txApp, "territory", territory.GetString("congregation"), territoryId, "")
+		if err != nil {
+			return err
+		}
+		cycles := []cycleRestart{restart}
+		territoryMaps, err := txApp.FindRecordsByFilter("maps", "territory = {:id}", "", 0, 0, dbx.Params{"id": territoryId})
+		if err != nil {
+			return err
+		}
+		for _, mapRecord := range territoryMaps {
+			restart, err := restartCoverageCycle(txApp, "map", territory.GetString("congregation"), territoryId, mapRecord.Id)
+			if err != nil {
+				return err
+			}
+			cycles = append(cycles, restart)
+		}
+		if err := saveResetSnapshot(txApp, "territory", territory.GetString("congregation"), territoryId, "", authID(c.Auth), records, cycles); err != nil {
+			return err
+		}
 		for _, record := range records {
 			record.Set("status", "not_done")
 			record.Set("not_home_tries", 0)
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// resetSnapshotListLimit caps how many snapshots the list endpoint returns;
+// only the most recent resets are realistically worth restoring.
+const resetSnapshotListLimit = 50
+
+// snapshotEntry is a single address as it stood immediately before a reset.
+type snapshotEntry struct {
+	Address      string `json:"address"`
+	Map          string `json:"map"`
+	Status       string `json:"status"`
+	NotHomeTries int    `json:"not_home_tries"`
+}
+
+// saveResetSnapshot records the status and not_home_tries of every address a
+// reset is about to flip back to not_done, along with the coverage cycles the
+// reset restarted. It must run inside the reset's transaction and before the
+// records are modified, so the snapshot and the reset commit or roll back
+// together. Nothing is written for an empty reset.
+func saveResetSnapshot(txApp core.App, scope, congregation, territory, mapId, createdBy string, records []*core.Record, cycles []cycleRestart) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	collection, err := txApp.FindCachedCollectionByNameOrId("reset_snapshots")
+	if err != nil {
+		return err
+	}
+
+	entries := make([]snapshotEntry, len(records))
+	for i, record := range records {
+		entries[i] = snapshotEntry{
+			Address:      record.Id,
+			Map:          record.GetString("map"),
+			Status:       record.GetString("status"),
+			NotHomeTries: record.GetInt("not_home_tries"),
+		}
+	}
+
+	snapshot := core.NewRecord(collection)
+	snapshot.Set("congregation", congregation)
+	snapshot.Set("territory", territory)
+	snapshot.Set("map", mapId)
+	snapshot.Set("scope", scope)
+	snapshot.Set("addresses", entries)
+	snapshot.Set("address_count", len(entries))
+	snapshot.Set("cycles", cycles)
+	snapshot.Set("created_by", createdBy)
+
+	return txApp.Save(snapshot)
+}
+
+// authorizeSnapshotScope applies the same role requirement as the reset that
+// produced a snapshot: administrators only for a map reset, administrators or
+// conductors for a territory reset, each covering the map or territory reset.
+func authorizeSnapshotScope(app core.App, userId, scope, mapId, territoryId string) error {
+	if scope == "territory" {
+		if !AuthorizeTerritoryByRole(app, userId, territoryId, "administrator", "conductor") {
+			return apis.NewForbiddenError("Administrator or conductor access required", nil)
+		}
+		return nil
+	}
+	if !AuthorizeMapByRole(app, userId, mapId, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+	return nil
+}
+
+type ListResetSnapshotsRequest struct {
+	Map       string `json:"map"`
+	Territory string `json:"territory"`
+}
+
+type resetSnapshotSummary struct {
+	Id           string `db:"id"            json:"id"`
+	Scope        string `db:"scope"         json:"scope"`
+	Map          string `db:"map"           json:"map"`
+	Territory    string `db:"territory"     json:"territory"`
+	AddressCount int    `db:"address_count" json:"address_count"`
+	CreatedBy    string `db:"created_by"    json:"created_by"`
+	Created      string `db:"created"       json:"created"`
+	RestoredAt   string `db:"restored_at"   json:"restored_at"`
+}
+
+// HandleListResetSnapshots lists the most recent reset snapshots for a map
+// (map resets only) or a territory (map and territory resets within it),
+// newest first. The per-address payload is omitted.
+func HandleListResetSnapshots(e *core.RequestEvent, app core.App) error {
+	data := ListResetSnapshotsRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if (data.Map == "") == (data.Territory == "") {
+		return apis.NewBadRequestError("Exactly one of map or territory is required", nil)
+	}
+
+	var filter, id string
+	if data.Map != "" {
+		mapData, err := fetchMapData(app, data.Map)
+		if err != nil {
+			return apis.NewNotFoundError("Map not found", nil)
+		}
+		if err := authorizeSnapshotScope(app, e.Auth.Id, "map", mapData.Id, ""); err != nil {
+			return err
+		}
+		filter = "s.map = {:id} AND s.scope = 'map'"
+		id = data.Map
+	} else {
+		if getTerritoryCongregation(app, data.Territory) == "" {
+			return apis.NewNotFoundError("Territory not found", nil)
+		}
+		if err := authorizeSnapshotScope(app, e.Auth.Id, "territory", "", data.Territory); err != nil {
+			return err
+		}
+		filter = "s.territory = {:id}"
+		id = data.Territory
+	}
+
+	snapshots := []resetSnapshotSummary{}
+	err := app.DB().NewQuery(`
+		SELECT s.id, s.scope, s.map, s.territory, s.address_count,
+		       COALESCE(u.name, '') AS created_by, s.created, s.restored_at
+		FROM reset_snapshots s
+		LEFT JOIN users u ON u.id = s.created_by
+		WHERE ` + filter + `
+		ORDER BY s.created DESC
+		LIMIT {:limit}
+	`).Bind(dbx.Params{"id": id, "limit": resetSnapshotListLimit}).All(&snapshots)
+	if err != nil {
+		return newServerError(err)
+	}
+
+	return e.JSON(http.StatusOK, snapshots)
+}
+
+type RestoreResetSnapshotRequest struct {
+	Snapshot string `json:"snapshot"`
+}
+
+// HandleRestoreResetSnapshot puts the addresses captured by a reset snapshot
+// back to their prior status and not_home_tries, then recalculates aggregates
+// for every affected map and territory.
+//
+// Only addresses still exactly as the reset left them (not_done, zero tries)
+// are restored. Anything worked since the reset is newer than the snapshot
+// and is left alone, as are addresses deleted in the meantime; both are
+// reported as skipped. A snapshot can be restored once.
+//
+// The coverage cycles the reset restarted are put back too (see
+// undoCycleRestart), so the reset no longer counts as a cycle boundary.
+func HandleRestoreResetSnapshot(e *core.RequestEvent, app core.App) error {
+	data := RestoreResetSnapshotRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Snapshot == "" {
+		return apis.NewBadRequestError("snapshot is required", nil)
+	}
+
+	snapshot, err := app.FindRecordById("reset_snapshots", data.Snapshot)
+	if err != nil {
+		return apis.NewNotFoundError("Snapshot not found", nil)
+	}
+
+	if err := authorizeSnapshotScope(app, e.Auth.Id, snapshot.GetString("scope"), snapshot.GetString("map"), snapshot.GetString("territory")); err != nil {
+		return err
+	}
+
+	if !snapshot.GetDateTime("restored_at").IsZero() {
+		return apis.NewBadRequestError("Snapshot has already been restored", nil)
+	}
+
+	var entries []snapshotEntry
+	if err := snapshot.UnmarshalJSONField("addresses", &entries); err != nil {
+		return newServerError(err)
+	}
+
+	var cycles []cycleRestart
+	if err := snapshot.UnmarshalJSONField("cycles", &cycles); err != nil {
+		return newServerError(err)
+	}
+
+	addressIds := make([]string, len(entries))
+	mapIDSet := make(map[string]bool)
+	for i, entry := range entries {
+		addressIds[i] = entry.Address
+		if entry.Map != "" {
+			mapIDSet[entry.Map] = true
+		}
+	}
+
+	// Same suppression as the reset itself: skip the per-address aggregate
+	// hook and recalculate once per map below.
+	for mapID := range mapIDSet {
+		app.Store().Set("bulk_reset:"+mapID, true)
+	}
+	defer func() {
+		for mapID := range mapIDSet {
+			app.Store().Remove("bulk_reset:" + mapID)
+		}
+	}()
+
+	userName := e.Auth.GetString("name")
+	territoryIDSet := make(map[string]bool)
+	restored := 0
+	var held []string
+	defer func() {
+		for _, key := range held {
+			app.Store().Remove(key)
+		}
+	}()
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		// Re-read inside the transaction so two concurrent restores of the
+		// same snapshot can't both get past the restored_at check.
+		current, err := txApp.FindRecordById("reset_snapshots", snapshot.Id)
+		if err != nil {
+			return err
+		}
+		if !current.GetDateTime("restored_at").IsZero() {
+			return apis.NewBadRequestError("Snapshot has already been restored", nil)
+		}
+
+		records, err := txApp.FindRecordsByIds("addresses", addressIds)
+		if err != nil {
+			return err
+		}
+		byId := make(map[string]*core.Record, len(records))
+		for _, record := range records {
+			byId[record.Id] = record
+		}
+
+		for _, entry := range entries {
+			record, ok := byId[entry.Address]
+			if !ok {
+				continue
+			}
+			if record.GetString("status") != "not_done" || record.GetInt("not_home_tries") != 0 {
+				continue
+			}
+			record.Set("status", entry.Status)
+			record.Set("not_home_tries", entry.NotHomeTries)
+			record.Set("updated_by", userName)
+			if err := txApp.SaveNoValidate(record); err != nil {
+				return err
+			}
+			if territory := record.GetString("territory"); territory != "" {
+				territoryIDSet[territory] = true
+			}
+			restored++
+		}
+
+		for _, restart := range cycles {
+			hold, err := undoCycleRestart(txApp, restart)
+			if err != nil {
+				return err
+			}
+			if hold {
+				key := coverageHoldKey(restart.Territory, restart.Map)
+				app.Store().Set(key, true)
+				held = append(held, key)
+			}
+			if restart.Scope == "territory" {
+				territoryIDSet[restart.Territory] = true
+			}
+		}
+
+		current.Set("restored_at", time.Now().UTC())
+		current.Set("restored_by", authID(e.Auth))
+		return txApp.Save(current)
+	})
+	if err != nil {
+		return wrapTransactionError(err)
+	}
+
+	for mapID := range mapIDSet {
+		if err := ProcessMapAggregates(mapID, app, false); err != nil {
+			log.Printf("Error recalculating aggregates for map %s: %v", mapID, err)
+		}
+	}
+	for territoryID := range territoryIDSet {
+		if err := ProcessTerritoryAggregates(territoryID, app); err != nil {
+			log.Printf("Error recalculating territory aggregates for %s: %v", territoryID, err)
+		}
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"restored": restored,
+		"skipped":  len(entries) - restored,
+	})
+}
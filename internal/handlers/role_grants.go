@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// assignableRoles are the roles an administrator can hand out through an
+// invitation or an access request approval.
+var assignableRoles = map[string]bool{
+	"read_only":     true,
+	"conductor":     true,
+	"administrator": true,
+}
+
+// grantRoleIfMissing gives userId role in congregation unless they already
+// hold a role there, returning the role they end up with and whether it was
+// newly granted. An existing role is never changed, so a stale invitation or
+// request cannot downgrade an administrator.
+//
+// A newly provisioned user's unprovisioned_* stamps are cleared so the
+// processUnprovisionedUsers timeline starts from scratch should they ever lose
+// their last role again.
+func grantRoleIfMissing(txApp core.App, userId, congregation, role string) (string, bool, error) {
+	existing, err := txApp.FindFirstRecordByFilter(
+		"roles",
+		"user = {:user} && congregation = {:congregation}",
+		dbx.Params{"user": userId, "congregation": congregation},
+	)
+	if err == nil {
+		return existing.GetString("role"), false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", false, err
+	}
+
+	rolesCol, err := txApp.FindCachedCollectionByNameOrId("roles")
+	if err != nil {
+		return "", false, err
+	}
+	roleRecord := core.NewRecord(rolesCol)
+	roleRecord.Set("user", userId)
+	roleRecord.Set("congregation", congregation)
+	roleRecord.Set("role", role)
+	if err := txApp.Save(roleRecord); err != nil {
+		return "", false, err
+	}
+
+	user, err := txApp.FindRecordById("users", userId)
+	if err != nil {
+		return "", false, err
+	}
+	user.Set("unprovisioned_since", nil)
+	user.Set("unprovisioned_warning_sent_at", nil)
+	user.Set("unprovisioned_final_warning_sent_at", nil)
+	user.Set("admin_alerted_at", nil)
+	if err := txApp.SaveNoValidate(user); err != nil {
+		return "", false, err
+	}
+
+	return role, true, nil
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"log"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// unscopedRoleSQL matches a roles row aliased r that applies to its whole
+// congregation. PocketBase stores an empty multi-relation as "[]", and rows
+// written before roles.territories existed hold NULL or "".
+const unscopedRoleSQL = "COALESCE(r.territories, '') IN ('', '[]')"
+
+// roleCoversTerritorySQL matches a roles row aliased r that applies to the
+// territory given by the SQL expression territoryExpr: congregation-wide
+// roles cover every territory, scoped roles only the ones they list.
+func roleCoversTerritorySQL(territoryExpr string) string {
+	return "(" + unscopedRoleSQL + " OR EXISTS (SELECT 1 FROM json_each(NULLIF(r.territories, '')) WHERE json_each.value = " + territoryExpr + "))"
+}
+
+// ValidateRoleTerritories rejects a role scoped to a territory outside the
+// role's own congregation, which would otherwise grant nothing while looking
+// like a grant. It should be called from OnRecordValidate("roles").
+func ValidateRoleTerritories(e *core.RecordEvent) error {
+	territories := e.Record.GetStringSlice("territories")
+	if len(territories) == 0 {
+		return e.Next()
+	}
+
+	ids := make([]any, len(territories))
+	for i, id := range territories {
+		ids[i] = id
+	}
+	var result struct {
+		Cnt int `db:"cnt"`
+	}
+	err := e.App.DB().Select("COUNT(*) AS cnt").From("territories").
+		Where(dbx.In("id", ids...)).
+		AndWhere(dbx.HashExp{"congregation": e.Record.GetString("congregation")}).
+		One(&result)
+	if err != nil {
+		return err
+	}
+	if result.Cnt != len(territories) {
+		return apis.NewBadRequestError("Role territories must belong to the role's congregation", nil)
+	}
+	return e.Next()
+}
+
+// RevokeRolesScopedToTerritory deletes roles scoped to nothing but the
+// territory being deleted. Left alone, PocketBase would drop the id from their
+// territories list, leaving it empty and so silently widening each role to the
+// whole congregation. Roles scoped to other territories as well just lose this
+// one through PocketBase's own relation cleanup.
+//
+// It should be called from OnRecordDelete("territories"), before e.Next(), so
+// it runs in the same transaction as the delete.
+func RevokeRolesScopedToTerritory(e *core.RecordEvent) error {
+	roles := []*core.Record{}
+	err := e.App.RecordQuery("roles").
+		AndWhere(dbx.NewExp(
+			"json_valid(territories) AND json_array_length(territories) = 1 AND json_extract(territories, '$[0]') = {:territory}",
+			dbx.Params{"territory": e.Record.Id},
+		)).
+		All(&roles)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		if err := e.App.Delete(role); err != nil {
+			return err
+		}
+		writeRoleLogEntry(e.App, role.GetString("congregation"), role.GetString("user"),
+			"revoked", role.GetString("role"), "", "", "")
+		log.Printf("RevokeRolesScopedToTerritory: revoked role %s, scoped only to deleted territory %s", role.Id, e.Record.Id)
+	}
+
+	return e.Next()
+}
+
+// userTerritoryIDs returns every territory a role of the user covers.
+func userTerritoryIDs(app core.App, userId string) ([]string, error) {
+	var rows []struct {
+		Id string `db:"id"`
+	}
+	err := app.DB().NewQuery(`
+		SELECT DISTINCT t.id FROM territories t
+		JOIN roles r ON r.congregation = t.congregation
+		WHERE r.user = {:userId} AND ` + roleCoversTerritorySQL("t.id"),
+	).Bind(dbx.Params{"userId": userId}).All(&rows)
+	if err != nil {
+		sentry.CaptureException(err)
+		return nil, err
+	}
+	ids := make([]string, len(rows))
+	for i, r := range rows {
+		ids[i] = r.Id
+	}
+	return ids, nil
+}
@@ -70,7 +70,8 @@ func userCongregationIDs(app core.App, userId string) ([]string, error) {
 	return ids, nil
 }
 
-// userMapIDs returns every map in every congregation the user holds any role in.
+// userMapIDs returns every map covered by any role of the user: all maps of a
+// congregation for an unscoped role, only those in its territories otherwise.
 func userMapIDs(app core.App, userId string) ([]string, error) {
 	var rows []struct {
 		Id string `db:"id"`
@@ -78,8 +79,8 @@ func userMapIDs(app core.App, userId string) ([]string, error) {
 	err := app.DB().NewQuery(`
 		SELECT DISTINCT m.id FROM maps m
 		JOIN roles r ON r.congregation = m.congregation
-		WHERE r.user = {:userId}
-	`).Bind(dbx.Params{"userId": userId}).All(&rows)
+		WHERE r.user = {:userId} AND ` + roleCoversTerritorySQL("m.territory"),
+	).Bind(dbx.Params{"userId": userId}).All(&rows)
 	if err != nil {
 		return nil, err
 	}
@@ -91,8 +92,8 @@ func userMapIDs(app core.App, userId string) ([]string, error) {
 }
 
 // resolveMapScopeIDs returns the maps a request may access: the single map
-// behind a valid, non-expired link-id, or every map in every congregation
-// the auth user holds a role in.
+// behind a valid, non-expired link-id, or every map covered by a role of the
+// auth user.
 func resolveMapScopeIDs(app core.App, auth *core.Record, linkId string) ([]string, error) {
 	if linkId != "" {
 		var result struct {
@@ -187,6 +188,28 @@ func congregationScopeKeep(app core.App, userId string) (func(*core.Record) bool
 	return func(r *core.Record) bool { return set[r.GetString("congregation")] }, nil
 }
 
+// mapIdScopeKeep returns a predicate matching the map records themselves
+// that a role of the user covers.
+func mapIdScopeKeep(app core.App, userId string) (func(*core.Record) bool, error) {
+	ids, err := userMapIDs(app, userId)
+	if err != nil || len(ids) == 0 {
+		return nil, errors.New("unauthorized")
+	}
+	set := toSet(ids)
+	return func(r *core.Record) bool { return set[r.Id] }, nil
+}
+
+// territoryScopeKeep returns a predicate matching the territory records a
+// role of the user covers.
+func territoryScopeKeep(app core.App, userId string) (func(*core.Record) bool, error) {
+	ids, err := userTerritoryIDs(app, userId)
+	if err != nil || len(ids) == 0 {
+		return nil, errors.New("unauthorized")
+	}
+	set := toSet(ids)
+	return func(r *core.Record) bool { return set[r.Id] }, nil
+}
+
 // rolesScopeKeep matches the user's own role records, plus every role
 // record in a congregation they hold any role in — any congregation member
 // may list the full roster, not just admins.
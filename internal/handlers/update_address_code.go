@@ -131,7 +131,7 @@ func HandleMapUpdateSequence(e *core.RequestEvent, app core.App) error {
 		return apis.NewNotFoundError("Map not found", nil)
 	}
 
-	if !AuthorizeByRole(app, e.Auth.Id, mapData.GetString("congregation"), "administrator") {
+	if !AuthorizeMapByRole(app, e.Auth.Id, mapData.Id, "administrator") {
 		return apis.NewForbiddenError("Administrator access required", nil)
 	}
 
@@ -141,6 +141,25 @@ func HandleMapUpdateSequence(e *core.RequestEvent, app core.App) error {
 
 	log.Println("Updating sequences for", len(data.Codes), "codes in map", data.MapId)
 
+	var current []struct {
+		Code     string `db:"code"`
+		Sequence int    `db:"sequence"`
+	}
+	if err := app.DB().NewQuery("SELECT code, MIN(sequence) AS sequence FROM addresses WHERE map = {:map} GROUP BY code").
+		Bind(dbx.Params{"map": data.MapId}).All(&current); err != nil {
+		return newServerError(err)
+	}
+	oldSequence := make(map[string]int, len(current))
+	for _, row := range current {
+		oldSequence[row.Code] = row.Sequence
+	}
+	changes := map[string]any{}
+	for _, codeSeq := range data.Codes {
+		if old := oldSequence[codeSeq.Code]; old != codeSeq.Sequence {
+			changes[codeSeq.Code] = fromTo(old, codeSeq.Sequence)
+		}
+	}
+
 	err = app.RunInTransaction(func(txApp core.App) error {
 		for _, codeSeq := range data.Codes {
 			records, err := txApp.FindRecordsByFilter(
@@ -172,6 +191,12 @@ func HandleMapUpdateSequence(e *core.RequestEvent, app core.App) error {
 		return newServerError(err)
 	}
 
+	if len(changes) > 0 {
+		writeStructureLog(app, mapData.GetString("congregation"), structureCodesResequenced, "map", data.MapId, authID(e.Auth), map[string]any{
+			"codes": changes,
+		})
+	}
+
 	return e.String(http.StatusOK, "Address sequences updated successfully")
 }
 
@@ -194,18 +219,27 @@ func HandleMapDelete(c *core.RequestEvent, app core.App) error {
 		return apis.NewBadRequestError("code is required", nil)
 	}
 
-	code := data.Code
-	mapId := data.Map
-
-	mapData, err := fetchMapData(app, mapId)
+	mapData, err := fetchMapData(app, data.Map)
 	if err != nil {
 		return apis.NewNotFoundError("Map not found", nil)
 	}
 
-	if !AuthorizeByRole(app, c.Auth.Id, mapData.GetString("congregation"), "administrator") {
+	if !AuthorizeMapByRole(app, c.Auth.Id, mapData.Id, "administrator") {
 		return apis.NewForbiddenError("Administrator access required", nil)
 	}
 
+	if err := deleteMapCode(app, mapData, data.Code, authID(c.Auth)); err != nil {
+		return err
+	}
+
+	return c.String(http.StatusOK, "Addresses code deleted successfully")
+}
+
+// deleteMapCode removes every address for code on mapData, refusing to remove
+// the map's last code, then logs the change and refreshes aggregates. Shared by
+// HandleMapDelete and approved change requests.
+func deleteMapCode(app core.App, mapData *core.Record, code, changedBy string) error {
+	mapId := mapData.Id
 	log.Println("Deleting addresses for code", code, "in map", mapId)
 
 	codeCount, err := countUniqueAddressCodes(app, mapId)
@@ -234,7 +268,16 @@ func HandleMapDelete(c *core.RequestEvent, app core.App) error {
 	if err != nil {
 		return newServerError(err)
 	}
+	floors := make([]int, len(addressRecords))
+	for i, addressRecord := range addressRecords {
+		floors[i] = addressRecord.GetInt("floor")
+	}
+	writeStructureLog(app, mapData.GetString("congregation"), structureCodeDeleted, "map", mapId, changedBy, map[string]any{
+		"code":   code,
+		"floors": floors,
+	})
+
 	ProcessMapAggregates(mapId, app)
 
-	return c.String(http.StatusOK, "Addresses code deleted successfully")
+	return nil
 }
@@ -76,6 +76,7 @@ func ProcessMapAggregates(mapID string, app core.App, resetTerritoryAggregates .
 		return err
 	}
 
+	prevProgress := mapRecord.GetInt("progress")
 	mapRecord.Set("aggregates", amap)
 	mapRecord.Set("progress", donePercentage)
 
@@ -84,6 +85,9 @@ func ProcessMapAggregates(mapID string, app core.App, resetTerritoryAggregates .
 		return err
 	}
 
+	active := aggregates.Done+aggregates.NotHomeMaxTries+aggregates.NotHomeLessTries > 0
+	trackCoverageCycle(app, "map", mapRecord.GetString("congregation"), mapRecord.GetString("territory"), mapID, prevProgress, donePercentage, active, amap)
+
 	reset := true
 	if len(resetTerritoryAggregates) > 0 {
 		reset = resetTerritoryAggregates[0]
@@ -100,15 +104,26 @@ func ProcessMapAggregates(mapID string, app core.App, resetTerritoryAggregates .
 
 // ProcessTerritoryAggregates recalculates a territory's progress percentage
 // by summing the completed/total values stored in each map's aggregates.
+// The remaining per-status sums feed the territory's coverage cycle.
 func ProcessTerritoryAggregates(territoryID string, app core.App) error {
 	progress := struct {
 		Completed int `db:"completed"`
 		Total     int `db:"total"`
+		NotDone   int `db:"not_done"`
+		Done      int `db:"done"`
+		NotHome   int `db:"not_home"`
+		Invalid   int `db:"invalid"`
+		Dnc       int `db:"dnc"`
 	}{}
 	err := app.DB().NewQuery(`
 		SELECT
 			COALESCE(SUM(json_extract(COALESCE(NULLIF(aggregates, ''), '{}'), '$.completed')), 0) AS completed,
-			COALESCE(SUM(json_extract(COALESCE(NULLIF(aggregates, ''), '{}'), '$.total')), 0) AS total
+			COALESCE(SUM(json_extract(COALESCE(NULLIF(aggregates, ''), '{}'), '$.total')), 0) AS total,
+			COALESCE(SUM(json_extract(COALESCE(NULLIF(aggregates, ''), '{}'), '$.notDone')), 0) AS not_done,
+			COALESCE(SUM(json_extract(COALESCE(NULLIF(aggregates, ''), '{}'), '$.done')), 0) AS done,
+			COALESCE(SUM(json_extract(COALESCE(NULLIF(aggregates, ''), '{}'), '$.notHome')), 0) AS not_home,
+			COALESCE(SUM(json_extract(COALESCE(NULLIF(aggregates, ''), '{}'), '$.invalid')), 0) AS invalid,
+			COALESCE(SUM(json_extract(COALESCE(NULLIF(aggregates, ''), '{}'), '$.dnc')), 0) AS dnc
 		FROM maps
 		WHERE territory = {:territory}
 	`).Bind(dbx.Params{"territory": territoryID}).One(&progress)
@@ -128,6 +143,7 @@ func ProcessTerritoryAggregates(territoryID string, app core.App) error {
 		return err
 	}
 
+	prevProgress := territoryRecord.GetInt("progress")
 	territoryRecord.Set("progress", donePercentage)
 
 	if err := app.SaveNoValidate(territoryRecord); err != nil {
@@ -135,5 +151,17 @@ func ProcessTerritoryAggregates(territoryID string, app core.App) error {
 		return err
 	}
 
+	breakdown := map[string]interface{}{
+		"notDone":   progress.NotDone,
+		"done":      progress.Done,
+		"notHome":   progress.NotHome,
+		"invalid":   progress.Invalid,
+		"dnc":       progress.Dnc,
+		"completed": progress.Completed,
+		"total":     progress.Total,
+	}
+	active := progress.Completed+progress.NotHome > 0
+	trackCoverageCycle(app, "territory", territoryRecord.GetString("congregation"), territoryID, "", prevProgress, donePercentage, active, breakdown)
+
 	return nil
 }
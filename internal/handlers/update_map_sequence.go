@@ -30,7 +30,7 @@ func HandleUpdateTerritoryMapSequence(e *core.RequestEvent, app core.App) error
 		return apis.NewNotFoundError("Territory not found", nil)
 	}
 
-	if !AuthorizeByRole(app, e.Auth.Id, congId, "administrator") {
+	if !AuthorizeTerritoryByRole(app, e.Auth.Id, data.TerritoryId, "administrator") {
 		return apis.NewForbiddenError("Administrator access required", nil)
 	}
 
@@ -61,6 +61,13 @@ func HandleUpdateTerritoryMapSequence(e *core.RequestEvent, app core.App) error
 		}
 	}
 
+	changes := map[string]any{}
+	for i, id := range data.MapIds {
+		if old := recordById[id].GetInt("sequence"); old != i+1 {
+			changes[id] = fromTo(old, i+1)
+		}
+	}
+
 	err = app.RunInTransaction(func(txApp core.App) error {
 		for i, id := range data.MapIds {
 			rec := recordById[id]
@@ -75,5 +82,11 @@ func HandleUpdateTerritoryMapSequence(e *core.RequestEvent, app core.App) error
 		return newServerError(err)
 	}
 
+	if len(changes) > 0 {
+		writeStructureLog(app, congId, structureMapsResequenced, "territory", data.TerritoryId, authID(e.Auth), map[string]any{
+			"maps": changes,
+		})
+	}
+
 	return e.String(http.StatusOK, "Map sequences updated")
 }
@@ -38,7 +38,7 @@ func HandleMapTerritoryUpdate(e *core.RequestEvent, app core.App) error {
 	}
 
 	congregation := mapDetails.GetString("congregation")
-	if !AuthorizeByRole(app, e.Auth.Id, congregation, "administrator") {
+	if !AuthorizeMapByRole(app, e.Auth.Id, mapDetails.Id, "administrator") {
 		return apis.NewForbiddenError("Administrator access required", nil)
 	}
 
@@ -47,6 +47,9 @@ func HandleMapTerritoryUpdate(e *core.RequestEvent, app core.App) error {
 	if getTerritoryCongregation(app, data.NewTerritory) != congregation {
 		return apis.NewBadRequestError("Invalid destination territory", nil)
 	}
+	if !AuthorizeTerritoryByRole(app, e.Auth.Id, data.NewTerritory, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
 
 	// Taken from the record rather than the request body: the caller does not get
 	// to choose which territory gets its aggregates recalculated.
@@ -76,6 +79,11 @@ func HandleMapTerritoryUpdate(e *core.RequestEvent, app core.App) error {
 		return newServerError(err)
 	}
 
+	writeStructureLog(app, congregation, structureMapMoved, "map", data.Map, authID(e.Auth), map[string]any{
+		"territory": fromTo(oldTerritory, newTerritory),
+		"addresses": len(addressRecords),
+	})
+
 	ProcessTerritoryAggregates(oldTerritory, app)
 	ProcessTerritoryAggregates(newTerritory, app)
 
@@ -270,6 +270,27 @@ func handleOptionDeletion(txDao core.App, id, defaultId, congregation string) er
 	return nil
 }
 
+// optionDiff returns a from/to entry for every field in next whose value
+// differs from the option record as it stands.
+func optionDiff(record *core.Record, next map[string]any) map[string]any {
+	changes := map[string]any{}
+	for field, value := range next {
+		var current any
+		switch value.(type) {
+		case bool:
+			current = record.GetBool(field)
+		case int:
+			current = record.GetInt(field)
+		default:
+			current = record.GetString(field)
+		}
+		if current != value {
+			changes[field] = fromTo(current, value)
+		}
+	}
+	return changes
+}
+
 // HandleOptionUpdate processes batch updates of congregation options within a transaction
 func HandleOptionUpdate(c *core.RequestEvent, app core.App) error {
 	requestInfo, _ := c.RequestInfo()
@@ -302,6 +323,9 @@ func HandleOptionUpdate(c *core.RequestEvent, app core.App) error {
 	var defaultOption string
 	var affectedMaps []string // maps to recalculate if is_countable changes
 
+	// Collected for structure_log; only written once the transaction commits.
+	var created, updated, deleted []map[string]any
+
 	err := app.RunInTransaction(func(txApp core.App) error {
 		batchOptionIds := make(map[string]bool)
 		for _, option := range options {
@@ -375,6 +399,14 @@ func HandleOptionUpdate(c *core.RequestEvent, app core.App) error {
 					}
 				}
 
+				changes := optionDiff(optionRecord, map[string]any{
+					"is_default":   isDefault,
+					"is_countable": isCountable,
+					"code":         code,
+					"description":  description,
+					"sequence":     sequence,
+				})
+
 				optionRecord.Set("is_default", isDefault)
 				optionRecord.Set("is_countable", isCountable)
 				optionRecord.Set("code", code)
@@ -385,6 +417,11 @@ func HandleOptionUpdate(c *core.RequestEvent, app core.App) error {
 					return err
 				}
 
+				if len(changes) > 0 {
+					changes["id"] = optionRecord.Id
+					updated = append(updated, changes)
+				}
+
 				if isDefault {
 					defaultOption = optionRecord.Id
 				}
@@ -406,6 +443,15 @@ func HandleOptionUpdate(c *core.RequestEvent, app core.App) error {
 					return err
 				}
 
+				created = append(created, map[string]any{
+					"id":           newOption.Id,
+					"code":         code,
+					"description":  description,
+					"is_default":   isDefault,
+					"is_countable": isCountable,
+					"sequence":     sequence,
+				})
+
 				if isDefault {
 					defaultOption = newOption.Id
 				}
@@ -427,9 +473,20 @@ func HandleOptionUpdate(c *core.RequestEvent, app core.App) error {
 					return err
 				}
 
+				deletedRecord, err := txApp.FindRecordById("options", id)
+				if err != nil {
+					return err
+				}
+
 				if err := handleOptionDeletion(txApp, id, defaultOption, congregation); err != nil {
 					return err
 				}
+
+				deleted = append(deleted, map[string]any{
+					"id":          id,
+					"code":        deletedRecord.GetString("code"),
+					"description": deletedRecord.GetString("description"),
+				})
 			}
 		}
 
@@ -452,6 +509,14 @@ func HandleOptionUpdate(c *core.RequestEvent, app core.App) error {
 		}
 	}
 
+	if len(created)+len(updated)+len(deleted) > 0 {
+		writeStructureLog(app, congregation, structureOptionsUpdated, "congregation", congregation, authID(c.Auth), map[string]any{
+			"created": created,
+			"updated": updated,
+			"deleted": deleted,
+		})
+	}
+
 	log.Printf("Options update completed for congregation: %s", congregation)
 	return c.JSON(200, map[string]any{"message": "Options processed successfully"})
 }
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// The functions below turn domain hooks into webhook events. app is the
+// root app captured by RegisterDomainHooks rather than e.App, which may be a
+// transaction that has already committed by the time its after-success hooks
+// run.
+
+// EmitAddressStatusWebhook sends address.status_changed when an address's
+// status changed, except during a bulk map reset. It should be called from
+// OnRecordAfterUpdateSuccess("addresses").
+func EmitAddressStatusWebhook(app core.App, e *core.RecordEvent) {
+	oldStatus := e.Record.Original().GetString("status")
+	newStatus := e.Record.GetString("status")
+	if oldStatus == newStatus || oldStatus == "" {
+		return
+	}
+	mapID := e.Record.GetString("map")
+	if mapID != "" && app.Store().Has("bulk_reset:"+mapID) {
+		return
+	}
+	EmitWebhookEvent(app, e.Record.GetString("congregation"), WebhookAddressStatusChanged, map[string]any{
+		"address":        e.Record.Id,
+		"map":            mapID,
+		"territory":      e.Record.GetString("territory"),
+		"code":           e.Record.GetString("code"),
+		"floor":          e.Record.GetInt("floor"),
+		"old_status":     oldStatus,
+		"new_status":     newStatus,
+		"not_home_tries": e.Record.GetInt("not_home_tries"),
+		"changed_by":     e.Record.GetString("updated_by"),
+	})
+}
+
+func assignmentWebhookData(assignment *core.Record) map[string]any {
+	return map[string]any{
+		"assignment":  assignment.Id,
+		"map":         assignment.GetString("map"),
+		"type":        assignment.GetString("type"),
+		"user":        assignment.GetString("user"),
+		"publisher":   assignment.GetString("publisher"),
+		"expiry_date": assignment.GetDateTime("expiry_date"),
+	}
+}
+
+// EmitAssignmentCreatedWebhook sends assignment.created. It should be called
+// from OnRecordAfterCreateSuccess("assignments"), which also covers
+// assignments made by quicklinks.
+func EmitAssignmentCreatedWebhook(app core.App, e *core.RecordEvent) {
+	EmitWebhookEvent(app, e.Record.GetString("congregation"), WebhookAssignmentCreated, assignmentWebhookData(e.Record))
+}
+
+// EmitAssignmentExpiredWebhook sends assignment.expired when a deleted
+// assignment was past its expiry date, as the cleanup job's are. It should be
+// called from OnRecordAfterDeleteSuccess("assignments").
+func EmitAssignmentExpiredWebhook(app core.App, e *core.RecordEvent) {
+	expiry := e.Record.GetDateTime("expiry_date")
+	if expiry.IsZero() || expiry.Time().After(time.Now()) {
+		return
+	}
+	EmitWebhookEvent(app, e.Record.GetString("congregation"), WebhookAssignmentExpired, assignmentWebhookData(e.Record))
+}
+
+func roleWebhookData(role *core.Record) map[string]any {
+	return map[string]any{
+		"role_id":     role.Id,
+		"user":        role.GetString("user"),
+		"role":        role.GetString("role"),
+		"territories": role.GetStringSlice("territories"),
+		"expires_at":  role.GetDateTime("expires_at"),
+	}
+}
+
+// EmitRoleGrantedWebhook sends role.granted for every new role, however it
+// was granted. It should be called from OnRecordAfterCreateSuccess("roles").
+func EmitRoleGrantedWebhook(app core.App, e *core.RecordEvent) {
+	EmitWebhookEvent(app, e.Record.GetString("congregation"), WebhookRoleGranted, roleWebhookData(e.Record))
+}
+
+// EmitRoleRevokedWebhook sends role.revoked for every deleted role, with
+// reason "expired" for roles past their expires_at. It should be called from
+// OnRecordAfterDeleteSuccess("roles").
+func EmitRoleRevokedWebhook(app core.App, e *core.RecordEvent) {
+	data := roleWebhookData(e.Record)
+	data["reason"] = "revoked"
+	if expires := e.Record.GetDateTime("expires_at"); !expires.IsZero() && !expires.Time().After(time.Now()) {
+		data["reason"] = "expired"
+	}
+	EmitWebhookEvent(app, e.Record.GetString("congregation"), WebhookRoleRevoked, data)
+}
+
+// EmitMapCompletedWebhook sends map.completed when a map's progress reaches
+// 100%. It should be called from OnRecordAfterUpdateSuccess("maps").
+func EmitMapCompletedWebhook(app core.App, e *core.RecordEvent) {
+	if e.Record.GetInt("progress") < 100 || e.Record.Original().GetInt("progress") >= 100 {
+		return
+	}
+	EmitWebhookEvent(app, e.Record.GetString("congregation"), WebhookMapCompleted, map[string]any{
+		"map":         e.Record.Id,
+		"territory":   e.Record.GetString("territory"),
+		"description": e.Record.GetString("description"),
+		"aggregates":  e.Record.Get("aggregates"),
+	})
+}
+
+func emitMessageWebhook(app core.App, message *core.Record) {
+	EmitWebhookEvent(app, message.GetString("congregation"), WebhookMessageCreated, map[string]any{
+		"message":    message.Id,
+		"map":        message.GetString("map"),
+		"parent":     message.GetString("parent"),
+		"type":       message.GetString("type"),
+		"created_by": message.GetString("created_by"),
+		"text":       message.GetString("message"),
+	})
+}
+
+// EmitMessageCreatedWebhook sends message.created for a new message, unless
+// it is scheduled: those are sent by EmitMessagePublishedWebhook. It should
+// be called from OnRecordAfterCreateSuccess("messages").
+func EmitMessageCreatedWebhook(app core.App, e *core.RecordEvent) {
+	if !e.Record.GetDateTime("publish_at").IsZero() && e.Record.GetDateTime("published_at").IsZero() {
+		return
+	}
+	emitMessageWebhook(app, e.Record)
+}
+
+// EmitMessagePublishedWebhook sends message.created when a scheduled message
+// is published. It should be called from OnRecordAfterUpdateSuccess("messages").
+func EmitMessagePublishedWebhook(app core.App, e *core.RecordEvent) {
+	if e.Record.GetDateTime("published_at").IsZero() || !e.Record.Original().GetDateTime("published_at").IsZero() {
+		return
+	}
+	emitMessageWebhook(app, e.Record)
+}
@@ -0,0 +1,606 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/routine"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Webhook events, as listed in the webhooks.events field.
+const (
+	WebhookAddressStatusChanged = "address.status_changed"
+	WebhookAssignmentCreated    = "assignment.created"
+	WebhookAssignmentExpired    = "assignment.expired"
+	WebhookRoleGranted          = "role.granted"
+	WebhookRoleRevoked          = "role.revoked"
+	WebhookMapCompleted         = "map.completed"
+	WebhookMessageCreated       = "message.created"
+
+	// webhookPing is sent only by HandleTestWebhook.
+	webhookPing = "ping"
+)
+
+var WebhookEvents = []string{
+	WebhookAddressStatusChanged,
+	WebhookAssignmentCreated,
+	WebhookAssignmentExpired,
+	WebhookRoleGranted,
+	WebhookRoleRevoked,
+	WebhookMapCompleted,
+	WebhookMessageCreated,
+}
+
+const (
+	// WebhookMaxAttempts is how many deliveries are tried before one is
+	// marked failed. With webhookBaseBackoff doubling per attempt this spans
+	// about a day.
+	WebhookMaxAttempts  = 10
+	webhookBaseBackoff  = time.Minute
+	webhookMaxBackoff   = 6 * time.Hour
+	webhookTimeout      = 10 * time.Second
+	webhookSecretLength = 32
+
+	// WebhookStaleSending is how long a delivery may stay in sending before
+	// the retry job assumes the process sending it died.
+	WebhookStaleSending = 5 * time.Minute
+
+	// Headers on every delivery. The signature is
+	// t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>" keyed by the secret>.
+	webhookSignatureHeader = "X-Ministry-Mapper-Signature"
+	webhookEventHeader     = "X-Ministry-Mapper-Event"
+	webhookDeliveryHeader  = "X-Ministry-Mapper-Delivery"
+)
+
+// webhookPayload is the JSON body of a delivery.
+type webhookPayload struct {
+	ID           string         `json:"id"`
+	Event        string         `json:"event"`
+	Congregation string         `json:"congregation"`
+	OccurredAt   string         `json:"occurred_at"`
+	Data         map[string]any `json:"data"`
+}
+
+// EmitWebhookEvent queues a delivery of event to each of the congregation's
+// active webhooks subscribed to it, then tries them in the background so the
+// caller is not held up by slow endpoints. Failures are retried by the
+// webhook delivery job. Errors are logged: a webhook must never fail the
+// change that triggered it.
+func EmitWebhookEvent(app core.App, congregation, event string, data map[string]any) {
+	if congregation == "" {
+		return
+	}
+	webhooks, err := app.FindAllRecords("webhooks", dbx.NewExp(
+		`congregation = {:congregation} AND active = TRUE AND EXISTS (
+			SELECT 1 FROM json_each(webhooks.events) WHERE value = {:event})`,
+		dbx.Params{"congregation": congregation, "event": event},
+	))
+	if err != nil {
+		log.Printf("EmitWebhookEvent: failed to find webhooks for %s in %s: %v", event, congregation, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	queued := make([]*core.Record, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		delivery, err := queueWebhookDelivery(app, webhook, event, data)
+		if err != nil {
+			log.Printf("EmitWebhookEvent: failed to queue %s for webhook %s: %v", event, webhook.Id, err)
+			continue
+		}
+		queued = append(queued, delivery)
+	}
+
+	routine.FireAndForget(func() {
+		for _, delivery := range queued {
+			_ = DeliverWebhook(app, delivery, time.Now().UTC())
+		}
+	})
+}
+
+func queueWebhookDelivery(app core.App, webhook *core.Record, event string, data map[string]any) (*core.Record, error) {
+	col, err := app.FindCachedCollectionByNameOrId("webhook_deliveries")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	delivery := core.NewRecord(col)
+	delivery.Id = core.GenerateDefaultRandomId()
+	delivery.Set("webhook", webhook.Id)
+	delivery.Set("congregation", webhook.GetString("congregation"))
+	delivery.Set("event", event)
+	delivery.Set("payload", webhookPayload{
+		ID:           delivery.Id,
+		Event:        event,
+		Congregation: webhook.GetString("congregation"),
+		OccurredAt:   now.Format(time.RFC3339),
+		Data:         data,
+	})
+	delivery.Set("status", "pending")
+	delivery.Set("next_attempt_at", now)
+	if err := app.Save(delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// DeliverWebhook claims delivery, posts it to its webhook and records the
+// outcome. The claim is a conditional update so two runs never post the same
+// delivery at once. The returned error is the delivery failure, already
+// recorded on the row.
+func DeliverWebhook(app core.App, delivery *core.Record, now time.Time) error {
+	res, err := app.DB().NewQuery(`
+		UPDATE webhook_deliveries SET status = 'sending', updated = {:now}
+		WHERE id = {:id} AND (status = 'pending' OR (status = 'sending' AND updated <= {:stale}))
+	`).Bind(dbx.Params{
+		"id":    delivery.Id,
+		"now":   now.Format(types.DefaultDateLayout),
+		"stale": now.Add(-WebhookStaleSending).Format(types.DefaultDateLayout),
+	}).Execute()
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	// Reload: the caller's copy predates the claim.
+	delivery, err = app.FindRecordById("webhook_deliveries", delivery.Id)
+	if err != nil {
+		return err
+	}
+
+	status, err := postWebhook(app, delivery, now)
+	attempts := delivery.GetInt("attempts") + 1
+	delivery.Set("attempts", attempts)
+	delivery.Set("response_status", status)
+	if err != nil {
+		delivery.Set("last_error", truncateWebhookError(err.Error()))
+		if attempts >= WebhookMaxAttempts {
+			delivery.Set("status", "failed")
+		} else {
+			delivery.Set("status", "pending")
+			delivery.Set("next_attempt_at", now.Add(WebhookBackoff(attempts)))
+		}
+	} else {
+		delivery.Set("status", "delivered")
+		delivery.Set("delivered_at", now)
+		delivery.Set("last_error", "")
+	}
+	if saveErr := app.Save(delivery); saveErr != nil {
+		log.Printf("DeliverWebhook: failed to record attempt on %s: %v", delivery.Id, saveErr)
+	}
+	return err
+}
+
+// postWebhook sends one signed delivery, returning the endpoint's HTTP status
+// (0 if it was never reached) and an error unless it answered 2xx.
+func postWebhook(app core.App, delivery *core.Record, now time.Time) (int, error) {
+	webhook, err := app.FindRecordById("webhooks", delivery.GetString("webhook"))
+	if err != nil {
+		return 0, fmt.Errorf("webhook not found: %w", err)
+	}
+	if !webhook.GetBool("active") && delivery.GetString("event") != webhookPing {
+		return 0, errors.New("webhook is disabled")
+	}
+
+	body := []byte(delivery.GetString("payload"))
+	req, err := http.NewRequest(http.MethodPost, webhook.GetString("url"), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Ministry-Mapper-Webhooks/1.0")
+	req.Header.Set(webhookEventHeader, delivery.GetString("event"))
+	req.Header.Set(webhookDeliveryHeader, delivery.Id)
+	req.Header.Set(webhookSignatureHeader, SignWebhook(webhook.GetString("secret"), now.Unix(), body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %d: %s", resp.StatusCode, snippet)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook is the signature header value for body sent at timestamp.
+// Receivers recompute the HMAC over "<t>.<body>" and should reject
+// timestamps more than a few minutes old.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	t := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookBackoff is the wait after the given number of failed attempts.
+func WebhookBackoff(attempts int) time.Duration {
+	wait := webhookBaseBackoff
+	for i := 1; i < attempts && wait < webhookMaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, webhookMaxBackoff)
+}
+
+// allowPrivateTargets reports whether WEBHOOK_ALLOW_PRIVATE_TARGETS=true
+// lifts the public-address guard on outgoing requests, for local development.
+func allowPrivateTargets() bool {
+	return os.Getenv("WEBHOOK_ALLOW_PRIVATE_TARGETS") == "true"
+}
+
+// nonPublicPrefixes are the special-purpose ranges (RFC 6890 and the IANA
+// registries) an outgoing request must never reach.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("10.0.0.0/8"),      // private
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT, cloud metadata
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // link-local
+	netip.MustParsePrefix("172.16.0.0/12"),   // private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relay anycast
+	netip.MustParsePrefix("192.168.0.0/16"),  // private
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, broadcast
+	netip.MustParsePrefix("::/128"),          // unspecified
+	netip.MustParsePrefix("::1/128"),         // loopback
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local NAT64
+	netip.MustParsePrefix("100::/64"),        // discard
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments, Teredo
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4
+	netip.MustParsePrefix("fc00::/7"),        // unique local
+	netip.MustParsePrefix("fe80::/10"),       // link-local
+	netip.MustParsePrefix("fec0::/10"),       // deprecated site-local
+	netip.MustParsePrefix("ff00::/8"),        // multicast
+}
+
+// isPublicAddress reports whether ip lies outside every non-public range.
+// IPv4-mapped IPv6 addresses are judged as the IPv4 address they carry, and
+// zones are dropped since a zoned address never matches a prefix.
+func isPublicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap().WithZone("")
+	if !ip.IsValid() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookIdleTimeout is how long an idle keep-alive connection to a webhook
+// or push endpoint stays open for reuse.
+const webhookIdleTimeout = 90 * time.Second
+
+// webhookClient is shared by every webhook delivery and push, so keep-alive
+// connections are pooled and closed once idle rather than left open by a
+// transport built per request.
+var webhookClient = newWebhookClient()
+
+// newWebhookClient refuses to connect to any non-public address, so a webhook
+// cannot be pointed at the server's own network or its cloud metadata service.
+// The check runs on the resolved address being dialled, so DNS cannot dodge
+// it. Push subscription endpoints, being supplied by the caller too, go
+// through the same client.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivateTargets() {
+				return nil
+			}
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddress(addrPort.Addr()) {
+				return fmt.Errorf("target %s is not a public address", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			IdleConnTimeout:     webhookIdleTimeout,
+			TLSHandshakeTimeout: webhookTimeout,
+		},
+		// A redirect could lead anywhere; the endpoint must answer itself.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func truncateWebhookError(s string) string {
+	if len(s) <= 1000 {
+		return s
+	}
+	return s[:999] + "…"
+}
+
+type ListWebhooksRequest struct {
+	Congregation string `json:"congregation"`
+}
+
+type SaveWebhookRequest struct {
+	Congregation string   `json:"congregation"`
+	Id           string   `json:"id"`
+	URL          string   `json:"url"`
+	Description  string   `json:"description"`
+	Events       []string `json:"events"`
+	Active       *bool    `json:"active"`
+	RotateSecret bool     `json:"rotate_secret"`
+}
+
+type WebhookRequest struct {
+	Id string `json:"id"`
+}
+
+type ListWebhookDeliveriesRequest struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+}
+
+func webhookResponse(webhook *core.Record) map[string]any {
+	return map[string]any{
+		"id":          webhook.Id,
+		"url":         webhook.GetString("url"),
+		"description": webhook.GetString("description"),
+		"events":      webhook.GetStringSlice("events"),
+		"active":      webhook.GetBool("active"),
+		"created":     webhook.GetDateTime("created"),
+		"updated":     webhook.GetDateTime("updated"),
+	}
+}
+
+// findAdminWebhook loads a webhook the caller administers.
+func findAdminWebhook(e *core.RequestEvent, app core.App, id string) (*core.Record, error) {
+	if id == "" {
+		return nil, apis.NewBadRequestError("id is required", nil)
+	}
+	webhook, err := app.FindRecordById("webhooks", id)
+	if err != nil {
+		return nil, apis.NewNotFoundError("Webhook not found", nil)
+	}
+	if !AuthorizeByRole(app, e.Auth.Id, webhook.GetString("congregation"), "administrator") {
+		return nil, apis.NewForbiddenError("Administrator access required", nil)
+	}
+	return webhook, nil
+}
+
+// HandleListWebhooks lists a congregation's webhooks, without their secrets.
+func HandleListWebhooks(e *core.RequestEvent, app core.App) error {
+	data := ListWebhooksRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	if data.Congregation == "" {
+		return apis.NewBadRequestError("congregation is required", nil)
+	}
+	if !AuthorizeByRole(app, e.Auth.Id, data.Congregation, "administrator") {
+		return apis.NewForbiddenError("Administrator access required", nil)
+	}
+
+	webhooks, err := app.FindRecordsByFilter("webhooks", "congregation = {:congregation}", "created", 0, 0,
+		dbx.Params{"congregation": data.Congregation})
+	if err != nil {
+		return newServerError(err)
+	}
+	response := make([]map[string]any, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		response = append(response, webhookResponse(webhook))
+	}
+	return e.JSON(http.StatusOK, map[string]any{"events": WebhookEvents, "webhooks": response})
+}
+
+// HandleSaveWebhook creates a webhook, or updates the one named by id. The
+// signing secret is generated on creation and returned only then, or when
+// rotate_secret replaces it.
+func HandleSaveWebhook(e *core.RequestEvent, app core.App) error {
+	data := SaveWebhookRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	target, err := url.Parse(data.URL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		return apis.NewBadRequestError("url must be an http or https URL", nil)
+	}
+	if len(data.Events) == 0 {
+		return apis.NewBadRequestError("events is required", nil)
+	}
+	for _, event := range data.Events {
+		if !slices.Contains(WebhookEvents, event) {
+			return apis.NewBadRequestError("Unknown webhook event: "+event, nil)
+		}
+	}
+
+	var webhook *core.Record
+	if data.Id != "" {
+		webhook, err = findAdminWebhook(e, app, data.Id)
+		if err != nil {
+			return err
+		}
+	} else {
+		if data.Congregation == "" {
+			return apis.NewBadRequestError("congregation is required", nil)
+		}
+		if !AuthorizeByRole(app, e.Auth.Id, data.Congregation, "administrator") {
+			return apis.NewForbiddenError("Administrator access required", nil)
+		}
+		collection, err := app.FindCachedCollectionByNameOrId("webhooks")
+		if err != nil {
+			return newServerError(err)
+		}
+		webhook = core.NewRecord(collection)
+		webhook.Set("congregation", data.Congregation)
+		webhook.Set("active", true)
+	}
+
+	webhook.Set("url", data.URL)
+	webhook.Set("description", data.Description)
+	webhook.Set("events", data.Events)
+	if data.Active != nil {
+		webhook.Set("active", *data.Active)
+	}
+	secret := ""
+	if webhook.IsNew() || data.RotateSecret {
+		secret = "whsec_" + security.RandomString(webhookSecretLength)
+		webhook.Set("secret", secret)
+	}
+	if err := app.Save(webhook); err != nil {
+		return apis.NewBadRequestError("Invalid webhook", err)
+	}
+
+	response := webhookResponse(webhook)
+	if secret != "" {
+		response["secret"] = secret
+	}
+	return e.JSON(http.StatusOK, response)
+}
+
+// HandleDeleteWebhook deletes a webhook and its delivery log.
+func HandleDeleteWebhook(e *core.RequestEvent, app core.App) error {
+	data := WebhookRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	webhook, err := findAdminWebhook(e, app, data.Id)
+	if err != nil {
+		return err
+	}
+	if err := app.Delete(webhook); err != nil {
+		return newServerError(err)
+	}
+	return e.JSON(http.StatusOK, map[string]any{"id": webhook.Id})
+}
+
+// HandleTestWebhook sends a ping delivery to a webhook straight away, even a
+// disabled one, and returns how the endpoint answered. A failed ping is
+// logged like any delivery but not retried.
+func HandleTestWebhook(e *core.RequestEvent, app core.App) error {
+	data := WebhookRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	webhook, err := findAdminWebhook(e, app, data.Id)
+	if err != nil {
+		return err
+	}
+
+	delivery, err := queueWebhookDelivery(app, webhook, webhookPing, map[string]any{
+		"webhook":      webhook.Id,
+		"triggered_by": e.Auth.Id,
+	})
+	if err != nil {
+		return newServerError(err)
+	}
+	deliverErr := DeliverWebhook(app, delivery, time.Now().UTC())
+	delivery, err = app.FindRecordById("webhook_deliveries", delivery.Id)
+	if err != nil {
+		return newServerError(err)
+	}
+	if deliverErr != nil {
+		delivery.Set("status", "failed")
+		if err := app.Save(delivery); err != nil {
+			return newServerError(err)
+		}
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"delivery":        delivery.Id,
+		"delivered":       deliverErr == nil,
+		"response_status": delivery.GetInt("response_status"),
+		"error":           delivery.GetString("last_error"),
+	})
+}
+
+type webhookDeliveryEntry struct {
+	Id             string        `db:"id"              json:"id"`
+	Event          string        `db:"event"           json:"event"`
+	Status         string        `db:"status"          json:"status"`
+	Attempts       int           `db:"attempts"        json:"attempts"`
+	ResponseStatus int           `db:"response_status" json:"response_status"`
+	LastError      string        `db:"last_error"      json:"last_error"`
+	NextAttemptAt  string        `db:"next_attempt_at" json:"next_attempt_at"`
+	DeliveredAt    string        `db:"delivered_at"    json:"delivered_at"`
+	Payload        types.JSONRaw `db:"payload"         json:"payload"`
+	Created        string        `db:"created"         json:"created"`
+}
+
+// HandleListWebhookDeliveries is a webhook's delivery log, newest first.
+// status narrows it to pending, delivered or failed.
+func HandleListWebhookDeliveries(e *core.RequestEvent, app core.App) error {
+	data := ListWebhookDeliveriesRequest{}
+	if err := e.BindBody(&data); err != nil {
+		return apis.NewBadRequestError("Invalid request body", nil)
+	}
+	webhook, err := findAdminWebhook(e, app, data.Id)
+	if err != nil {
+		return err
+	}
+
+	filter := "1 = 1"
+	switch data.Status {
+	case "":
+	case "pending":
+		filter = "status IN ('pending', 'sending')"
+	case "delivered", "failed":
+		filter = "status = '" + data.Status + "'"
+	default:
+		return apis.NewBadRequestError("status must be pending, delivered or failed", nil)
+	}
+
+	entries := []webhookDeliveryEntry{}
+	err = app.DB().NewQuery(`
+		SELECT id, event, status, COALESCE(attempts, 0) AS attempts,
+		       COALESCE(response_status, 0) AS response_status, COALESCE(last_error, '') AS last_error,
+		       COALESCE(next_attempt_at, '') AS next_attempt_at, COALESCE(delivered_at, '') AS delivered_at,
+		       payload, created
+		FROM webhook_deliveries
+		WHERE webhook = {:webhook} AND ` + filter + `
+		ORDER BY created DESC
+		LIMIT 200
+	`).Bind(dbx.Params{"webhook": webhook.Id}).All(&entries)
+	if err != nil {
+		return newServerError(err)
+	}
+	return e.JSON(http.StatusOK, entries)
+}
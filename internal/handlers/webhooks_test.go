@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"0.0.0.0", false},
+		{"10.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.100.100.200", false},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"172.16.0.1", false},
+		{"192.0.0.170", false},
+		{"192.0.2.1", false},
+		{"192.168.1.1", false},
+		{"198.18.0.1", false},
+		{"224.0.0.1", false},
+		{"239.255.255.250", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::", false},
+		{"::1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"2001::1", false},
+		{"2001:db8::1", false},
+		{"2002:a00:1::", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+		{"fe80::1", false},
+		{"fe80::1%eth0", false},
+		{"ff02::1", false},
+		{"1.1.1.1", true},
+		{"8.8.8.8", true},
+		{"100.128.0.1", true},
+		{"::ffff:8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+		{"2606:4700:4700::1111", true},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddress(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("isPublicAddress(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookClient_RefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer server.Close()
+
+	if _, err := webhookClient.Get(server.URL); err == nil {
+		t.Error("request to a loopback server succeeded, want it refused")
+	}
+
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+	res, err := webhookClient.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with private targets allowed: %v", err)
+	}
+	res.Body.Close()
+}
+
+func TestWebhookClient_ClosesIdleConnections(t *testing.T) {
+	transport, ok := webhookClient.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("unexpected transport %T", webhookClient.Transport)
+	}
+	if transport.IdleConnTimeout <= 0 || transport.TLSHandshakeTimeout <= 0 {
+		t.Errorf("idle and TLS handshake timeouts must be set, got %v and %v", transport.IdleConnTimeout, transport.TLSHandshakeTimeout)
+	}
+}
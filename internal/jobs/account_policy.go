@@ -0,0 +1,181 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"ministry-mapper/internal/handlers"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Steps of the inactive-user and unprovisioned-user lifecycles, as reported
+// by PlanAccountActions.
+const (
+	accountActionWarn      = "warning"
+	accountActionFinalWarn = "final_warning"
+	accountActionDisable   = "disable"
+	accountActionDelete    = "delete"
+)
+
+// unprovisionedDeleteGraceDays is how long a disabled unprovisioned account is
+// kept for investigation before it is deleted ("disable first, delete later").
+const unprovisionedDeleteGraceDays = 30
+
+// inactivityPolicySQL lists the congregations whose policy governs a user's
+// inactivity: every congregation they hold a role in.
+const inactivityPolicySQL = `SELECT DISTINCT user, congregation FROM roles`
+
+// unprovisionedPolicySQL lists the congregations whose policy governs a user
+// without a role: those that revoked or let expire a role of theirs. Users
+// who never had a role fall back to DefaultAccountPolicy.
+const unprovisionedPolicySQL = `
+	SELECT DISTINCT user, congregation FROM roles_log
+	WHERE action IN ('revoked', 'expired') AND user != '' AND congregation != ''`
+
+// userAccountPolicies resolves each user's effective policy — the strictest
+// of the policies of the congregations pairsSQL pairs them with — and those
+// congregations. Users absent from the result get DefaultAccountPolicy.
+func userAccountPolicies(app core.App, pairsSQL string) (map[string]handlers.AccountPolicy, map[string][]string, error) {
+	congregations, err := app.FindAllRecords("congregations")
+	if err != nil {
+		return nil, nil, fmt.Errorf("load congregation policies: %w", err)
+	}
+	byCongregation := make(map[string]handlers.AccountPolicy, len(congregations))
+	for _, c := range congregations {
+		byCongregation[c.Id] = handlers.CongregationAccountPolicy(c)
+	}
+
+	var pairs []struct {
+		User         string `db:"user"`
+		Congregation string `db:"congregation"`
+	}
+	if err := app.DB().NewQuery(pairsSQL).All(&pairs); err != nil {
+		return nil, nil, fmt.Errorf("load policy congregations: %w", err)
+	}
+
+	policies := map[string]handlers.AccountPolicy{}
+	userCongregations := map[string][]string{}
+	for _, pair := range pairs {
+		policy, ok := byCongregation[pair.Congregation]
+		if !ok {
+			continue
+		}
+		if existing, seen := policies[pair.User]; seen {
+			policy = existing.Stricter(policy)
+		}
+		policies[pair.User] = policy
+		userCongregations[pair.User] = append(userCongregations[pair.User], pair.Congregation)
+	}
+	return policies, userCongregations, nil
+}
+
+func policyFor(policies map[string]handlers.AccountPolicy, userID string) handlers.AccountPolicy {
+	if p, ok := policies[userID]; ok {
+		return p
+	}
+	return handlers.DefaultAccountPolicy
+}
+
+// minInactivityWarnDays is the earliest any policy in effect warns an inactive
+// user, used to pre-filter candidates in SQL.
+func minInactivityWarnDays(policies map[string]handlers.AccountPolicy) int {
+	days := handlers.DefaultAccountPolicy.InactivityWarnDays
+	for _, p := range policies {
+		days = min(days, p.InactivityWarnDays)
+	}
+	return days
+}
+
+// inactiveUserAction returns the step processInactiveUsers takes for u at now
+// under policy p ("" for none), and how many days u has been inactive.
+func inactiveUserAction(u inactiveUser, p handlers.AccountPolicy, now time.Time) (string, int) {
+	inactive := inactiveDays(u, now)
+	switch {
+	case inactive >= p.InactivityDisableDays:
+		return accountActionDisable, inactive
+	case inactive >= p.InactivityFinalWarnDays && u.InactiveFinalWarningSentAt == "":
+		return accountActionFinalWarn, inactive
+	case inactive >= p.InactivityWarnDays && u.InactiveWarningSentAt == "":
+		return accountActionWarn, inactive
+	}
+	return "", inactive
+}
+
+// unprovisionedUserAction returns the step processUnprovisionedUsers takes for
+// u at now under policy p ("" for none), and the age of u's unprovisioned
+// period in days. The clock runs from unprovisioned_since when a role was
+// revoked from an existing user, and from account creation otherwise.
+func unprovisionedUserAction(u unprovisionedUser, p handlers.AccountPolicy, now time.Time) (string, int) {
+	ageRef := u.Created
+	if u.UnprovisionedSince != "" {
+		ageRef = u.UnprovisionedSince
+	}
+	age := accountAgeDays(ageRef, now)
+
+	if u.Disabled {
+		if age >= p.UnprovisionedDisableDays+unprovisionedDeleteGraceDays {
+			return accountActionDelete, age
+		}
+		return "", age
+	}
+	switch {
+	case age >= p.UnprovisionedDisableDays:
+		return accountActionDisable, age
+	case age >= p.UnprovisionedFinalWarnDays && u.UnprovisionedFinalWarningSentAt == "":
+		return accountActionFinalWarn, age
+	case age >= p.UnprovisionedWarnDays && u.UnprovisionedWarningSentAt == "":
+		return accountActionWarn, age
+	}
+	return "", age
+}
+
+// PlanAccountActions lists what processInactiveUsers and
+// processUnprovisionedUsers would do if they ran at the given time, without
+// sending or changing anything. Each action carries the congregations whose
+// policy applied to the user.
+func PlanAccountActions(app core.App, at time.Time) ([]handlers.AccountPolicyAction, error) {
+	actions := []handlers.AccountPolicyAction{}
+
+	inactivePolicies, inactiveCongregations, err := userAccountPolicies(app, inactivityPolicySQL)
+	if err != nil {
+		return nil, err
+	}
+	inactive, err := fetchInactiveCandidates(app, minInactivityWarnDays(inactivePolicies), at)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range inactive {
+		action, days := inactiveUserAction(u, policyFor(inactivePolicies, u.ID), at)
+		if action == "" {
+			continue
+		}
+		actions = append(actions, handlers.AccountPolicyAction{
+			User: u.ID, Name: u.Name, Email: u.Email,
+			Lifecycle: "inactive", Action: action, Days: days,
+			Congregations: inactiveCongregations[u.ID],
+		})
+	}
+
+	unprovisionedPolicies, unprovisionedCongregations, err := userAccountPolicies(app, unprovisionedPolicySQL)
+	if err != nil {
+		return nil, err
+	}
+	unprovisioned, err := fetchUnprovisionedUsers(app)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range unprovisioned {
+		action, days := unprovisionedUserAction(u, policyFor(unprovisionedPolicies, u.ID), at)
+		if action == "" {
+			continue
+		}
+		actions = append(actions, handlers.AccountPolicyAction{
+			User: u.ID, Name: u.Name, Email: u.Email,
+			Lifecycle: "unprovisioned", Action: action, Days: days,
+			Congregations: unprovisionedCongregations[u.ID],
+		})
+	}
+
+	return actions, nil
+}
@@ -0,0 +1,127 @@
+//go:build testdata
+
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"ministry-mapper/internal/handlers"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func setInactivityPolicy(t testing.TB, app core.App, congregationID string, warn, final, disable int) {
+	t.Helper()
+
+	congregation, err := app.FindRecordById("congregations", congregationID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	congregation.Set("inactivity_warn_days", warn)
+	congregation.Set("inactivity_final_warn_days", final)
+	congregation.Set("inactivity_disable_days", disable)
+	if err := app.Save(congregation); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setLastLogin(t testing.TB, app core.App, userID string, at time.Time) {
+	t.Helper()
+	if err := updateUserField(app, userID, "last_login", at.UTC().Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessInactiveUsers_AppliesCongregationPolicy(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	setInactivityPolicy(t, app, "testcongalpha01", 30, 45, 60)
+	seventyDaysAgo := time.Now().Add(-70 * 24 * time.Hour)
+	setLastLogin(t, app, "testuseralpha02", seventyDaysAgo)
+	setLastLogin(t, app, "testuserbeta002", seventyDaysAgo)
+	stubSend(t, nil)
+
+	if err := processInactiveUsers(app); err != nil {
+		t.Fatal(err)
+	}
+
+	alpha, err := app.FindRecordById("users", "testuseralpha02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alpha.GetBool("disabled") {
+		t.Error("alpha's 60-day policy should disable a user inactive for 70 days")
+	}
+	beta, err := app.FindRecordById("users", "testuserbeta002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if beta.GetBool("disabled") {
+		t.Error("beta keeps the default policy and must not disable at 70 days")
+	}
+}
+
+func TestUserAccountPolicies_StrictestAcrossCongregations(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	setInactivityPolicy(t, app, "testcongalpha01", 30, 45, 60)
+	setInactivityPolicy(t, app, "testcongbeta001", 20, 100, 200)
+
+	// Give the beta conductor a role in alpha as well.
+	roles, err := app.FindCollectionByNameOrId("roles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role := core.NewRecord(roles)
+	role.Set("congregation", "testcongalpha01")
+	role.Set("user", "testuserbeta002")
+	role.Set("role", "read_only")
+	if err := app.Save(role); err != nil {
+		t.Fatal(err)
+	}
+
+	policies, congregations, err := userAccountPolicies(app, inactivityPolicySQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := policies["testuserbeta002"]
+	if got.InactivityWarnDays != 20 || got.InactivityFinalWarnDays != 45 || got.InactivityDisableDays != 60 {
+		t.Errorf("want the smallest of each threshold (20/45/60), got %+v", got)
+	}
+	if got.UnprovisionedDisableDays != handlers.DefaultAccountPolicy.UnprovisionedDisableDays {
+		t.Errorf("unset thresholds should keep their default, got %d", got.UnprovisionedDisableDays)
+	}
+	if len(congregations["testuserbeta002"]) != 2 {
+		t.Errorf("both congregations should be recorded, got %v", congregations["testuserbeta002"])
+	}
+}
+
+func TestPlanAccountActions_ChangesNothing(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	setInactivityPolicy(t, app, "testcongalpha01", 30, 45, 60)
+	// Disabled by tomorrow's run, not today's.
+	setLastLogin(t, app, "testuseralpha02", time.Now().Add(-(59*24+12)*time.Hour))
+	sent := stubSend(t, nil)
+
+	actions, err := PlanAccountActions(app, time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found *handlers.AccountPolicyAction
+	for i := range actions {
+		if actions[i].User == "testuseralpha02" {
+			found = &actions[i]
+		}
+	}
+	if found == nil || found.Action != accountActionDisable || found.Lifecycle != "inactive" {
+		t.Fatalf("want a planned inactive disable for testuseralpha02, got %+v", found)
+	}
+
+	user, err := app.FindRecordById("users", "testuseralpha02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.GetBool("disabled") || len(*sent) != 0 {
+		t.Error("planning must not disable anyone or send email")
+	}
+}
@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"ministry-mapper/internal/handlers"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// assignmentExpiryWarningWindow is how long before its expiry_date a link's
+// subscribed browsers are told the link is about to stop working.
+const assignmentExpiryWarningWindow = time.Hour
+
+// processAssignmentExpiryWarnings pushes a warning to each browser subscribed
+// through a link expiring within assignmentExpiryWarningWindow, once per
+// subscription. Link-id publishers have no email, so this is their only
+// notice before assignmentsCleanup removes the link.
+func processAssignmentExpiryWarnings(app core.App, now time.Time) error {
+	if !handlers.PushEnabled() {
+		return nil
+	}
+	now = now.UTC()
+
+	var rows []struct {
+		Subscription string `db:"subscription"`
+		Assignment   string `db:"assignment"`
+		MapName      string `db:"map_name"`
+		ExpiryDate   string `db:"expiry_date"`
+		Timezone     string `db:"timezone"`
+		Language     string `db:"language"`
+		Origin       string `db:"origin"`
+	}
+	err := app.DB().NewQuery(`
+		SELECT s.id AS subscription, a.id AS assignment, COALESCE(m.description, '') AS map_name,
+		       a.expiry_date, COALESCE(c.timezone, '') AS timezone,
+		       COALESCE(c.language, '') AS language, COALESCE(c.origin, '') AS origin
+		FROM push_subscriptions s
+		JOIN assignments a ON a.id = s.assignment
+		LEFT JOIN maps m ON m.id = a.map
+		LEFT JOIN congregations c ON c.id = a.congregation
+		WHERE a.expiry_date > {:now} AND a.expiry_date <= {:until}
+		  AND COALESCE(s.expiry_warned_at, '') = ''
+	`).Bind(dbx.Params{
+		"now":   now.Format(types.DefaultDateLayout),
+		"until": now.Add(assignmentExpiryWarningWindow).Format(types.DefaultDateLayout),
+	}).All(&rows)
+	if err != nil {
+		return fmt.Errorf("processAssignmentExpiryWarnings: query expiring links: %w", err)
+	}
+
+	warned := 0
+	for _, row := range rows {
+		subscription, err := app.FindRecordById("push_subscriptions", row.Subscription)
+		if err != nil {
+			continue
+		}
+		expiry, err := types.ParseDateTime(row.ExpiryDate)
+		if err != nil {
+			continue
+		}
+		location, err := time.LoadLocation(row.Timezone)
+		if err != nil {
+			location = time.UTC
+		}
+		language := row.Language
+		if language == "" {
+			language = originLanguages[row.Origin]
+		}
+		loc := loadLocale(language)
+
+		err = handlers.SendPush(app, subscription, handlers.PushNotification{
+			Kind:  handlers.PushAssignmentExpiry,
+			Title: loc.text("push.expiry_title"),
+			Body:  loc.text("push.expiry_body", row.MapName, loc.date(expiry.Time().In(location), dateStyleTime)),
+			Tag:   "expiry-" + row.Assignment,
+			Data:  map[string]string{"link_id": row.Assignment},
+		})
+		if err != nil {
+			// Gone subscriptions are deleted; others are retried next run.
+			log.Printf("processAssignmentExpiryWarnings: subscription %s: %v", row.Subscription, err)
+			continue
+		}
+		subscription.Set("expiry_warned_at", now)
+		if err := app.Save(subscription); err != nil {
+			log.Printf("processAssignmentExpiryWarnings: failed to stamp subscription %s: %v", subscription.Id, err)
+			continue
+		}
+		warned++
+	}
+	if len(rows) > 0 {
+		log.Printf("processAssignmentExpiryWarnings: warned %d of %d subscription(s)", warned, len(rows))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+//go:build testdata
+
+package jobs
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestProcessAssignmentExpiryWarnings_WarnsEachSubscriptionOnce(t *testing.T) {
+	app := setupMessagesTestApp(t)
+
+	vapid, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := vapid.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VAPID_PRIVATE_KEY", base64.RawURLEncoding.EncodeToString(raw))
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+
+	var mu sync.Mutex
+	pushed := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		pushed[strings.TrimPrefix(req.URL.Path, "/")]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	browser, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	assignments, err := app.FindCollectionByNameOrId("assignments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscriptions, err := app.FindCollectionByNameOrId("push_subscriptions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []struct {
+		id     string
+		expiry time.Time
+	}{
+		{"pushexpiring01", now.Add(30 * time.Minute)},
+		{"pushlater00001", now.Add(3 * time.Hour)},
+	} {
+		assignment := core.NewRecord(assignments)
+		assignment.Id = link.id
+		assignment.Set("map", "testmapalpha01a")
+		assignment.Set("congregation", "testcongalpha01")
+		assignment.Set("publisher", "Push Publisher")
+		assignment.Set("type", "publisher")
+		assignment.Set("expiry_date", link.expiry)
+		if err := app.SaveNoValidate(assignment); err != nil {
+			t.Fatal(err)
+		}
+		sub := core.NewRecord(subscriptions)
+		sub.Set("assignment", link.id)
+		sub.Set("endpoint", server.URL+"/"+link.id)
+		sub.Set("p256dh", base64.RawURLEncoding.EncodeToString(browser.PublicKey().Bytes()))
+		sub.Set("auth", base64.RawURLEncoding.EncodeToString(make([]byte, 16)))
+		if err := app.Save(sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for range 2 {
+		if err := processAssignmentExpiryWarnings(app, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if pushed["pushexpiring01"] != 1 {
+		t.Errorf("the expiring link should be warned once, got %d", pushed["pushexpiring01"])
+	}
+	if pushed["pushlater00001"] != 0 {
+		t.Errorf("a link expiring in 3h should not be warned yet, got %d", pushed["pushlater00001"])
+	}
+}
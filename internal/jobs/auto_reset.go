@@ -0,0 +1,247 @@
+package jobs
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"ministry-mapper/internal/handlers"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// autoResetActor is written to updated_by on every address the job resets, so
+// the change is attributable in addresses_log and the map view.
+const autoResetActor = "Auto reset"
+
+type autoResetPolicy struct {
+	ID              string `db:"id"`
+	AfterDays       int    `db:"auto_reset_after_days"`
+	DoneAfterMonths int    `db:"auto_reset_done_after_months"`
+}
+
+// autoResetRow is one map (and, for the done-age policy, one address in it)
+// selected for reset.
+type autoResetRow struct {
+	Address     string `db:"address"`
+	Map         string `db:"map"`
+	Description string `db:"description"`
+	Territory   string `db:"territory_code"`
+}
+
+type autoResetEntry struct {
+	MapName   string
+	Territory string
+	Reason    string
+	Count     int
+}
+
+// AutoResetTemplateData holds the data passed to the auto_reset.html template.
+type AutoResetTemplateData struct {
+	Entries []autoResetEntry
+	Count   int
+}
+
+// processAutoResets applies each congregation's auto-reset policy and emails
+// its administrators a summary of what was reset. The two policies are
+// independent and either can be off (0):
+//
+//   - auto_reset_after_days: a map at 100% is fully reset once it has been
+//     complete for that many days. Completion time is the end of its latest
+//     completed coverage cycle, falling back to its last status change for
+//     maps that completed before cycles were tracked.
+//   - auto_reset_done_after_months: individual done addresses whose last
+//     change to done is older than that many months go back to not_done.
+//
+// Resets go through handlers.BulkResetMap, so they are snapshotted and can be
+// undone from /reset/restore like a manual reset.
+func processAutoResets(app core.App) error {
+	log.Println("processAutoResets: starting")
+
+	var policies []autoResetPolicy
+	err := app.DB().NewQuery(`
+		SELECT id,
+		       COALESCE(auto_reset_after_days, 0)        AS auto_reset_after_days,
+		       COALESCE(auto_reset_done_after_months, 0) AS auto_reset_done_after_months
+		FROM congregations
+		WHERE auto_reset_after_days > 0 OR auto_reset_done_after_months > 0
+	`).All(&policies)
+	if err != nil {
+		return fmt.Errorf("processAutoResets: query failed: %w", err)
+	}
+
+	if len(policies) == 0 {
+		log.Println("processAutoResets: no congregations with an auto-reset policy")
+		return nil
+	}
+
+	for _, policy := range policies {
+		if err := processAutoReset(app, policy); err != nil {
+			log.Printf("processAutoResets: congregation %s: %v", policy.ID, err)
+		}
+	}
+
+	log.Println("processAutoResets: completed")
+	return nil
+}
+
+func processAutoReset(app core.App, policy autoResetPolicy) error {
+	congRecord, err := app.FindRecordById("congregations", policy.ID)
+	if err != nil {
+		return err
+	}
+	loc := loadLocale(congregationLanguage(congRecord))
+
+	var entries []autoResetEntry
+
+	if policy.AfterDays > 0 {
+		var rows []autoResetRow
+		err := app.DB().NewQuery(`
+			SELECT '' AS address, m.id AS map,
+			       COALESCE(NULLIF(m.description, ''), m.code) AS description,
+			       COALESCE(t.code, '') AS territory_code
+			FROM maps m
+			LEFT JOIN territories t ON t.id = m.territory
+			WHERE m.congregation = {:congregation}
+			  AND m.progress >= 100
+			  AND JULIANDAY('now') - JULIANDAY(COALESCE(
+			        (SELECT MAX(c.ended_at) FROM coverage_cycles c
+			         WHERE c.map = m.id AND c.scope = 'map' AND c.outcome = 'completed'),
+			        (SELECT MAX(l.created) FROM addresses_log l WHERE l.map = m.id)
+			      )) >= {:days}
+			ORDER BY t.code, m.sequence
+		`).Bind(dbx.Params{"congregation": policy.ID, "days": policy.AfterDays}).All(&rows)
+		if err != nil {
+			return fmt.Errorf("query completed maps: %w", err)
+		}
+
+		reason := loc.text("auto_reset.reason_completed", policy.AfterDays)
+		for _, row := range rows {
+			records, err := app.FindRecordsByFilter("addresses", "map = {:map} && (status = 'not_home' || status = 'done')", "", 0, 0, dbx.Params{"map": row.Map})
+			if err != nil {
+				log.Printf("processAutoReset: map %s: %v", row.Map, err)
+				continue
+			}
+			if entry, ok := autoResetMap(app, row, records, reason, true); ok {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	if policy.DoneAfterMonths > 0 {
+		var rows []autoResetRow
+		err := app.DB().NewQuery(`
+			SELECT a.id AS address, m.id AS map,
+			       COALESCE(NULLIF(m.description, ''), m.code) AS description,
+			       COALESCE(t.code, '') AS territory_code
+			FROM addresses a
+			JOIN maps m ON m.id = a.map
+			LEFT JOIN territories t ON t.id = m.territory
+			WHERE a.congregation = {:congregation}
+			  AND a.status = 'done'
+			  AND JULIANDAY(COALESCE(
+			        (SELECT MAX(l.created) FROM addresses_log l WHERE l.address = a.id AND l.new_status = 'done'),
+			        a.updated
+			      )) <= JULIANDAY('now', '-' || {:months} || ' months')
+			ORDER BY t.code, m.sequence
+		`).Bind(dbx.Params{"congregation": policy.ID, "months": policy.DoneAfterMonths}).All(&rows)
+		if err != nil {
+			return fmt.Errorf("query stale done addresses: %w", err)
+		}
+
+		// Group addresses by map, preserving query order.
+		mapOrder := []string{}
+		byMap := make(map[string][]string)
+		mapRows := make(map[string]autoResetRow)
+		for _, row := range rows {
+			if _, seen := byMap[row.Map]; !seen {
+				mapOrder = append(mapOrder, row.Map)
+				mapRows[row.Map] = row
+			}
+			byMap[row.Map] = append(byMap[row.Map], row.Address)
+		}
+
+		reason := loc.text("auto_reset.reason_done", policy.DoneAfterMonths)
+		for _, mapID := range mapOrder {
+			records, err := app.FindRecordsByIds("addresses", byMap[mapID])
+			if err != nil {
+				log.Printf("processAutoReset: map %s: %v", mapID, err)
+				continue
+			}
+			if entry, ok := autoResetMap(app, mapRows[mapID], records, reason, false); ok {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	if len(entries) == 0 {
+		log.Printf("processAutoReset: nothing to reset for congregation %s", policy.ID)
+		return nil
+	}
+
+	return sendAutoResetSummary(app, congRecord, loc, entries)
+}
+
+// autoResetMap resets records within one map through the shared bulk-reset
+// path and reports the result as a summary entry. ok is false when there was
+// nothing to reset or the reset failed (already logged).
+func autoResetMap(app core.App, row autoResetRow, records []*core.Record, reason string, fullReset bool) (autoResetEntry, bool) {
+	if len(records) == 0 {
+		return autoResetEntry{}, false
+	}
+
+	mapRecord, err := app.FindRecordById("maps", row.Map)
+	if err != nil {
+		log.Printf("processAutoReset: map %s: %v", row.Map, err)
+		return autoResetEntry{}, false
+	}
+
+	if err := handlers.BulkResetMap(app, mapRecord, records, autoResetActor, "", fullReset); err != nil {
+		log.Printf("processAutoReset: map %s: %v", row.Map, err)
+		return autoResetEntry{}, false
+	}
+
+	return autoResetEntry{
+		MapName:   row.Description,
+		Territory: row.Territory,
+		Reason:    reason,
+		Count:     len(records),
+	}, true
+}
+
+func sendAutoResetSummary(app core.App, congRecord *core.Record, loc *locale, entries []autoResetEntry) error {
+	congID := congRecord.Id
+	recipients, err := fetchCongregationRecipients(app, congID, true, digestAutoReset)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		log.Printf("processAutoReset: no admin recipients for congregation %s", congID)
+		return nil
+	}
+
+	data := AutoResetTemplateData{Entries: entries}
+	for _, e := range entries {
+		data.Count += e.Count
+	}
+
+	tmpl, err := parseTemplate("templates/auto_reset.html", loc)
+	if err != nil {
+		return fmt.Errorf("parse auto_reset template: %w", err)
+	}
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("execute auto_reset template: %w", err)
+	}
+
+	location := loadCongregationLocation(congRecord)
+	subject := loc.text("auto_reset.subject", congRecord.GetString("name"), loc.date(time.Now().In(location), dateStyleDate))
+	if err := queueDigest(app, congRecord, digestAutoReset, recipients, subject, body.String(), nil); err != nil {
+		return fmt.Errorf("queue auto-reset summary: %w", err)
+	}
+
+	log.Printf("processAutoReset: summary queued for congregation %s (%d addresses in %d maps)", congID, data.Count, len(entries))
+	return nil
+}
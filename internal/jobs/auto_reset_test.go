@@ -0,0 +1,180 @@
+//go:build testdata
+
+package jobs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func setAutoResetPolicy(t testing.TB, app *tests.TestApp, afterDays, doneAfterMonths int) {
+	t.Helper()
+	cong, err := app.FindRecordById("congregations", "testcongalpha01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cong.Set("auto_reset_after_days", afterDays)
+	cong.Set("auto_reset_done_after_months", doneAfterMonths)
+	if err := app.SaveNoValidate(cong); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func addressStatus(t testing.TB, app core.App, id string) string {
+	t.Helper()
+	addr, err := app.FindRecordById("addresses", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr.GetString("status")
+}
+
+func TestProcessAutoResets_ResetsMapsCompleteForLongerThanPolicy(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	setAutoResetPolicy(t, app, 7, 0)
+
+	// testmapalpha01a reached 100% ten days ago.
+	if _, err := app.DB().NewQuery("UPDATE maps SET progress = 100 WHERE id = 'testmapalpha01a'").Execute(); err != nil {
+		t.Fatal(err)
+	}
+	col, err := app.FindCollectionByNameOrId("coverage_cycles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cycle := core.NewRecord(col)
+	cycle.Set("congregation", "testcongalpha01")
+	cycle.Set("territory", "testterralpha01")
+	cycle.Set("map", "testmapalpha01a")
+	cycle.Set("scope", "map")
+	cycle.Set("opened_by", "reset")
+	cycle.Set("started_at", time.Now().Add(-40*24*time.Hour))
+	cycle.Set("ended_at", time.Now().Add(-10*24*time.Hour))
+	cycle.Set("outcome", "completed")
+	if err := app.SaveNoValidate(cycle); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := stubSend(t, nil)
+
+	if err := processAutoResets(app); err != nil {
+		t.Fatalf("processAutoResets returned error: %v", err)
+	}
+
+	for _, id := range []string{"testalpha01a003", "testalpha01a004", "testalpha01a005"} {
+		if got := addressStatus(t, app, id); got != "not_done" {
+			t.Errorf("%s: want not_done, got %s", id, got)
+		}
+	}
+
+	addr, err := app.FindRecordById("addresses", "testalpha01a005")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := addr.GetString("updated_by"); got != autoResetActor {
+		t.Errorf("updated_by: want %q, got %q", autoResetActor, got)
+	}
+
+	snapshots, err := app.FindRecordsByFilter("reset_snapshots", "map = {:map}", "", 0, 0, dbx.Params{"map": "testmapalpha01a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 {
+		t.Errorf("expected the auto reset to be snapshotted, got %d snapshots", len(snapshots))
+	}
+
+	open, err := app.FindRecordsByFilter("coverage_cycles", "map = {:map} && ended_at = ''", "", 0, 0, dbx.Params{"map": "testmapalpha01a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 {
+		t.Errorf("a full auto reset should open a new coverage cycle, got %d open", len(open))
+	}
+
+	if len(*sent) != 1 {
+		t.Fatalf("expected 1 summary email, got %d", len(*sent))
+	}
+	if body := (*sent)[0].Body; !strings.Contains(body, "Blk 100A") || !strings.Contains(body, "Completed 7 or more days ago") {
+		t.Errorf("summary should name the map and the reason, got body: %s", body)
+	}
+	for _, r := range (*sent)[0].Recipients {
+		if r.Email != "admin@alpha.test" {
+			t.Errorf("summary should go to administrators only, got %s", r.Email)
+		}
+	}
+}
+
+func TestProcessAutoResets_LeavesRecentlyCompletedMapsAlone(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	setAutoResetPolicy(t, app, 30, 0)
+
+	if _, err := app.DB().NewQuery("UPDATE maps SET progress = 100 WHERE id = 'testmapalpha01a'").Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := stubSend(t, nil)
+
+	if err := processAutoResets(app); err != nil {
+		t.Fatalf("processAutoResets returned error: %v", err)
+	}
+
+	if got := addressStatus(t, app, "testalpha01a005"); got != "done" {
+		t.Errorf("map completed today must not be reset under a 30-day policy, got %s", got)
+	}
+	if len(*sent) != 0 {
+		t.Errorf("no email expected when nothing was reset, got %d", len(*sent))
+	}
+}
+
+func TestProcessAutoResets_ResetsOnlyStaleDoneAddresses(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	setAutoResetPolicy(t, app, 0, 3)
+
+	stale := time.Now().AddDate(0, -4, 0).UTC().Format("2006-01-02 15:04:05.000Z")
+	if _, err := app.DB().NewQuery("UPDATE addresses SET updated = {:stale} WHERE id = 'testalpha01a005'").
+		Bind(dbx.Params{"stale": stale}).Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := stubSend(t, nil)
+
+	if err := processAutoResets(app); err != nil {
+		t.Fatalf("processAutoResets returned error: %v", err)
+	}
+
+	if got := addressStatus(t, app, "testalpha01a005"); got != "not_done" {
+		t.Errorf("stale done address: want not_done, got %s", got)
+	}
+	for _, id := range []string{"testalpha01a003", "testalpha01a004"} {
+		if got := addressStatus(t, app, id); got != "not_home" {
+			t.Errorf("%s: the done-age policy must not touch not_home addresses, got %s", id, got)
+		}
+	}
+
+	if len(*sent) != 1 {
+		t.Fatalf("expected 1 summary email, got %d", len(*sent))
+	}
+	if body := (*sent)[0].Body; !strings.Contains(body, "Done more than 3 month(s) ago") {
+		t.Errorf("summary should state the done-age reason, got body: %s", body)
+	}
+}
+
+func TestProcessAutoResets_NoPolicyIsNoOp(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	sent := stubSend(t, nil)
+
+	if err := processAutoResets(app); err != nil {
+		t.Fatalf("processAutoResets returned error: %v", err)
+	}
+
+	if got := addressStatus(t, app, "testalpha01a005"); got != "done" {
+		t.Errorf("no policy configured, want done, got %s", got)
+	}
+	if len(*sent) != 0 {
+		t.Errorf("expected no email, got %d", len(*sent))
+	}
+}
@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"ministry-mapper/internal/handlers"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type changeRequestDecidedTmplData struct {
+	UserName  string
+	AdminName string
+	MapName   string
+	Change    string
+	Approved  bool
+	Note      string
+	AppURL    string
+}
+
+// SendChangeRequestDecidedEmail tells the requester of a change request on
+// mapRecord whether it was applied, in the requester's language.
+func SendChangeRequestDecidedEmail(app core.App, user, request, mapRecord *core.Record) error {
+	congRecord, _ := app.FindRecordById("congregations", mapRecord.GetString("congregation"))
+	loc := loadLocale(userLanguage(user.GetString("language"), congRecord))
+	tmpl, err := parseTemplate("templates/change_request_decided.html", loc)
+	if err != nil {
+		return fmt.Errorf("SendChangeRequestDecidedEmail: parse template: %w", err)
+	}
+
+	email := user.GetString("email")
+	data := changeRequestDecidedTmplData{
+		UserName: displayName(user.GetString("name"), email),
+		MapName:  mapRecord.GetString("description"),
+		Change:   handlers.DescribeChangeRequest(request),
+		Approved: request.GetString("status") == "approved",
+		Note:     request.GetString("decision_note"),
+		AppURL:   os.Getenv("PB_APP_URL"),
+	}
+	if admin, err := app.FindRecordById("users", request.GetString("decided_by")); err == nil {
+		data.AdminName = admin.GetString("name")
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("SendChangeRequestDecidedEmail: execute template: %w", err)
+	}
+
+	subject := loc.text("change_request.subject_rejected")
+	if data.Approved {
+		subject = loc.text("change_request.subject_approved")
+	}
+	return queuePlainEmail(app, mapRecord.GetString("congregation"), email, user.GetString("name"), subject, body.String(), nil)
+}
@@ -1,34 +1,52 @@
 package jobs
 
 import (
-	"context"
-	"fmt"
-	"os"
 	"time"
 
-	"github.com/mailersend/mailersend-go"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 )
 
-// Recipient holds the name and email of an email recipient.
+// Recipient holds the name and email of an email recipient. The remaining
+// fields are the user's notification preferences in the congregation, filled
+// in by fetchCongregationRecipients and never stored with a queued email.
 type Recipient struct {
-	Name  string `db:"name"`
-	Email string `db:"email"`
+	Name  string `db:"name" json:"name"`
+	Email string `db:"email" json:"email"`
+
+	UserID           string `db:"id" json:"-"`
+	Frequency        string `db:"frequency" json:"-"`
+	QuietStart       string `db:"quiet_start" json:"-"`
+	QuietEnd         string `db:"quiet_end" json:"-"`
+	UnsubscribeToken string `db:"unsubscribe_token" json:"-"`
 }
 
 // fetchCongregationRecipients returns the users holding (adminOnly) or not holding
-// (!adminOnly) the administrator role in the given congregation.
-func fetchCongregationRecipients(app core.App, congregationId string, adminOnly bool) ([]Recipient, error) {
+// (!adminOnly) the administrator role in the given congregation. kind, when set,
+// is a digest in handlers.NotificationKinds and leaves out users who muted it;
+// pass "" for emails users cannot opt out of.
+func fetchCongregationRecipients(app core.App, congregationId string, adminOnly bool, kind string) ([]Recipient, error) {
 	roleCond := "roles.role = 'administrator'"
 	if !adminOnly {
 		roleCond = "roles.role != 'administrator'"
 	}
-	recipients := []Recipient{}
-	err := app.DB().Select("users.*").From("users").
+	query := app.DB().Select(
+		"users.id", "users.name", "users.email",
+		"COALESCE(np.frequency, '') AS frequency",
+		"COALESCE(np.quiet_start, '') AS quiet_start",
+		"COALESCE(np.quiet_end, '') AS quiet_end",
+		"COALESCE(np.unsubscribe_token, '') AS unsubscribe_token",
+	).From("users").
 		InnerJoin("roles", dbx.NewExp("roles.user = users.id and "+roleCond)).
-		Where(dbx.NewExp("roles.congregation = {:congregation}", dbx.Params{"congregation": congregationId})).
-		All(&recipients)
+		LeftJoin("notification_preferences np", dbx.NewExp("np.user = users.id AND np.congregation = roles.congregation")).
+		Where(dbx.NewExp("roles.congregation = {:congregation}", dbx.Params{"congregation": congregationId}))
+	if kind != "" {
+		query = query.AndWhere(dbx.NewExp(`np.id IS NULL OR NOT EXISTS (
+			SELECT 1 FROM json_each(COALESCE(NULLIF(np.muted, ''), '[]')) WHERE value = {:kind})`,
+			dbx.Params{"kind": kind}))
+	}
+	recipients := []Recipient{}
+	err := query.GroupBy("users.id").All(&recipients)
 	return recipients, err
 }
 
@@ -42,30 +60,8 @@ func loadCongregationLocation(congRecord *core.Record) *time.Location {
 	return location
 }
 
-// sendHTMLEmail sends a single HTML email via MailerSend to the given recipients.
-// It's a package-level var so tests can substitute a stub instead of sending real email.
-var sendHTMLEmail = func(recipients []Recipient, subject, htmlBody string) error {
-	apiKey := os.Getenv("MAILERSEND_API_KEY")
-	fromEmail := os.Getenv("MAILERSEND_FROM_EMAIL")
-	if apiKey == "" || fromEmail == "" {
-		return fmt.Errorf("MAILERSEND_API_KEY or MAILERSEND_FROM_EMAIL not configured")
-	}
-
-	ms := mailersend.NewMailersend(apiKey)
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	emailRecipients := make([]mailersend.Recipient, 0, len(recipients))
-	for _, r := range recipients {
-		emailRecipients = append(emailRecipients, mailersend.Recipient{Email: r.Email, Name: r.Name})
-	}
-
-	message := ms.Email.NewMessage()
-	message.SetFrom(mailersend.From{Email: fromEmail, Name: "Ministry Mapper"})
-	message.SetRecipients(emailRecipients)
-	message.SetSubject(subject)
-	message.SetHTML(htmlBody)
-
-	_, err := ms.Email.Send(ctx, message)
-	return err
+// queueHTMLEmail queues a single HTML email to the given recipients in the
+// email outbox (see queueEmail).
+func queueHTMLEmail(app core.App, congregation string, recipients []Recipient, subject, htmlBody string, effect *outboxEffect) error {
+	return queueEmail(app, congregation, Email{To: recipients, Subject: subject, HTML: htmlBody}, effect)
 }
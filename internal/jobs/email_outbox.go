@@ -0,0 +1,383 @@
+package jobs
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	// outboxMaxAttempts is how many deliveries are tried before an email is
+	// dead-lettered. With outboxBaseBackoff doubling per attempt this spans
+	// about ten hours, long enough to ride out a provider outage.
+	outboxMaxAttempts = 8
+	outboxBaseBackoff = 5 * time.Minute
+	outboxMaxBackoff  = 6 * time.Hour
+
+	// outboxStaleSending is how long a row may stay in sending before the
+	// worker assumes the process delivering it died and tries again.
+	outboxStaleSending = 10 * time.Minute
+
+	outboxSentRetention = 30 * 24 * time.Hour
+	outboxDeadRetention = 90 * 24 * time.Hour
+	outboxBatchSize     = 100
+)
+
+// Effects applied once a queued email is delivered. Each names the records
+// it updates as collection.field.
+const (
+	effectMessagesRead           = "messages.read"
+	effectAccessRequestsDigested = "access_requests.digest_sent_at"
+	effectRoleExpiryWarned       = "roles.expiry_warning_sent_at"
+)
+
+// userStampEffect is the effect stamping field on the referenced users.
+func userStampEffect(field string) string {
+	return "users." + field
+}
+
+// outboxEffect is the bookkeeping a job defers until its email is delivered:
+// Kind picks the function in outboxEffects and Refs are the record ids it
+// applies to.
+type outboxEffect struct {
+	Kind string
+	Refs []string
+}
+
+type outboxEffectFunc func(app core.App, refs []string, at time.Time) error
+
+var outboxEffects = map[string]outboxEffectFunc{
+	effectMessagesRead:           markMessagesRead,
+	effectAccessRequestsDigested: stampRows("access_requests", "digest_sent_at"),
+	effectRoleExpiryWarned:       stampRows("roles", "expiry_warning_sent_at"),
+
+	userStampEffect("inactive_warning_sent_at"):            stampUsers("inactive_warning_sent_at"),
+	userStampEffect("inactive_final_warning_sent_at"):      stampUsers("inactive_final_warning_sent_at"),
+	userStampEffect("unprovisioned_warning_sent_at"):       stampUsers("unprovisioned_warning_sent_at"),
+	userStampEffect("unprovisioned_final_warning_sent_at"): stampUsers("unprovisioned_final_warning_sent_at"),
+	userStampEffect("admin_alerted_at"):                    stampUsers("admin_alerted_at"),
+}
+
+// markMessagesRead marks digested messages read through the app, so realtime
+// subscribers see the change.
+func markMessagesRead(app core.App, refs []string, _ time.Time) error {
+	for _, id := range refs {
+		message, err := app.FindRecordById("messages", id)
+		if err != nil {
+			continue
+		}
+		message.Set("read", true)
+		if err := app.Save(message); err != nil {
+			return fmt.Errorf("mark message %s read: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// stampRows sets a date field on the referenced rows without running hooks,
+// matching how the jobs stamped them before the outbox.
+func stampRows(collection, field string) outboxEffectFunc {
+	return func(app core.App, refs []string, at time.Time) error {
+		if len(refs) == 0 {
+			return nil
+		}
+		ids := make([]any, len(refs))
+		for i, id := range refs {
+			ids[i] = id
+		}
+		stamp := dbx.Params{field: at.UTC().Format(types.DefaultDateLayout)}
+		_, err := app.DB().Update(collection, stamp, dbx.In("id", ids...)).Execute()
+		return err
+	}
+}
+
+func stampUsers(field string) outboxEffectFunc {
+	return func(app core.App, refs []string, at time.Time) error {
+		for _, id := range refs {
+			if err := updateUserField(app, id, field, at.UTC().Format(time.RFC3339)); err != nil {
+				return fmt.Errorf("stamp %s on user %s: %w", field, id, err)
+			}
+		}
+		return nil
+	}
+}
+
+// deliverEmail hands a queued email to the configured transport.
+// It's a package-level var so tests can substitute a stub instead of sending real email.
+var deliverEmail = sendEmail
+
+// queueEmail stores email in the outbox and makes a first delivery attempt
+// straight away, so a healthy transport sends as promptly as before. A failed
+// attempt is left to processEmailOutbox and is not an error here: the email
+// is queued. effect, when set, is applied only after delivery. congregation
+// is empty for system emails that belong to no congregation.
+func queueEmail(app core.App, congregation string, email Email, effect *outboxEffect) error {
+	return queueEmailAt(app, congregation, email, effect, time.Time{})
+}
+
+// queueEmailAt is queueEmail holding the email until at, such as the end of
+// the recipient's quiet hours. A zero or past at queues it as queueEmail does.
+func queueEmailAt(app core.App, congregation string, email Email, effect *outboxEffect, at time.Time) error {
+	now := time.Now().UTC()
+	held := at.After(now)
+	if !held {
+		at = now
+	}
+
+	col, err := app.FindCollectionByNameOrId("email_outbox")
+	if err != nil {
+		return fmt.Errorf("queueEmail: %w", err)
+	}
+
+	record := core.NewRecord(col)
+	record.Set("congregation", congregation)
+	record.Set("recipients", email.To)
+	record.Set("subject", email.Subject)
+	record.Set("html", email.HTML)
+	record.Set("status", "pending")
+	record.Set("next_attempt_at", at.UTC())
+	if effect != nil {
+		record.Set("effect", effect.Kind)
+		record.Set("effect_refs", effect.Refs)
+	}
+	if len(email.Attachments) > 0 {
+		names := make([]string, 0, len(email.Attachments))
+		files := make([]*filesystem.File, 0, len(email.Attachments))
+		for _, a := range email.Attachments {
+			file, err := filesystem.NewFileFromBytes(a.Content, a.Filename)
+			if err != nil {
+				return fmt.Errorf("queueEmail: attachment %s: %w", a.Filename, err)
+			}
+			files = append(files, file)
+			names = append(names, a.Filename)
+		}
+		record.Set("attachments", files)
+		record.Set("attachment_names", names)
+	}
+	if err := app.Save(record); err != nil {
+		return fmt.Errorf("queueEmail: save: %w", err)
+	}
+	if held {
+		return nil
+	}
+
+	// Reload so the attachments field holds the stored file names.
+	queued, err := app.FindRecordById("email_outbox", record.Id)
+	if err != nil {
+		log.Printf("queueEmail: %q queued but not reloaded, left to the worker: %v", email.Subject, err)
+		return nil
+	}
+	if err := deliverOutboxEmail(app, queued, time.Now().UTC()); err != nil {
+		log.Printf("queueEmail: %q queued for retry: %v", email.Subject, err)
+	}
+	return nil
+}
+
+// queuedRefsSQL is a subquery of the refs of effect kind still waiting on
+// delivery, for jobs to leave those rows out rather than queue them twice.
+// kind must be one of the effect constants.
+func queuedRefsSQL(kind string) string {
+	return `(SELECT j.value FROM email_outbox o, json_each(o.effect_refs) j
+		WHERE o.status IN ('pending', 'sending') AND o.effect = '` + kind + `')`
+}
+
+// queuedRefs is queuedRefsSQL as a set, for jobs that select in Go.
+func queuedRefs(app core.App, kind string) (map[string]bool, error) {
+	var rows []struct {
+		Ref string `db:"ref"`
+	}
+	err := app.DB().NewQuery("SELECT value AS ref FROM " + queuedRefsSQL(kind)).All(&rows)
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		refs[row.Ref] = true
+	}
+	return refs, nil
+}
+
+// processEmailOutbox delivers queued emails that are due, including ones
+// left in sending by a run that died, then purges delivered and dead emails
+// past their retention.
+func processEmailOutbox(app core.App, now time.Time) error {
+	now = now.UTC()
+
+	var due []struct {
+		ID string `db:"id"`
+	}
+	err := app.DB().NewQuery(`
+		SELECT id FROM email_outbox
+		WHERE (status = 'pending' AND next_attempt_at <= {:now})
+		   OR (status = 'sending' AND updated <= {:stale})
+		ORDER BY next_attempt_at
+		LIMIT {:limit}
+	`).Bind(dbx.Params{
+		"now":   now.Format(types.DefaultDateLayout),
+		"stale": now.Add(-outboxStaleSending).Format(types.DefaultDateLayout),
+		"limit": outboxBatchSize,
+	}).All(&due)
+	if err != nil {
+		return fmt.Errorf("processEmailOutbox: query due emails: %w", err)
+	}
+
+	failed := 0
+	for _, row := range due {
+		record, err := app.FindRecordById("email_outbox", row.ID)
+		if err != nil {
+			continue
+		}
+		if err := deliverOutboxEmail(app, record, now); err != nil {
+			failed++
+		}
+	}
+	if len(due) > 0 {
+		log.Printf("processEmailOutbox: %d due, %d failed", len(due), failed)
+	}
+
+	purgeEmailOutbox(app, "sent", "sent_at", now.Add(-outboxSentRetention))
+	purgeEmailOutbox(app, "dead", "updated", now.Add(-outboxDeadRetention))
+	return nil
+}
+
+// deliverOutboxEmail claims record, sends it and records the outcome. The
+// claim is a conditional update so two runs never send the same email. The
+// returned error is the delivery failure, already recorded on the row.
+func deliverOutboxEmail(app core.App, record *core.Record, now time.Time) error {
+	res, err := app.DB().NewQuery(`
+		UPDATE email_outbox SET status = 'sending', updated = {:now}
+		WHERE id = {:id} AND (status = 'pending' OR (status = 'sending' AND updated <= {:stale}))
+	`).Bind(dbx.Params{
+		"id":    record.Id,
+		"now":   now.Format(types.DefaultDateLayout),
+		"stale": now.Add(-outboxStaleSending).Format(types.DefaultDateLayout),
+	}).Execute()
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	email, err := loadOutboxEmail(app, record)
+	if err == nil {
+		err = deliverEmail(email)
+	}
+
+	attempts := record.GetInt("attempts") + 1
+	record.Set("attempts", attempts)
+	if err != nil {
+		record.Set("last_error", truncate(err.Error(), 1000))
+		if attempts >= outboxMaxAttempts {
+			record.Set("status", "dead")
+			log.Printf("processEmailOutbox: %s (%q) dead after %d attempts: %v", record.Id, email.Subject, attempts, err)
+		} else {
+			record.Set("status", "pending")
+			record.Set("next_attempt_at", now.Add(outboxBackoff(attempts)))
+		}
+		if saveErr := app.Save(record); saveErr != nil {
+			log.Printf("processEmailOutbox: failed to record attempt on %s: %v", record.Id, saveErr)
+		}
+		return err
+	}
+
+	record.Set("status", "sent")
+	record.Set("sent_at", now)
+	record.Set("last_error", "")
+	if err := app.Save(record); err != nil {
+		log.Printf("CRITICAL processEmailOutbox: %s delivered but not marked sent — it may be sent again: %v", record.Id, err)
+	}
+	applyOutboxEffect(app, record, now)
+	return nil
+}
+
+// outboxBackoff is the wait after the given number of failed attempts.
+func outboxBackoff(attempts int) time.Duration {
+	wait := outboxBaseBackoff
+	for i := 1; i < attempts && wait < outboxMaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, outboxMaxBackoff)
+}
+
+func loadOutboxEmail(app core.App, record *core.Record) (Email, error) {
+	email := Email{
+		Subject: record.GetString("subject"),
+		HTML:    record.GetString("html"),
+	}
+	if err := record.UnmarshalJSONField("recipients", &email.To); err != nil {
+		return email, fmt.Errorf("recipients: %w", err)
+	}
+
+	stored := record.GetStringSlice("attachments")
+	if len(stored) == 0 {
+		return email, nil
+	}
+	var names []string
+	_ = record.UnmarshalJSONField("attachment_names", &names)
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return email, err
+	}
+	defer fsys.Close()
+
+	for i, key := range stored {
+		r, err := fsys.GetReader(record.BaseFilesPath() + "/" + key)
+		if err != nil {
+			return email, fmt.Errorf("attachment %s: %w", key, err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return email, fmt.Errorf("attachment %s: %w", key, err)
+		}
+		filename := key
+		if i < len(names) {
+			filename = names[i]
+		}
+		email.Attachments = append(email.Attachments, EmailAttachment{Filename: filename, Content: content})
+	}
+	return email, nil
+}
+
+func applyOutboxEffect(app core.App, record *core.Record, at time.Time) {
+	kind := record.GetString("effect")
+	if kind == "" {
+		return
+	}
+	apply, ok := outboxEffects[kind]
+	if !ok {
+		log.Printf("processEmailOutbox: unknown effect %q on %s", kind, record.Id)
+		return
+	}
+	var refs []string
+	if err := record.UnmarshalJSONField("effect_refs", &refs); err != nil {
+		log.Printf("processEmailOutbox: bad effect_refs on %s: %v", record.Id, err)
+		return
+	}
+	if err := apply(app, refs, at); err != nil {
+		log.Printf("CRITICAL processEmailOutbox: %s delivered but %s not applied — it may be sent again: %v", record.Id, kind, err)
+	}
+}
+
+func purgeEmailOutbox(app core.App, status, field string, before time.Time) {
+	records, err := app.FindRecordsByFilter("email_outbox",
+		"status = {:status} && "+field+" < {:before}", "", outboxBatchSize, 0,
+		dbx.Params{"status": status, "before": before.Format(types.DefaultDateLayout)})
+	if err != nil {
+		log.Printf("processEmailOutbox: purge %s: %v", status, err)
+		return
+	}
+	for _, record := range records {
+		if err := app.Delete(record); err != nil {
+			log.Printf("processEmailOutbox: failed to purge %s: %v", record.Id, err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+//go:build testdata
+
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func outboxRecords(t testing.TB, app core.App) []*core.Record {
+	t.Helper()
+	records, err := app.FindAllRecords("email_outbox", dbx.NewExp("1 = 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestProcessMessages_MarksReadOnlyOnceDigestIsDelivered(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	sent := stubSend(t, assertError)
+
+	if err := processMessages(app, 60); err != nil {
+		t.Fatal(err)
+	}
+	queued := outboxRecords(t, app)
+	if len(queued) != 1 {
+		t.Fatalf("want the digest queued once, got %d", len(queued))
+	}
+	if got := queued[0].GetString("status"); got != "pending" {
+		t.Errorf("failed digest: status %q, want pending", got)
+	}
+	if queued[0].GetInt("attempts") != 1 || queued[0].GetString("last_error") == "" {
+		t.Error("the failed first attempt should be recorded")
+	}
+
+	// The next run must not queue the same messages again.
+	if err := processMessages(app, 60); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(outboxRecords(t, app)); n != 1 || len(*sent) != 1 {
+		t.Errorf("queued messages were picked up again: %d queued, %d attempts", n, len(*sent))
+	}
+	if msg, _ := app.FindRecordById("messages", "testmsgalpha01a"); msg.GetBool("read") {
+		t.Fatal("message should stay unread until the digest is delivered")
+	}
+
+	stubSend(t, nil)
+	if err := processEmailOutbox(app, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	delivered, err := app.FindRecordById("email_outbox", queued[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered.GetString("status") != "sent" || delivered.GetDateTime("sent_at").IsZero() {
+		t.Errorf("retried digest: status %q, want sent", delivered.GetString("status"))
+	}
+	if msg, _ := app.FindRecordById("messages", "testmsgalpha01a"); !msg.GetBool("read") {
+		t.Error("message should be marked read once the digest is delivered")
+	}
+}
+
+func TestProcessEmailOutbox_BacksOffThenDeadLetters(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	sent := stubSend(t, assertError)
+
+	email := Email{To: []Recipient{{Name: "Alpha Admin", Email: "admin@alpha.test"}}, Subject: "Backoff", HTML: "<p>x</p>"}
+	if err := queueEmail(app, "testcongalpha01", email, nil); err != nil {
+		t.Fatal(err)
+	}
+	id := outboxRecords(t, app)[0].Id
+
+	now := time.Now().UTC()
+	for attempt := 1; attempt < outboxMaxAttempts; attempt++ {
+		record, err := app.FindRecordById("email_outbox", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := record.GetDateTime("next_attempt_at").Time()
+		wantAfter := outboxBackoff(attempt)
+		if attempt > 1 {
+			if got := next.Sub(now); got != wantAfter {
+				t.Errorf("after attempt %d: next attempt in %s, want %s", attempt, got, wantAfter)
+			}
+		}
+
+		// Not yet due: nothing is sent.
+		before := len(*sent)
+		if err := processEmailOutbox(app, next.Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if len(*sent) != before {
+			t.Fatalf("attempt %d ran before it was due", attempt+1)
+		}
+
+		now = next
+		if err := processEmailOutbox(app, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	record, err := app.FindRecordById("email_outbox", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.GetString("status") != "dead" || record.GetInt("attempts") != outboxMaxAttempts {
+		t.Fatalf("want dead after %d attempts, got %s after %d", outboxMaxAttempts, record.GetString("status"), record.GetInt("attempts"))
+	}
+	if len(*sent) != outboxMaxAttempts {
+		t.Errorf("want %d delivery attempts, got %d", outboxMaxAttempts, len(*sent))
+	}
+
+	if err := processEmailOutbox(app, now.Add(48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != outboxMaxAttempts {
+		t.Error("a dead email should not be retried by the worker")
+	}
+}
+
+func TestQueueEmail_DeliversStoredAttachments(t *testing.T) {
+	app := setupMessagesTestApp(t)
+
+	var delivered []Email
+	fail := true
+	original := deliverEmail
+	deliverEmail = func(email Email) error {
+		delivered = append(delivered, email)
+		if fail {
+			return assertError
+		}
+		return nil
+	}
+	t.Cleanup(func() { deliverEmail = original })
+
+	if err := queueEmail(app, "testcongalpha01", reportEmail, nil); err != nil {
+		t.Fatal(err)
+	}
+	fail = false
+	if err := processEmailOutbox(app, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(delivered) != 2 {
+		t.Fatalf("want the eager attempt and one retry, got %d", len(delivered))
+	}
+	retried := delivered[1]
+	if len(retried.Attachments) != 1 {
+		t.Fatalf("retry should carry the attachment, got %d", len(retried.Attachments))
+	}
+	got := retried.Attachments[0]
+	want := reportEmail.Attachments[0]
+	if got.Filename != want.Filename || string(got.Content) != string(want.Content) {
+		t.Errorf("attachment: got %s (%q), want %s (%q)", got.Filename, got.Content, want.Filename, want.Content)
+	}
+	if len(retried.To) != 1 || retried.To[0] != reportEmail.To[0] {
+		t.Errorf("recipients: got %v", retried.To)
+	}
+}
@@ -2,54 +2,42 @@ package jobs
 
 import (
 	"bytes"
-	"context"
-	"encoding/base64"
 	"fmt"
+	"html/template"
 	"log"
-	"os"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
-	"text/template"
 	"time"
 
-	"github.com/mailersend/mailersend-go"
+	"ministry-mapper/internal/handlers"
+
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/xuri/excelize/v2"
 )
 
-// reportTmpl is parsed once on first use and reused for all email sends.
+// reportTmpls holds report.html parsed once per language on first use and
+// reused for all email sends.
 var (
-	reportTmpl     *template.Template
-	reportTmplOnce sync.Once
-	reportTmplErr  error
+	reportTmpls   = map[string]*template.Template{}
+	reportTmplsMu sync.Mutex
 )
 
-func getReportTemplate() (*template.Template, error) {
-	reportTmplOnce.Do(func() {
-		reportTmpl, reportTmplErr = template.ParseFiles("templates/report.html")
-	})
-	return reportTmpl, reportTmplErr
-}
-
-// sendEmailWithRetry retries a MailerSend send call up to 3 times with exponential backoff.
-func sendEmailWithRetry(send func() error) error {
-	delays := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second}
-	var err error
-	for attempt := 0; attempt <= len(delays); attempt++ {
-		err = send()
-		if err == nil {
-			return nil
-		}
-		if attempt < len(delays) {
-			log.Printf("Email send attempt %d failed: %v — retrying in %s", attempt+1, err, delays[attempt])
-			time.Sleep(delays[attempt])
-		}
+func getReportTemplate(loc *locale) (*template.Template, error) {
+	reportTmplsMu.Lock()
+	defer reportTmplsMu.Unlock()
+	if tmpl, ok := reportTmpls[loc.Lang]; ok {
+		return tmpl, nil
 	}
-	return fmt.Errorf("email send failed after %d attempts: %w", len(delays)+1, err)
+	tmpl, err := parseTemplate("templates/report.html", loc)
+	if err != nil {
+		return nil, err
+	}
+	reportTmpls[loc.Lang] = tmpl
+	return tmpl, nil
 }
 
 type ReportTemplateData struct {
@@ -406,10 +394,21 @@ func createDetailsSheet(app core.App, f *excelize.File, congregation *core.Recor
 		row++
 	}
 
+	// Completed coverage cycles per territory. A failure here only blanks the
+	// two coverage columns; the rest of the report is unaffected.
+	coverageByTerritory := make(map[string]handlers.TerritoryCoverage, len(territories))
+	if coverage, err := handlers.TerritoryCoverageStats(app, congregation.Id); err != nil {
+		log.Printf("warning: failed to fetch coverage cycles: %v", err)
+	} else {
+		for _, c := range coverage {
+			coverageByTerritory[c.Territory] = c
+		}
+	}
+
 	row += 2 // Two empty rows for better spacing
 	f.SetCellValue(sheet, fmt.Sprintf("A%d", row), "Territory Overview")
-	f.MergeCell(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("C%d", row))
-	f.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("C%d", row), sectionHeaderStyle)
+	f.MergeCell(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("E%d", row))
+	f.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("E%d", row), sectionHeaderStyle)
 	f.SetRowHeight(sheet, row, 30)
 	row++
 
@@ -421,9 +420,11 @@ func createDetailsSheet(app core.App, f *excelize.File, congregation *core.Recor
 		f.SetCellValue(sheet, fmt.Sprintf("A%d", row), "Territory Code")
 		f.SetCellValue(sheet, fmt.Sprintf("B%d", row), "Territory Description")
 		f.SetCellValue(sheet, fmt.Sprintf("C%d", row), "Territory Progress")
+		f.SetCellValue(sheet, fmt.Sprintf("D%d", row), "Times Covered")
+		f.SetCellValue(sheet, fmt.Sprintf("E%d", row), "Avg Days to Cover")
 
 		territoryHeaderStyle, _ := getTableHeaderStyle(f)
-		f.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("C%d", row), territoryHeaderStyle)
+		f.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("E%d", row), territoryHeaderStyle)
 		f.SetRowHeight(sheet, row, 28)
 		row++
 
@@ -448,8 +449,17 @@ func createDetailsSheet(app core.App, f *excelize.File, congregation *core.Recor
 				f.SetCellValue(sheet, fmt.Sprintf("C%d", row), "N/A")
 			}
 
+			coverage := coverageByTerritory[territory.Id]
+			f.SetCellValue(sheet, fmt.Sprintf("D%d", row), coverage.CyclesCovered)
+			if coverage.CyclesCovered > 0 {
+				f.SetCellValue(sheet, fmt.Sprintf("E%d", row), coverage.AverageDays)
+			} else {
+				f.SetCellValue(sheet, fmt.Sprintf("E%d", row), "N/A")
+			}
+
 			f.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("B%d", row), alternatingDataStyle(i%2 == 0))
 			f.SetCellStyle(sheet, fmt.Sprintf("C%d", row), fmt.Sprintf("C%d", row), alternatingPercentStyle(i%2 == 0))
+			f.SetCellStyle(sheet, fmt.Sprintf("D%d", row), fmt.Sprintf("E%d", row), alternatingDataStyle(i%2 == 0))
 
 			f.SetRowHeight(sheet, row, 25)
 			row++
@@ -551,6 +561,7 @@ func createDetailsSheet(app core.App, f *excelize.File, congregation *core.Recor
 	f.SetColWidth(sheet, "A", "A", 22)
 	f.SetColWidth(sheet, "B", "B", 45)
 	f.SetColWidth(sheet, "C", "C", 18)
+	f.SetColWidth(sheet, "D", "E", 18)
 
 	for i := 2; i <= 7; i++ {
 		f.SetRowHeight(sheet, i, 28)
@@ -1325,14 +1336,7 @@ func getStatusSymbol(status string) string {
 func sendReportEmailFromBuffer(app core.App, congregation *core.Record, filename string, content []byte, aiEnabled bool, period ReportPeriod) error {
 	log.Printf("Sending report email for congregation: %s", congregation.Get("code"))
 
-	if os.Getenv("MAILERSEND_API_KEY") == "" {
-		return fmt.Errorf("MAILERSEND_API_KEY is not configured")
-	}
-	if os.Getenv("MAILERSEND_FROM_EMAIL") == "" {
-		return fmt.Errorf("MAILERSEND_FROM_EMAIL is not configured")
-	}
-
-	recipients, err := fetchCongregationRecipients(app, congregation.Id, true)
+	recipients, err := fetchCongregationRecipients(app, congregation.Id, true, "")
 	if err != nil {
 		log.Println("Error fetching recipients:", err)
 		return err
@@ -1344,7 +1348,8 @@ func sendReportEmailFromBuffer(app core.App, congregation *core.Record, filename
 
 	log.Printf("Processing %d recipients\n", len(recipients))
 
-	tmpl, err := getReportTemplate()
+	loc := loadLocale(congregationLanguage(congregation))
+	tmpl, err := getReportTemplate(loc)
 	if err != nil {
 		log.Println("Error parsing template:", err)
 		return err
@@ -1355,8 +1360,8 @@ func sendReportEmailFromBuffer(app core.App, congregation *core.Record, filename
 	emailData := ReportTemplateData{
 		CongregationName: congregationName,
 		CongregationCode: congregationCode,
-		ReportDate:       period.Label,
-		ReportTitle:      "Monthly Report",
+		ReportDate:       period.localLabel(loc),
+		ReportTitle:      loc.text("report.monthly"),
 		FileName:         filename,
 		IsOnDemand:       false,
 		Summary:          generateAISummary(app, congregation, aiEnabled, period),
@@ -1368,35 +1373,19 @@ func sendReportEmailFromBuffer(app core.App, congregation *core.Record, filename
 		return err
 	}
 
-	encoded := base64.StdEncoding.EncodeToString(content)
-	ms := mailersend.NewMailersend(os.Getenv("MAILERSEND_API_KEY"))
-
-	emailRecipients := []mailersend.Recipient{}
-	for _, r := range recipients {
-		emailRecipients = append(emailRecipients, mailersend.Recipient{
-			Email: r.Email,
-			Name:  r.Name,
-		})
+	message := Email{
+		To:          recipients,
+		Subject:     loc.text("report.subject", emailData.ReportTitle, congregationName, emailData.ReportDate),
+		HTML:        body.String(),
+		Attachments: []EmailAttachment{{Filename: filename, Content: content}},
 	}
 
-	message := ms.Email.NewMessage()
-	message.SetFrom(mailersend.From{Email: os.Getenv("MAILERSEND_FROM_EMAIL"), Name: "Ministry Mapper"})
-	message.SetRecipients(emailRecipients)
-	message.SetSubject(fmt.Sprintf("Monthly Report for %s - %s", congregation.Get("name"), period.Label))
-	message.SetHTML(body.String())
-	message.AddAttachment(mailersend.Attachment{Filename: filename, Content: encoded})
-
-	if err := sendEmailWithRetry(func() error {
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-		defer cancel()
-		_, err := ms.Email.Send(ctx, message)
-		return err
-	}); err != nil {
-		log.Printf("Error sending report email for %s: %v", congregation.Get("code"), err)
+	if err := queueEmail(app, congregation.Id, message, nil); err != nil {
+		log.Printf("Error queueing report email for %s: %v", congregation.Get("code"), err)
 		return err
 	}
 
-	log.Println("Report email sent successfully")
+	log.Println("Report email queued successfully")
 	return nil
 }
 
@@ -1409,16 +1398,10 @@ func sendReportEmailToRecipient(app core.App, congregation *core.Record, filenam
 		return fmt.Errorf("recipient has no email address")
 	}
 
-	if os.Getenv("MAILERSEND_API_KEY") == "" {
-		return fmt.Errorf("MAILERSEND_API_KEY is not configured")
-	}
-	if os.Getenv("MAILERSEND_FROM_EMAIL") == "" {
-		return fmt.Errorf("MAILERSEND_FROM_EMAIL is not configured")
-	}
-
 	log.Printf("Sending on-demand report for congregation %s to %s", congregation.Get("code"), email)
 
-	tmpl, err := getReportTemplate()
+	loc := loadLocale(congregationLanguage(congregation))
+	tmpl, err := getReportTemplate(loc)
 	if err != nil {
 		log.Println("Error parsing template:", err)
 		return err
@@ -1429,8 +1412,8 @@ func sendReportEmailToRecipient(app core.App, congregation *core.Record, filenam
 	emailData := ReportTemplateData{
 		CongregationName: congregationName,
 		CongregationCode: congregationCode,
-		ReportDate:       period.Label,
-		ReportTitle:      "Activity Report",
+		ReportDate:       period.localLabel(loc),
+		ReportTitle:      loc.text("report.activity"),
 		FileName:         filename,
 		RecipientName:    name,
 		IsOnDemand:       true,
@@ -1443,27 +1426,19 @@ func sendReportEmailToRecipient(app core.App, congregation *core.Record, filenam
 		return err
 	}
 
-	encoded := base64.StdEncoding.EncodeToString(content)
-	ms := mailersend.NewMailersend(os.Getenv("MAILERSEND_API_KEY"))
-
-	message := ms.Email.NewMessage()
-	message.SetFrom(mailersend.From{Email: os.Getenv("MAILERSEND_FROM_EMAIL"), Name: "Ministry Mapper"})
-	message.SetRecipients([]mailersend.Recipient{{Email: email, Name: name}})
-	message.SetSubject(fmt.Sprintf("Activity Report for %s - %s", congregationName, period.Label))
-	message.SetHTML(body.String())
-	message.AddAttachment(mailersend.Attachment{Filename: filename, Content: encoded})
+	message := Email{
+		To:          []Recipient{{Email: email, Name: name}},
+		Subject:     loc.text("report.subject", emailData.ReportTitle, congregationName, emailData.ReportDate),
+		HTML:        body.String(),
+		Attachments: []EmailAttachment{{Filename: filename, Content: content}},
+	}
 
-	if err := sendEmailWithRetry(func() error {
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-		defer cancel()
-		_, err := ms.Email.Send(ctx, message)
-		return err
-	}); err != nil {
-		log.Printf("Error sending on-demand report email: %v", err)
+	if err := queueEmail(app, congregation.Id, message, nil); err != nil {
+		log.Printf("Error queueing on-demand report email: %v", err)
 		return err
 	}
 
-	log.Println("On-demand report email sent successfully")
+	log.Println("On-demand report email queued successfully")
 	return nil
 }
 
@@ -0,0 +1,16 @@
+package jobs
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// InstructionPushTitle titles the push notification of a broadcast from
+// sender in the congregation's language, falling back to the default
+// language when the congregation cannot be loaded.
+func InstructionPushTitle(app core.App, congregationId, sender string) string {
+	language := defaultLanguage
+	if congRecord, err := app.FindRecordById("congregations", congregationId); err == nil {
+		language = congregationLanguage(congRecord)
+	}
+	return loadLocale(language).text("push.instruction_title", sender)
+}
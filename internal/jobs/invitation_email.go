@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type invitationTmplData struct {
+	CongregationName string
+	RoleName         string
+	InviterName      string
+	ExpiresAt        string
+	AcceptURL        string
+}
+
+// SendInvitationEmail emails an invitation link to the invited address. The
+// link carries the plaintext token as ?invitation=, which the frontend passes
+// to /invitation/accept after the invitee signs in. The invitee has no
+// account yet, so the email is in the congregation's language.
+func SendInvitationEmail(app core.App, invitation *core.Record, token string) error {
+	congregation, err := app.FindRecordById("congregations", invitation.GetString("congregation"))
+	if err != nil {
+		return fmt.Errorf("SendInvitationEmail: load congregation: %w", err)
+	}
+
+	inviterName := ""
+	if inviter, err := app.FindRecordById("users", invitation.GetString("invited_by")); err == nil {
+		inviterName = inviter.GetString("name")
+	}
+
+	loc := loadLocale(congregationLanguage(congregation))
+	tmpl, err := parseTemplate("templates/invitation.html", loc)
+	if err != nil {
+		return fmt.Errorf("SendInvitationEmail: parse template: %w", err)
+	}
+
+	location := loadCongregationLocation(congregation)
+	appURL := strings.TrimRight(os.Getenv("PB_APP_URL"), "/")
+	data := invitationTmplData{
+		CongregationName: congregation.GetString("name"),
+		RoleName:         loc.text("invitation.role." + invitation.GetString("role")),
+		InviterName:      inviterName,
+		ExpiresAt:        loc.date(invitation.GetDateTime("expires_at").Time().In(location), dateStyleDateTime),
+		AcceptURL:        appURL + "/?invitation=" + url.QueryEscape(token),
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("SendInvitationEmail: execute template: %w", err)
+	}
+
+	email := invitation.GetString("email")
+	subject := loc.text("invitation.subject", data.CongregationName)
+	return queuePlainEmail(app, congregation.Id, email, "", subject, body.String(), nil)
+}
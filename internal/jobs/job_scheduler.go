@@ -81,6 +81,37 @@ func ConfigureScheduler(app core.App) {
 		return assignmentsCleanup(app)
 	})
 
+	// Every 5 min: scheduled instructions should appear, and lapsed pins
+	// drop, close to their time. Runs ahead of processInstructions so a
+	// freshly published instruction makes the next digest.
+	addTask("processMessageSchedule", "4,9,14,19,24,29,34,39,44,49,54,59 * * * *", "enable-message-schedule", func() error {
+		return processMessageSchedule(app, time.Now())
+	})
+
+	// Every 5 min: retries queued emails whose first delivery attempt failed,
+	// backing off per email, and purges old delivered ones.
+	addTask("processEmailOutbox", "2,7,12,17,22,27,32,37,42,47,52,57 * * * *", "enable-email-outbox", func() error {
+		return processEmailOutbox(app, time.Now())
+	})
+
+	// Hourly: users who batch their digests get them once a day or week, at
+	// 07:00 in the congregation's timezone or once their quiet hours end.
+	addTask("processNotificationBatches", "53 * * * *", "enable-notification-batches", func() error {
+		return processNotificationBatches(app, time.Now())
+	})
+
+	// Every 15 min: retries webhook deliveries whose endpoint failed, backing
+	// off per delivery, and purges old delivered ones.
+	addTask("processWebhookDeliveries", "5,20,35,50 * * * *", "enable-webhook-deliveries", func() error {
+		return processWebhookDeliveries(app, time.Now())
+	})
+
+	// Every 15 min: link-id publishers have no email, so a subscribed browser
+	// is pushed a warning within the hour before their link expires.
+	addTask("processAssignmentExpiryWarnings", "10,25,40,55 * * * *", "enable-assignment-expiry-push", func() error {
+		return processAssignmentExpiryWarnings(app, time.Now())
+	})
+
 	// Every 30 min: publishers receive messages while actively working.
 	addTask("processMessages", "8,38 * * * *", "enable-message-processing", func() error {
 		return processMessages(app, 30)
@@ -96,6 +127,18 @@ func ConfigureScheduler(app core.App) {
 		return ProcessNotes(app, 60)
 	})
 
+	// Hourly: a new user is waiting on an administrator's decision, but an
+	// hourly digest is prompt enough without an email per request.
+	addTask("processAccessRequests", "43 * * * *", "enable-access-request-digest", func() error {
+		return processAccessRequests(app)
+	})
+
+	// Hourly: an expired role should stop granting access soon after its
+	// expires_at, and warnings go out a few days ahead.
+	addTask("processRoleExpiry", "13 * * * *", "enable-role-expiry", func() error {
+		return processRoleExpiry(app, time.Now())
+	})
+
 	// Monthly on the 1st — at 18:00 UTC (02:00 SGT), deep off-peak.
 	// Heavy job: reads all congregation data, builds Excel workbook, sends email
 	// to all administrators.
@@ -123,5 +166,19 @@ func ConfigureScheduler(app core.App) {
 		return ProcessNewAddresses(app, time.Now().UTC().Add(-24*time.Hour))
 	})
 
+	// Daily — at 19:30 UTC (03:30 SGT), after the night's other jobs.
+	// Applies per-congregation auto-reset policies and emails administrators
+	// a summary of the maps it reset.
+	addTask("processAutoResets", "30 19 * * *", "enable-auto-reset", func() error {
+		return processAutoResets(app)
+	})
+
+	// Daily — at 18:45 UTC (02:45 SGT), between the user jobs.
+	// Archives audit log rows past their retention period to storage and
+	// deletes them.
+	addTask("processLogRetention", "45 18 * * *", "enable-log-retention", func() error {
+		return processLogRetention(app, time.Now())
+	})
+
 	scheduler.Start()
 }
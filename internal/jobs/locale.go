@@ -0,0 +1,234 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// defaultLanguage is what emails fall back to when a congregation or user has
+// no language of their own, and what missing catalog entries fall back to.
+const defaultLanguage = "en"
+
+// localesDir holds one JSON catalog per language in migrations.emailLanguages.
+const localesDir = "templates/locales"
+
+// originLanguages is the language of a congregation that has not chosen one,
+// by origin. Origins not listed use defaultLanguage.
+var originLanguages = map[string]string{
+	"cn": "zh",
+	"mx": "es",
+	"br": "pt",
+	"eg": "ar",
+	"sa": "ar",
+}
+
+// Date styles passed to locale.date. Each catalog maps them to a Go layout in
+// which {month} and {mon} stand for the full and short month names.
+const (
+	dateStyleDate      = "date"       // 02 Jan 2006
+	dateStyleShortDate = "short_date" // 2 Jan 2006
+	dateStyleLongDate  = "long_date"  // 2 January 2006
+	dateStyleDateTime  = "date_time"  // 02 Jan 2006, 3:04 PM
+	dateStyleTimeDate  = "time_date"  // 03:04 PM, 02 Jan 2006
+	dateStyleTime      = "time"       // 03:04 PM
+	dateStyleMonth     = "month"      // January 2006
+)
+
+// locale is one language's catalog of email strings.
+type locale struct {
+	Lang        string            `json:"-"`
+	Name        string            `json:"name"` // in English, for LLM prompts
+	Dir         string            `json:"dir"`
+	Months      []string          `json:"months"`
+	MonthsShort []string          `json:"months_short"`
+	Formats     map[string]string `json:"formats"`
+	Messages    map[string]string `json:"messages"`
+
+	fallback *locale
+}
+
+var (
+	localesMu sync.Mutex
+	locales   = map[string]*locale{}
+)
+
+// loadLocale returns the catalog for lang. An unknown language, or one whose
+// catalog cannot be read, gets the default language's catalog; if even that
+// is missing, an empty catalog that renders message keys as they are.
+func loadLocale(lang string) *locale {
+	if lang == "" {
+		lang = defaultLanguage
+	}
+	localesMu.Lock()
+	defer localesMu.Unlock()
+	return loadLocaleLocked(lang)
+}
+
+func loadLocaleLocked(lang string) *locale {
+	if l, ok := locales[lang]; ok {
+		return l
+	}
+
+	l := &locale{}
+	raw, err := os.ReadFile(filepath.Join(localesDir, lang+".json"))
+	if err == nil {
+		err = json.Unmarshal(raw, l)
+	}
+	switch {
+	case err != nil && lang == defaultLanguage:
+		log.Printf("loadLocale: %s: %v", lang, err)
+		l = &locale{Name: "English", Dir: "ltr"}
+	case err != nil:
+		log.Printf("loadLocale: %s: %v; using %s", lang, err, defaultLanguage)
+		l = loadLocaleLocked(defaultLanguage)
+	default:
+		if lang != defaultLanguage {
+			l.fallback = loadLocaleLocked(defaultLanguage)
+		}
+	}
+	if l.Lang == "" {
+		l.Lang = lang
+	}
+	locales[lang] = l
+	return l
+}
+
+// congregationLanguage is the language email and AI summaries for the
+// congregation are written in: its language setting, else the usual language
+// of its origin.
+func congregationLanguage(congRecord *core.Record) string {
+	if lang := congRecord.GetString("language"); lang != "" {
+		return lang
+	}
+	if lang, ok := originLanguages[congRecord.GetString("origin")]; ok {
+		return lang
+	}
+	return defaultLanguage
+}
+
+// userLanguage is the language of an email addressed to a single user: their
+// own language setting, else that of congRecord (nil if the user belongs to
+// no congregation).
+func userLanguage(userLang string, congRecord *core.Record) string {
+	if userLang != "" {
+		return userLang
+	}
+	if congRecord != nil {
+		return congregationLanguage(congRecord)
+	}
+	return defaultLanguage
+}
+
+// message returns the catalog entry for key, falling back to the default
+// language and then to the key itself.
+func (l *locale) message(key string) string {
+	for c := l; c != nil; c = c.fallback {
+		if msg, ok := c.Messages[key]; ok {
+			return msg
+		}
+	}
+	return key
+}
+
+// text formats the plain-text message key with args, for subjects and push
+// notifications. Catalog entries take their arguments as %s or %[n]s.
+func (l *locale) text(key string, args ...any) string {
+	msg := l.message(key)
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, stringArgs(args, false)...)
+}
+
+// html formats message key for a template. The catalog entry is trusted
+// markup; args are escaped unless they are already template.HTML.
+func (l *locale) html(key string, args ...any) template.HTML {
+	msg := l.message(key)
+	if len(args) == 0 {
+		return template.HTML(msg)
+	}
+	return template.HTML(fmt.Sprintf(msg, stringArgs(args, true)...))
+}
+
+func stringArgs(args []any, escape bool) []any {
+	out := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case template.HTML:
+			out[i] = string(v)
+		default:
+			s := fmt.Sprint(v)
+			if escape {
+				s = template.HTMLEscapeString(s)
+			}
+			out[i] = s
+		}
+	}
+	return out
+}
+
+// date formats t (already in the congregation's timezone) in the given
+// dateStyle* with localised month names.
+func (l *locale) date(t time.Time, style string) string {
+	layout := ""
+	for c := l; c != nil && layout == ""; c = c.fallback {
+		layout = c.Formats[style]
+	}
+	if layout == "" {
+		layout = "02 Jan 2006"
+	}
+	out := t.Format(layout)
+	month := int(t.Month()) - 1
+	if len(l.Months) == 12 {
+		out = strings.ReplaceAll(out, "{month}", l.Months[month])
+	}
+	if len(l.MonthsShort) == 12 {
+		out = strings.ReplaceAll(out, "{mon}", l.MonthsShort[month])
+	}
+	return out
+}
+
+// dir is the text direction for the html dir attribute.
+func (l *locale) dir() string {
+	if l.Dir == "rtl" {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// languageName is the language's English name, which the LLM prompts use to
+// ask for summaries in it.
+func (l *locale) languageName() string {
+	if l.Name == "" {
+		return "English"
+	}
+	return l.Name
+}
+
+// languageInstruction is the sentence appended to an LLM system prompt so the
+// summary comes back in the named language.
+func languageInstruction(language string) string {
+	if language == "" {
+		language = "English"
+	}
+	return "Write every JSON value in " + language + "; keep the JSON field names in English."
+}
+
+// parseTemplate parses an email template with the t, lang and dir functions
+// bound to l.
+func parseTemplate(file string, l *locale) (*template.Template, error) {
+	return template.New(filepath.Base(file)).Funcs(template.FuncMap{
+		"t":    l.html,
+		"lang": func() string { return l.Lang },
+		"dir":  l.dir,
+	}).ParseFiles(file)
+}
@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// chdirRepoRoot lets loadLocale find templates/locales.
+func chdirRepoRoot(t *testing.T) {
+	t.Helper()
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(origDir) })
+}
+
+func TestLoadLocale_CatalogsCoverEveryEnglishKey(t *testing.T) {
+	chdirRepoRoot(t)
+	en := loadLocale("en")
+	for _, lang := range []string{"zh", "es", "pt", "ar"} {
+		l := loadLocale(lang)
+		if l.Lang != lang {
+			t.Fatalf("loadLocale(%q) returned the %q catalog", lang, l.Lang)
+		}
+		for key := range en.Messages {
+			if _, ok := l.Messages[key]; !ok {
+				t.Errorf("%s catalog is missing %q", lang, key)
+			}
+		}
+	}
+}
+
+func TestLoadLocale_UnknownLanguageFallsBackToEnglish(t *testing.T) {
+	chdirRepoRoot(t)
+	l := loadLocale("xx")
+	if got := l.text("batch.stop"); got != "Stop these emails" {
+		t.Errorf("unknown language text = %q; want the English entry", got)
+	}
+	if got := l.text("no.such.key"); got != "no.such.key" {
+		t.Errorf("missing key = %q; want the key itself", got)
+	}
+}
+
+func TestLocaleHTML_EscapesArguments(t *testing.T) {
+	chdirRepoRoot(t)
+	got := string(loadLocale("en").html("access_requests.intro", 2, "<b>Alpha</b>"))
+	if !strings.Contains(got, "<strong>&lt;b&gt;Alpha&lt;/b&gt;</strong>") {
+		t.Errorf("html() should keep catalog markup and escape arguments, got %q", got)
+	}
+}
+
+func TestLocaleDate_LocalisesMonthNames(t *testing.T) {
+	chdirRepoRoot(t)
+	ts := time.Date(2026, time.March, 5, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		lang, style, want string
+	}{
+		{"en", dateStyleLongDate, "5 March 2026"},
+		{"es", dateStyleLongDate, "5 de marzo de 2026"},
+		{"pt", dateStyleMonth, "março de 2026"},
+		{"zh", dateStyleDateTime, "2026年3月5日 14:30"},
+		{"ar", dateStyleLongDate, "5 مارس 2026"},
+	}
+	for _, tc := range tests {
+		if got := loadLocale(tc.lang).date(ts, tc.style); got != tc.want {
+			t.Errorf("%s date(%s) = %q; want %q", tc.lang, tc.style, got, tc.want)
+		}
+	}
+}
+
+func TestLocaleDir(t *testing.T) {
+	chdirRepoRoot(t)
+	if got := loadLocale("ar").dir(); got != "rtl" {
+		t.Errorf("ar dir = %q; want rtl", got)
+	}
+	if got := loadLocale("es").dir(); got != "ltr" {
+		t.Errorf("es dir = %q; want ltr", got)
+	}
+}
+
+func TestCongregationLanguage(t *testing.T) {
+	collection := core.NewBaseCollection("congregations")
+	collection.Fields.Add(&core.TextField{Name: "language"}, &core.TextField{Name: "origin"})
+
+	tests := []struct {
+		language, origin, want string
+	}{
+		{"pt", "mx", "pt"},
+		{"", "mx", "es"},
+		{"", "sg", "en"},
+		{"", "", "en"},
+	}
+	for _, tc := range tests {
+		record := core.NewRecord(collection)
+		record.Set("language", tc.language)
+		record.Set("origin", tc.origin)
+		if got := congregationLanguage(record); got != tc.want {
+			t.Errorf("congregationLanguage(language=%q, origin=%q) = %q; want %q", tc.language, tc.origin, got, tc.want)
+		}
+	}
+
+	if got := userLanguage("", nil); got != defaultLanguage {
+		t.Errorf("userLanguage without congregation = %q; want %q", got, defaultLanguage)
+	}
+}
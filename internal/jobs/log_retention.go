@@ -0,0 +1,281 @@
+package jobs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// retainedLogs are the audit collections the retention job prunes. Each one's
+// retention in days is read from LOG_RETENTION_<NAME>_DAYS (for example
+// LOG_RETENTION_ADDRESSES_LOG_DAYS); unset or 0 keeps rows forever.
+var retainedLogs = []string{"addresses_log", "assignments_log", "roles_log", "structure_log"}
+
+// IsRetainedLog reports whether collection is one of the audit logs the
+// retention job archives.
+func IsRetainedLog(collection string) bool {
+	return slices.Contains(retainedLogs, collection)
+}
+
+// logArchivePrefix is the storage folder archives are written under, one
+// gzipped JSONL file per collection per calendar month.
+const logArchivePrefix = "log_archives"
+
+// LogArchiveKey returns the storage key of a collection's archive for a month
+// in YYYY-MM form.
+func LogArchiveKey(collection, month string) string {
+	return fmt.Sprintf("%s/%s/%s.jsonl.gz", logArchivePrefix, collection, month)
+}
+
+// logRetentionDays returns the configured retention for a collection, or 0.
+func logRetentionDays(collection string) int {
+	raw := os.Getenv("LOG_RETENTION_" + strings.ToUpper(collection) + "_DAYS")
+	if raw == "" {
+		return 0
+	}
+	days, err := strconv.Atoi(raw)
+	if err != nil || days < 0 {
+		log.Printf("processLogRetention: ignoring invalid retention %q for %s", raw, collection)
+		return 0
+	}
+	return days
+}
+
+// RunLogRetention is the exported entry point used by tests.
+func RunLogRetention(app core.App, now time.Time) error {
+	return processLogRetention(app, now)
+}
+
+// processLogRetention archives and then deletes audit rows older than each
+// collection's retention period.
+//
+// The cutoff is rounded down to the start of its month so a month is only
+// ever archived once it is entirely past retention, and the archive is
+// uploaded before any row is deleted: a failed upload leaves the rows in
+// place for the next run. Should an archive for the month already exist (a
+// row arrived late, or a previous run died between upload and delete), the
+// new rows are merged into it rather than overwriting it.
+func processLogRetention(app core.App, now time.Time) error {
+	log.Println("processLogRetention: starting")
+
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return fmt.Errorf("processLogRetention: open storage: %w", err)
+	}
+	defer fsys.Close()
+
+	for _, collection := range retainedLogs {
+		days := logRetentionDays(collection)
+		if days == 0 {
+			continue
+		}
+
+		expired := now.UTC().AddDate(0, 0, -days)
+		cutoff := time.Date(expired.Year(), expired.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+		months, err := expiredLogMonths(app, collection, cutoff)
+		if err != nil {
+			log.Printf("processLogRetention: %s: %v", collection, err)
+			continue
+		}
+
+		for _, month := range months {
+			n, err := archiveLogMonth(app, fsys, collection, month)
+			if err != nil {
+				log.Printf("processLogRetention: %s %s: %v", collection, month, err)
+				continue
+			}
+			log.Printf("processLogRetention: archived and pruned %d %s rows for %s", n, collection, month)
+		}
+	}
+
+	log.Println("processLogRetention: completed")
+	return nil
+}
+
+// expiredLogMonths lists the YYYY-MM months holding rows created before cutoff.
+func expiredLogMonths(app core.App, collection string, cutoff time.Time) ([]string, error) {
+	var rows []struct {
+		Month string `db:"month"`
+	}
+	err := app.DB().NewQuery(fmt.Sprintf(
+		"SELECT DISTINCT strftime('%%Y-%%m', created) AS month FROM %s WHERE created < {:cutoff} ORDER BY month",
+		collection,
+	)).Bind(dbx.Params{"cutoff": cutoff.Format(types.DefaultDateLayout)}).All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	months := make([]string, 0, len(rows))
+	for _, row := range rows {
+		months = append(months, row.Month)
+	}
+	return months, nil
+}
+
+// archiveLogMonth writes one month of a collection to storage and deletes the
+// archived rows, returning how many were archived.
+func archiveLogMonth(app core.App, fsys *filesystem.System, collection, month string) (int, error) {
+	start, err := time.Parse("2006-01", month)
+	if err != nil {
+		return 0, err
+	}
+	params := dbx.Params{
+		"start": start.Format(types.DefaultDateLayout),
+		"end":   start.AddDate(0, 1, 0).Format(types.DefaultDateLayout),
+	}
+	where := "created >= {:start} AND created < {:end}"
+
+	rows, err := selectLogRows(app, collection, where, params)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	key := LogArchiveKey(collection, month)
+	exists, err := fsys.Exists(key)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		previous, err := ReadLogArchive(app, key)
+		if err != nil {
+			return 0, fmt.Errorf("read existing archive: %w", err)
+		}
+		rows = mergeArchiveRows(previous, rows)
+	}
+
+	content, err := encodeLogArchive(rows)
+	if err != nil {
+		return 0, err
+	}
+	if err := fsys.Upload(content, key); err != nil {
+		return 0, fmt.Errorf("upload archive: %w", err)
+	}
+
+	res, err := app.DB().NewQuery(fmt.Sprintf("DELETE FROM %s WHERE %s", collection, where)).Bind(params).Execute()
+	if err != nil {
+		return 0, fmt.Errorf("delete archived rows: %w", err)
+	}
+	deleted, _ := res.RowsAffected()
+	return int(deleted), nil
+}
+
+// selectLogRows reads rows as column -> value maps. NULL columns are omitted.
+func selectLogRows(app core.App, collection, where string, params dbx.Params) ([]map[string]string, error) {
+	rows, err := app.DB().NewQuery(fmt.Sprintf("SELECT * FROM %s WHERE %s ORDER BY created, id", collection, where)).
+		Bind(params).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []map[string]string
+	for rows.Next() {
+		raw := dbx.NullStringMap{}
+		if err := rows.ScanMap(raw); err != nil {
+			return nil, err
+		}
+		row := make(map[string]string, len(raw))
+		for column, value := range raw {
+			if value.Valid {
+				row[column] = value.String
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// mergeArchiveRows combines an existing archive with newly expired rows,
+// keeping one copy of each id and ordering by created.
+func mergeArchiveRows(previous, next []map[string]string) []map[string]string {
+	byId := make(map[string]map[string]string, len(previous)+len(next))
+	for _, row := range previous {
+		byId[row["id"]] = row
+	}
+	for _, row := range next {
+		byId[row["id"]] = row
+	}
+
+	merged := make([]map[string]string, 0, len(byId))
+	for _, row := range byId {
+		merged = append(merged, row)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i]["created"] != merged[j]["created"] {
+			return merged[i]["created"] < merged[j]["created"]
+		}
+		return merged[i]["id"] < merged[j]["id"]
+	})
+	return merged
+}
+
+func encodeLogArchive(rows []map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return nil, err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReadLogArchive loads every row of an archive written by the retention job.
+func ReadLogArchive(app core.App, key string) ([]map[string]string, error) {
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return nil, err
+	}
+	defer fsys.Close()
+
+	reader, err := fsys.GetReader(key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return decodeLogArchive(reader)
+}
+
+func decodeLogArchive(r io.Reader) ([]map[string]string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var rows []map[string]string
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), 2<<20)
+	for scanner.Scan() {
+		row := map[string]string{}
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
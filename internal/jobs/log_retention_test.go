@@ -0,0 +1,96 @@
+//go:build testdata
+
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func insertAddressLog(t testing.TB, app core.App, id, created string) {
+	t.Helper()
+	_, err := app.DB().Insert("addresses_log", dbx.Params{
+		"id": id, "address": "testalpha01a001", "congregation": "testcongalpha01",
+		"territory": "testterralpha01", "map": "testmapalpha01a",
+		"old_status": "not_done", "new_status": "done", "changed_by": "Field Worker",
+		"created": created, "updated": created,
+	}).Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countAddressLogs(t testing.TB, app core.App, ids ...string) int {
+	t.Helper()
+	var n int
+	for _, id := range ids {
+		if _, err := app.FindRecordById("addresses_log", id); err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func TestProcessLogRetention_ArchivesWholeExpiredMonths(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	t.Setenv("LOG_RETENTION_ADDRESSES_LOG_DAYS", "30")
+
+	insertAddressLog(t, app, "retainlog000001", "2026-01-05 10:00:00.000Z")
+	insertAddressLog(t, app, "retainlog000002", "2026-01-20 10:00:00.000Z")
+	insertAddressLog(t, app, "retainlog000003", "2026-02-10 10:00:00.000Z")
+	insertAddressLog(t, app, "retainlog000004", "2026-03-10 10:00:00.000Z")
+
+	// 30 days before 15 March is 13 February, so the cutoff rounds down to
+	// 1 February: January is archived, February is not yet entirely expired.
+	now := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	if err := processLogRetention(app, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := countAddressLogs(t, app, "retainlog000001", "retainlog000002"); n != 0 {
+		t.Errorf("January rows should be pruned, %d remain", n)
+	}
+	if n := countAddressLogs(t, app, "retainlog000003", "retainlog000004"); n != 2 {
+		t.Errorf("February and March rows must be kept, got %d", n)
+	}
+
+	rows, err := ReadLogArchive(app, LogArchiveKey("addresses_log", "2026-01"))
+	if err != nil {
+		t.Fatalf("January archive missing: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["id"] != "retainlog000001" || rows[1]["id"] != "retainlog000002" {
+		t.Fatalf("unexpected archive contents: %v", rows)
+	}
+	if rows[0]["new_status"] != "done" || rows[0]["changed_by"] != "Field Worker" {
+		t.Errorf("archive should keep every column, got %v", rows[0])
+	}
+
+	// A row for an already archived month is merged into the existing file.
+	insertAddressLog(t, app, "retainlog000005", "2026-01-25 10:00:00.000Z")
+	if err := processLogRetention(app, now); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = ReadLogArchive(app, LogArchiveKey("addresses_log", "2026-01"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Errorf("expected the late row merged into the archive, got %d rows", len(rows))
+	}
+}
+
+func TestProcessLogRetention_NoPolicyKeepsEverything(t *testing.T) {
+	app := setupMessagesTestApp(t)
+
+	insertAddressLog(t, app, "retainlog000001", "2020-01-05 10:00:00.000Z")
+
+	if err := processLogRetention(app, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if n := countAddressLogs(t, app, "retainlog000001"); n != 1 {
+		t.Error("rows must be kept when no retention is configured")
+	}
+}
@@ -0,0 +1,204 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/domodwyer/mailyak/v3"
+	"github.com/mailersend/mailersend-go"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+const mailFromName = "Ministry Mapper"
+
+// Email is one outbound message, independent of the transport delivering it.
+type Email struct {
+	To          []Recipient
+	Subject     string
+	HTML        string
+	Attachments []EmailAttachment
+}
+
+// EmailAttachment is a file sent with an Email, such as the Excel report.
+type EmailAttachment struct {
+	Filename string
+	Content  []byte
+}
+
+// MailTransport delivers an Email. The transport is picked by MAIL_TRANSPORT
+// (see newMailTransport) so every job sends through the same one.
+type MailTransport interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// newMailTransport builds the transport selected by MAIL_TRANSPORT:
+//
+//   - "mailersend" (the default): the MailerSend API, keyed by MAILERSEND_API_KEY.
+//   - "smtp": the relay in PB_SMTP_HOST / PB_SMTP_PORT, authenticating with
+//     PB_SMTP_USERNAME / PB_SMTP_PASSWORD when set. Port 465 uses implicit
+//     TLS; any other port upgrades with STARTTLS when the server offers it.
+//   - "outbox": writes each message as a file into the maildir at
+//     MAIL_OUTBOX_DIR (default pb_data/outbox), for development and tests.
+//
+// The sender is MAIL_FROM_EMAIL, falling back to MAILERSEND_FROM_EMAIL.
+// Configuration is read on every call so a misconfigured transport fails the
+// send that uses it rather than the whole app.
+func newMailTransport() (MailTransport, error) {
+	from := os.Getenv("MAIL_FROM_EMAIL")
+	if from == "" {
+		from = os.Getenv("MAILERSEND_FROM_EMAIL")
+	}
+	sender := mail.Address{Name: mailFromName, Address: from}
+
+	switch kind := os.Getenv("MAIL_TRANSPORT"); kind {
+	case "", "mailersend":
+		apiKey := os.Getenv("MAILERSEND_API_KEY")
+		if apiKey == "" || from == "" {
+			return nil, fmt.Errorf("MAILERSEND_API_KEY or MAIL_FROM_EMAIL not configured")
+		}
+		return &mailerSendTransport{apiKey: apiKey, from: sender}, nil
+	case "smtp":
+		host := os.Getenv("PB_SMTP_HOST")
+		if host == "" || from == "" {
+			return nil, fmt.Errorf("PB_SMTP_HOST or MAIL_FROM_EMAIL not configured")
+		}
+		port := 587
+		if p := os.Getenv("PB_SMTP_PORT"); p != "" {
+			var err error
+			if port, err = strconv.Atoi(p); err != nil {
+				return nil, fmt.Errorf("invalid PB_SMTP_PORT %q", p)
+			}
+		}
+		return &smtpTransport{
+			client: &mailer.SMTPClient{
+				Host:     host,
+				Port:     port,
+				TLS:      port == 465,
+				Username: os.Getenv("PB_SMTP_USERNAME"),
+				Password: os.Getenv("PB_SMTP_PASSWORD"),
+			},
+			from: sender,
+		}, nil
+	case "outbox":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = filepath.Join("pb_data", "outbox")
+		}
+		if sender.Address == "" {
+			sender.Address = "ministry-mapper@localhost"
+		}
+		return &outboxTransport{dir: dir, from: sender}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_TRANSPORT %q", kind)
+	}
+}
+
+// sendEmail delivers email through the configured transport.
+func sendEmail(email Email) error {
+	transport, err := newMailTransport()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	return transport.Send(ctx, email)
+}
+
+type mailerSendTransport struct {
+	apiKey string
+	from   mail.Address
+}
+
+func (t *mailerSendTransport) Send(ctx context.Context, email Email) error {
+	ms := mailersend.NewMailersend(t.apiKey)
+
+	recipients := make([]mailersend.Recipient, 0, len(email.To))
+	for _, r := range email.To {
+		recipients = append(recipients, mailersend.Recipient{Email: r.Email, Name: r.Name})
+	}
+
+	message := ms.Email.NewMessage()
+	message.SetFrom(mailersend.From{Email: t.from.Address, Name: t.from.Name})
+	message.SetRecipients(recipients)
+	message.SetSubject(email.Subject)
+	message.SetHTML(email.HTML)
+	for _, a := range email.Attachments {
+		message.AddAttachment(mailersend.Attachment{Filename: a.Filename, Content: base64.StdEncoding.EncodeToString(a.Content)})
+	}
+
+	_, err := ms.Email.Send(ctx, message)
+	return err
+}
+
+// smtpTransport sends through PocketBase's SMTP client, the same one it uses
+// for its own auth emails.
+type smtpTransport struct {
+	client *mailer.SMTPClient
+	from   mail.Address
+}
+
+func (t *smtpTransport) Send(_ context.Context, email Email) error {
+	message := &mailer.Message{
+		From:    t.from,
+		Subject: email.Subject,
+		HTML:    email.HTML,
+	}
+	for _, r := range email.To {
+		message.To = append(message.To, mail.Address{Name: r.Name, Address: r.Email})
+	}
+	if len(email.Attachments) > 0 {
+		message.Attachments = make(map[string]io.Reader, len(email.Attachments))
+		for _, a := range email.Attachments {
+			message.Attachments[a.Filename] = bytes.NewReader(a.Content)
+		}
+	}
+	return t.client.Send(message)
+}
+
+// outboxTransport renders each message as it would go over SMTP and delivers
+// it into a maildir (tmp/, new/, cur/) instead, so any mail client can open it.
+type outboxTransport struct {
+	dir  string
+	from mail.Address
+}
+
+func (t *outboxTransport) Send(_ context.Context, email Email) error {
+	yak := mailyak.New("", nil)
+	yak.From(t.from.Address)
+	yak.FromName(t.from.Name)
+	for _, r := range email.To {
+		yak.To((&mail.Address{Name: r.Name, Address: r.Email}).String())
+	}
+	yak.Subject(email.Subject)
+	yak.HTML().Set(email.HTML)
+	for _, a := range email.Attachments {
+		yak.Attach(a.Filename, bytes.NewReader(a.Content))
+	}
+
+	buf, err := yak.MimeBuf()
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(t.dir, sub), 0o755); err != nil {
+			return err
+		}
+	}
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("%d.%s.%s.eml", time.Now().UnixNano(), security.RandomString(8), host)
+	tmpPath := filepath.Join(t.dir, "tmp", name)
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(t.dir, "new", name))
+}
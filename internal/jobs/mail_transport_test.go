@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"bufio"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var reportEmail = Email{
+	To:          []Recipient{{Name: "Alpha Admin", Email: "admin@alpha.test"}},
+	Subject:     "Monthly Report for Alpha - Sep 2026",
+	HTML:        "<p>Report attached</p>",
+	Attachments: []EmailAttachment{{Filename: "report.xlsx", Content: []byte("PK\x03\x04 workbook")}},
+}
+
+func TestSendEmail_OutboxWritesMaildirMessage(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("MAIL_TRANSPORT", "outbox")
+	t.Setenv("MAIL_OUTBOX_DIR", dir)
+	t.Setenv("MAIL_FROM_EMAIL", "noreply@ministry-mapper.test")
+
+	if err := sendEmail(reportEmail); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("want one message in new/, got %d", len(entries))
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "new", entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("outbox file is not a valid message: %v", err)
+	}
+	if got := msg.Header.Get("Subject"); got != reportEmail.Subject {
+		t.Errorf("Subject: got %q", got)
+	}
+	if got := msg.Header.Get("To"); !strings.Contains(got, "admin@alpha.test") {
+		t.Errorf("To: got %q", got)
+	}
+	if got := msg.Header.Get("From"); !strings.Contains(got, "noreply@ministry-mapper.test") {
+		t.Errorf("From: got %q", got)
+	}
+	if !strings.Contains(string(raw), `filename="report.xlsx"`) {
+		t.Error("the attachment should be part of the message")
+	}
+}
+
+func TestNewMailTransport_Configuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"mailersend without key", map[string]string{"MAIL_TRANSPORT": "", "MAILERSEND_API_KEY": "", "MAILERSEND_FROM_EMAIL": "a@b.test"}, true},
+		{"mailersend", map[string]string{"MAIL_TRANSPORT": "mailersend", "MAILERSEND_API_KEY": "key", "MAILERSEND_FROM_EMAIL": "a@b.test"}, false},
+		{"smtp without host", map[string]string{"MAIL_TRANSPORT": "smtp", "PB_SMTP_HOST": "", "MAIL_FROM_EMAIL": "a@b.test"}, true},
+		{"smtp with bad port", map[string]string{"MAIL_TRANSPORT": "smtp", "PB_SMTP_HOST": "relay.test", "PB_SMTP_PORT": "x", "MAIL_FROM_EMAIL": "a@b.test"}, true},
+		{"smtp", map[string]string{"MAIL_TRANSPORT": "smtp", "PB_SMTP_HOST": "relay.test", "PB_SMTP_PORT": "465", "MAIL_FROM_EMAIL": "a@b.test"}, false},
+		{"unknown", map[string]string{"MAIL_TRANSPORT": "pigeon"}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, key := range []string{"MAIL_FROM_EMAIL", "MAILERSEND_FROM_EMAIL", "MAILERSEND_API_KEY", "PB_SMTP_HOST", "PB_SMTP_PORT"} {
+				t.Setenv(key, "")
+			}
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			_, err := newMailTransport()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// fakeSMTPServer accepts one plain-text SMTP session and returns the DATA it
+// received on the channel.
+func fakeSMTPServer(t *testing.T) (port int, data <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var body strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					body.WriteString(l)
+				}
+				received <- body.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	return ln.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestSendEmail_SMTPSendsAttachments(t *testing.T) {
+	port, data := fakeSMTPServer(t)
+	t.Setenv("MAIL_TRANSPORT", "smtp")
+	t.Setenv("PB_SMTP_HOST", "127.0.0.1")
+	t.Setenv("PB_SMTP_PORT", strconv.Itoa(port))
+	t.Setenv("PB_SMTP_USERNAME", "")
+	t.Setenv("PB_SMTP_PASSWORD", "")
+	t.Setenv("MAIL_FROM_EMAIL", "noreply@ministry-mapper.test")
+
+	if err := sendEmail(reportEmail); err != nil {
+		t.Fatal(err)
+	}
+	body := <-data
+	if !strings.Contains(body, "Subject: "+reportEmail.Subject) {
+		t.Error("relayed message should carry the subject")
+	}
+	if !strings.Contains(body, `filename="report.xlsx"`) {
+		t.Error("relayed message should carry the report attachment")
+	}
+}
@@ -0,0 +1,384 @@
+package jobs
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"ministry-mapper/internal/handlers"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Digest kinds, as listed in handlers.NotificationKinds.
+const (
+	digestMessages       = "messages"
+	digestInstructions   = "instructions"
+	digestNotes          = "notes"
+	digestNewAddresses   = "new_addresses"
+	digestAccessRequests = "access_requests"
+	digestAutoReset      = "auto_reset"
+	digestRoleExpiry     = "role_expiry"
+)
+
+// notificationBatchHour is the local hour daily and weekly (Monday) batches
+// become due.
+const notificationBatchHour = 7
+
+var unsubscribeFooterTmpl = template.Must(template.New("unsubscribe").Parse(`
+<div dir="{{.Dir}}" style="max-width:600px;margin:0 auto 20px;text-align:center;font-size:12px;color:#888;font-family:-apple-system,BlinkMacSystemFont,'Segoe UI',Roboto,sans-serif;">
+    {{if .KindURL}}<a href="{{.KindURL}}" style="color:#888;">{{.KindLabel}}</a> &middot; {{end}}<a href="{{.AllURL}}" style="color:#888;">{{.AllLabel}}</a>
+</div>
+`))
+
+// unsubscribeURL is the app link muting kind, or every digest when kind is
+// empty, for the preferences owning token.
+func unsubscribeURL(token, kind string) string {
+	link := strings.TrimRight(os.Getenv("PB_APP_URL"), "/") + "/?unsubscribe=" + url.QueryEscape(token)
+	if kind != "" {
+		link += "&kind=" + url.QueryEscape(kind)
+	}
+	return link
+}
+
+// withUnsubscribeFooter adds one-click unsubscribe links for kind (empty for
+// a batch of several kinds) to the end of an HTML email body, worded in loc.
+func withUnsubscribeFooter(htmlBody, congregationName, kind, token string, loc *locale) string {
+	data := struct {
+		Dir, KindLabel, KindURL, AllLabel, AllURL string
+	}{
+		Dir:      loc.dir(),
+		AllLabel: loc.text("digest.unsubscribe_all", congregationName),
+		AllURL:   unsubscribeURL(token, ""),
+	}
+	if kind != "" {
+		data.KindLabel = loc.text("digest.stop_kind", loc.text("digest."+kind))
+		data.KindURL = unsubscribeURL(token, kind)
+	}
+	var footer bytes.Buffer
+	if err := unsubscribeFooterTmpl.Execute(&footer, data); err != nil {
+		return htmlBody
+	}
+	if i := strings.LastIndex(htmlBody, "</body>"); i >= 0 {
+		return htmlBody[:i] + footer.String() + htmlBody[i:]
+	}
+	return htmlBody + footer.String()
+}
+
+// recipientToken returns r's unsubscribe token, creating r's preferences in
+// congregationId if they have none yet.
+func recipientToken(app core.App, r Recipient, congregationId string) (string, error) {
+	if r.UnsubscribeToken != "" {
+		return r.UnsubscribeToken, nil
+	}
+	pref, err := handlers.EnsureNotificationPreference(app, r.UserID, congregationId)
+	if err != nil {
+		return "", err
+	}
+	return pref.GetString("unsubscribe_token"), nil
+}
+
+// quietHoursEnd returns when the quiet hours start to end (HH:MM, possibly
+// spanning midnight) finish if now falls inside them in location, or the
+// zero time if it does not.
+func quietHoursEnd(start, end string, location *time.Location, now time.Time) time.Time {
+	if start == "" || end == "" || start == end {
+		return time.Time{}
+	}
+	s, err := time.Parse("15:04", start)
+	if err != nil {
+		return time.Time{}
+	}
+	e, err := time.Parse("15:04", end)
+	if err != nil {
+		return time.Time{}
+	}
+
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	startMinute, endMinute := s.Hour()*60+s.Minute(), e.Hour()*60+e.Minute()
+	quiet := minute >= startMinute && minute < endMinute
+	if startMinute > endMinute {
+		quiet = minute >= startMinute || minute < endMinute
+	}
+	if !quiet {
+		return time.Time{}
+	}
+
+	until := time.Date(local.Year(), local.Month(), local.Day(), e.Hour(), e.Minute(), 0, 0, location)
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until.UTC()
+}
+
+// queueDigest sends a digest email of the given kind to each recipient on
+// their own terms: immediately with an unsubscribe footer, held in the
+// outbox until their quiet hours end, or stored for their daily or weekly
+// batch. effect rides on the emails queued now; if every recipient batches
+// it, it is applied straight away so the job does not pick the same rows up
+// again.
+func queueDigest(app core.App, congRecord *core.Record, kind string, recipients []Recipient, subject, htmlBody string, effect *outboxEffect) error {
+	now := time.Now().UTC()
+	location := loadCongregationLocation(congRecord)
+	loc := loadLocale(congregationLanguage(congRecord))
+	congregationName := congRecord.GetString("name")
+
+	queued, held := 0, 0
+	var lastErr error
+	for _, r := range recipients {
+		if r.Frequency == handlers.NotificationDaily || r.Frequency == handlers.NotificationWeekly {
+			if err := holdDigest(app, congRecord.Id, r.UserID, kind, subject, htmlBody); err != nil {
+				log.Printf("queueDigest: failed to hold %s digest for %s: %v", kind, r.Email, err)
+				lastErr = err
+				continue
+			}
+			held++
+			continue
+		}
+
+		body := htmlBody
+		if token, err := recipientToken(app, r, congRecord.Id); err == nil {
+			body = withUnsubscribeFooter(htmlBody, congregationName, kind, token, loc)
+		} else {
+			log.Printf("queueDigest: no unsubscribe token for %s: %v", r.Email, err)
+		}
+		at := quietHoursEnd(r.QuietStart, r.QuietEnd, location, now)
+		email := Email{To: []Recipient{r}, Subject: subject, HTML: body}
+		if err := queueEmailAt(app, congRecord.Id, email, effect, at); err != nil {
+			log.Printf("queueDigest: failed to queue %s digest for %s: %v", kind, r.Email, err)
+			lastErr = err
+			continue
+		}
+		queued++
+	}
+
+	if queued == 0 && held == 0 {
+		return lastErr
+	}
+	if queued == 0 && effect != nil {
+		if apply, ok := outboxEffects[effect.Kind]; ok {
+			if err := apply(app, effect.Refs, now); err != nil {
+				log.Printf("queueDigest: failed to apply %s for a batched digest: %v", effect.Kind, err)
+			}
+		}
+	}
+	return nil
+}
+
+// pushDigest sends n by Web Push to the recipients who get the digest email
+// now. Those batching their digests or in their quiet hours are not pushed;
+// the email reaches them later.
+func pushDigest(app core.App, congRecord *core.Record, recipients []Recipient, n handlers.PushNotification) {
+	if !handlers.PushEnabled() {
+		return
+	}
+	now := time.Now().UTC()
+	location := loadCongregationLocation(congRecord)
+	userIds := make([]string, 0, len(recipients))
+	for _, r := range recipients {
+		if r.UserID == "" || r.Frequency == handlers.NotificationDaily || r.Frequency == handlers.NotificationWeekly {
+			continue
+		}
+		if !quietHoursEnd(r.QuietStart, r.QuietEnd, location, now).IsZero() {
+			continue
+		}
+		userIds = append(userIds, r.UserID)
+	}
+	handlers.PushToUsers(app, userIds, n)
+}
+
+// holdDigest stores a digest for the user's next batch.
+func holdDigest(app core.App, congregationId, userId, kind, subject, htmlBody string) error {
+	col, err := app.FindCachedCollectionByNameOrId("notification_batch_items")
+	if err != nil {
+		return err
+	}
+	item := core.NewRecord(col)
+	item.Set("user", userId)
+	item.Set("congregation", congregationId)
+	item.Set("kind", kind)
+	item.Set("subject", subject)
+	item.Set("html", htmlBody)
+	return app.Save(item)
+}
+
+// latestBatchSlot is the most recent time at or before now that a batch of
+// the given frequency became due in location.
+func latestBatchSlot(frequency string, location *time.Location, now time.Time) time.Time {
+	local := now.In(location)
+	slot := time.Date(local.Year(), local.Month(), local.Day(), notificationBatchHour, 0, 0, 0, location)
+	if slot.After(local) {
+		slot = slot.AddDate(0, 0, -1)
+	}
+	if frequency == handlers.NotificationWeekly {
+		for slot.Weekday() != time.Monday {
+			slot = slot.AddDate(0, 0, -1)
+		}
+	}
+	return slot.UTC()
+}
+
+var (
+	digestStyleRe = regexp.MustCompile(`(?is)<style[^>]*>(.*?)</style>`)
+	digestBodyRe  = regexp.MustCompile(`(?is)<body[^>]*>(.*)</body>`)
+)
+
+type notificationBatchSection struct {
+	Subject        string
+	Body           template.HTML
+	UnsubscribeURL string
+}
+
+type notificationBatchTmplData struct {
+	CongregationName string
+	Period           string
+	Styles           template.CSS
+	Sections         []notificationBatchSection
+	UnsubscribeURL   string
+}
+
+// processNotificationBatches sends each user whose daily or weekly batch is
+// due a single email combining their held digests. Users in their quiet hours
+// wait for the next run; users who switched back to immediate get everything
+// held for them.
+func processNotificationBatches(app core.App, now time.Time) error {
+	var pending []struct {
+		User         string `db:"user"`
+		Congregation string `db:"congregation"`
+	}
+	err := app.DB().NewQuery("SELECT DISTINCT user, congregation FROM notification_batch_items").All(&pending)
+	if err != nil {
+		return fmt.Errorf("processNotificationBatches: %w", err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	sent := 0
+	for _, p := range pending {
+		ok, err := deliverNotificationBatch(app, p.User, p.Congregation, now.UTC())
+		if err != nil {
+			log.Printf("processNotificationBatches: user %s in %s: %v", p.User, p.Congregation, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	log.Printf("processNotificationBatches: %d batches sent", sent)
+	return nil
+}
+
+// deliverNotificationBatch queues the user's held digests if their batch is
+// due, reporting whether it did. The batch is worded in the congregation's
+// language, like the digests it collects.
+func deliverNotificationBatch(app core.App, userId, congregationId string, now time.Time) (bool, error) {
+	congRecord, err := app.FindRecordById("congregations", congregationId)
+	if err != nil {
+		return false, err
+	}
+	pref, err := handlers.EnsureNotificationPreference(app, userId, congregationId)
+	if err != nil {
+		return false, err
+	}
+	location := loadCongregationLocation(congRecord)
+	if !quietHoursEnd(pref.GetString("quiet_start"), pref.GetString("quiet_end"), location, now).IsZero() {
+		return false, nil
+	}
+
+	loc := loadLocale(congregationLanguage(congRecord))
+	frequency := pref.GetString("frequency")
+	cutoff := now
+	period := loc.text("batch.immediate")
+	switch frequency {
+	case handlers.NotificationDaily:
+		cutoff = latestBatchSlot(frequency, location, now)
+		period = loc.text("batch.daily")
+	case handlers.NotificationWeekly:
+		cutoff = latestBatchSlot(frequency, location, now)
+		period = loc.text("batch.weekly")
+	}
+
+	items, err := app.FindRecordsByFilter("notification_batch_items",
+		"user = {:user} && congregation = {:congregation} && created <= {:cutoff}",
+		"created", 0, 0,
+		dbx.Params{"user": userId, "congregation": congregationId, "cutoff": cutoff.Format(types.DefaultDateLayout)})
+	if err != nil {
+		return false, err
+	}
+	if len(items) == 0 {
+		return false, nil
+	}
+
+	user, err := app.FindRecordById("users", userId)
+	if err != nil {
+		return false, err
+	}
+
+	token := pref.GetString("unsubscribe_token")
+	muted := pref.GetStringSlice("muted")
+	data := notificationBatchTmplData{
+		CongregationName: congRecord.GetString("name"),
+		Period:           period,
+		UnsubscribeURL:   unsubscribeURL(token, ""),
+	}
+	seenStyles := map[string]bool{}
+	var styles strings.Builder
+	for _, item := range items {
+		// Muted since it was held.
+		if slices.Contains(muted, item.GetString("kind")) {
+			continue
+		}
+		html := item.GetString("html")
+		for _, m := range digestStyleRe.FindAllStringSubmatch(html, -1) {
+			if css := strings.TrimSpace(m[1]); !seenStyles[css] {
+				seenStyles[css] = true
+				styles.WriteString(css)
+				styles.WriteString("\n")
+			}
+		}
+		body := html
+		if m := digestBodyRe.FindStringSubmatch(html); m != nil {
+			body = m[1]
+		}
+		data.Sections = append(data.Sections, notificationBatchSection{
+			Subject:        item.GetString("subject"),
+			Body:           template.HTML(body),
+			UnsubscribeURL: unsubscribeURL(token, item.GetString("kind")),
+		})
+	}
+	data.Styles = template.CSS(styles.String())
+
+	if len(data.Sections) > 0 && user.GetString("email") != "" {
+		tmpl, err := parseTemplate("templates/notification_batch.html", loc)
+		if err != nil {
+			return false, fmt.Errorf("parse template: %w", err)
+		}
+		var body bytes.Buffer
+		if err := tmpl.Execute(&body, data); err != nil {
+			return false, err
+		}
+		subject := fmt.Sprintf("%s - %s - %s", period, data.CongregationName, loc.date(now.In(location), dateStyleDate))
+		to := []Recipient{{Name: user.GetString("name"), Email: user.GetString("email")}}
+		if err := queueEmail(app, congregationId, Email{To: to, Subject: subject, HTML: body.String()}, nil); err != nil {
+			return false, err
+		}
+	}
+
+	for _, item := range items {
+		if err := app.Delete(item); err != nil {
+			log.Printf("processNotificationBatches: failed to delete batch item %s: %v", item.Id, err)
+		}
+	}
+	return len(data.Sections) > 0, nil
+}
@@ -0,0 +1,193 @@
+//go:build testdata
+
+package jobs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ministry-mapper/internal/handlers"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// setNotificationPreference gives the Alpha administrator the given
+// notification preferences.
+func setNotificationPreference(t testing.TB, app core.App, muted []string, frequency, quietStart, quietEnd string) *core.Record {
+	t.Helper()
+	pref, err := handlers.EnsureNotificationPreference(app, "testuseralpha01", "testcongalpha01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pref.Set("muted", muted)
+	pref.Set("frequency", frequency)
+	pref.Set("quiet_start", quietStart)
+	pref.Set("quiet_end", quietEnd)
+	if err := app.Save(pref); err != nil {
+		t.Fatal(err)
+	}
+	return pref
+}
+
+func TestQueueDigest_AddsUnsubscribeLinks(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	sent := stubSend(t, nil)
+
+	if err := processMessages(app, 60); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("want 1 digest, got %d", len(*sent))
+	}
+
+	pref, err := app.FindFirstRecordByFilter("notification_preferences", "user = 'testuseralpha01' && congregation = 'testcongalpha01'")
+	if err != nil {
+		t.Fatalf("sending a digest should create the recipient's preferences: %v", err)
+	}
+	token := pref.GetString("unsubscribe_token")
+	body := (*sent)[0].Body
+	if !strings.Contains(body, "?unsubscribe="+token+"&amp;kind=messages") {
+		t.Error("digest should link to unsubscribe from message digests")
+	}
+	if !strings.Contains(body, "?unsubscribe="+token+`"`) {
+		t.Error("digest should link to unsubscribe from every digest")
+	}
+}
+
+func TestQueueDigest_SkipsMutedRecipients(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	sent := stubSend(t, nil)
+	setNotificationPreference(t, app, []string{digestMessages}, handlers.NotificationImmediate, "", "")
+
+	if err := processMessages(app, 60); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 0 || len(outboxRecords(t, app)) != 0 {
+		t.Errorf("a muted digest should not be queued, got %d sent", len(*sent))
+	}
+	if msg, _ := app.FindRecordById("messages", "testmsgalpha01a"); msg.GetBool("read") {
+		t.Error("messages nobody was sent should stay unread")
+	}
+}
+
+func TestQueueDigest_HoldsDuringQuietHours(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	sent := stubSend(t, nil)
+	now := time.Now().UTC()
+	// Quiet hours are in the congregation's timezone.
+	singapore, err := time.LoadLocation("Asia/Singapore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setNotificationPreference(t, app, nil, handlers.NotificationImmediate,
+		now.Add(-time.Hour).In(singapore).Format("15:04"), now.Add(2*time.Hour).In(singapore).Format("15:04"))
+
+	if err := processMessages(app, 60); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 0 {
+		t.Fatal("nothing should be sent during quiet hours")
+	}
+	queued := outboxRecords(t, app)
+	if len(queued) != 1 {
+		t.Fatalf("want the digest held in the outbox, got %d", len(queued))
+	}
+	if next := queued[0].GetDateTime("next_attempt_at").Time(); next.Before(now.Add(time.Hour)) {
+		t.Errorf("held until %s, want the end of quiet hours", next)
+	}
+
+	if err := processEmailOutbox(app, now.Add(3*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 {
+		t.Errorf("the digest should go out once quiet hours end, got %d", len(*sent))
+	}
+}
+
+func TestProcessNotificationBatches_SendsDailyBatch(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	sent := stubSend(t, nil)
+	setNotificationPreference(t, app, nil, handlers.NotificationDaily, "", "")
+
+	if err := processMessages(app, 60); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 0 || len(outboxRecords(t, app)) != 0 {
+		t.Fatal("a daily recipient's digest should be held, not queued")
+	}
+	if msg, _ := app.FindRecordById("messages", "testmsgalpha01a"); !msg.GetBool("read") {
+		t.Error("messages held for a batch should be marked read so they are not held twice")
+	}
+
+	now := time.Now().UTC()
+	if err := processNotificationBatches(app, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 0 {
+		t.Fatal("the batch should wait for the next daily slot")
+	}
+
+	if err := processNotificationBatches(app, now.Add(25*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("want one batch email, got %d", len(*sent))
+	}
+	batch := (*sent)[0]
+	if !strings.HasPrefix(batch.Subject, "Your daily digest") || !strings.Contains(batch.Body, "New messages received") {
+		t.Errorf("batch should carry the held digest, got %q", batch.Subject)
+	}
+	if !strings.Contains(batch.Body, "?unsubscribe=") {
+		t.Error("batch should carry unsubscribe links")
+	}
+	items, err := app.FindAllRecords("notification_batch_items", dbx.NewExp("1 = 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("sent batch items should be removed, %d left", len(items))
+	}
+}
+
+func TestQuietHoursEnd(t *testing.T) {
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name       string
+		start, end string
+		at         time.Duration
+		want       time.Duration // zero when not in quiet hours
+	}{
+		{"before", "22:00", "07:00", 21 * time.Hour, 0},
+		{"evening, spanning midnight", "22:00", "07:00", 23 * time.Hour, 31 * time.Hour},
+		{"early morning, spanning midnight", "22:00", "07:00", 6 * time.Hour, 7 * time.Hour},
+		{"at the end", "22:00", "07:00", 7 * time.Hour, 0},
+		{"daytime", "12:00", "14:00", 13 * time.Hour, 14 * time.Hour},
+		{"unset", "", "", 13 * time.Hour, 0},
+	} {
+		got := quietHoursEnd(tc.start, tc.end, time.UTC, day.Add(tc.at))
+		want := time.Time{}
+		if tc.want != 0 {
+			want = day.Add(tc.want)
+		}
+		if !got.Equal(want) {
+			t.Errorf("%s: got %s, want %s", tc.name, got, want)
+		}
+	}
+}
+
+func TestLatestBatchSlot(t *testing.T) {
+	// Wednesday 11 March 2026, 06:00 UTC.
+	now := time.Date(2026, 3, 11, 6, 0, 0, 0, time.UTC)
+	if got, want := latestBatchSlot(handlers.NotificationDaily, time.UTC, now), time.Date(2026, 3, 10, 7, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("daily: got %s, want %s", got, want)
+	}
+	if got, want := latestBatchSlot(handlers.NotificationWeekly, time.UTC, now), time.Date(2026, 3, 9, 7, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("weekly: got %s, want %s", got, want)
+	}
+	singapore := time.FixedZone("SGT", 8*60*60)
+	if got, want := latestBatchSlot(handlers.NotificationDaily, singapore, now), time.Date(2026, 3, 10, 23, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("daily in SGT: got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type accessRequestRow struct {
+	ID      string `db:"id"`
+	Name    string `db:"name"`
+	Email   string `db:"email"`
+	Message string `db:"message"`
+	Created string `db:"created"`
+}
+
+type accessRequestEntry struct {
+	Name    string
+	Email   string
+	Message string
+	Created string
+}
+
+// AccessRequestsTemplateData holds the data passed to the access_requests.html template.
+type AccessRequestsTemplateData struct {
+	CongregationName string
+	Requests         []accessRequestEntry
+	AppURL           string
+}
+
+// processAccessRequests emails each congregation's administrators a digest of
+// access requests raised since the last digest. A request is included once:
+// digest_sent_at is stamped after the email is sent, and only then, so a
+// failed send is retried on the next run.
+func processAccessRequests(app core.App) error {
+	log.Println("processAccessRequests: starting")
+
+	var congregations []struct {
+		Congregation string `db:"congregation"`
+	}
+	err := app.DB().NewQuery(`
+		SELECT DISTINCT congregation FROM access_requests
+		WHERE status = 'pending' AND COALESCE(digest_sent_at, '') = ''
+	`).All(&congregations)
+	if err != nil {
+		return fmt.Errorf("processAccessRequests: query failed: %w", err)
+	}
+
+	if len(congregations) == 0 {
+		log.Println("processAccessRequests: no new access requests")
+		return nil
+	}
+
+	for _, c := range congregations {
+		if err := processCongregationAccessRequests(app, c.Congregation); err != nil {
+			log.Printf("processAccessRequests: congregation %s: %v", c.Congregation, err)
+		}
+	}
+
+	log.Println("processAccessRequests: completed")
+	return nil
+}
+
+func processCongregationAccessRequests(app core.App, congID string) error {
+	congRecord, err := app.FindRecordById("congregations", congID)
+	if err != nil {
+		return err
+	}
+
+	var rows []accessRequestRow
+	err = app.DB().NewQuery(`
+		SELECT r.id, COALESCE(u.name, '') AS name, COALESCE(u.email, '') AS email,
+		       COALESCE(r.message, '') AS message, r.created
+		FROM access_requests r
+		JOIN users u ON u.id = r.user
+		WHERE r.congregation = {:congregation} AND r.status = 'pending'
+		  AND COALESCE(r.digest_sent_at, '') = ''
+		  AND r.id NOT IN ` + queuedRefsSQL(effectAccessRequestsDigested) + `
+		ORDER BY r.created
+	`).Bind(dbx.Params{"congregation": congID}).All(&rows)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	recipients, err := fetchCongregationRecipients(app, congID, true, digestAccessRequests)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		log.Printf("processAccessRequests: no admin recipients for congregation %s", congID)
+		return nil
+	}
+
+	loc := loadLocale(congregationLanguage(congRecord))
+	tmpl, err := parseTemplate("templates/access_requests.html", loc)
+	if err != nil {
+		return fmt.Errorf("parse access_requests template: %w", err)
+	}
+
+	location := loadCongregationLocation(congRecord)
+	data := AccessRequestsTemplateData{
+		CongregationName: congRecord.GetString("name"),
+		AppURL:           os.Getenv("PB_APP_URL"),
+	}
+	for _, row := range rows {
+		created := row.Created
+		if t, err := parsePBDate(row.Created); err == nil {
+			created = loc.date(t.In(location), dateStyleDateTime)
+		}
+		data.Requests = append(data.Requests, accessRequestEntry{
+			Name:    displayName(row.Name, row.Email),
+			Email:   row.Email,
+			Message: row.Message,
+			Created: created,
+		})
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("execute access_requests template: %w", err)
+	}
+
+	// digest_sent_at is stamped by the outbox once the digest is delivered.
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	subject := loc.text("access_requests.subject", data.CongregationName, len(rows))
+	if err := queueDigest(app, congRecord, digestAccessRequests, recipients, subject, body.String(), &outboxEffect{Kind: effectAccessRequestsDigested, Refs: ids}); err != nil {
+		return fmt.Errorf("queue access request digest: %w", err)
+	}
+
+	log.Printf("processAccessRequests: digest of %d request(s) queued for congregation %s", len(rows), congID)
+	return nil
+}
@@ -0,0 +1,125 @@
+//go:build testdata
+
+package jobs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func addAccessRequest(t testing.TB, app core.App, userID, message string) *core.Record {
+	t.Helper()
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := core.NewRecord(users)
+	user.Id = userID
+	user.Set("email", userID+"@example.test")
+	user.Set("name", "Requesting User")
+	user.SetPassword("Test1234!")
+	if err := app.Save(user); err != nil {
+		t.Fatal(err)
+	}
+
+	col, err := app.FindCollectionByNameOrId("access_requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := core.NewRecord(col)
+	request.Set("congregation", "testcongalpha01")
+	request.Set("user", userID)
+	request.Set("message", message)
+	request.Set("status", "pending")
+	if err := app.Save(request); err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+func TestProcessAccessRequests_DigestsNewRequestsOnce(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	request := addAccessRequest(t, app, "testrequester01", "I attend the Sunday meeting")
+
+	sent := stubSend(t, nil)
+	if err := processAccessRequests(app); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*sent) != 1 {
+		t.Fatalf("expected one digest, got %d", len(*sent))
+	}
+	email := (*sent)[0]
+	if len(email.Recipients) != 1 || email.Recipients[0].Email != "admin@alpha.test" {
+		t.Errorf("digest should go to alpha's administrators only, got %+v", email.Recipients)
+	}
+	if !strings.Contains(email.Body, "Requesting User") || !strings.Contains(email.Body, "I attend the Sunday meeting") {
+		t.Error("digest should list the requester and their message")
+	}
+
+	stamped, err := app.FindRecordById("access_requests", request.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stamped.GetDateTime("digest_sent_at").IsZero() {
+		t.Error("digest_sent_at should be stamped after sending")
+	}
+
+	if err := processAccessRequests(app); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 {
+		t.Errorf("a request must only be digested once, got %d emails", len(*sent))
+	}
+}
+
+func TestProcessAccessRequests_FailedSendIsRetried(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	request := addAccessRequest(t, app, "testrequester01", "")
+
+	stubSend(t, errors.New("mail provider down"))
+	if err := processAccessRequests(app); err != nil {
+		t.Fatal(err)
+	}
+
+	unstamped, err := app.FindRecordById("access_requests", request.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !unstamped.GetDateTime("digest_sent_at").IsZero() {
+		t.Error("digest_sent_at must stay empty when the email fails")
+	}
+}
+
+func TestProcessAccessRequests_UsesCongregationLanguage(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	congregation, err := app.FindRecordById("congregations", "testcongalpha01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	congregation.Set("language", "ar")
+	if err := app.Save(congregation); err != nil {
+		t.Fatal(err)
+	}
+	addAccessRequest(t, app, "testrequester01", "")
+
+	sent := stubSend(t, nil)
+	if err := processAccessRequests(app); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*sent) != 1 {
+		t.Fatalf("expected one digest, got %d", len(*sent))
+	}
+	email := (*sent)[0]
+	if !strings.HasPrefix(email.Subject, "طلبات الوصول") {
+		t.Errorf("subject should be in Arabic, got %q", email.Subject)
+	}
+	if !strings.Contains(email.Body, `dir="rtl"`) {
+		t.Error("Arabic digest should be laid out right to left")
+	}
+}
@@ -3,7 +3,6 @@ package jobs
 import (
 	"bytes"
 	"fmt"
-	"html/template"
 	"log"
 	"os"
 	"time"
@@ -16,6 +15,8 @@ type inactiveUser struct {
 	ID                         string `db:"id"`
 	Name                       string `db:"name"`
 	Email                      string `db:"email"`
+	Language                   string `db:"language"`
+	Congregation               string `db:"congregation"`
 	LastLogin                  string `db:"last_login"`
 	Created                    string `db:"created"`
 	InactiveWarningSentAt      string `db:"inactive_warning_sent_at"`
@@ -27,29 +28,22 @@ type inactiveUserTmplData struct {
 	LastLogin    string
 	DeadlineDate string
 	DaysLeft     int
+	InactiveDays int
 	AppURL       string
 }
 
-const (
-	// inactivityWarnDays is the day threshold for the first warning (~3 months).
-	inactivityWarnDays = 91
-	// inactivityFinalWarnDays is the threshold for the final warning (~5 months, 30 days before disable).
-	inactivityFinalWarnDays = 152
-	// inactivityDisableDays is the threshold for disabling the account (~6 months).
-	// Aligns with NIST SP 800-53 AC-2(3): automatic disabling of inactive accounts.
-	inactivityDisableDays = 183
-)
-
 // processInactiveUsers enforces the inactive-user lifecycle aligned with NIST SP 800-53 AC-2(3)
 // (disable inactive accounts) and IAM best practices for retention-focused applications.
 //
-// Timeline:
+// Timeline (defaults; each congregation may set its own, and a user in several
+// congregations gets the strictest of each threshold):
 //   - Day 91  (~3 months): Send first warning — "account disabled in ~3 months".
 //   - Day 152 (~5 months): Send final warning — "account disabled in 30 days".
 //   - Day 183 (~6 months): Disable the account.
 //
 // Accounts are never auto-deleted — congregation ministry history must be preserved.
-// Administrators may re-enable or permanently delete accounts manually.
+// Congregation administrators may re-enable accounts through /user/reenable;
+// superusers may also permanently delete them manually.
 //
 // The inactivity clock uses last_login if available, falling back to the account
 // creation date for users who have never logged in.
@@ -57,25 +51,14 @@ func processInactiveUsers(app core.App) error {
 	log.Println("processInactiveUsers: starting")
 
 	appURL := os.Getenv("PB_APP_URL")
+	now := time.Now().UTC()
 
-	// Fetch all enabled users who may be inactive (last_login or created is old enough).
-	// The threshold is intentionally loose (>= warn threshold) so we process all candidates
-	// in Go; the exact day-count logic is computed from the actual date values.
-	var users []inactiveUser
-	err := app.DB().NewQuery(`
-		SELECT
-			id, name, email,
-			COALESCE(last_login, '')                    AS last_login,
-			created,
-			COALESCE(inactive_warning_sent_at, '')      AS inactive_warning_sent_at,
-			COALESCE(inactive_final_warning_sent_at,'') AS inactive_final_warning_sent_at
-		FROM users
-		WHERE disabled = false
-		  AND (
-		        (last_login IS NOT NULL AND last_login != '' AND CAST(JULIANDAY('now') - JULIANDAY(last_login) AS INTEGER) >= {:warnDays})
-		     OR ((last_login IS NULL OR last_login = '') AND CAST(JULIANDAY('now') - JULIANDAY(created) AS INTEGER) >= {:warnDays})
-		  )
-	`).Bind(map[string]any{"warnDays": inactivityWarnDays}).All(&users)
+	policies, _, err := userAccountPolicies(app, inactivityPolicySQL)
+	if err != nil {
+		return fmt.Errorf("processInactiveUsers: %w", err)
+	}
+
+	users, err := fetchInactiveCandidates(app, minInactivityWarnDays(policies), now)
 	if err != nil {
 		return fmt.Errorf("processInactiveUsers: query failed: %w", err)
 	}
@@ -87,13 +70,22 @@ func processInactiveUsers(app core.App) error {
 
 	log.Printf("processInactiveUsers: processing %d inactive user(s)", len(users))
 
-	now := time.Now().UTC()
+	queuedWarnings, err := queuedRefs(app, userStampEffect("inactive_warning_sent_at"))
+	if err != nil {
+		return fmt.Errorf("processInactiveUsers: %w", err)
+	}
+	queuedFinalWarnings, err := queuedRefs(app, userStampEffect("inactive_final_warning_sent_at"))
+	if err != nil {
+		return fmt.Errorf("processInactiveUsers: %w", err)
+	}
 
 	for _, u := range users {
-		inactive := inactiveDays(u, now)
+		policy := policyFor(policies, u.ID)
+		action, inactive := inactiveUserAction(u, policy, now)
 
-		// Disable — inactive for 6+ months (NIST AC-2(3)).
-		if inactive >= inactivityDisableDays {
+		switch action {
+		case accountActionDisable:
+			// Disable — inactivity_disable_days reached (NIST AC-2(3)).
 			record, err := app.FindRecordById("users", u.ID)
 			if err != nil {
 				log.Printf("processInactiveUsers: cannot find user %s: %v", u.ID, err)
@@ -105,33 +97,26 @@ func processInactiveUsers(app core.App) error {
 				continue
 			}
 			log.Printf("processInactiveUsers: disabled inactive user %s (%d days inactive)", u.Email, inactive)
-			continue
-		}
 
-		// Final warning — 30 days before disable (~5 months).
-		if inactive >= inactivityFinalWarnDays && u.InactiveFinalWarningSentAt == "" {
-			daysLeft := inactivityDisableDays - inactive
-			deadline := now.AddDate(0, 0, daysLeft).Format("2 January 2006")
-			if err := sendInactiveUserEmail(u, true, deadline, daysLeft, appURL); err != nil {
-				log.Printf("processInactiveUsers: final warning email failed for %s: %v", u.Email, err)
-				continue
+		case accountActionFinalWarn, accountActionWarn:
+			isFinal := action == accountActionFinalWarn
+			field := "inactive_warning_sent_at"
+			if isFinal {
+				field = "inactive_final_warning_sent_at"
 			}
-			if err := updateUserField(app, u.ID, "inactive_final_warning_sent_at", now.Format(time.RFC3339)); err != nil {
-				log.Printf("CRITICAL processInactiveUsers: final warning sent to %s but timestamp not saved — duplicate email may be sent on next run: %v", u.Email, err)
+			// The outbox stamps the field once the warning is delivered.
+			queued := queuedWarnings
+			if isFinal {
+				queued = queuedFinalWarnings
 			}
-			continue
-		}
-
-		// First warning — inactivity threshold reached (~3 months).
-		if inactive >= inactivityWarnDays && u.InactiveWarningSentAt == "" {
-			daysLeft := inactivityDisableDays - inactive
-			deadline := now.AddDate(0, 0, daysLeft).Format("2 January 2006")
-			if err := sendInactiveUserEmail(u, false, deadline, daysLeft, appURL); err != nil {
-				log.Printf("processInactiveUsers: warning email failed for %s: %v", u.Email, err)
+			if queued[u.ID] {
 				continue
 			}
-			if err := updateUserField(app, u.ID, "inactive_warning_sent_at", now.Format(time.RFC3339)); err != nil {
-				log.Printf("CRITICAL processInactiveUsers: warning sent to %s but timestamp not saved — duplicate email may be sent on next run: %v", u.Email, err)
+			daysLeft := policy.InactivityDisableDays - inactive
+			deadline := now.AddDate(0, 0, daysLeft)
+			effect := &outboxEffect{Kind: userStampEffect(field), Refs: []string{u.ID}}
+			if err := sendInactiveUserEmail(app, u, isFinal, deadline, inactive, daysLeft, appURL, effect); err != nil {
+				log.Printf("processInactiveUsers: %s email failed for %s: %v", action, u.Email, err)
 			}
 		}
 	}
@@ -140,37 +125,68 @@ func processInactiveUsers(app core.App) error {
 	return nil
 }
 
-// sendInactiveUserEmail sends a warning or final-warning email to an inactive user.
-func sendInactiveUserEmail(u inactiveUser, isFinal bool, deadlineDate string, daysLeft int, appURL string) error {
+// fetchInactiveCandidates returns enabled users inactive for at least warnDays
+// at now. The threshold is intentionally loose (the earliest warning of any
+// policy) so the exact per-user decision is made in Go from the date values.
+func fetchInactiveCandidates(app core.App, warnDays int, now time.Time) ([]inactiveUser, error) {
+	var users []inactiveUser
+	err := app.DB().NewQuery(`
+		SELECT
+			id, name, email,
+			COALESCE(language, '')                      AS language,
+			COALESCE((SELECT r.congregation FROM roles r WHERE r.user = users.id ORDER BY r.created LIMIT 1), '') AS congregation,
+			COALESCE(last_login, '')                    AS last_login,
+			created,
+			COALESCE(inactive_warning_sent_at, '')      AS inactive_warning_sent_at,
+			COALESCE(inactive_final_warning_sent_at,'') AS inactive_final_warning_sent_at
+		FROM users
+		WHERE disabled = false
+		  AND (
+		        (last_login IS NOT NULL AND last_login != '' AND CAST(JULIANDAY({:now}) - JULIANDAY(last_login) AS INTEGER) >= {:warnDays})
+		     OR ((last_login IS NULL OR last_login = '') AND CAST(JULIANDAY({:now}) - JULIANDAY(created) AS INTEGER) >= {:warnDays})
+		  )
+	`).Bind(map[string]any{"warnDays": warnDays, "now": now.UTC().Format("2006-01-02 15:04:05")}).All(&users)
+	return users, err
+}
+
+// sendInactiveUserEmail queues a warning or final-warning email to an inactive user, in
+// their language or else that of the congregation they joined first.
+func sendInactiveUserEmail(app core.App, u inactiveUser, isFinal bool, deadline time.Time, inactive, daysLeft int, appURL string, effect *outboxEffect) error {
+	var congRecord *core.Record
+	if u.Congregation != "" {
+		congRecord, _ = app.FindRecordById("congregations", u.Congregation)
+	}
+	loc := loadLocale(userLanguage(u.Language, congRecord))
+
 	templateFile := "templates/user_inactive_warning.html"
-	subject := "Ministry Mapper: Your account will be deactivated due to inactivity"
+	subject := loc.text("inactive.subject")
 
 	if isFinal {
 		templateFile = "templates/user_inactive_final_warning.html"
-		unit := "days"
+		subject = loc.text("inactive_final.subject", daysLeft)
 		if daysLeft == 1 {
-			unit = "day"
+			subject = loc.text("inactive_final.subject_one")
 		}
-		subject = fmt.Sprintf("Ministry Mapper: Your account will be deactivated in %d %s", daysLeft, unit)
 	}
 
-	tmpl, err := template.ParseFiles(templateFile)
+	tmpl, err := parseTemplate(templateFile, loc)
 	if err != nil {
 		return fmt.Errorf("sendInactiveUserEmail: parse template: %w", err)
 	}
 
-	lastLoginDisplay := "Never"
+	lastLoginDisplay := loc.text("common.never")
 	if u.LastLogin != "" {
 		if t, err := parsePBDate(u.LastLogin); err == nil {
-			lastLoginDisplay = t.Format("2 January 2006")
+			lastLoginDisplay = loc.date(t, dateStyleLongDate)
 		}
 	}
 
 	data := inactiveUserTmplData{
 		UserName:     displayName(u.Name, u.Email),
 		LastLogin:    lastLoginDisplay,
-		DeadlineDate: deadlineDate,
+		DeadlineDate: loc.date(deadline, dateStyleLongDate),
 		DaysLeft:     daysLeft,
+		InactiveDays: inactive,
 		AppURL:       appURL,
 	}
 
@@ -179,7 +195,7 @@ func sendInactiveUserEmail(u inactiveUser, isFinal bool, deadlineDate string, da
 		return fmt.Errorf("sendInactiveUserEmail: execute template: %w", err)
 	}
 
-	return sendPlainEmail(u.Email, u.Name, subject, body.String())
+	return queuePlainEmail(app, "", u.Email, u.Name, subject, body.String(), effect)
 }
 
 // inactiveDays returns the number of days since the user last interacted with the system.
@@ -2,25 +2,28 @@ package jobs
 
 import (
 	"bytes"
-	"html/template"
 	"log"
 	"strings"
 	"time"
 
+	"ministry-mapper/internal/handlers"
+
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
-// BuildInstructionsPrompt constructs the system and user messages for the instructions AI overview.
-func BuildInstructionsPrompt(messages []messagesData, mapName string) (systemMsg, userMsg string) {
+// BuildInstructionsPrompt constructs the system and user messages for the instructions AI overview,
+// asking for it in language (the English name of the congregation's language).
+func BuildInstructionsPrompt(messages []messagesData, mapName, language string) (systemMsg, userMsg string) {
 	systemMsg = `You are an assistant helping congregation publishers understand instructions ` +
 		`from their administrator about their assigned territory map. ` +
 		`These instructions may include directives, special conditions, access notes, ` +
 		`or other guidance the administrator wants publishers to follow. ` +
 		`Analyse the instructions and return a JSON object with exactly one field: ` +
 		`"overview" (2-3 sentence narrative summarising the key directives and what publishers need to do or be aware of). ` +
-		`Be factual, concise, and respectful.`
+		`Be factual, concise, and respectful. ` + languageInstruction(language)
 
 	var sb strings.Builder
 	sb.WriteString("Administrator instructions for territory map " + mapName + ":\n\n")
@@ -35,14 +38,14 @@ func BuildInstructionsPrompt(messages []messagesData, mapName string) (systemMsg
 
 // generateInstructionsAISummary builds an OverviewSummary from the instructions list.
 // Returns an empty OverviewSummary (Available=false) if AI is disabled or the call fails.
-func generateInstructionsAISummary(messages []messagesData, mapName string) OverviewSummary {
+func generateInstructionsAISummary(messages []messagesData, mapName, language string) OverviewSummary {
 	client := newLLMClient()
 	if client == nil {
 		log.Printf("AI overview skipped for instructions (%s): OPENAI_API_KEY not set", mapName)
 		return OverviewSummary{}
 	}
 
-	systemMsg, userMsg := BuildInstructionsPrompt(messages, mapName)
+	systemMsg, userMsg := BuildInstructionsPrompt(messages, mapName, language)
 	resp, err := client.generateOverview(systemMsg, userMsg)
 	if err != nil {
 		log.Printf("AI overview: LLM call failed for instructions (%s): %v", mapName, err)
@@ -55,6 +58,20 @@ func generateInstructionsAISummary(messages []messagesData, mapName string) Over
 	}
 }
 
+// liveInstructionsFilter matches a map's pinned administrator instructions
+// that are published and whose pin has not lapsed.
+const liveInstructionsFilter = "map = {:map} && pinned = true && type = 'administrator' && " +
+	"(publish_at = '' || published_at != '') && (pin_until = '' || pin_until > {:now})"
+
+// instructionTime is when an instruction reached publishers: its publish
+// time if it was scheduled, otherwise its creation.
+func instructionTime(message *core.Record) types.DateTime {
+	if published := message.GetDateTime("published_at"); !published.IsZero() {
+		return published
+	}
+	return message.GetDateTime("created")
+}
+
 func processInstruction(mapID string, app core.App) error {
 	log.Printf("Processing instructions for map: %s", mapID)
 
@@ -85,7 +102,7 @@ func processInstruction(mapID string, app core.App) error {
 
 	territoryCode := territoryRecord.Get("code").(string)
 
-	messages, err := app.FindRecordsByFilter("messages", "map = {:map} && pinned = true && type = 'administrator'", "created", 0, 0, dbx.Params{"map": mapID})
+	messages, err := app.FindRecordsByFilter("messages", liveInstructionsFilter, "created", 0, 0, dbx.Params{"map": mapID, "now": time.Now().UTC().Format(types.DefaultDateLayout)})
 	if err != nil {
 		log.Println("Error finding messages by filter:", err)
 		return err
@@ -96,7 +113,7 @@ func processInstruction(mapID string, app core.App) error {
 		return nil
 	}
 
-	recipients, err := fetchCongregationRecipients(app, congregation, false)
+	recipients, err := fetchCongregationRecipients(app, congregation, false, digestInstructions)
 	if err != nil {
 		log.Println("Error fetching recipients:", err)
 		return err
@@ -108,7 +125,8 @@ func processInstruction(mapID string, app core.App) error {
 	}
 	log.Printf("Processing %d recipients\n", len(recipients))
 
-	tmpl, err := template.ParseFiles("templates/instructions.html")
+	loc := loadLocale(congregationLanguage(congRecord))
+	tmpl, err := parseTemplate("templates/instructions.html", loc)
 	if err != nil {
 		log.Println("Error parsing template:", err)
 		return err
@@ -125,12 +143,12 @@ func processInstruction(mapID string, app core.App) error {
 		emailData.Messages = append(emailData.Messages, messagesData{
 			Publisher: message.Get("created_by").(string),
 			Message:   message.Get("message").(string),
-			Date:      message.GetDateTime("created").Time().In(location).Format("03:04 PM, 02 Jan 2006"),
+			Date:      loc.date(instructionTime(message).Time().In(location), dateStyleTimeDate),
 		})
 	}
 
 	if IsAISummaryEnabled() {
-		emailData.Summary = generateInstructionsAISummary(emailData.Messages, emailData.MapName)
+		emailData.Summary = generateInstructionsAISummary(emailData.Messages, emailData.MapName, loc.languageName())
 	}
 
 	var body bytes.Buffer
@@ -139,17 +157,30 @@ func processInstruction(mapID string, app core.App) error {
 		return err
 	}
 
-	subject := "New instructions received for " + mapRecord.Get("description").(string)
-	if err := sendHTMLEmail(recipients, subject, body.String()); err != nil {
-		log.Println("Error sending email:", err)
+	subject := loc.text("instructions.subject", mapRecord.Get("description").(string))
+	if err := queueDigest(app, congRecord, digestInstructions, recipients, subject, body.String(), nil); err != nil {
+		log.Println("Error queueing email:", err)
 		return err
 	}
-	log.Println("Email sent successfully")
+	log.Println("Email queued successfully")
+
+	latest := messages[len(messages)-1]
+	notification := handlers.PushNotification{
+		Kind:  handlers.PushInstruction,
+		Title: subject,
+		Body:  latest.GetString("message"),
+		Tag:   "instructions-" + mapID,
+		Data:  map[string]string{"map": mapID},
+	}
+	pushDigest(app, congRecord, recipients, notification)
+	handlers.PushToMapLinks(app, mapID, notification)
 	return nil
 }
 
 // processInstructions emails publishers the pinned administrator instructions
-// created within the last timeIntervalMinutes, grouped per map.
+// created within the last timeIntervalMinutes, grouped per map. A scheduled
+// instruction counts from when processMessageSchedule published it rather
+// than from when it was written.
 func processInstructions(app core.App, timeIntervalMinutes int) error {
 	log.Println("Starting instructions processing")
 
@@ -157,7 +188,7 @@ func processInstructions(app core.App, timeIntervalMinutes int) error {
 
 	timeBuffer := time.Duration(-timeIntervalMinutes) * time.Minute
 
-	err := app.DB().Select("maps.id").Distinct(true).From("maps").InnerJoin("messages", dbx.NewExp("messages.map = maps.id and messages.pinned = true and messages.type = 'administrator'")).Where(dbx.NewExp("messages.created > {:created}", dbx.Params{"created": time.Now().UTC().Add(timeBuffer)})).All(&maps)
+	err := app.DB().Select("maps.id").Distinct(true).From("maps").InnerJoin("messages", dbx.NewExp("messages.map = maps.id and messages.pinned = true and messages.type = 'administrator'")).Where(dbx.NewExp("(CASE WHEN messages.publish_at = '' THEN messages.created ELSE messages.published_at END) > {:created}", dbx.Params{"created": time.Now().UTC().Add(timeBuffer)})).All(&maps)
 
 	if err != nil {
 		log.Println("Error fetching maps:", err)
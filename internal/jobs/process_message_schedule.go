@@ -0,0 +1,55 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// processMessageSchedule publishes administrator messages whose publish_at
+// has passed and unpins those whose pin_until has.
+//
+// Both are saved as ordinary record updates so subscribed clients get a
+// realtime event: publishers see a scheduled instruction appear, and a
+// lapsed pin drop, without reloading. Publishing stamps published_at, which
+// processInstructions uses as the instruction's time in its digest.
+func processMessageSchedule(app core.App, now time.Time) error {
+	log.Println("processMessageSchedule: starting")
+
+	params := dbx.Params{"now": now.UTC().Format(types.DefaultDateLayout)}
+
+	scheduled := []*core.Record{}
+	err := app.RecordQuery("messages").
+		AndWhere(dbx.NewExp("publish_at != '' AND published_at = '' AND publish_at <= {:now}", params)).
+		All(&scheduled)
+	if err != nil {
+		return fmt.Errorf("processMessageSchedule: query scheduled messages: %w", err)
+	}
+	for _, message := range scheduled {
+		message.Set("published_at", now)
+		if err := app.Save(message); err != nil {
+			log.Printf("processMessageSchedule: failed to publish message %s: %v", message.Id, err)
+		}
+	}
+
+	lapsed := []*core.Record{}
+	err = app.RecordQuery("messages").
+		AndWhere(dbx.NewExp("pinned = 1 AND pin_until != '' AND pin_until <= {:now}", params)).
+		All(&lapsed)
+	if err != nil {
+		return fmt.Errorf("processMessageSchedule: query lapsed pins: %w", err)
+	}
+	for _, message := range lapsed {
+		message.Set("pinned", false)
+		if err := app.Save(message); err != nil {
+			log.Printf("processMessageSchedule: failed to unpin message %s: %v", message.Id, err)
+		}
+	}
+
+	log.Printf("processMessageSchedule: completed, %d published, %d unpinned", len(scheduled), len(lapsed))
+	return nil
+}
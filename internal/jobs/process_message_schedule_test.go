@@ -0,0 +1,99 @@
+//go:build testdata
+
+package jobs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func addInstruction(t testing.TB, app core.App, message string, publishAt time.Time) *core.Record {
+	t.Helper()
+	rec := addMessage(t, app, "testmapalpha01a", message, "admin@alpha.test", "administrator", false)
+	rec.Set("pinned", true)
+	rec.Set("publish_at", publishAt)
+	if err := app.SaveNoValidate(rec); err != nil {
+		t.Fatalf("failed to schedule message: %v", err)
+	}
+	return rec
+}
+
+func digestsMentioning(sent []sentEmail, text string) int {
+	n := 0
+	for _, email := range sent {
+		if strings.Contains(email.Body, text) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestProcessMessageSchedule_PublishesDueAndUnpinsLapsed(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	now := time.Now().UTC()
+	due := addInstruction(t, app, "Due instruction", now.Add(-time.Minute))
+	later := addInstruction(t, app, "Later instruction", now.Add(time.Hour))
+
+	pinned, err := app.FindRecordById("messages", "testmsgalphapin1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned.Set("pin_until", now.Add(-time.Minute))
+	if err := app.SaveNoValidate(pinned); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := processMessageSchedule(app, now); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		id            string
+		wantPublished bool
+	}{{due.Id, true}, {later.Id, false}} {
+		rec, err := app.FindRecordById("messages", tc.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if published := !rec.GetDateTime("published_at").IsZero(); published != tc.wantPublished {
+			t.Errorf("%s: published=%v, want %v", rec.GetString("message"), published, tc.wantPublished)
+		}
+	}
+
+	pinned, err = app.FindRecordById("messages", "testmsgalphapin1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinned.GetBool("pinned") {
+		t.Error("a message past pin_until should be unpinned")
+	}
+}
+
+func TestProcessInstructions_ScheduledInstructionCountsFromPublish(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	sent := stubSend(t, nil)
+	now := time.Now().UTC()
+	addInstruction(t, app, "Use the side gate this week", now.Add(-time.Minute))
+
+	// Written within the window but not yet published: not in the digest.
+	if err := processInstructions(app, 30); err != nil {
+		t.Fatal(err)
+	}
+	if digestsMentioning(*sent, "Use the side gate this week") != 0 {
+		t.Fatal("an unpublished instruction should not be sent")
+	}
+	*sent = (*sent)[:0]
+
+	if err := processMessageSchedule(app, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := processInstructions(app, 30); err != nil {
+		t.Fatal(err)
+	}
+	if digestsMentioning(*sent, "Use the side gate this week") != 2 {
+		t.Error("each non-administrator's digest after publishing should include the instruction")
+	}
+}
@@ -2,11 +2,13 @@ package jobs
 
 import (
 	"bytes"
-	"html/template"
 	"log"
+	"os"
 	"strings"
 	"time"
 
+	"ministry-mapper/internal/handlers"
+
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
@@ -17,6 +19,7 @@ type messagesData struct {
 	Message   string
 	Date      string
 	MapName   string
+	InReplyTo string
 }
 type EmailTemplateData struct {
 	Messages []messagesData
@@ -24,8 +27,9 @@ type EmailTemplateData struct {
 	Summary  OverviewSummary
 }
 
-// BuildMessagesPrompt constructs the system and user messages for the messages AI overview.
-func BuildMessagesPrompt(messages []messagesData, congregationName string) (systemMsg, userMsg string) {
+// BuildMessagesPrompt constructs the system and user messages for the messages AI overview,
+// asking for it in language (the English name of the congregation's language).
+func BuildMessagesPrompt(messages []messagesData, congregationName, language string) (systemMsg, userMsg string) {
 	systemMsg = `You are an assistant helping congregation administrators review a digest of ` +
 		`recently received feedback messages from publishers about their assigned map territories. ` +
 		`Messages may cover topics like map boundaries, access difficulties, special conditions, ` +
@@ -35,7 +39,7 @@ func BuildMessagesPrompt(messages []messagesData, congregationName string) (syst
 		`"overview" (2-3 sentence narrative summarising the recent publisher feedback) and ` +
 		`"key_themes" (1-2 sentences identifying the main concerns or action items administrators ` +
 		`should address, including any address data corrections needed). ` +
-		`Be factual, concise, and respectful.`
+		`Be factual, concise, and respectful. ` + languageInstruction(language)
 
 	var sb strings.Builder
 	sb.WriteString("Recent publisher feedback for ")
@@ -51,6 +55,11 @@ func BuildMessagesPrompt(messages []messagesData, congregationName string) (syst
 		sb.WriteString("Date: ")
 		sb.WriteString(m.Date)
 		sb.WriteString("\n")
+		if m.InReplyTo != "" {
+			sb.WriteString("In reply to: ")
+			sb.WriteString(m.InReplyTo)
+			sb.WriteString("\n")
+		}
 		sb.WriteString("Message: ")
 		sb.WriteString(m.Message)
 		sb.WriteString("\n\n")
@@ -61,14 +70,14 @@ func BuildMessagesPrompt(messages []messagesData, congregationName string) (syst
 
 // generateMessagesAISummary builds an OverviewSummary from the messages list.
 // Returns an empty OverviewSummary (Available=false) if AI is disabled or the call fails.
-func generateMessagesAISummary(messages []messagesData, congregationName string) OverviewSummary {
+func generateMessagesAISummary(messages []messagesData, congregationName, language string) OverviewSummary {
 	client := newLLMClient()
 	if client == nil {
 		log.Printf("AI overview skipped for messages (%s): OPENAI_API_KEY not set", congregationName)
 		return OverviewSummary{}
 	}
 
-	systemMsg, userMsg := BuildMessagesPrompt(messages, congregationName)
+	systemMsg, userMsg := BuildMessagesPrompt(messages, congregationName, language)
 	resp, err := client.generateOverview(systemMsg, userMsg)
 	if err != nil {
 		log.Printf("AI overview: LLM call failed for messages (%s): %v", congregationName, err)
@@ -82,6 +91,13 @@ func generateMessagesAISummary(messages []messagesData, congregationName string)
 	}
 }
 
+// unresolvedThreadFilter matches root messages that are not resolved and
+// replies whose root is not resolved.
+const unresolvedThreadFilter = "((parent = '' && resolved_at = '') || (parent != '' && parent.resolved_at = ''))"
+
+// inReplyToMaxLen bounds the quoted root message shown above a reply.
+const inReplyToMaxLen = 140
+
 // MapData holds a map ID for batch processing. Used by processInstructions
 // (process_instructions.go), which stays map-scoped.
 type MapData struct {
@@ -104,22 +120,39 @@ func processMessage(congID string, app core.App) error {
 	// No age bound here: this must sweep the entire unread backlog for the
 	// congregation, not just messages created within the discovery window,
 	// otherwise messages older than that window can never be reached again.
-	messages, err := app.FindRecordsByFilter("messages", "congregation = {:congregation} && read = false && type != 'administrator'", "created", 0, 0, dbx.Params{"congregation": congID})
+	// Messages in resolved threads are left out; a new reply reopens the
+	// thread and brings them back.
+	messages, err := app.FindRecordsByFilter("messages", "congregation = {:congregation} && read = false && type != 'administrator' && "+unresolvedThreadFilter, "created", 0, 0, dbx.Params{"congregation": congID})
 	if err != nil {
 		log.Println("Error finding messages by filter:", err)
 		return err
 	}
 
+	// Messages already in a digest waiting on delivery are marked read once
+	// it is sent; queueing them again would send them twice.
+	queued, err := queuedRefs(app, effectMessagesRead)
+	if err != nil {
+		log.Println("Error finding queued messages:", err)
+		return err
+	}
+	pending := messages[:0]
+	for _, message := range messages {
+		if !queued[message.Id] {
+			pending = append(pending, message)
+		}
+	}
+	messages = pending
+
 	if len(messages) == 0 {
 		log.Println("No messages found")
 		return nil
 	}
 
-	if expandErrs := app.ExpandRecords(messages, []string{"map"}, nil); len(expandErrs) > 0 {
+	if expandErrs := app.ExpandRecords(messages, []string{"map", "parent"}, nil); len(expandErrs) > 0 {
 		log.Printf("Warning: failed to expand map for some messages: %v", expandErrs)
 	}
 
-	recipients, err := fetchCongregationRecipients(app, congID, true)
+	recipients, err := fetchCongregationRecipients(app, congID, true, digestMessages)
 	if err != nil {
 		log.Println("Error fetching recipients:", err)
 		return err
@@ -131,7 +164,8 @@ func processMessage(congID string, app core.App) error {
 	}
 	log.Printf("Processing %d recipients\n", len(recipients))
 
-	tmpl, err := template.ParseFiles("templates/messages.html")
+	loc := loadLocale(congregationLanguage(congRecord))
+	tmpl, err := parseTemplate("templates/messages.html", loc)
 	if err != nil {
 		log.Println("Error parsing template:", err)
 		return err
@@ -144,24 +178,29 @@ func processMessage(congID string, app core.App) error {
 	location := loadCongregationLocation(congRecord)
 
 	for _, message := range messages {
-		mapName := "(unknown map)"
+		mapName := loc.text("messages.unknown_map")
 		if mapData := message.ExpandedOne("map"); mapData != nil {
 			if name, ok := mapData.Get("description").(string); ok {
 				mapName = name
 			}
 		}
+		inReplyTo := ""
+		if parent := message.ExpandedOne("parent"); parent != nil {
+			inReplyTo = truncate(parent.GetString("message"), inReplyToMaxLen)
+		}
 		emailData.Messages = append(emailData.Messages, messagesData{
 			Publisher: message.Get("created_by").(string),
 			Message:   message.Get("message").(string),
-			Date:      message.GetDateTime("created").Time().In(location).Format("03:04 PM, 02 Jan 2006"),
+			Date:      loc.date(message.GetDateTime("created").Time().In(location), dateStyleTimeDate),
 			MapName:   mapName,
+			InReplyTo: inReplyTo,
 		})
 	}
 
 	congregationName, _ := congRecord.Get("name").(string)
 
 	if IsAISummaryEnabled() {
-		emailData.Summary = generateMessagesAISummary(emailData.Messages, congregationName)
+		emailData.Summary = generateMessagesAISummary(emailData.Messages, congregationName, loc.languageName())
 	}
 
 	var body bytes.Buffer
@@ -170,25 +209,35 @@ func processMessage(congID string, app core.App) error {
 		return err
 	}
 
-	subject := "New messages received for " + congregationName
-	if err := sendHTMLEmail(recipients, subject, body.String()); err != nil {
-		log.Println("Error sending email:", err)
-		return err
+	// read marks a message as sent in a digest, so it is set by the outbox
+	// once the digest is delivered; who has opened it is tracked per reader
+	// in message_reads.
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		ids[i] = message.Id
 	}
-	log.Println("Email sent successfully")
 
-	for _, message := range messages {
-		message.Set("read", true)
-		if err := app.Save(message); err != nil {
-			log.Printf("Error marking message %s as read: %v\n", message.Id, err)
-		}
+	subject := loc.text("messages.subject", congregationName)
+	if err := queueDigest(app, congRecord, digestMessages, recipients, subject, body.String(), &outboxEffect{Kind: effectMessagesRead, Refs: ids}); err != nil {
+		log.Println("Error queueing email:", err)
+		return err
 	}
+	log.Println("Email queued successfully")
+
+	pushDigest(app, congRecord, recipients, handlers.PushNotification{
+		Kind:  handlers.PushMessages,
+		Title: subject,
+		Body:  loc.text("messages.push_body", len(messages)),
+		Tag:   "messages-" + congID,
+		URL:   os.Getenv("PB_APP_URL"),
+	})
 
 	return nil
 }
 
 // processMessages emails administrators a digest of unread non-administrator
-// messages created within the last timeIntervalMinutes, grouped per congregation.
+// messages in unresolved threads created within the last timeIntervalMinutes,
+// grouped per congregation.
 func processMessages(app core.App, timeIntervalMinutes int) error {
 	log.Println("Starting messages processing")
 
@@ -196,7 +245,12 @@ func processMessages(app core.App, timeIntervalMinutes int) error {
 
 	timeBuffer := time.Duration(-timeIntervalMinutes) * time.Minute
 
-	err := app.DB().NewQuery("SELECT DISTINCT congregation FROM messages WHERE created > {:created} AND read = false AND type != 'administrator'").Bind(dbx.Params{"created": time.Now().UTC().Add(timeBuffer)}).All(&congregations)
+	err := app.DB().NewQuery(`
+		SELECT DISTINCT m.congregation FROM messages m
+		LEFT JOIN messages p ON p.id = m.parent
+		WHERE m.created > {:created} AND m.read = false AND m.type != 'administrator'
+		AND COALESCE(CASE WHEN COALESCE(m.parent, '') != '' THEN p.resolved_at ELSE m.resolved_at END, '') = ''
+	`).Bind(dbx.Params{"created": time.Now().UTC().Add(timeBuffer)}).All(&congregations)
 
 	if err != nil {
 		log.Println("Error fetching congregations:", err)
@@ -39,8 +39,8 @@ func setupMessagesTestApp(t testing.TB) *tests.TestApp {
 	return app
 }
 
-// stubSend installs a fake sendHTMLEmail for the duration of the test and
-// returns a pointer to the recorded calls.
+// stubSend installs a fake deliverEmail for the duration of the test and
+// returns a pointer to the recorded delivery attempts.
 type sentEmail struct {
 	Recipients []Recipient
 	Subject    string
@@ -50,12 +50,12 @@ type sentEmail struct {
 func stubSend(t testing.TB, result error) *[]sentEmail {
 	t.Helper()
 	sent := []sentEmail{}
-	original := sendHTMLEmail
-	sendHTMLEmail = func(recipients []Recipient, subject, htmlBody string) error {
-		sent = append(sent, sentEmail{Recipients: recipients, Subject: subject, Body: htmlBody})
+	original := deliverEmail
+	deliverEmail = func(email Email) error {
+		sent = append(sent, sentEmail{Recipients: email.To, Subject: email.Subject, Body: email.HTML})
 		return result
 	}
-	t.Cleanup(func() { sendHTMLEmail = original })
+	t.Cleanup(func() { deliverEmail = original })
 	return &sent
 }
 
@@ -241,3 +241,55 @@ func TestProcessMessages_HandlesMessageWithNoMap(t *testing.T) {
 		t.Error("expected mapless message to still be marked read")
 	}
 }
+
+func TestProcessMessages_ExcludesResolvedThreads(t *testing.T) {
+	app := setupMessagesTestApp(t)
+
+	resolved := addMessage(t, app, "testmapalpha01b", "Resolved gate code question", "Test Publisher 4", "publisher", false)
+	resolved.Set("resolved_at", time.Now())
+	if err := app.SaveNoValidate(resolved); err != nil {
+		t.Fatalf("failed to resolve message: %v", err)
+	}
+	reply := addMessage(t, app, "testmapalpha01b", "Follow-up on a resolved thread", "Test Publisher 4", "publisher", false)
+	reply.Set("parent", resolved.Id)
+	if err := app.SaveNoValidate(reply); err != nil {
+		t.Fatalf("failed to attach reply: %v", err)
+	}
+
+	sent := stubSend(t, nil)
+	if err := processMessages(app, 60); err != nil {
+		t.Fatalf("processMessages returned error: %v", err)
+	}
+
+	body := (*sent)[0].Body
+	if strings.Contains(body, "Resolved gate code question") || strings.Contains(body, "Follow-up on a resolved thread") {
+		t.Error("digest should not include messages in resolved threads")
+	}
+	reloaded, err := app.FindRecordById("messages", reply.Id)
+	if err != nil {
+		t.Fatalf("failed to reload reply: %v", err)
+	}
+	if reloaded.GetBool("read") {
+		t.Error("messages in resolved threads should stay unread")
+	}
+}
+
+func TestProcessMessages_QuotesRootAboveReplies(t *testing.T) {
+	app := setupMessagesTestApp(t)
+
+	reply := addMessage(t, app, "testmapalpha01a", "Still locked today", "Test Publisher", "publisher", false)
+	reply.Set("parent", "testmsgalpha01a")
+	if err := app.SaveNoValidate(reply); err != nil {
+		t.Fatalf("failed to attach reply: %v", err)
+	}
+
+	sent := stubSend(t, nil)
+	if err := processMessages(app, 60); err != nil {
+		t.Fatalf("processMessages returned error: %v", err)
+	}
+
+	body := (*sent)[0].Body
+	if !strings.Contains(body, "Still locked today") || !strings.Contains(body, "In reply to:") {
+		t.Errorf("expected the reply with its root quoted, got body: %s", body)
+	}
+}
@@ -3,7 +3,6 @@ package jobs
 import (
 	"bytes"
 	"fmt"
-	"html/template"
 	"log"
 	"strings"
 	"time"
@@ -47,7 +46,7 @@ type territoryRow struct {
 
 // ProcessNewAddress sends a daily digest of app-created addresses to all
 // administrators of the given congregation.
-func ProcessNewAddress(congID string, app core.App, since time.Time, tmpl *template.Template) error {
+func ProcessNewAddress(congID string, app core.App, since time.Time) error {
 	log.Printf("Processing new addresses for congregation: %s", congID)
 
 	congRecord, err := app.FindRecordById("congregations", congID)
@@ -137,6 +136,7 @@ func ProcessNewAddress(congID string, app core.App, since time.Time, tmpl *templ
 	}
 
 	location := loadCongregationLocation(congRecord)
+	loc := loadLocale(congregationLanguage(congRecord))
 
 	// Group addresses by map, preserving insertion order
 	groupOrder := []string{}
@@ -169,16 +169,20 @@ func ProcessNewAddress(congID string, app core.App, since time.Time, tmpl *templ
 		createdBy, _ := addr.Get("created_by").(string)
 
 		status, _ := addr.Get("status").(string)
-		var statusLabel, statusClass string
+		var statusClass string
 		switch status {
 		case "done":
-			statusLabel, statusClass = "Done", "status-done"
+			statusClass = "status-done"
 		case "not_home":
-			statusLabel, statusClass = "Not Home", "status-not_home"
+			statusClass = "status-not_home"
 		case "do_not_call":
-			statusLabel, statusClass = "Do Not Call", "status-dnc"
+			statusClass = "status-dnc"
 		case "invalid":
-			statusLabel, statusClass = "Invalid", "status-invalid"
+			statusClass = "status-invalid"
+		}
+		var statusLabel string
+		if statusClass != "" {
+			statusLabel = loc.text("status." + status)
 		}
 
 		notes, _ := addr.Get("notes").(string)
@@ -186,7 +190,7 @@ func ProcessNewAddress(congID string, app core.App, since time.Time, tmpl *templ
 
 		entry := newAddressEntry{
 			Display:     display,
-			Date:        addr.GetDateTime("created").Time().In(location).Format("03:04 PM"),
+			Date:        loc.date(addr.GetDateTime("created").Time().In(location), dateStyleTime),
 			CreatedBy:   createdBy,
 			StatusLabel: statusLabel,
 			StatusClass: statusClass,
@@ -214,7 +218,7 @@ func ProcessNewAddress(congID string, app core.App, since time.Time, tmpl *templ
 		emailData.Maps = append(emailData.Maps, *groups[id])
 	}
 
-	recipients, err := fetchCongregationRecipients(app, congID, true)
+	recipients, err := fetchCongregationRecipients(app, congID, true, digestNewAddresses)
 	if err != nil {
 		log.Printf("Error fetching recipients for congregation %s: %v", congID, err)
 		return err
@@ -225,6 +229,12 @@ func ProcessNewAddress(congID string, app core.App, since time.Time, tmpl *templ
 		return nil
 	}
 
+	tmpl, err := parseTemplate("templates/new_addresses.html", loc)
+	if err != nil {
+		log.Printf("Error parsing new_addresses template: %v", err)
+		return err
+	}
+
 	var body bytes.Buffer
 	if err := tmpl.Execute(&body, emailData); err != nil {
 		log.Printf("Error executing new_addresses template: %v", err)
@@ -232,13 +242,13 @@ func ProcessNewAddress(congID string, app core.App, since time.Time, tmpl *templ
 	}
 
 	congName, _ := congRecord.Get("name").(string)
-	subject := fmt.Sprintf("New Addresses Added - %s - %s", congName, since.In(location).Format("02 Jan 2006"))
-	if err := sendHTMLEmail(recipients, subject, body.String()); err != nil {
-		log.Printf("Error sending new addresses email for congregation %s: %v", congID, err)
+	subject := loc.text("new_addresses.subject", congName, loc.date(since.In(location), dateStyleDate))
+	if err := queueDigest(app, congRecord, digestNewAddresses, recipients, subject, body.String(), nil); err != nil {
+		log.Printf("Error queueing new addresses email for congregation %s: %v", congID, err)
 		return err
 	}
 
-	log.Printf("New addresses digest sent for congregation %s (%d addresses)", congID, len(addresses))
+	log.Printf("New addresses digest queued for congregation %s (%d addresses)", congID, len(addresses))
 	return nil
 }
 
@@ -262,15 +272,9 @@ func ProcessNewAddresses(app core.App, since time.Time) error {
 		return nil
 	}
 
-	tmpl, err := template.ParseFiles("templates/new_addresses.html")
-	if err != nil {
-		log.Printf("Error parsing new_addresses template: %v", err)
-		return err
-	}
-
 	log.Printf("Processing %d congregation(s) with new addresses", len(congregations))
 	for _, c := range congregations {
-		if err := ProcessNewAddress(c.ID, app, since, tmpl); err != nil {
+		if err := ProcessNewAddress(c.ID, app, since); err != nil {
 			log.Printf("Error processing new addresses for congregation %s: %v", c.ID, err)
 		}
 	}
@@ -3,7 +3,6 @@ package jobs
 import (
 	"bytes"
 	"fmt"
-	"html/template"
 	"log"
 	"strings"
 	"time"
@@ -24,15 +23,16 @@ type NotesTemplateData struct {
 	Summary OverviewSummary
 }
 
-// BuildNotesPrompt constructs the system and user messages for the notes AI overview.
-func BuildNotesPrompt(notes []notesData, congregationName string) (systemMsg, userMsg string) {
+// BuildNotesPrompt constructs the system and user messages for the notes AI overview,
+// asking for it in language (the English name of the congregation's language).
+func BuildNotesPrompt(notes []notesData, congregationName, language string) (systemMsg, userMsg string) {
 	systemMsg = `You are an assistant helping congregation administrators review a digest of ` +
 		`recently updated property notes left by publishers during field ministry. ` +
 		`These notes describe physical characteristics and conditions of the property ` +
 		`(e.g. dogs, gate access, intercom, parking, renovations, unit vacancy). ` +
 		`Analyse the notes and return a JSON object with exactly one field: ` +
 		`"overview" (2-3 sentence narrative summarising the key property observations from this period). ` +
-		`Be factual, concise, and respectful.`
+		`Be factual, concise, and respectful. ` + languageInstruction(language)
 
 	var sb strings.Builder
 	sb.WriteString("Recent property notes for " + congregationName + " congregation:\n\n")
@@ -48,14 +48,14 @@ func BuildNotesPrompt(notes []notesData, congregationName string) (systemMsg, us
 
 // generateNotesAISummary builds an OverviewSummary from the notes list.
 // Returns an empty OverviewSummary (Available=false) if AI is disabled or the call fails.
-func generateNotesAISummary(notes []notesData, congregationName string) OverviewSummary {
+func generateNotesAISummary(notes []notesData, congregationName, language string) OverviewSummary {
 	client := newLLMClient()
 	if client == nil {
 		log.Printf("AI overview skipped for notes (%s): OPENAI_API_KEY not set", congregationName)
 		return OverviewSummary{}
 	}
 
-	systemMsg, userMsg := BuildNotesPrompt(notes, congregationName)
+	systemMsg, userMsg := BuildNotesPrompt(notes, congregationName, language)
 	resp, err := client.generateOverview(systemMsg, userMsg)
 	if err != nil {
 		log.Printf("AI overview: LLM call failed for notes (%s): %v", congregationName, err)
@@ -98,7 +98,7 @@ func ProcessNote(congID string, app core.App, timeBuffer time.Duration) error {
 		return nil
 	}
 
-	recipients, err := fetchCongregationRecipients(app, congID, true)
+	recipients, err := fetchCongregationRecipients(app, congID, true, digestNotes)
 	if err != nil {
 		log.Println("Error fetching recipients:", err)
 		return err
@@ -110,7 +110,8 @@ func ProcessNote(congID string, app core.App, timeBuffer time.Duration) error {
 	}
 	log.Printf("Processing %d recipients\n", len(recipients))
 
-	tmpl, err := template.ParseFiles("templates/notes.html")
+	loc := loadLocale(congregationLanguage(congRecord))
+	tmpl, err := parseTemplate("templates/notes.html", loc)
 	if err != nil {
 		log.Println("Error parsing template:", err)
 		return err
@@ -139,14 +140,14 @@ func ProcessNote(congID string, app core.App, timeBuffer time.Duration) error {
 			Address:   addressName,
 			Publisher: note.Get("last_notes_updated_by").(string),
 			Message:   noteText,
-			Date:      note.GetDateTime("last_notes_updated").Time().In(location).Format("03:04 PM, 02 Jan 2006"),
+			Date:      loc.date(note.GetDateTime("last_notes_updated").Time().In(location), dateStyleTimeDate),
 		}
 		emailData.Notes = append(emailData.Notes, notesData)
 	}
 
 	if IsAISummaryEnabled() {
 		congregationName, _ := congRecord.Get("name").(string)
-		emailData.Summary = generateNotesAISummary(emailData.Notes, congregationName)
+		emailData.Summary = generateNotesAISummary(emailData.Notes, congregationName, loc.languageName())
 	}
 
 	var body bytes.Buffer
@@ -155,12 +156,12 @@ func ProcessNote(congID string, app core.App, timeBuffer time.Duration) error {
 		return err
 	}
 
-	subject := "Notes updated for " + congRecord.Get("name").(string) + " - " + time.Now().Format("02 Jan 2006")
-	if err := sendHTMLEmail(recipients, subject, body.String()); err != nil {
-		log.Println("Error sending email:", err)
+	subject := loc.text("notes.subject", congRecord.Get("name").(string), loc.date(time.Now().In(location), dateStyleDate))
+	if err := queueDigest(app, congRecord, digestNotes, recipients, subject, body.String(), nil); err != nil {
+		log.Println("Error queueing email:", err)
 		return err
 	}
-	log.Println("Email sent successfully")
+	log.Println("Email queued successfully")
 	return nil
 }
 
@@ -0,0 +1,235 @@
+package jobs
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"ministry-mapper/internal/handlers"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// roleExpiryWarningWindow is how long before expires_at the user and the
+// congregation's administrators are warned.
+const roleExpiryWarningWindow = 3 * 24 * time.Hour
+
+type expiringRoleRow struct {
+	ID        string `db:"id"`
+	User      string `db:"user"`
+	Role      string `db:"role"`
+	Name      string `db:"name"`
+	Email     string `db:"email"`
+	Language  string `db:"language"`
+	ExpiresAt string `db:"expires_at"`
+}
+
+type expiringRoleEntry struct {
+	Name      string
+	Email     string
+	RoleName  string
+	ExpiresAt string
+}
+
+type roleExpiryUserTmplData struct {
+	UserName         string
+	CongregationName string
+	RoleName         string
+	ExpiresAt        string
+	AppURL           string
+}
+
+type roleExpiryAdminTmplData struct {
+	CongregationName string
+	Roles            []expiringRoleEntry
+	AppURL           string
+}
+
+// processRoleExpiry revokes roles whose expires_at has passed and warns about
+// roles expiring within roleExpiryWarningWindow.
+//
+// Revocation deletes the role like a manual delete does, so
+// OnRecordAfterDeleteSuccess("roles") runs HandleRoleDelete and a user left
+// with no role starts the unprovisioned-user clock. Each revocation is logged
+// to roles_log as "expired".
+func processRoleExpiry(app core.App, now time.Time) error {
+	log.Println("processRoleExpiry: starting")
+
+	if err := revokeExpiredRoles(app, now); err != nil {
+		return err
+	}
+	if err := warnExpiringRoles(app, now); err != nil {
+		return err
+	}
+
+	log.Println("processRoleExpiry: completed")
+	return nil
+}
+
+func revokeExpiredRoles(app core.App, now time.Time) error {
+	roles := []*core.Record{}
+	err := app.RecordQuery("roles").
+		AndWhere(dbx.NewExp("expires_at != '' AND expires_at <= {:now}",
+			dbx.Params{"now": now.UTC().Format(types.DefaultDateLayout)})).
+		All(&roles)
+	if err != nil {
+		return fmt.Errorf("processRoleExpiry: query expired roles: %w", err)
+	}
+
+	for _, role := range roles {
+		if err := app.Delete(role); err != nil {
+			log.Printf("processRoleExpiry: failed to revoke role %s: %v", role.Id, err)
+			continue
+		}
+		handlers.LogRoleExpired(app, role)
+		log.Printf("processRoleExpiry: revoked expired %s role of user %s in congregation %s",
+			role.GetString("role"), role.GetString("user"), role.GetString("congregation"))
+	}
+	return nil
+}
+
+func warnExpiringRoles(app core.App, now time.Time) error {
+	var congregations []struct {
+		Congregation string `db:"congregation"`
+	}
+	err := app.DB().NewQuery(`
+		SELECT DISTINCT congregation FROM roles
+		WHERE expires_at != '' AND expires_at > {:now} AND expires_at <= {:until}
+		  AND COALESCE(expiry_warning_sent_at, '') = ''
+		  AND id NOT IN ` + queuedRefsSQL(effectRoleExpiryWarned) + `
+	`).Bind(expiryWindowParams(now)).All(&congregations)
+	if err != nil {
+		return fmt.Errorf("processRoleExpiry: query expiring roles: %w", err)
+	}
+
+	if len(congregations) == 0 {
+		return nil
+	}
+
+	for _, c := range congregations {
+		if err := warnCongregationExpiringRoles(app, c.Congregation, now); err != nil {
+			log.Printf("processRoleExpiry: congregation %s: %v", c.Congregation, err)
+		}
+	}
+	return nil
+}
+
+// warnCongregationExpiringRoles sends the administrators a list of the
+// congregation's expiring roles as the role_expiry digest, so it follows their
+// notification preferences, then emails each affected user. A role is stamped
+// by the outbox only once its user's warning is delivered; until then it is
+// left out of later runs, and a dead-lettered warning is retried (and listed
+// to the administrators again). The administrators' list is in the
+// congregation's language and each warning in its user's.
+func warnCongregationExpiringRoles(app core.App, congID string, now time.Time) error {
+	congRecord, err := app.FindRecordById("congregations", congID)
+	if err != nil {
+		return err
+	}
+
+	params := expiryWindowParams(now)
+	params["congregation"] = congID
+	var rows []expiringRoleRow
+	err = app.DB().NewQuery(`
+		SELECT r.id, r.user, r.role, COALESCE(u.name, '') AS name, COALESCE(u.email, '') AS email,
+		       COALESCE(u.language, '') AS language, r.expires_at
+		FROM roles r
+		JOIN users u ON u.id = r.user
+		WHERE r.congregation = {:congregation}
+		  AND r.expires_at != '' AND r.expires_at > {:now} AND r.expires_at <= {:until}
+		  AND COALESCE(r.expiry_warning_sent_at, '') = ''
+		  AND r.id NOT IN ` + queuedRefsSQL(effectRoleExpiryWarned) + `
+		ORDER BY r.expires_at
+	`).Bind(params).All(&rows)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	location := loadCongregationLocation(congRecord)
+	loc := loadLocale(congregationLanguage(congRecord))
+	appURL := os.Getenv("PB_APP_URL")
+	congregationName := congRecord.GetString("name")
+
+	entries := make([]expiringRoleEntry, len(rows))
+	for i, row := range rows {
+		entries[i] = expiringRoleEntry{
+			Name:      displayName(row.Name, row.Email),
+			Email:     row.Email,
+			RoleName:  loc.text("role." + row.Role),
+			ExpiresAt: formatRoleExpiry(row.ExpiresAt, location, loc),
+		}
+	}
+
+	admins, err := fetchCongregationRecipients(app, congID, true, digestRoleExpiry)
+	if err != nil {
+		return err
+	}
+	if len(admins) > 0 {
+		adminTmpl, err := parseTemplate("templates/role_expiry_admin.html", loc)
+		if err != nil {
+			return fmt.Errorf("parse role_expiry_admin template: %w", err)
+		}
+		var body bytes.Buffer
+		data := roleExpiryAdminTmplData{CongregationName: congregationName, Roles: entries, AppURL: appURL}
+		if err := adminTmpl.Execute(&body, data); err != nil {
+			return fmt.Errorf("execute role_expiry_admin template: %w", err)
+		}
+		subject := loc.text("role_expiry_admin.subject", congregationName, len(rows))
+		if err := queueDigest(app, congRecord, digestRoleExpiry, admins, subject, body.String(), nil); err != nil {
+			return fmt.Errorf("queue expiring roles alert: %w", err)
+		}
+	} else {
+		log.Printf("processRoleExpiry: no admin recipients for congregation %s", congID)
+	}
+
+	for i, row := range rows {
+		userLoc := loadLocale(userLanguage(row.Language, congRecord))
+		userTmpl, err := parseTemplate("templates/role_expiry_warning.html", userLoc)
+		if err != nil {
+			return fmt.Errorf("parse role_expiry_warning template: %w", err)
+		}
+		var body bytes.Buffer
+		data := roleExpiryUserTmplData{
+			UserName:         entries[i].Name,
+			CongregationName: congregationName,
+			RoleName:         userLoc.text("role." + row.Role),
+			ExpiresAt:        formatRoleExpiry(row.ExpiresAt, location, userLoc),
+			AppURL:           appURL,
+		}
+		if err := userTmpl.Execute(&body, data); err != nil {
+			log.Printf("processRoleExpiry: template error for %s: %v", row.Email, err)
+			continue
+		}
+		subject := userLoc.text("role_expiry.subject", congregationName)
+		effect := &outboxEffect{Kind: effectRoleExpiryWarned, Refs: []string{row.ID}}
+		if err := queuePlainEmail(app, congID, row.Email, row.Name, subject, body.String(), effect); err != nil {
+			log.Printf("processRoleExpiry: warning email failed for %s: %v", row.Email, err)
+		}
+	}
+
+	log.Printf("processRoleExpiry: warned about %d expiring role(s) in congregation %s", len(rows), congID)
+	return nil
+}
+
+// formatRoleExpiry shows a stored expires_at in the congregation's timezone,
+// or as stored if it does not parse.
+func formatRoleExpiry(expiresAt string, location *time.Location, loc *locale) string {
+	if t, err := parsePBDate(expiresAt); err == nil {
+		return loc.date(t.In(location), dateStyleDateTime)
+	}
+	return expiresAt
+}
+
+func expiryWindowParams(now time.Time) dbx.Params {
+	return dbx.Params{
+		"now":   now.UTC().Format(types.DefaultDateLayout),
+		"until": now.UTC().Add(roleExpiryWarningWindow).Format(types.DefaultDateLayout),
+	}
+}
@@ -0,0 +1,124 @@
+//go:build testdata
+
+package jobs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ministry-mapper/internal/handlers"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func setRoleExpiry(t testing.TB, app core.App, roleID string, expiresAt time.Time) {
+	t.Helper()
+
+	role, err := app.FindRecordById("roles", roleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	role.Set("expires_at", expiresAt)
+	if err := app.Save(role); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessRoleExpiry_RevokesExpiredRoleLikeManualDelete(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	app.OnRecordAfterDeleteSuccess("roles").BindFunc(func(e *core.RecordEvent) error {
+		handlers.HandleRoleDelete(e)
+		return e.Next()
+	})
+	now := time.Now().UTC()
+	setRoleExpiry(t, app, "testrolexcng01c", now.Add(-time.Hour))
+	stubSend(t, nil)
+
+	if err := processRoleExpiry(app, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.FindRecordById("roles", "testrolexcng01c"); err == nil {
+		t.Fatal("expired role should be revoked")
+	}
+	if _, err := app.FindRecordById("roles", "testrolexcng01b"); err != nil {
+		t.Error("roles without expires_at must be left alone")
+	}
+
+	entry, err := app.FindFirstRecordByFilter("roles_log", "user = 'testuseralpha03' && action = 'expired'")
+	if err != nil {
+		t.Fatalf("revocation should be logged as expired: %v", err)
+	}
+	if entry.GetString("old_role") != "read_only" {
+		t.Errorf("old_role: want read_only, got %q", entry.GetString("old_role"))
+	}
+
+	user, err := app.FindRecordById("users", "testuseralpha03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.GetDateTime("unprovisioned_since").IsZero() {
+		t.Error("a user left with no role should have unprovisioned_since stamped")
+	}
+}
+
+func TestProcessRoleExpiry_WarnsUserAndAdminsOnce(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	now := time.Now().UTC()
+	setRoleExpiry(t, app, "testrolexcng01b", now.Add(48*time.Hour))
+	setRoleExpiry(t, app, "testrolexcng01c", now.Add(10*24*time.Hour))
+
+	sent := stubSend(t, nil)
+	if err := processRoleExpiry(app, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*sent) != 2 {
+		t.Fatalf("want an admin alert and one user warning, got %d emails", len(*sent))
+	}
+	admin, user := (*sent)[0], (*sent)[1]
+	if len(admin.Recipients) != 1 || admin.Recipients[0].Email != "admin@alpha.test" {
+		t.Errorf("alert should go to alpha's administrators, got %+v", admin.Recipients)
+	}
+	if !strings.Contains(admin.Body, "conductor@alpha.test") || strings.Contains(admin.Body, "readonly@alpha.test") {
+		t.Error("alert should list only roles expiring within the warning window")
+	}
+	if !strings.Contains(admin.Body, "unsubscribe=") || !strings.Contains(admin.Body, "kind=role_expiry") {
+		t.Error("alert should carry one-click unsubscribe links")
+	}
+	if len(user.Recipients) != 1 || user.Recipients[0].Email != "conductor@alpha.test" {
+		t.Errorf("warning should go to the affected user, got %+v", user.Recipients)
+	}
+
+	role, err := app.FindRecordById("roles", "testrolexcng01b")
+	if err != nil {
+		t.Fatal("a role inside the warning window must not be revoked yet")
+	}
+	if role.GetDateTime("expiry_warning_sent_at").IsZero() {
+		t.Error("expiry_warning_sent_at should be stamped after warning")
+	}
+
+	if err := processRoleExpiry(app, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 2 {
+		t.Errorf("a role must only be warned about once, got %d emails", len(*sent))
+	}
+}
+
+func TestProcessRoleExpiry_MutedAdminGetsNoAlert(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	now := time.Now().UTC()
+	setRoleExpiry(t, app, "testrolexcng01b", now.Add(48*time.Hour))
+	setNotificationPreference(t, app, []string{digestRoleExpiry}, "", "", "")
+
+	sent := stubSend(t, nil)
+	if err := processRoleExpiry(app, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*sent) != 1 || (*sent)[0].Recipients[0].Email != "conductor@alpha.test" {
+		t.Fatalf("only the affected user should be emailed, got %+v", *sent)
+	}
+}
@@ -17,6 +17,7 @@ type unprovisionedUser struct {
 	ID                              string `db:"id"`
 	Name                            string `db:"name"`
 	Email                           string `db:"email"`
+	Language                        string `db:"language"`
 	Disabled                        bool   `db:"disabled"`
 	Created                         string `db:"created"`
 	UnprovisionedSince              string `db:"unprovisioned_since"`
@@ -47,7 +48,8 @@ type unprovisionedNewUser struct {
 // processUnprovisionedUsers enforces the unprovisioned-user lifecycle aligned with NIST SP 800-53 AC-2
 // (automated account management) and IAM best-practice least-privilege principles.
 //
-// Timeline:
+// Timeline (defaults; a user whose role was revoked or expired follows the
+// strictest policy of the congregations that removed them):
 //   - On detection: Alert congregation administrators the first time the job runs after an
 //     unprovisioned account is found (guarded by admin_alerted_at field — fires exactly once
 //     regardless of job timing drift or downtime).
@@ -62,19 +64,7 @@ func processUnprovisionedUsers(app core.App) error {
 	appURL := os.Getenv("PB_APP_URL")
 
 	// Fetch all users with zero role assignments.
-	var users []unprovisionedUser
-	err := app.DB().NewQuery(`
-		SELECT
-			u.id, u.name, u.email, u.disabled, u.created,
-			COALESCE(u.unprovisioned_since, '')               AS unprovisioned_since,
-			COALESCE(u.unprovisioned_warning_sent_at, '')       AS unprovisioned_warning_sent_at,
-			COALESCE(u.unprovisioned_final_warning_sent_at, '') AS unprovisioned_final_warning_sent_at,
-			COALESCE(u.admin_alerted_at, '')                    AS admin_alerted_at
-		FROM users u
-		LEFT JOIN roles r ON r.user = u.id
-		GROUP BY u.id
-		HAVING COUNT(r.id) = 0
-	`).All(&users)
+	users, err := fetchUnprovisionedUsers(app)
 	if err != nil {
 		return fmt.Errorf("processUnprovisionedUsers: query failed: %w", err)
 	}
@@ -84,25 +74,29 @@ func processUnprovisionedUsers(app core.App) error {
 		return nil
 	}
 
+	policies, _, err := userAccountPolicies(app, unprovisionedPolicySQL)
+	if err != nil {
+		return fmt.Errorf("processUnprovisionedUsers: %w", err)
+	}
+
 	log.Printf("processUnprovisionedUsers: processing %d unprovisioned user(s)", len(users))
 
+	queued := map[string]map[string]bool{}
+	for _, field := range []string{"unprovisioned_warning_sent_at", "unprovisioned_final_warning_sent_at", "admin_alerted_at"} {
+		if queued[field], err = queuedRefs(app, userStampEffect(field)); err != nil {
+			return fmt.Errorf("processUnprovisionedUsers: %w", err)
+		}
+	}
+
 	now := time.Now().UTC()
 	var newlyCreated []unprovisionedNewUser
 
 	for _, u := range users {
-		// Use unprovisioned_since if set (role was revoked from an existing user).
-		// Fall back to created for brand-new accounts that never had a role.
-		ageRef := u.Created
-		if u.UnprovisionedSince != "" {
-			ageRef = u.UnprovisionedSince
-		}
-		age := accountAgeDays(ageRef, now)
-
 		// Admin alert — queue if admins have not yet been notified about this account.
 		// Guard against disabled accounts: if email delivery was down when the account
 		// was first disabled, admin_alerted_at is never stamped. Without the !u.Disabled
-		// check, the alert would re-queue on every run until Day 37 deletion.
-		if u.AdminAlertedAt == "" && !u.Disabled {
+		// check, the alert would re-queue on every run until deletion.
+		if u.AdminAlertedAt == "" && !u.Disabled && !queued["admin_alerted_at"][u.ID] {
 			newlyCreated = append(newlyCreated, unprovisionedNewUser{
 				ID:      u.ID,
 				Name:    u.Name,
@@ -111,25 +105,25 @@ func processUnprovisionedUsers(app core.App) error {
 			})
 		}
 
-		if u.Disabled {
+		policy := policyFor(policies, u.ID)
+		action, age := unprovisionedUserAction(u, policy, now)
+
+		switch action {
+		case accountActionDelete:
 			// Delete — disabled accounts past the 30-day investigation window.
-			if age >= 37 {
-				record, err := app.FindRecordById("users", u.ID)
-				if err != nil {
-					log.Printf("processUnprovisionedUsers: cannot find user %s for deletion: %v", u.ID, err)
-					continue
-				}
-				if err := app.Delete(record); err != nil {
-					log.Printf("processUnprovisionedUsers: failed to delete user %s: %v", u.ID, err)
-					continue
-				}
-				log.Printf("processUnprovisionedUsers: deleted unprovisioned user %s (account age %d days)", u.Email, age)
+			record, err := app.FindRecordById("users", u.ID)
+			if err != nil {
+				log.Printf("processUnprovisionedUsers: cannot find user %s for deletion: %v", u.ID, err)
+				continue
 			}
-			continue
-		}
+			if err := app.Delete(record); err != nil {
+				log.Printf("processUnprovisionedUsers: failed to delete user %s: %v", u.ID, err)
+				continue
+			}
+			log.Printf("processUnprovisionedUsers: deleted unprovisioned user %s (account age %d days)", u.Email, age)
 
-		// Disable — unprovisioned for 7+ days without a role assignment (NIST AC-2).
-		if age >= 7 {
+		case accountActionDisable:
+			// Disable — unprovisioned_disable_days without a role assignment (NIST AC-2).
 			record, err := app.FindRecordById("users", u.ID)
 			if err != nil {
 				log.Printf("processUnprovisionedUsers: cannot find user %s to disable: %v", u.ID, err)
@@ -141,47 +135,30 @@ func processUnprovisionedUsers(app core.App) error {
 				continue
 			}
 			log.Printf("processUnprovisionedUsers: disabled unprovisioned user %s (account age %d days)", u.Email, age)
-			continue
-		}
 
-		// Final warning — 24 h before disable (day 6).
-		if age >= 6 && u.UnprovisionedFinalWarningSentAt == "" {
-			daysLeft := 7 - age
-			if err := sendUnprovisionedUserEmail(u.Email, u.Name, true, daysLeft, appURL); err != nil {
-				log.Printf("processUnprovisionedUsers: final warning email failed for %s: %v", u.Email, err)
-				continue
-			}
-			if err := updateUserField(app, u.ID, "unprovisioned_final_warning_sent_at", now.Format(time.RFC3339)); err != nil {
-				log.Printf("CRITICAL processUnprovisionedUsers: final warning sent to %s but timestamp not saved — duplicate email may be sent on next run: %v", u.Email, err)
+		case accountActionFinalWarn, accountActionWarn:
+			isFinal := action == accountActionFinalWarn
+			field := "unprovisioned_warning_sent_at"
+			if isFinal {
+				field = "unprovisioned_final_warning_sent_at"
 			}
-			continue
-		}
-
-		// First warning — 4 days remaining (day 3).
-		if age >= 3 && u.UnprovisionedWarningSentAt == "" {
-			daysLeft := 7 - age
-			if err := sendUnprovisionedUserEmail(u.Email, u.Name, false, daysLeft, appURL); err != nil {
-				log.Printf("processUnprovisionedUsers: warning email failed for %s: %v", u.Email, err)
+			// The outbox stamps the field once the warning is delivered.
+			if queued[field][u.ID] {
 				continue
 			}
-			if err := updateUserField(app, u.ID, "unprovisioned_warning_sent_at", now.Format(time.RFC3339)); err != nil {
-				log.Printf("CRITICAL processUnprovisionedUsers: warning sent to %s but timestamp not saved — duplicate email may be sent on next run: %v", u.Email, err)
+			daysLeft := policy.UnprovisionedDisableDays - age
+			effect := &outboxEffect{Kind: userStampEffect(field), Refs: []string{u.ID}}
+			if err := sendUnprovisionedUserEmail(app, u.Email, u.Name, u.Language, isFinal, daysLeft, appURL, effect); err != nil {
+				log.Printf("processUnprovisionedUsers: %s email failed for %s: %v", action, u.Email, err)
 			}
 		}
 	}
 
 	// Alert congregation admins about any unprovisioned accounts not yet flagged.
-	// Only stamp admin_alerted_at after at least one admin was successfully notified.
+	// The outbox stamps admin_alerted_at once any one alert is delivered.
 	if len(newlyCreated) > 0 {
-		sent, err := alertAdminsUnprovisionedUsers(app, newlyCreated, appURL)
-		if err != nil {
+		if _, err := alertAdminsUnprovisionedUsers(app, newlyCreated, appURL); err != nil {
 			log.Printf("processUnprovisionedUsers: admin alert failed: %v", err)
-		} else if sent > 0 {
-			for _, nu := range newlyCreated {
-				if err := updateUserField(app, nu.ID, "admin_alerted_at", now.Format(time.RFC3339)); err != nil {
-					log.Printf("CRITICAL processUnprovisionedUsers: admin alert sent for %s but admin_alerted_at not saved — alert may re-send: %v", nu.Email, err)
-				}
-			}
 		}
 	}
 
@@ -189,16 +166,36 @@ func processUnprovisionedUsers(app core.App) error {
 	return nil
 }
 
-// sendUnprovisionedUserEmail sends a warning or final-warning email to an unprovisioned user.
-func sendUnprovisionedUserEmail(toEmail, toName string, isFinal bool, daysRemaining int, appURL string) error {
+// fetchUnprovisionedUsers returns every user with no role assignment.
+func fetchUnprovisionedUsers(app core.App) ([]unprovisionedUser, error) {
+	var users []unprovisionedUser
+	err := app.DB().NewQuery(`
+		SELECT
+			u.id, u.name, u.email, COALESCE(u.language, '') AS language, u.disabled, u.created,
+			COALESCE(u.unprovisioned_since, '')               AS unprovisioned_since,
+			COALESCE(u.unprovisioned_warning_sent_at, '')       AS unprovisioned_warning_sent_at,
+			COALESCE(u.unprovisioned_final_warning_sent_at, '') AS unprovisioned_final_warning_sent_at,
+			COALESCE(u.admin_alerted_at, '')                    AS admin_alerted_at
+		FROM users u
+		LEFT JOIN roles r ON r.user = u.id
+		GROUP BY u.id
+		HAVING COUNT(r.id) = 0
+	`).All(&users)
+	return users, err
+}
+
+// sendUnprovisionedUserEmail queues a warning or final-warning email to an unprovisioned user.
+// With no congregation to take a language from, it is in the user's own or the default.
+func sendUnprovisionedUserEmail(app core.App, toEmail, toName, language string, isFinal bool, daysRemaining int, appURL string, effect *outboxEffect) error {
+	loc := loadLocale(userLanguage(language, nil))
 	templateFile := "templates/user_unprovisioned_warning.html"
-	subject := "Ministry Mapper: Please complete your account setup"
+	subject := loc.text("unprovisioned.subject")
 	if isFinal {
 		templateFile = "templates/user_unprovisioned_final_warning.html"
-		subject = "Ministry Mapper: Your account will be deactivated in 24 hours"
+		subject = loc.text("unprovisioned_final.subject")
 	}
 
-	tmpl, err := template.ParseFiles(templateFile)
+	tmpl, err := parseTemplate(templateFile, loc)
 	if err != nil {
 		return fmt.Errorf("sendUnprovisionedUserEmail: parse template: %w", err)
 	}
@@ -214,14 +211,14 @@ func sendUnprovisionedUserEmail(toEmail, toName string, isFinal bool, daysRemain
 		return fmt.Errorf("sendUnprovisionedUserEmail: execute template: %w", err)
 	}
 
-	return sendPlainEmail(toEmail, toName, subject, body.String())
+	return queuePlainEmail(app, "", toEmail, toName, subject, body.String(), effect)
 }
 
 // alertAdminsUnprovisionedUsers notifies all PocketBase superadmins about unprovisioned accounts.
 // Superadmins are system-level owners and are the correct recipients since unprovisioned users
 // have no congregation linkage yet — there is no congregation-scoped admin to notify.
-// Returns the number of superadmins successfully notified so the caller can decide whether to
-// stamp admin_alerted_at.
+// Each alert stamps admin_alerted_at on the listed users once delivered. Returns the number of
+// alerts queued.
 func alertAdminsUnprovisionedUsers(app core.App, newUsers []unprovisionedNewUser, appURL string) (int, error) {
 	superusers, err := app.FindRecordsByFilter(core.CollectionNameSuperusers, "", "", 0, 0)
 	if err != nil {
@@ -239,6 +236,10 @@ func alertAdminsUnprovisionedUsers(app core.App, newUsers []unprovisionedNewUser
 	}
 
 	subject := fmt.Sprintf("Ministry Mapper: %d unprovisioned account(s) require attention", len(newUsers))
+	ids := make([]string, len(newUsers))
+	for i, nu := range newUsers {
+		ids[i] = nu.ID
+	}
 	sent := 0
 
 	for _, su := range superusers {
@@ -253,7 +254,8 @@ func alertAdminsUnprovisionedUsers(app core.App, newUsers []unprovisionedNewUser
 			log.Printf("alertAdminsUnprovisionedUsers: template error for superadmin %s: %v", email, err)
 			continue
 		}
-		if err := sendPlainEmail(email, "Superadmin", subject, body.String()); err != nil {
+		effect := &outboxEffect{Kind: userStampEffect("admin_alerted_at"), Refs: ids}
+		if err := queuePlainEmail(app, "", email, "Superadmin", subject, body.String(), effect); err != nil {
 			log.Printf("alertAdminsUnprovisionedUsers: email failed for superadmin %s: %v", email, err)
 			continue
 		}
@@ -273,10 +275,10 @@ func updateUserField(app core.App, userID, field, value string) error {
 	return app.SaveNoValidate(record)
 }
 
-// sendPlainEmail sends a single HTML email to one recipient.
+// queuePlainEmail queues a single HTML email to one recipient.
 // Shared by all user management job emails.
-func sendPlainEmail(toEmail, toName, subject, htmlBody string) error {
-	return sendHTMLEmail([]Recipient{{Email: toEmail, Name: toName}}, subject, htmlBody)
+func queuePlainEmail(app core.App, congregation, toEmail, toName, subject, htmlBody string, effect *outboxEffect) error {
+	return queueHTMLEmail(app, congregation, []Recipient{{Email: toEmail, Name: toName}}, subject, htmlBody, effect)
 }
 
 // accountAgeDays calculates how many full days have elapsed since the account was created.
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type userReenabledTmplData struct {
+	UserName         string
+	AdminName        string
+	CongregationName string
+	AppURL           string
+}
+
+// SendUserReenabledEmail tells a user that an administrator of congregation
+// re-enabled their account, in the user's language.
+func SendUserReenabledEmail(app core.App, user, congregation, admin *core.Record) error {
+	loc := loadLocale(userLanguage(user.GetString("language"), congregation))
+	tmpl, err := parseTemplate("templates/user_reenabled.html", loc)
+	if err != nil {
+		return fmt.Errorf("SendUserReenabledEmail: parse template: %w", err)
+	}
+
+	email := user.GetString("email")
+	data := userReenabledTmplData{
+		UserName:         displayName(user.GetString("name"), email),
+		CongregationName: congregation.GetString("name"),
+		AppURL:           os.Getenv("PB_APP_URL"),
+	}
+	if admin != nil {
+		data.AdminName = admin.GetString("name")
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("SendUserReenabledEmail: execute template: %w", err)
+	}
+
+	subject := loc.text("reenabled.subject")
+	return queuePlainEmail(app, congregation.Id, email, user.GetString("name"), subject, body.String(), nil)
+}
@@ -76,6 +76,7 @@ type SummaryData struct {
 	Available           bool
 	CongregationName    string
 	Period              string // "February 2026"
+	Language            string // English name of the language to write in, e.g. "Spanish"
 	Territories         []TerritoryProgress
 	MonthlyByTerritory  []TerritoryMonthlyActivity // per-territory activity for the report month
 	TotalChanges        int
@@ -105,6 +106,14 @@ type ReportPeriod struct {
 	IsOnDemand bool   // true for on-demand reports, false for scheduled monthly reports
 }
 
+// localLabel is Label with loc's month names and date formats.
+func (p ReportPeriod) localLabel(loc *locale) string {
+	if !p.IsOnDemand {
+		return loc.date(p.Start, dateStyleMonth)
+	}
+	return loc.date(p.Start, dateStyleShortDate) + " – " + loc.date(p.End.AddDate(0, 0, -1), dateStyleShortDate)
+}
+
 // PreviousCalendarMonth returns a ReportPeriod covering the previous full calendar month.
 // Used by the scheduled monthly report job.
 func PreviousCalendarMonth() ReportPeriod {
@@ -518,6 +527,7 @@ func BuildSummaryData(app core.App, congregation *core.Record, period ReportPeri
 		Available:           false,
 		CongregationName:    name,
 		Period:              period.Label,
+		Language:            loadLocale(congregationLanguage(congregation)).languageName(),
 		Territories:         territories,
 		MonthlyByTerritory:  monthlyByTerritory,
 		TotalChanges:        totalChanges,
@@ -535,6 +545,10 @@ func BuildSummaryData(app core.App, congregation *core.Record, period ReportPeri
 // BuildPrompt constructs the system and user messages sent to the LLM.
 // All derived metrics must already be populated in data before calling this.
 func BuildPrompt(data SummaryData) (systemMsg, userMsg string) {
+	language := data.Language
+	if language == "" {
+		language = "English"
+	}
 	systemMsg = `You are the territory servant for a Jehovah's Witness congregation, writing the
 territory activity report for your service overseer and fellow elders.
 
@@ -594,7 +608,7 @@ Before drafting any section, identify from TERRITORY ACTIVITY:
 Use these verified facts as your sole basis for sections 1 and 2.
 
 WRITING STYLE:
-- Write in plain, simple English — short sentences, everyday words
+- Write in plain, simple ` + language + ` — short sentences, everyday words
 - Avoid formal or corporate-sounding phrases (e.g. "in the absence of", "lay the groundwork",
   "rekindling systematic outreach", "tangible progress")
 - Write as if speaking warmly to a fellow elder, not drafting an official document
@@ -636,6 +650,7 @@ RULES:
   (individual addresses re-opened for ministry) and is not meaningful for the activity summary
 - When referencing a map in narrative text, use the map's description as shown in the data
   (e.g. "map [description] in territory [territory]") — never use slash notation like "M05/112 (5)"
+- ` + languageInstruction(language) + `
 - Respond only in this exact JSON schema:
 {
   "covered_activity": "<section 1 paragraph>",
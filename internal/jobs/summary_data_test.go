@@ -407,6 +407,20 @@ func TestBuildPrompt_JSONSchemaInSystemMessage(t *testing.T) {
 	}
 }
 
+func TestBuildPrompt_AsksForCongregationLanguage(t *testing.T) {
+	data := minimalSummaryData()
+	systemMsg, _ := BuildPrompt(data)
+	if !strings.Contains(systemMsg, "Write every JSON value in English") {
+		t.Error("system message should default to English")
+	}
+
+	data.Language = "Spanish"
+	systemMsg, _ = BuildPrompt(data)
+	if !strings.Contains(systemMsg, "Write every JSON value in Spanish") {
+		t.Error("system message should ask for the congregation's language")
+	}
+}
+
 // minimalSummaryData returns a SummaryData with just enough fields populated
 // to let BuildPrompt run without panicking.
 func minimalSummaryData() SummaryData {
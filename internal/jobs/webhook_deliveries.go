@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"ministry-mapper/internal/handlers"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	webhookDeliveredRetention = 30 * 24 * time.Hour
+	webhookFailedRetention    = 90 * 24 * time.Hour
+	webhookBatchSize          = 200
+)
+
+// processWebhookDeliveries retries webhook deliveries that are due, including
+// ones left in sending by a run that died, then purges delivered and failed
+// deliveries past their retention. First attempts are made as events happen;
+// this job only picks up what failed.
+func processWebhookDeliveries(app core.App, now time.Time) error {
+	now = now.UTC()
+
+	var due []struct {
+		ID string `db:"id"`
+	}
+	err := app.DB().NewQuery(`
+		SELECT id FROM webhook_deliveries
+		WHERE (status = 'pending' AND next_attempt_at <= {:now})
+		   OR (status = 'sending' AND updated <= {:stale})
+		ORDER BY next_attempt_at
+		LIMIT {:limit}
+	`).Bind(dbx.Params{
+		"now":   now.Format(types.DefaultDateLayout),
+		"stale": now.Add(-handlers.WebhookStaleSending).Format(types.DefaultDateLayout),
+		"limit": webhookBatchSize,
+	}).All(&due)
+	if err != nil {
+		return fmt.Errorf("processWebhookDeliveries: query due deliveries: %w", err)
+	}
+
+	failed := 0
+	for _, row := range due {
+		delivery, err := app.FindRecordById("webhook_deliveries", row.ID)
+		if err != nil {
+			continue
+		}
+		if err := handlers.DeliverWebhook(app, delivery, now); err != nil {
+			failed++
+		}
+	}
+	if len(due) > 0 {
+		log.Printf("processWebhookDeliveries: %d due, %d failed", len(due), failed)
+	}
+
+	for _, purge := range []struct {
+		status, field string
+		before        time.Time
+	}{
+		{"delivered", "delivered_at", now.Add(-webhookDeliveredRetention)},
+		{"failed", "updated", now.Add(-webhookFailedRetention)},
+	} {
+		_, err := app.DB().NewQuery("DELETE FROM webhook_deliveries WHERE status = {:status} AND " + purge.field + " < {:before}").
+			Bind(dbx.Params{"status": purge.status, "before": purge.before.Format(types.DefaultDateLayout)}).
+			Execute()
+		if err != nil {
+			log.Printf("processWebhookDeliveries: purge %s: %v", purge.status, err)
+		}
+	}
+	return nil
+}
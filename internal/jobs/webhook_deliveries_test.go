@@ -0,0 +1,115 @@
+//go:build testdata
+
+package jobs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ministry-mapper/internal/handlers"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestProcessWebhookDeliveries_RetriesWithBackoffThenPurges(t *testing.T) {
+	app := setupMessagesTestApp(t)
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+
+	var healthy atomic.Bool
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	webhooks, err := app.FindCollectionByNameOrId("webhooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook := core.NewRecord(webhooks)
+	webhook.Set("congregation", "testcongalpha01")
+	webhook.Set("url", server.URL)
+	webhook.Set("events", []string{handlers.WebhookMapCompleted})
+	webhook.Set("active", true)
+	webhook.Set("secret", "whsec_test")
+	if err := app.Save(webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dates are stored to the millisecond.
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	deliveries, err := app.FindCollectionByNameOrId("webhook_deliveries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery := core.NewRecord(deliveries)
+	delivery.Set("webhook", webhook.Id)
+	delivery.Set("congregation", "testcongalpha01")
+	delivery.Set("event", handlers.WebhookMapCompleted)
+	delivery.Set("payload", map[string]any{"event": handlers.WebhookMapCompleted})
+	delivery.Set("status", "pending")
+	delivery.Set("next_attempt_at", now)
+	if err := app.Save(delivery); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := processWebhookDeliveries(app, now); err != nil {
+		t.Fatal(err)
+	}
+	record, err := app.FindRecordById("webhook_deliveries", delivery.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.GetString("status") != "pending" || record.GetInt("attempts") != 1 || record.GetInt("response_status") != http.StatusServiceUnavailable {
+		t.Fatalf("after a 503: status %q, %d attempts, response %d", record.GetString("status"), record.GetInt("attempts"), record.GetInt("response_status"))
+	}
+	next := record.GetDateTime("next_attempt_at").Time()
+	if got := next.Sub(now); got != handlers.WebhookBackoff(1) {
+		t.Errorf("next attempt in %s, want %s", got, handlers.WebhookBackoff(1))
+	}
+
+	healthy.Store(true)
+	if err := processWebhookDeliveries(app, next.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 1 {
+		t.Fatal("the retry ran before it was due")
+	}
+	if err := processWebhookDeliveries(app, next); err != nil {
+		t.Fatal(err)
+	}
+	record, err = app.FindRecordById("webhook_deliveries", delivery.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.GetString("status") != "delivered" || record.GetDateTime("delivered_at").IsZero() {
+		t.Fatalf("retry: status %q, want delivered", record.GetString("status"))
+	}
+
+	if err := processWebhookDeliveries(app, next.Add(webhookDeliveredRetention+time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.FindRecordById("webhook_deliveries", delivery.Id); err == nil {
+		t.Error("a delivered delivery past retention should be purged")
+	}
+}
+
+func TestWebhookBackoff_DoublesUpToTheCap(t *testing.T) {
+	if got := handlers.WebhookBackoff(1); got != time.Minute {
+		t.Errorf("first retry after %s, want 1m", got)
+	}
+	if got := handlers.WebhookBackoff(3); got != 4*time.Minute {
+		t.Errorf("third retry after %s, want 4m", got)
+	}
+	if got := handlers.WebhookBackoff(handlers.WebhookMaxAttempts); got != 6*time.Hour {
+		t.Errorf("last retry after %s, want the 6h cap", got)
+	}
+}
@@ -289,6 +289,40 @@ func TestDomainHook_HandleRoleDelete_LastRole(t *testing.T) {
 	}
 }
 
+func TestDomainHook_RoleExpiryChangeClearsWarning(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.Cleanup()
+
+	// Each save starts from a fresh load, as an API request would: Original()
+	// is what the record held when it was read.
+	update := func(fields map[string]any) *core.Record {
+		t.Helper()
+		role, err := app.FindRecordById("roles", "testrolexcng01b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range fields {
+			role.Set(k, v)
+		}
+		if err := app.Save(role); err != nil {
+			t.Fatal(err)
+		}
+		return role
+	}
+
+	update(map[string]any{"expires_at": time.Now().Add(48 * time.Hour)})
+
+	role := update(map[string]any{"expiry_warning_sent_at": time.Now(), "role": "administrator"})
+	if role.GetDateTime("expiry_warning_sent_at").IsZero() {
+		t.Error("an unrelated change must keep expiry_warning_sent_at")
+	}
+
+	role = update(map[string]any{"expires_at": time.Now().Add(30 * 24 * time.Hour)})
+	if !role.GetDateTime("expiry_warning_sent_at").IsZero() {
+		t.Error("extending expires_at should clear expiry_warning_sent_at so the new date is warned about")
+	}
+}
+
 // TestDomainHook_AggregateFullChain verifies the full path from a not_home_tries
 // increment through to the map progress field being recomputed by the async
 // address update hook.
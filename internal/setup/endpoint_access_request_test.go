@@ -0,0 +1,197 @@
+//go:build testdata
+
+package setup
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// addUnprovisionedUser creates a user with no role, as processUnprovisionedUsers
+// would see them a few days after signing up, and returns their auth token.
+func addUnprovisionedUser(t testing.TB, app core.App, id string) string {
+	t.Helper()
+
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := core.NewRecord(users)
+	user.Id = id
+	user.Set("email", id+"@example.test")
+	user.Set("name", "New Publisher")
+	user.Set("unprovisioned_since", time.Now().Add(-4*24*time.Hour))
+	user.Set("unprovisioned_warning_sent_at", time.Now().Add(-24*time.Hour))
+	user.SetPassword("Test1234!")
+	if err := app.Save(user); err != nil {
+		t.Fatal(err)
+	}
+	token, err := user.NewAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAccessRequest_ApproveGrantsRoleAndClearsUnprovisioned(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	userToken := addUnprovisionedUser(t, testApp, "testnewpub00001")
+	mux := buildTestMux(t, testApp)
+
+	res := postJSON(t, mux, "/access/request", userToken, `{"code":"alpha","message":"Sunday group"}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("request returned %d: %s", res.Code, res.Body)
+	}
+	if !strings.Contains(res.Body.String(), `"congregation":"Alpha Congregation"`) {
+		t.Errorf("code should match case-insensitively: %s", res.Body)
+	}
+
+	dup := postJSON(t, mux, "/access/request", userToken, `{"code":"ALPHA"}`)
+	if dup.Code != http.StatusBadRequest {
+		t.Errorf("duplicate request: want 400, got %d", dup.Code)
+	}
+
+	request, err := testApp.FindFirstRecordByFilter("access_requests", "user = 'testnewpub00001'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decide := postJSON(t, mux, "/access/decide", adminToken,
+		`{"request":"`+request.Id+`","decision":"approve","role":"conductor"}`)
+	if decide.Code != http.StatusOK {
+		t.Fatalf("approve returned %d: %s", decide.Code, decide.Body)
+	}
+
+	if role := roleIn(t, testApp, "testnewpub00001", "testcongalpha01"); role != "conductor" {
+		t.Errorf("approval should grant conductor, got %q", role)
+	}
+	user, err := testApp.FindRecordById("users", "testnewpub00001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.GetDateTime("unprovisioned_since").IsZero() || !user.GetDateTime("unprovisioned_warning_sent_at").IsZero() {
+		t.Error("approval should clear the unprovisioned stamps")
+	}
+	if _, err := testApp.FindFirstRecordByFilter("roles_log",
+		"user = 'testnewpub00001' && action = 'granted' && changed_by = 'testuseralpha01'"); err != nil {
+		t.Errorf("grant not logged: %v", err)
+	}
+
+	again := postJSON(t, mux, "/access/decide", adminToken, `{"request":"`+request.Id+`","decision":"deny"}`)
+	if again.Code != http.StatusBadRequest || !strings.Contains(again.Body.String(), "Access request is already approved.") {
+		t.Errorf("deciding twice: %d %s", again.Code, again.Body)
+	}
+}
+
+func TestAccessRequest_Deny(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	userToken := addUnprovisionedUser(t, testApp, "testnewpub00001")
+	mux := buildTestMux(t, testApp)
+
+	if res := postJSON(t, mux, "/access/request", userToken, `{"code":"ALPHA"}`); res.Code != http.StatusCreated {
+		t.Fatalf("request returned %d: %s", res.Code, res.Body)
+	}
+	request, err := testApp.FindFirstRecordByFilter("access_requests", "user = 'testnewpub00001'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res := postJSON(t, mux, "/access/decide", adminToken, `{"request":"`+request.Id+`","decision":"deny"}`); res.Code != http.StatusOK {
+		t.Fatalf("deny returned %d: %s", res.Code, res.Body)
+	}
+	if role := roleIn(t, testApp, "testnewpub00001", "testcongalpha01"); role != "" {
+		t.Errorf("denial must not grant a role, got %q", role)
+	}
+
+	list := postJSON(t, mux, "/access/requests", adminToken, `{"congregation":"testcongalpha01","status":"denied"}`)
+	if !strings.Contains(list.Body.String(), `"decided_by":"Alpha Admin"`) {
+		t.Errorf("denied request should list who decided: %s", list.Body)
+	}
+}
+
+func TestAccessRequest_Endpoint(t *testing.T) {
+	readonlyToken, err := generateToken("readonly@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:   "unknown code",
+			Method: http.MethodPost,
+			URL:    "/access/request",
+			Body:   strings.NewReader(`{"code":"GAMMA"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": readonlyToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{`"No congregation has that code."`},
+		},
+		{
+			Name:   "existing member cannot request access",
+			Method: http.MethodPost,
+			URL:    "/access/request",
+			Body:   strings.NewReader(`{"code":"ALPHA"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": readonlyToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"You already have access to this congregation."`},
+		},
+		{
+			Name:   "conductor cannot list requests",
+			Method: http.MethodPost,
+			URL:    "/access/requests",
+			Body:   strings.NewReader(`{"congregation":"testcongalpha01"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": conductorToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"Administrator access required."`},
+		},
+		{
+			Name:   "decision must be approve or deny",
+			Method: http.MethodPost,
+			URL:    "/access/decide",
+			Body:   strings.NewReader(`{"request":"anything","decision":"maybe"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": conductorToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"Decision must be approve or deny."`},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
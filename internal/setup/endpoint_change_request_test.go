@@ -0,0 +1,273 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// submitChange raises a change request on testmapalpha01a through the seeded
+// publisher link and returns its id.
+func submitChange(t *testing.T, mux http.Handler, body string) string {
+	t.Helper()
+
+	res := postWithLink(t, mux, "/change/request", "testassignalpha01", body)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("change request returned %d: %s", res.Code, res.Body)
+	}
+	var created struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	return created.Id
+}
+
+func countCode(t *testing.T, testApp *tests.TestApp, code string) int {
+	t.Helper()
+
+	var result struct {
+		Cnt int `db:"cnt"`
+	}
+	err := testApp.DB().NewQuery("SELECT COUNT(*) AS cnt FROM addresses WHERE map = 'testmapalpha01a' AND code = {:code}").
+		Bind(dbx.Params{"code": code}).One(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Cnt
+}
+
+func TestChangeRequest_ApproveAddCode(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readOnlyToken, err := generateToken("readonly@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	body := `{"map":"testmapalpha01a","kind":"add_code","code":"15A","note":"New unit next to 15"}`
+	id := submitChange(t, mux, body)
+	if res := postWithLink(t, mux, "/change/request", "testassignalpha01", body); res.Code != http.StatusBadRequest {
+		t.Errorf("duplicate pending request: want 400, got %d", res.Code)
+	}
+	if res := postWithLink(t, mux, "/change/request", "testassignalpha01", `{"map":"testmapalpha01a","kind":"add_code","code":"10"}`); res.Code != http.StatusBadRequest {
+		t.Errorf("adding an existing code: want 400, got %d", res.Code)
+	}
+	if res := postWithLink(t, mux, "/change/request", "testassignbeta001", body); res.Code != http.StatusForbidden {
+		t.Errorf("link for another map: want 403, got %d", res.Code)
+	}
+
+	if res := postJSON(t, mux, "/change/requests", readOnlyToken, `{"congregation":"testcongalpha01"}`); res.Code != http.StatusForbidden {
+		t.Errorf("read-only listing: want 403, got %d", res.Code)
+	}
+	res := postJSON(t, mux, "/change/requests", adminToken, `{"congregation":"testcongalpha01","status":"pending"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("listing returned %d: %s", res.Code, res.Body)
+	}
+	var queue []struct {
+		Id          string `json:"id"`
+		RequestedBy string `json:"requested_by"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &queue); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 1 || queue[0].Id != id || queue[0].RequestedBy != "Test Publisher Alpha" {
+		t.Errorf("queue: want the one request by Test Publisher Alpha, got %s", res.Body)
+	}
+
+	decide := `{"request":"` + id + `","decision":"approve","note":"Added"}`
+	if res := postJSON(t, mux, "/change/decide", conductorToken, decide); res.Code != http.StatusForbidden {
+		t.Errorf("conductor decision: want 403, got %d", res.Code)
+	}
+	if res := postJSON(t, mux, "/change/decide", adminToken, decide); res.Code != http.StatusOK {
+		t.Fatalf("approve returned %d: %s", res.Code, res.Body)
+	}
+	if res := postJSON(t, mux, "/change/decide", adminToken, decide); res.Code != http.StatusBadRequest {
+		t.Errorf("deciding twice: want 400, got %d", res.Code)
+	}
+
+	if got := countCode(t, testApp, "15A"); got == 0 {
+		t.Error("approved add_code should create the code's addresses")
+	}
+	request, err := testApp.FindRecordById("change_requests", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.GetString("status") != "approved" || request.GetString("decided_by") != "testuseralpha01" {
+		t.Errorf("want approved by testuseralpha01, got %q by %q", request.GetString("status"), request.GetString("decided_by"))
+	}
+
+	// The publisher sees the decision as a reply in the request's thread.
+	root, err := testApp.FindRecordById("messages", request.GetString("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.GetDateTime("resolved_at").IsZero() {
+		t.Error("the request's thread should be resolved once decided")
+	}
+	replies, err := testApp.FindAllRecords("messages", dbx.HashExp{"parent": root.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0].GetString("type") != "administrator" || replies[0].GetString("message") != "Done: add code 15A\nAdded" {
+		t.Errorf("want one administrator reply announcing the change, got %d", len(replies))
+	}
+}
+
+func TestChangeRequest_RenameFlagAndDeny(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	rename := submitChange(t, mux, `{"map":"testmapalpha01a","kind":"rename_code","code":"11","new_code":"11A"}`)
+	flag := submitChange(t, mux, `{"map":"testmapalpha01a","kind":"flag_dnc","code":"12","floor":1}`)
+	remove := submitChange(t, mux, `{"map":"testmapalpha01a","kind":"remove_code","code":"13"}`)
+
+	for _, id := range []string{rename, flag} {
+		if res := postJSON(t, mux, "/change/decide", adminToken, `{"request":"`+id+`","decision":"approve"}`); res.Code != http.StatusOK {
+			t.Fatalf("approve %s returned %d: %s", id, res.Code, res.Body)
+		}
+	}
+	if res := postJSON(t, mux, "/change/decide", adminToken, `{"request":"`+remove+`","decision":"deny","note":"Unit still exists"}`); res.Code != http.StatusOK {
+		t.Fatalf("deny returned %d: %s", res.Code, res.Body)
+	}
+
+	if countCode(t, testApp, "11") != 0 || countCode(t, testApp, "11A") == 0 {
+		t.Error("approved rename_code should move code 11 to 11A")
+	}
+	address, err := testApp.FindRecordById("addresses", "testalpha01a003")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address.GetString("status") != "do_not_call" || address.GetString("dnc_time") == "" {
+		t.Errorf("approved flag_dnc: want do_not_call with dnc_time, got %q %q", address.GetString("status"), address.GetString("dnc_time"))
+	}
+	if countCode(t, testApp, "13") == 0 {
+		t.Error("denied remove_code should leave the code in place")
+	}
+	denied, err := testApp.FindRecordById("change_requests", remove)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if denied.GetString("status") != "denied" || denied.GetString("decision_note") != "Unit still exists" {
+		t.Errorf("want denied with note, got %q %q", denied.GetString("status"), denied.GetString("decision_note"))
+	}
+}
+
+func TestChangeRequest_StaleApprovalStaysPending(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	id := submitChange(t, mux, `{"map":"testmapalpha01a","kind":"add_code","code":"16"}`)
+	if res := postJSON(t, mux, "/map/code/add", adminToken, `{"map":"testmapalpha01a","codes":["16"]}`); res.Code != http.StatusOK {
+		t.Fatalf("manual add returned %d: %s", res.Code, res.Body)
+	}
+
+	if res := postJSON(t, mux, "/change/decide", adminToken, `{"request":"`+id+`","decision":"approve"}`); res.Code != http.StatusBadRequest {
+		t.Errorf("approving a change already made: want 400, got %d", res.Code)
+	}
+	request, err := testApp.FindRecordById("change_requests", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.GetString("status") != "pending" {
+		t.Errorf("a change that could not be applied should stay pending, got %q", request.GetString("status"))
+	}
+}
+
+func TestChangeRequest_SignedInRequesterIsNotified(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	// The decision email's template is loaded relative to the repo root.
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(origDir) })
+
+	res := postJSON(t, mux, "/change/request", conductorToken, `{"map":"testmapalpha01a","kind":"remove_code","code":"13"}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("change request returned %d: %s", res.Code, res.Body)
+	}
+	var created struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	request, err := testApp.FindRecordById("change_requests", created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.GetString("assignment") != "" || request.GetString("requested_by_user") != "testuseralpha02" {
+		t.Errorf("want no assignment and requested_by_user testuseralpha02, got %q and %q",
+			request.GetString("assignment"), request.GetString("requested_by_user"))
+	}
+
+	res = postJSON(t, mux, "/change/decide", adminToken, `{"request":"`+created.Id+`","decision":"deny"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("deny returned %d: %s", res.Code, res.Body)
+	}
+	var decided struct {
+		EmailSent bool `json:"email_sent"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &decided); err != nil {
+		t.Fatal(err)
+	}
+	if !decided.EmailSent {
+		t.Error("the signed-in requester should be emailed the decision")
+	}
+
+	var queued struct {
+		Cnt int `db:"cnt"`
+	}
+	err = testApp.DB().NewQuery("SELECT COUNT(*) AS cnt FROM email_outbox WHERE recipients LIKE '%conductor@alpha.test%'").One(&queued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued.Cnt != 1 {
+		t.Errorf("want one decision email to conductor@alpha.test, got %d", queued.Cnt)
+	}
+}
@@ -0,0 +1,171 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+type codeSequenceRow struct {
+	Code     string `db:"code"`
+	Sequence int    `db:"sequence"`
+	Floors   int    `db:"floors"`
+}
+
+func mapCodeSequences(t *testing.T, testApp *tests.TestApp, mapID string) map[string]codeSequenceRow {
+	t.Helper()
+
+	var rows []codeSequenceRow
+	err := testApp.DB().NewQuery(`
+		SELECT code, MIN(sequence) AS sequence, COUNT(DISTINCT floor) AS floors
+		FROM addresses WHERE map = {:map} GROUP BY code
+	`).Bind(dbx.Params{"map": mapID}).All(&rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(map[string]codeSequenceRow, len(rows))
+	for _, row := range rows {
+		result[row.Code] = row
+	}
+	return result
+}
+
+// A patterned map skips the excluded units, builds the basement, and numbers
+// codes in natural order; a patterned floor reuses the sequences of codes
+// already on the map and appends new ones.
+func TestCodePattern_NewMapAndFloor(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	mux := buildTestMux(t, testApp)
+
+	res := postJSON(t, mux, "/map/add", adminToken, `{
+		"territory":     "testterralpha01",
+		"congregation":  "testcongalpha01",
+		"type":          "multi",
+		"name":          "Blk 777 Pattern",
+		"coordinates":   "1.3714,103.8494",
+		"code_pattern":  "1..14,!4,!13",
+		"floor_pattern": "-1..3"
+	}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("map/add returned %d: %s", res.Code, res.Body)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	codes := mapCodeSequences(t, testApp, created.ID)
+	if len(codes) != 12 {
+		t.Fatalf("expected 12 codes, got %d", len(codes))
+	}
+	for _, skipped := range []string{"4", "13"} {
+		if _, ok := codes[skipped]; ok {
+			t.Errorf("code %s should have been excluded", skipped)
+		}
+	}
+	for code, want := range map[string]int{"1": 0, "3": 2, "5": 3, "10": 8, "14": 11} {
+		if got := codes[code].Sequence; got != want {
+			t.Errorf("sequence of %s: want %d, got %d", code, want, got)
+		}
+	}
+	if got := codes["1"].Floors; got != 4 {
+		t.Errorf("expected 4 floors (-1, 1, 2, 3), got %d", got)
+	}
+
+	var basement struct {
+		N int `db:"n"`
+	}
+	if err := testApp.DB().NewQuery("SELECT COUNT(*) AS n FROM addresses WHERE map = {:map} AND floor = -1").
+		Bind(dbx.Params{"map": created.ID}).One(&basement); err != nil {
+		t.Fatal(err)
+	}
+	if basement.N != 12 {
+		t.Errorf("expected 12 basement units, got %d", basement.N)
+	}
+
+	res = postJSON(t, mux, "/map/floor/add", adminToken,
+		`{"map":"`+created.ID+`","add_higher":true,"code_pattern":"1..3,15"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("map/floor/add returned %d: %s", res.Code, res.Body)
+	}
+
+	codes = mapCodeSequences(t, testApp, created.ID)
+	if got := codes["2"].Sequence; got != 1 {
+		t.Errorf("existing code 2 must keep sequence 1, got %d", got)
+	}
+	if got := codes["15"].Sequence; got != 12 {
+		t.Errorf("new code 15 should follow the highest sequence, got %d", got)
+	}
+	if got := codes["15"].Floors; got != 1 {
+		t.Errorf("code 15 should exist only on the new floor, got %d floors", got)
+	}
+}
+
+func TestCodePattern_Preview(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:   "preview expands codes in natural order",
+			Method: http.MethodPost,
+			URL:    "/map/codes/preview",
+			Body:   strings.NewReader(`{"code_pattern":"10,9,01..02,1A..1B","floor_pattern":"-1..2"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": adminToken,
+			},
+			TestAppFactory: setupTestApp,
+			ExpectedStatus: http.StatusOK,
+			ExpectedContent: []string{
+				`"codes":[{"code":"01","sequence":0},{"code":"1A","sequence":1},{"code":"1B","sequence":2},{"code":"02","sequence":3},{"code":"9","sequence":4},{"code":"10","sequence":5}]`,
+				`"floors":[-1,1,2]`,
+			},
+		},
+		{
+			Name:   "invalid range is rejected",
+			Method: http.MethodPost,
+			URL:    "/map/codes/preview",
+			Body:   strings.NewReader(`{"code_pattern":"A1..B3"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": adminToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`must vary only in its last number or letter`},
+		},
+		{
+			Name:            "preview requires authentication",
+			Method:          http.MethodPost,
+			URL:             "/map/codes/preview",
+			Body:            strings.NewReader(`{"code_pattern":"1..3"}`),
+			Headers:         map[string]string{"Content-Type": "application/json"},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  401,
+			ExpectedContent: []string{`"data":{}`},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
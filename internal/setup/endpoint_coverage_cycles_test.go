@@ -0,0 +1,302 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"ministry-mapper/internal/handlers"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+func findCoverageCycles(t *testing.T, testApp *tests.TestApp, filter string, params dbx.Params) []*core.Record {
+	t.Helper()
+
+	cycles, err := testApp.FindRecordsByFilter("coverage_cycles", filter, "started_at", 0, 0, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cycles
+}
+
+// markAddressesDone flips the given addresses to done as a field worker would,
+// then recalculates the map synchronously. The bulk_reset flag keeps the async
+// aggregate hook out of the way so the test does not race it.
+func markAddressesDone(t *testing.T, testApp *tests.TestApp, mapID string, addressIDs ...string) {
+	t.Helper()
+
+	testApp.Store().Set("bulk_reset:"+mapID, true)
+	defer testApp.Store().Remove("bulk_reset:" + mapID)
+
+	for _, id := range addressIDs {
+		addr, err := testApp.FindRecordById("addresses", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr.Set("status", "done")
+		addr.Set("updated_by", "Field Worker")
+		if err := testApp.Save(addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := handlers.ProcessMapAggregates(mapID, testApp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A map reset opens a cycle; reaching 100% closes it with its duration,
+// publisher count and breakdown. The territory, having no open cycle, jumps
+// straight to 100% and records a zero-length cycle of its own.
+func TestCoverageCycle_ResetThenCompletion(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	mux := buildTestMux(t, testApp)
+
+	if res := postJSON(t, mux, "/map/reset", adminToken, `{"map":"testmapalpha01a"}`); res.Code != http.StatusOK {
+		t.Fatalf("reset returned %d: %s", res.Code, res.Body)
+	}
+
+	mapCycles := findCoverageCycles(t, testApp, "scope = 'map' && map = {:map}", dbx.Params{"map": "testmapalpha01a"})
+	if len(mapCycles) != 1 {
+		t.Fatalf("expected 1 map cycle after reset, got %d", len(mapCycles))
+	}
+	if got := mapCycles[0].GetString("opened_by"); got != "reset" {
+		t.Errorf("opened_by: want reset, got %q", got)
+	}
+	if !mapCycles[0].GetDateTime("ended_at").IsZero() {
+		t.Error("cycle opened by reset should still be open")
+	}
+
+	// Only 003 and 004 carry a countable option.
+	markAddressesDone(t, testApp, "testmapalpha01a", "testalpha01a003", "testalpha01a004")
+
+	mapCycles = findCoverageCycles(t, testApp, "scope = 'map' && map = {:map}", dbx.Params{"map": "testmapalpha01a"})
+	if len(mapCycles) != 1 {
+		t.Fatalf("completion must close the open cycle, not add one; got %d cycles", len(mapCycles))
+	}
+	cycle := mapCycles[0]
+	if got := cycle.GetString("outcome"); got != "completed" {
+		t.Errorf("outcome: want completed, got %q", got)
+	}
+	if cycle.GetDateTime("ended_at").IsZero() {
+		t.Error("completed cycle should have ended_at set")
+	}
+	if got := cycle.GetInt("publishers"); got != 1 {
+		t.Errorf("publishers: want 1, got %d", got)
+	}
+	var breakdown map[string]any
+	if err := json.Unmarshal([]byte(cycle.GetString("breakdown")), &breakdown); err != nil {
+		t.Fatal(err)
+	}
+	if got := int(breakdown["done"].(float64)); got != 2 {
+		t.Errorf("breakdown.done: want 2, got %d", got)
+	}
+
+	territoryCycles := findCoverageCycles(t, testApp, "scope = 'territory' && territory = {:territory}", dbx.Params{"territory": "testterralpha01"})
+	if len(territoryCycles) != 1 {
+		t.Fatalf("expected 1 territory cycle, got %d", len(territoryCycles))
+	}
+	if got := territoryCycles[0].GetString("outcome"); got != "completed" {
+		t.Errorf("territory outcome: want completed, got %q", got)
+	}
+
+	// Recalculating an already-complete map must not open another cycle.
+	if err := handlers.ProcessMapAggregates("testmapalpha01a", testApp); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(findCoverageCycles(t, testApp, "map = {:map}", dbx.Params{"map": "testmapalpha01a"})); n != 1 {
+		t.Errorf("recalculation at 100%% created extra cycles: got %d", n)
+	}
+
+	res := postJSON(t, mux, "/territory/coverage", adminToken, `{"congregation":"testcongalpha01"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("coverage returned %d: %s", res.Code, res.Body)
+	}
+	var stats []handlers.TerritoryCoverage
+	if err := json.Unmarshal(res.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, s := range stats {
+		if s.Territory != "testterralpha01" {
+			continue
+		}
+		found = true
+		if s.CyclesCovered != 1 {
+			t.Errorf("cycles_covered: want 1, got %d", s.CyclesCovered)
+		}
+		if s.LastCompleted == "" {
+			t.Error("last_completed should be set")
+		}
+		if s.CurrentStarted != "" {
+			t.Errorf("no territory cycle should be open, got current_started %q", s.CurrentStarted)
+		}
+	}
+	if !found {
+		t.Fatal("testterralpha01 missing from coverage stats")
+	}
+}
+
+// A reset while a cycle is open ends it with outcome "reset" and opens a new
+// one; a territory reset does this for the territory and every map in it.
+func TestCoverageCycle_ResetInterruptsOpenCycle(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	mux := buildTestMux(t, testApp)
+
+	if res := postJSON(t, mux, "/map/reset", adminToken, `{"map":"testmapalpha01a"}`); res.Code != http.StatusOK {
+		t.Fatalf("map reset returned %d: %s", res.Code, res.Body)
+	}
+	if res := postJSON(t, mux, "/territory/reset", adminToken, `{"territory":"testterralpha01"}`); res.Code != http.StatusOK {
+		t.Fatalf("territory reset returned %d: %s", res.Code, res.Body)
+	}
+
+	mapCycles := findCoverageCycles(t, testApp, "scope = 'map' && map = {:map}", dbx.Params{"map": "testmapalpha01a"})
+	if len(mapCycles) != 2 {
+		t.Fatalf("expected 2 map cycles, got %d", len(mapCycles))
+	}
+	if got := mapCycles[0].GetString("outcome"); got != "reset" {
+		t.Errorf("first cycle outcome: want reset, got %q", got)
+	}
+	if !mapCycles[1].GetDateTime("ended_at").IsZero() {
+		t.Error("second cycle should be open")
+	}
+
+	// Maps with nothing to reset still start a new cycle with their territory.
+	if n := len(findCoverageCycles(t, testApp, "scope = 'map' && map = {:map} && ended_at = ''", dbx.Params{"map": "testmapalpha01b"})); n != 1 {
+		t.Errorf("expected an open cycle for testmapalpha01b, got %d", n)
+	}
+	if n := len(findCoverageCycles(t, testApp, "scope = 'territory' && territory = {:territory} && ended_at = ''", dbx.Params{"territory": "testterralpha01"})); n != 1 {
+		t.Errorf("expected an open territory cycle, got %d", n)
+	}
+}
+
+// Restoring a reset's snapshot undoes its cycle boundary: the cycle the reset
+// opened is dropped and the one it cut short is reopened. With nothing to
+// reopen, the recalculation must not open a cycle in its place.
+func TestCoverageCycle_RestoreUndoesReset(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	mux := buildTestMux(t, testApp)
+
+	latestSnapshot := func(except string) string {
+		t.Helper()
+		snapshot, err := testApp.FindFirstRecordByFilter("reset_snapshots", "map = 'testmapalpha01a' && id != {:except}", dbx.Params{"except": except})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return snapshot.Id
+	}
+
+	if res := postJSON(t, mux, "/map/reset", adminToken, `{"map":"testmapalpha01a"}`); res.Code != http.StatusOK {
+		t.Fatalf("first reset returned %d: %s", res.Code, res.Body)
+	}
+	firstSnapshot := latestSnapshot("")
+	firstCycle := findCoverageCycles(t, testApp, "map = {:map}", dbx.Params{"map": "testmapalpha01a"})[0].Id
+
+	markAddressesDone(t, testApp, "testmapalpha01a", "testalpha01a003")
+	if res := postJSON(t, mux, "/map/reset", adminToken, `{"map":"testmapalpha01a"}`); res.Code != http.StatusOK {
+		t.Fatalf("second reset returned %d: %s", res.Code, res.Body)
+	}
+	secondSnapshot := latestSnapshot(firstSnapshot)
+
+	if res := postJSON(t, mux, "/reset/restore", adminToken, `{"snapshot":"`+secondSnapshot+`"}`); res.Code != http.StatusOK {
+		t.Fatalf("restore returned %d: %s", res.Code, res.Body)
+	}
+	mapCycles := findCoverageCycles(t, testApp, "map = {:map}", dbx.Params{"map": "testmapalpha01a"})
+	if len(mapCycles) != 1 || mapCycles[0].Id != firstCycle {
+		t.Fatalf("restore should leave only the reopened first cycle, got %d cycles", len(mapCycles))
+	}
+	if !mapCycles[0].GetDateTime("ended_at").IsZero() || mapCycles[0].GetString("outcome") != "" {
+		t.Errorf("first cycle should be open again, got ended_at %v outcome %q", mapCycles[0].GetDateTime("ended_at"), mapCycles[0].GetString("outcome"))
+	}
+
+	if res := postJSON(t, mux, "/reset/restore", adminToken, `{"snapshot":"`+firstSnapshot+`"}`); res.Code != http.StatusOK {
+		t.Fatalf("restore returned %d: %s", res.Code, res.Body)
+	}
+	if n := len(findCoverageCycles(t, testApp, "map = {:map}", dbx.Params{"map": "testmapalpha01a"})); n != 0 {
+		t.Errorf("restoring the first reset should leave no map cycles, got %d", n)
+	}
+}
+
+func TestCoverageCycle_Endpoint(t *testing.T) {
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readonlyToken, err := generateToken("readonly@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:   "conductor can view coverage",
+			Method: http.MethodPost,
+			URL:    "/territory/coverage",
+			Body:   strings.NewReader(`{"congregation":"testcongalpha01"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": conductorToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"territory":"testterralpha01"`, `"cycles_covered":0`},
+		},
+		{
+			Name:   "read-only member cannot view coverage",
+			Method: http.MethodPost,
+			URL:    "/territory/coverage",
+			Body:   strings.NewReader(`{"congregation":"testcongalpha01"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": readonlyToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"Administrator or conductor access required."`},
+		},
+		{
+			Name:   "congregation is required",
+			Method: http.MethodPost,
+			URL:    "/territory/coverage",
+			Body:   strings.NewReader(`{}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": conductorToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"Congregation is required."`},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
@@ -0,0 +1,159 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// addOutboxEmail stores an email_outbox row for congregation (empty for a
+// system email) in the given status.
+func addOutboxEmail(t testing.TB, app core.App, congregation, status string, attempts int) *core.Record {
+	t.Helper()
+
+	col, err := app.FindCollectionByNameOrId("email_outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := core.NewRecord(col)
+	email.Set("congregation", congregation)
+	email.Set("recipients", []map[string]string{{"name": "Alpha Admin", "email": "admin@alpha.test"}})
+	email.Set("subject", "New messages received for Alpha")
+	email.Set("html", "<p>digest</p>")
+	email.Set("status", status)
+	email.Set("attempts", attempts)
+	email.Set("last_error", "421 service unavailable")
+	if err := app.Save(email); err != nil {
+		t.Fatal(err)
+	}
+	return email
+}
+
+func TestEmailOutbox_AdministratorListsAndRetriesFailures(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readOnlyToken, err := generateToken("readonly@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	betaToken, err := generateToken("admin@beta.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	dead := addOutboxEmail(t, testApp, "testcongalpha01", "dead", 8)
+	retrying := addOutboxEmail(t, testApp, "testcongalpha01", "pending", 2)
+	addOutboxEmail(t, testApp, "testcongalpha01", "sent", 1)
+	addOutboxEmail(t, testApp, "testcongalpha01", "pending", 0)
+	system := addOutboxEmail(t, testApp, "", "dead", 8)
+
+	list := func(token, body string) []emailFailure {
+		t.Helper()
+		res := postJSON(t, mux, "/email/failures", token, body)
+		if res.Code != http.StatusOK {
+			t.Fatalf("/email/failures %s returned %d: %s", body, res.Code, res.Body)
+		}
+		var entries []emailFailure
+		if err := json.Unmarshal(res.Body.Bytes(), &entries); err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+
+	entries := list(adminToken, `{"congregation":"testcongalpha01"}`)
+	if ids := failureIds(entries); len(ids) != 2 || !ids[dead.Id] || !ids[retrying.Id] {
+		t.Errorf("want the dead and the retrying email, got %v", ids)
+	}
+	if ids := failureIds(list(adminToken, `{"congregation":"testcongalpha01","status":"dead"}`)); len(ids) != 1 || !ids[dead.Id] {
+		t.Errorf("status dead: got %v", ids)
+	}
+
+	for _, tc := range []struct {
+		name, token, body string
+		want              int
+	}{
+		{"read-only member", readOnlyToken, `{"congregation":"testcongalpha01"}`, http.StatusForbidden},
+		{"other congregation's administrator", betaToken, `{"congregation":"testcongalpha01"}`, http.StatusForbidden},
+		{"system emails without superuser", adminToken, `{"congregation":""}`, http.StatusBadRequest},
+		{"unknown status", adminToken, `{"congregation":"testcongalpha01","status":"sent"}`, http.StatusBadRequest},
+	} {
+		if res := postJSON(t, mux, "/email/failures", tc.token, tc.body); res.Code != tc.want {
+			t.Errorf("%s: want %d, got %d", tc.name, tc.want, res.Code)
+		}
+	}
+
+	if res := postJSON(t, mux, "/email/retry", betaToken, `{"id":"`+dead.Id+`"}`); res.Code != http.StatusForbidden {
+		t.Errorf("retry by another congregation's administrator: want 403, got %d", res.Code)
+	}
+	if res := postJSON(t, mux, "/email/retry", adminToken, `{"id":"`+system.Id+`"}`); res.Code != http.StatusForbidden {
+		t.Errorf("retry of a system email by an administrator: want 403, got %d", res.Code)
+	}
+	if res := postJSON(t, mux, "/email/retry", adminToken, `{"id":"`+dead.Id+`"}`); res.Code != http.StatusOK {
+		t.Fatalf("retry: want 200, got %d: %s", res.Code, res.Body)
+	}
+	requeued, err := testApp.FindRecordById("email_outbox", dead.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued.GetString("status") != "pending" || requeued.GetInt("attempts") != 0 {
+		t.Errorf("retried email: status %q with %d attempts, want pending with 0", requeued.GetString("status"), requeued.GetInt("attempts"))
+	}
+	if res := postJSON(t, mux, "/email/retry", adminToken, `{"id":"`+dead.Id+`"}`); res.Code != http.StatusOK {
+		t.Errorf("retrying a pending email should bring it forward, got %d", res.Code)
+	}
+}
+
+func TestEmailOutbox_SuperuserListsSystemFailures(t *testing.T) {
+	superuserToken, err := generateSuperuserToken("testing_account@ministry-mapper.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	addOutboxEmail(t, testApp, "testcongalpha01", "dead", 8)
+	system := addOutboxEmail(t, testApp, "", "dead", 8)
+
+	res := postJSON(t, mux, "/email/failures", superuserToken, `{}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d: %s", res.Code, res.Body)
+	}
+	var entries []emailFailure
+	if err := json.Unmarshal(res.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if ids := failureIds(entries); len(ids) != 1 || !ids[system.Id] {
+		t.Errorf("want only the system email, got %v", ids)
+	}
+	if entries[0].Recipients[0].Email != "admin@alpha.test" {
+		t.Errorf("recipients: got %+v", entries[0].Recipients)
+	}
+}
+
+type emailFailure struct {
+	Id         string `json:"id"`
+	Status     string `json:"status"`
+	Recipients []struct {
+		Email string `json:"email"`
+	} `json:"recipients"`
+}
+
+func failureIds(entries []emailFailure) map[string]bool {
+	ids := map[string]bool{}
+	for _, entry := range entries {
+		ids[entry.Id] = true
+	}
+	return ids
+}
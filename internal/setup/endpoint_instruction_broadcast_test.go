@@ -0,0 +1,176 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/subscriptions"
+)
+
+func TestInstructionBroadcast_SubscribeNeedsLiveLink(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.Cleanup()
+
+	tests := []struct {
+		sub  string
+		keep bool
+	}{
+		{"instructions/testassignalpha01", true},
+		{"instructions/testassignexprd01", false},
+		{"instructions/nosuchlink00000", false},
+		{"instructions/", false},
+	}
+	for _, tc := range tests {
+		got := runSubscribeHook(t, app, nil, []string{tc.sub})
+		if kept := len(got) == 1 && got[0] == tc.sub; kept != tc.keep {
+			t.Errorf("%s: kept=%v, want %v", tc.sub, kept, tc.keep)
+		}
+	}
+}
+
+func TestInstructionBroadcast_PushAndAcknowledge(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readOnlyToken, err := generateToken("readonly@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	// A publisher's app listening on its link's topic.
+	client := subscriptions.NewDefaultClient()
+	client.Subscribe("instructions/testassignalpha01")
+	testApp.SubscriptionsBroker().Register(client)
+	defer testApp.SubscriptionsBroker().Unregister(client.Id())
+
+	body := `{"scope":"map","target":"testmapalpha01a","message":"Skip block 12 today: lift maintenance."}`
+	if res := postJSON(t, mux, "/instruction/broadcast", readOnlyToken, body); res.Code != http.StatusForbidden {
+		t.Errorf("read-only broadcast: want 403, got %d", res.Code)
+	}
+	res := postJSON(t, mux, "/instruction/broadcast", adminToken, body)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("broadcast returned %d: %s", res.Code, res.Body)
+	}
+	var sent struct {
+		Id         string `json:"id"`
+		Recipients int    `json:"recipients"`
+		Delivered  int    `json:"delivered"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Recipients != 1 || sent.Delivered != 1 {
+		t.Errorf("want 1 recipient (the expired link excluded) delivered live, got %+v", sent)
+	}
+
+	select {
+	case msg := <-client.Channel():
+		var payload struct {
+			Id      string `json:"id"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Name != "instructions/testassignalpha01" || payload.Id != sent.Id {
+			t.Errorf("unexpected realtime message %s: %s", msg.Name, msg.Data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscribed publisher did not receive the broadcast")
+	}
+
+	res = postWithLink(t, mux, "/instruction/pending", "testassignalpha01", `{}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("pending returned %d: %s", res.Code, res.Body)
+	}
+	var pending []struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &pending); err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Id != sent.Id {
+		t.Errorf("pending: want the broadcast, got %s", res.Body)
+	}
+
+	ack := `{"broadcast":"` + sent.Id + `"}`
+	if res := postWithLink(t, mux, "/instruction/ack", "testassignbeta001", ack); res.Code != http.StatusNotFound {
+		t.Errorf("ack from a link not sent the broadcast: want 404, got %d", res.Code)
+	}
+	if res := postWithLink(t, mux, "/instruction/ack", "testassignexprd01", ack); res.Code != http.StatusForbidden {
+		t.Errorf("ack from an expired link: want 403, got %d", res.Code)
+	}
+	if res := postWithLink(t, mux, "/instruction/ack", "testassignalpha01", ack); res.Code != http.StatusOK {
+		t.Fatalf("ack returned %d: %s", res.Code, res.Body)
+	}
+
+	res = postWithLink(t, mux, "/instruction/pending", "testassignalpha01", `{}`)
+	if err := json.Unmarshal(res.Body.Bytes(), &pending); err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("pending after ack: want none, got %s", res.Body)
+	}
+
+	res = postJSON(t, mux, "/instruction/status", adminToken, ack)
+	if res.Code != http.StatusOK {
+		t.Fatalf("status returned %d: %s", res.Code, res.Body)
+	}
+	var status struct {
+		Recipients   int `json:"recipients"`
+		Acknowledged int `json:"acknowledged"`
+		Receipts     []struct {
+			Publisher      string `json:"publisher"`
+			AcknowledgedAt string `json:"acknowledged_at"`
+		} `json:"receipts"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Recipients != 1 || status.Acknowledged != 1 || status.Receipts[0].Publisher != "Test Publisher Alpha" || status.Receipts[0].AcknowledgedAt == "" {
+		t.Errorf("status: want Test Publisher Alpha acknowledged, got %s", res.Body)
+	}
+}
+
+func TestInstructionBroadcast_CongregationScope(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	betaToken, err := generateToken("admin@beta.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	body := `{"scope":"congregation","target":"testcongalpha01","message":"Meeting point moved to the library."}`
+	if res := postJSON(t, mux, "/instruction/broadcast", betaToken, body); res.Code != http.StatusForbidden {
+		t.Errorf("another congregation's admin: want 403, got %d", res.Code)
+	}
+	res := postJSON(t, mux, "/instruction/broadcast", adminToken, body)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("broadcast returned %d: %s", res.Code, res.Body)
+	}
+	var sent struct {
+		Recipients int `json:"recipients"`
+		Delivered  int `json:"delivered"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.Recipients != 3 || sent.Delivered != 0 {
+		t.Errorf("want the 3 live alpha links, none connected, got %+v", sent)
+	}
+}
@@ -0,0 +1,350 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// seedInvitation stores an invitation for token directly, since the real
+// token only ever leaves the server in the invitation email.
+func seedInvitation(t testing.TB, app core.App, id, email, role, token string, expiresAt time.Time) {
+	t.Helper()
+
+	collection, err := app.FindCollectionByNameOrId("invitations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invitation := core.NewRecord(collection)
+	invitation.Id = id
+	invitation.Set("congregation", "testcongalpha01")
+	invitation.Set("email", email)
+	invitation.Set("role", role)
+	invitation.Set("token_hash", security.SHA256(token))
+	invitation.Set("invited_by", "testuseralpha01")
+	invitation.Set("expires_at", expiresAt)
+	if err := app.Save(invitation); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func roleIn(t testing.TB, app core.App, user, congregation string) string {
+	t.Helper()
+	record, err := app.FindFirstRecordByFilter("roles", "user = {:user} && congregation = {:congregation}",
+		dbx.Params{"user": user, "congregation": congregation})
+	if err != nil {
+		return ""
+	}
+	return record.GetString("role")
+}
+
+func TestInvitation_CreateSupersedesPendingAndLogs(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	body := `{"congregation":"testcongalpha01","email":" Newcomer@Example.test ","role":"conductor"}`
+	first := postJSON(t, mux, "/invitation/create", adminToken, body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("create returned %d: %s", first.Code, first.Body)
+	}
+	var created struct {
+		Id    string `json:"id"`
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(first.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Email != "newcomer@example.test" {
+		t.Errorf("email should be normalised, got %q", created.Email)
+	}
+	if strings.Contains(first.Body.String(), "token") {
+		t.Error("the invitation token must only be sent by email")
+	}
+
+	if res := postJSON(t, mux, "/invitation/create", adminToken, body); res.Code != http.StatusCreated {
+		t.Fatalf("re-invite returned %d: %s", res.Code, res.Body)
+	}
+	previous, err := testApp.FindRecordById("invitations", created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous.GetDateTime("revoked_at").IsZero() {
+		t.Error("re-inviting should revoke the earlier pending invitation")
+	}
+
+	res := postJSON(t, mux, "/invitations", adminToken, `{"congregation":"testcongalpha01"}`)
+	var listed []struct {
+		Status    string `json:"status"`
+		InvitedBy string `json:"invited_by"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 2 || listed[0].Status != "pending" || listed[1].Status != "revoked" || listed[0].InvitedBy != "Alpha Admin" {
+		t.Errorf("unexpected invitation list %+v", listed)
+	}
+
+	logs, err := testApp.FindRecordsByFilter("roles_log", "congregation = 'testcongalpha01'", "created", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, l := range logs {
+		actions = append(actions, l.GetString("action"))
+	}
+	if strings.Join(actions, ",") != "invited,invitation_revoked,invited" {
+		t.Errorf("unexpected roles_log actions %v", actions)
+	}
+}
+
+func TestInvitation_AcceptWithToken(t *testing.T) {
+	xcongToken, err := generateToken("xcong@beta.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	seedInvitation(t, testApp, "testinvitation1", "someone.else@example.test", "read_only", "secret-token", time.Now().Add(24*time.Hour))
+	mux := buildTestMux(t, testApp)
+
+	res := postJSON(t, mux, "/invitation/accept", xcongToken, `{"token":"secret-token"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("accept returned %d: %s", res.Code, res.Body)
+	}
+	if role := roleIn(t, testApp, "testuserbeta002", "testcongalpha01"); role != "read_only" {
+		t.Errorf("expected read_only role in alpha, got %q", role)
+	}
+
+	invitation, err := testApp.FindRecordById("invitations", "testinvitation1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invitation.GetString("accepted_by") != "testuserbeta002" {
+		t.Errorf("accepted_by not recorded: %q", invitation.GetString("accepted_by"))
+	}
+
+	logRecord, err := testApp.FindFirstRecordByFilter("roles_log", "invitation = 'testinvitation1' && action = 'granted'")
+	if err != nil {
+		t.Fatalf("grant from invitation not logged: %v", err)
+	}
+	if logRecord.GetString("user") != "testuserbeta002" || logRecord.GetString("changed_by") != "testuseralpha01" {
+		t.Errorf("unexpected grant log %v", logRecord.FieldsData())
+	}
+
+	again := postJSON(t, mux, "/invitation/accept", xcongToken, `{"token":"secret-token"}`)
+	if again.Code != http.StatusBadRequest || !strings.Contains(again.Body.String(), "Invitation is accepted.") {
+		t.Errorf("second accept: %d %s", again.Code, again.Body)
+	}
+}
+
+func TestInvitation_AcceptedOnSignIn(t *testing.T) {
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	users, err := testApp.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newcomer := core.NewRecord(users)
+	newcomer.Id = "testnewcomer001"
+	newcomer.Set("email", "newcomer@example.test")
+	newcomer.Set("verified", true)
+	newcomer.SetPassword("Test1234!")
+	if err := testApp.Save(newcomer); err != nil {
+		t.Fatal(err)
+	}
+	seedInvitation(t, testApp, "testinvitation1", "newcomer@example.test", "conductor", "token-1", time.Now().Add(24*time.Hour))
+	seedInvitation(t, testApp, "testinvitation2", "newcomer@example.test", "administrator", "token-2", time.Now().Add(-time.Hour))
+
+	mux := buildTestMux(t, testApp)
+	res := postJSON(t, mux, "/api/collections/users/auth-with-password", "",
+		`{"identity":"newcomer@example.test","password":"Test1234!"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("sign in returned %d: %s", res.Code, res.Body)
+	}
+
+	if role := roleIn(t, testApp, "testnewcomer001", "testcongalpha01"); role != "conductor" {
+		t.Errorf("the pending invitation should grant conductor, got %q", role)
+	}
+	expired, err := testApp.FindRecordById("invitations", "testinvitation2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expired.GetDateTime("accepted_at").IsZero() {
+		t.Error("an expired invitation must not be accepted")
+	}
+}
+
+func TestInvitation_UnverifiedSignInIsNotProvisioned(t *testing.T) {
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	users, err := testApp.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	impostor := core.NewRecord(users)
+	impostor.Id = "testimpostor001"
+	impostor.Set("email", "newcomer@example.test")
+	impostor.SetPassword("Test1234!")
+	if err := testApp.Save(impostor); err != nil {
+		t.Fatal(err)
+	}
+	seedInvitation(t, testApp, "testinvitation1", "newcomer@example.test", "administrator", "token-1", time.Now().Add(24*time.Hour))
+
+	mux := buildTestMux(t, testApp)
+	postJSON(t, mux, "/api/collections/users/auth-with-password", "",
+		`{"identity":"newcomer@example.test","password":"Test1234!"}`)
+
+	if role := roleIn(t, testApp, "testimpostor001", "testcongalpha01"); role != "" {
+		t.Errorf("an unverified address must not claim an invitation, got role %q", role)
+	}
+}
+
+func TestInvitation_Endpoint(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	xcongToken, err := generateToken("xcong@beta.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withInvitations := func(t testing.TB) *tests.TestApp {
+		app := setupTestApp(t)
+		seedInvitation(t, app, "testinvitation1", "pending@example.test", "read_only", "pending-token", time.Now().Add(24*time.Hour))
+		seedInvitation(t, app, "testinvitation2", "late@example.test", "read_only", "expired-token", time.Now().Add(-time.Hour))
+		return app
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:   "conductor cannot invite",
+			Method: http.MethodPost,
+			URL:    "/invitation/create",
+			Body:   strings.NewReader(`{"congregation":"testcongalpha01","email":"a@example.test","role":"read_only"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": conductorToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"Administrator access required."`},
+		},
+		{
+			Name:   "existing member cannot be invited again",
+			Method: http.MethodPost,
+			URL:    "/invitation/create",
+			Body:   strings.NewReader(`{"congregation":"testcongalpha01","email":"readonly@alpha.test","role":"conductor"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": adminToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"This user already has a role in the congregation."`},
+		},
+		{
+			Name:   "unknown role is rejected",
+			Method: http.MethodPost,
+			URL:    "/invitation/create",
+			Body:   strings.NewReader(`{"congregation":"testcongalpha01","email":"a@example.test","role":"owner"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": adminToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"Role must be read_only, conductor or administrator."`},
+		},
+		{
+			Name:   "expired invitation cannot be accepted",
+			Method: http.MethodPost,
+			URL:    "/invitation/accept",
+			Body:   strings.NewReader(`{"token":"expired-token"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": xcongToken,
+			},
+			TestAppFactory:  withInvitations,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"Invitation is expired."`},
+		},
+		{
+			Name:   "unknown token is not found",
+			Method: http.MethodPost,
+			URL:    "/invitation/accept",
+			Body:   strings.NewReader(`{"token":"guess"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": xcongToken,
+			},
+			TestAppFactory:  withInvitations,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{`"Invitation not found."`},
+		},
+		{
+			Name:   "admin revokes a pending invitation",
+			Method: http.MethodPost,
+			URL:    "/invitation/revoke",
+			Body:   strings.NewReader(`{"invitation":"testinvitation1"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": adminToken,
+			},
+			TestAppFactory:  withInvitations,
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"Invitation revoked"`},
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				invitation, err := app.FindRecordById("invitations", "testinvitation1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if invitation.GetString("revoked_by") != "testuseralpha01" {
+					t.Errorf("revoked_by not recorded: %q", invitation.GetString("revoked_by"))
+				}
+				if _, err := app.FindFirstRecordByFilter("roles_log", "invitation = 'testinvitation1' && action = 'invitation_revoked'"); err != nil {
+					t.Errorf("revocation not logged: %v", err)
+				}
+			},
+		},
+		{
+			Name:   "other congregation's admin cannot revoke",
+			Method: http.MethodPost,
+			URL:    "/invitation/revoke",
+			Body:   strings.NewReader(`{"invitation":"testinvitation1"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": xcongToken,
+			},
+			TestAppFactory:  withInvitations,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"Administrator access required."`},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
@@ -0,0 +1,162 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// scheduleInstruction adds a pinned administrator instruction on
+// testmapalpha01a held back until publishAt.
+func scheduleInstruction(t testing.TB, app core.App, text string, publishAt time.Time) *core.Record {
+	t.Helper()
+
+	col, err := app.FindCollectionByNameOrId("messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := core.NewRecord(col)
+	message.Set("congregation", "testcongalpha01")
+	message.Set("map", "testmapalpha01a")
+	message.Set("message", text)
+	message.Set("created_by", "admin@alpha.test")
+	message.Set("type", "administrator")
+	message.Set("pinned", true)
+	message.Set("publish_at", publishAt)
+	if err := app.Save(message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+// linkMessageIds lists the ids of testmapalpha01a's messages visible to the
+// publisher holding linkId.
+func linkMessageIds(t *testing.T, mux http.Handler, linkId string) map[string]bool {
+	t.Helper()
+
+	path := "/api/collections/messages/records?fields=id&filter=" + url.QueryEscape(`map="testmapalpha01a"`)
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("link-id", linkId)
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("message list returned %d: %s", res.Code, res.Body)
+	}
+	var page struct {
+		Items []struct {
+			Id string `json:"id"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	for _, item := range page.Items {
+		ids[item.Id] = true
+	}
+	return ids
+}
+
+func TestMessageSchedule_HiddenFromPublishersUntilPublished(t *testing.T) {
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	scheduled := scheduleInstruction(t, testApp, "Lift closed from Monday", time.Now().Add(time.Hour))
+
+	if ids := linkMessageIds(t, mux, "testassignalpha01"); ids[scheduled.Id] || !ids["testmsgalphapin1"] {
+		t.Errorf("link-id list: want the pinned notice but not the scheduled one, got %v", ids)
+	}
+	if res := postWithLink(t, mux, "/message/thread", "testassignalpha01", `{"message":"`+scheduled.Id+`"}`); res.Code != http.StatusNotFound {
+		t.Errorf("thread of a scheduled message via link-id: want 404, got %d", res.Code)
+	}
+
+	scheduled, err := testApp.FindRecordById("messages", scheduled.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduled.Set("published_at", time.Now())
+	if err := testApp.Save(scheduled); err != nil {
+		t.Fatal(err)
+	}
+	if ids := linkMessageIds(t, mux, "testassignalpha01"); !ids[scheduled.Id] {
+		t.Errorf("link-id list: want the published message, got %v", ids)
+	}
+
+	// Rescheduling holds it back again.
+	scheduled, err = testApp.FindRecordById("messages", scheduled.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduled.Set("publish_at", time.Now().Add(2*time.Hour))
+	if err := testApp.Save(scheduled); err != nil {
+		t.Fatal(err)
+	}
+	if !scheduled.GetDateTime("published_at").IsZero() {
+		t.Error("moving publish_at should clear published_at")
+	}
+}
+
+func TestMessageSchedule_Validation(t *testing.T) {
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	message, err := testApp.FindRecordById("messages", "testmsgalpha01a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message.Set("pin_until", time.Now().Add(time.Hour))
+	if err := testApp.Save(message); err == nil {
+		t.Error("pin_until on a publisher message should be rejected")
+	}
+
+	pinned, err := testApp.FindRecordById("messages", "testmsgalphapin1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinned.Set("publish_at", time.Now().Add(2*time.Hour))
+	pinned.Set("pin_until", time.Now().Add(time.Hour))
+	if err := testApp.Save(pinned); err == nil {
+		t.Error("pin_until before publish_at should be rejected")
+	}
+}
+
+func TestMessageSchedule_LapsedPinIsNotFlagged(t *testing.T) {
+	scenarios := []tests.ApiScenario{
+		{
+			Name:   "pinned notice past pin_until does not set has_pinned_messages",
+			Method: http.MethodPost,
+			URL:    "/link/map",
+			Headers: map[string]string{
+				"Content-Type": "application/json",
+				"link-id":      "testassignalpha01",
+			},
+			TestAppFactory: func(t testing.TB) *tests.TestApp {
+				app := setupTestApp(t)
+				pinned, err := app.FindRecordById("messages", "testmsgalphapin1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				pinned.Set("pin_until", time.Now().Add(-time.Minute))
+				if err := app.Save(pinned); err != nil {
+					t.Fatal(err)
+				}
+				return app
+			},
+			ExpectedStatus:  200,
+			ExpectedContent: []string{`"has_pinned_messages":false`},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
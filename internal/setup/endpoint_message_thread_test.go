@@ -0,0 +1,194 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// postWithLink posts body to path as the publisher holding linkId.
+func postWithLink(t *testing.T, mux http.Handler, path, linkId, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("link-id", linkId)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestMessageThread_RepliesAndReadReceipts(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	res := postJSON(t, mux, "/message/reply", adminToken, `{"message":"testmsgalpha01a","text":"Thanks, we'll check the gate."}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("admin reply returned %d: %s", res.Code, res.Body)
+	}
+	var adminReply struct {
+		Id     string `json:"id"`
+		Parent string `json:"parent"`
+		Type   string `json:"type"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &adminReply); err != nil {
+		t.Fatal(err)
+	}
+	if adminReply.Parent != "testmsgalpha01a" || adminReply.Type != "administrator" {
+		t.Errorf("admin reply: want parent testmsgalpha01a type administrator, got %+v", adminReply)
+	}
+
+	// Replying to a reply joins the root's thread.
+	res = postWithLink(t, mux, "/message/reply", "testassignalpha01", `{"message":"`+adminReply.Id+`","text":"It was open this morning."}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("publisher reply returned %d: %s", res.Code, res.Body)
+	}
+	publisherReply, err := testApp.FindFirstRecordByData("messages", "message", "It was open this morning.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publisherReply.GetString("parent") != "testmsgalpha01a" || publisherReply.GetString("type") != "publisher" {
+		t.Errorf("publisher reply: want parent testmsgalpha01a type publisher, got parent %q type %q",
+			publisherReply.GetString("parent"), publisherReply.GetString("type"))
+	}
+	if got := publisherReply.GetString("created_by"); got != "Test Publisher Alpha" {
+		t.Errorf("publisher reply created_by: want assignment publisher, got %q", got)
+	}
+
+	if res := postWithLink(t, mux, "/message/reply", "testassignexprd01", `{"message":"testmsgalpha01a","text":"Late"}`); res.Code != http.StatusForbidden {
+		t.Errorf("expired link: want 403, got %d", res.Code)
+	}
+	if res := postWithLink(t, mux, "/message/reply", "testassignbeta001", `{"message":"testmsgalpha01a","text":"Wrong map"}`); res.Code != http.StatusForbidden {
+		t.Errorf("link for another map: want 403, got %d", res.Code)
+	}
+
+	// The admin has read only their own reply so far; marking the thread
+	// read adds the root and the publisher's reply.
+	res = postJSON(t, mux, "/message/read", adminToken, `{"message":"testmsgalpha01a"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("mark read returned %d: %s", res.Code, res.Body)
+	}
+	var marked struct {
+		Marked int `json:"marked"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &marked); err != nil {
+		t.Fatal(err)
+	}
+	if marked.Marked != 2 {
+		t.Errorf("mark read: want 2 new receipts, got %d", marked.Marked)
+	}
+	res = postJSON(t, mux, "/message/read", adminToken, `{"message":"testmsgalpha01a"}`)
+	if err := json.Unmarshal(res.Body.Bytes(), &marked); err != nil {
+		t.Fatal(err)
+	}
+	if marked.Marked != 0 {
+		t.Errorf("marking again: want 0 new receipts, got %d", marked.Marked)
+	}
+
+	res = postWithLink(t, mux, "/message/thread", "testassignalpha01", `{"message":"testmsgalpha01a"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("get thread returned %d: %s", res.Code, res.Body)
+	}
+	var thread struct {
+		Messages []struct {
+			Id     string `json:"id"`
+			ReadBy []struct {
+				Reader string `json:"reader"`
+			} `json:"read_by"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &thread); err != nil {
+		t.Fatal(err)
+	}
+	if len(thread.Messages) != 3 || thread.Messages[0].Id != "testmsgalpha01a" {
+		t.Fatalf("thread: want root then 2 replies, got %s", res.Body)
+	}
+	readers := map[string][]string{}
+	for _, m := range thread.Messages {
+		for _, r := range m.ReadBy {
+			readers[m.Id] = append(readers[m.Id], r.Reader)
+		}
+	}
+	if got := readers[publisherReply.Id]; len(got) != 2 {
+		t.Errorf("publisher reply: want read by its author and the admin, got %v", got)
+	}
+	if got := readers["testmsgalpha01a"]; len(got) != 1 || got[0] != "Alpha Admin" {
+		t.Errorf("root: want read by Alpha Admin only, got %v", got)
+	}
+}
+
+func TestMessageThread_ResolveAndReopen(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	body := `{"message":"testmsgalpha01a"}`
+	if res := postJSON(t, mux, "/message/resolve", conductorToken, body); res.Code != http.StatusForbidden {
+		t.Errorf("conductor: want 403, got %d", res.Code)
+	}
+	if res := postJSON(t, mux, "/message/resolve", adminToken, body); res.Code != http.StatusOK {
+		t.Fatalf("resolve returned %d: %s", res.Code, res.Body)
+	}
+	if res := postJSON(t, mux, "/message/resolve", adminToken, body); res.Code != http.StatusBadRequest {
+		t.Errorf("resolving twice: want 400, got %d", res.Code)
+	}
+
+	root, err := testApp.FindRecordById("messages", "testmsgalpha01a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.GetDateTime("resolved_at").IsZero() || root.GetString("resolved_by") != "testuseralpha01" {
+		t.Errorf("want resolved by testuseralpha01, got at %v by %q", root.GetDateTime("resolved_at"), root.GetString("resolved_by"))
+	}
+
+	if res := postWithLink(t, mux, "/message/reply", "testassignalpha01", `{"message":"testmsgalpha01a","text":"Gate is locked again."}`); res.Code != http.StatusCreated {
+		t.Fatalf("reply returned %d: %s", res.Code, res.Body)
+	}
+	root, err = testApp.FindRecordById("messages", "testmsgalpha01a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !root.GetDateTime("resolved_at").IsZero() || root.GetString("resolved_by") != "" {
+		t.Error("a new reply should reopen the thread")
+	}
+}
+
+func TestMessageThread_RepliesMustStayOnTheThreadMap(t *testing.T) {
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	collection, err := testApp.FindCollectionByNameOrId("messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := core.NewRecord(collection)
+	reply.Set("congregation", "testcongalpha01")
+	reply.Set("map", "testmapalpha01b")
+	reply.Set("message", "Wrong map")
+	reply.Set("type", "publisher")
+	reply.Set("parent", "testmsgalpha01a")
+	if err := testApp.Save(reply); err == nil {
+		t.Error("a reply on a different map from its thread should be rejected")
+	}
+}
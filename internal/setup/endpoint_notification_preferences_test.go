@@ -0,0 +1,112 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"ministry-mapper/internal/handlers"
+)
+
+type notificationPreferences struct {
+	Muted      []string `json:"muted"`
+	Frequency  string   `json:"frequency"`
+	QuietStart string   `json:"quiet_start"`
+	QuietEnd   string   `json:"quiet_end"`
+}
+
+func TestNotificationPreferences_MemberUpdatesOwnPreferences(t *testing.T) {
+	readOnlyToken, err := generateToken("readonly@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	betaToken, err := generateToken("admin@beta.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	get := func() notificationPreferences {
+		t.Helper()
+		res := postJSON(t, mux, "/notification/preferences", readOnlyToken, `{"congregation":"testcongalpha01"}`)
+		if res.Code != http.StatusOK {
+			t.Fatalf("/notification/preferences returned %d: %s", res.Code, res.Body)
+		}
+		var prefs notificationPreferences
+		if err := json.Unmarshal(res.Body.Bytes(), &prefs); err != nil {
+			t.Fatal(err)
+		}
+		return prefs
+	}
+
+	if prefs := get(); prefs.Frequency != "immediate" || len(prefs.Muted) != 0 {
+		t.Errorf("defaults: got %+v", prefs)
+	}
+
+	update := `{"congregation":"testcongalpha01","muted":["instructions"],"frequency":"weekly","quiet_start":"22:00","quiet_end":"07:00"}`
+	if res := postJSON(t, mux, "/notification/update", readOnlyToken, update); res.Code != http.StatusOK {
+		t.Fatalf("/notification/update returned %d: %s", res.Code, res.Body)
+	}
+	if prefs := get(); prefs.Frequency != "weekly" || !slices.Equal(prefs.Muted, []string{"instructions"}) || prefs.QuietStart != "22:00" || prefs.QuietEnd != "07:00" {
+		t.Errorf("after update: got %+v", prefs)
+	}
+
+	for _, tc := range []struct {
+		name, token, body string
+		want              int
+	}{
+		{"unknown kind", readOnlyToken, `{"congregation":"testcongalpha01","muted":["reports"]}`, http.StatusBadRequest},
+		{"unknown frequency", readOnlyToken, `{"congregation":"testcongalpha01","frequency":"hourly"}`, http.StatusBadRequest},
+		{"half-set quiet hours", readOnlyToken, `{"congregation":"testcongalpha01","quiet_start":"22:00"}`, http.StatusBadRequest},
+		{"malformed quiet hours", readOnlyToken, `{"congregation":"testcongalpha01","quiet_start":"9:00","quiet_end":"10:00"}`, http.StatusBadRequest},
+		{"another congregation", betaToken, `{"congregation":"testcongalpha01"}`, http.StatusForbidden},
+	} {
+		if res := postJSON(t, mux, "/notification/update", tc.token, tc.body); res.Code != tc.want {
+			t.Errorf("%s: want %d, got %d", tc.name, tc.want, res.Code)
+		}
+	}
+}
+
+func TestNotificationPreferences_UnsubscribeByToken(t *testing.T) {
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	record, err := handlers.EnsureNotificationPreference(testApp, "testuseralpha01", "testcongalpha01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := record.GetString("unsubscribe_token")
+
+	if res := postJSON(t, mux, "/notification/unsubscribe", "", `{"token":"not-a-token"}`); res.Code != http.StatusNotFound {
+		t.Errorf("unknown token: want 404, got %d", res.Code)
+	}
+	if res := postJSON(t, mux, "/notification/unsubscribe", "", `{"token":"`+token+`","kind":"notes"}`); res.Code != http.StatusOK {
+		t.Fatalf("unsubscribe from notes: want 200, got %d: %s", res.Code, res.Body)
+	}
+	record, _ = testApp.FindRecordById("notification_preferences", record.Id)
+	if muted := record.GetStringSlice("muted"); !slices.Equal(muted, []string{"notes"}) {
+		t.Errorf("after muting notes: got %v", muted)
+	}
+
+	res := postJSON(t, mux, "/notification/unsubscribe", "", `{"token":"`+token+`"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("unsubscribe from all: want 200, got %d", res.Code)
+	}
+	var body struct {
+		CongregationName string   `json:"congregation_name"`
+		Muted            []string `json:"muted"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Muted) != len(handlers.NotificationKinds) || body.CongregationName == "" {
+		t.Errorf("unsubscribe from all: got %+v", body)
+	}
+}
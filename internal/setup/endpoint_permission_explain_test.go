@@ -0,0 +1,137 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+type explainResponse struct {
+	Decision string `json:"decision"`
+	Reason   string `json:"reason"`
+	Checks   []struct {
+		Check  string `json:"check"`
+		Passed bool   `json:"passed"`
+	} `json:"checks"`
+}
+
+func explain(t *testing.T, mux http.Handler, token, body string) explainResponse {
+	t.Helper()
+
+	res := postJSON(t, mux, "/access/explain", token, body)
+	if res.Code != http.StatusOK {
+		t.Fatalf("explain %s returned %d: %s", body, res.Code, res.Body)
+	}
+	var out explainResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func failedCheck(r explainResponse) string {
+	for _, c := range r.Checks {
+		if !c.Passed {
+			return c.Check
+		}
+	}
+	return ""
+}
+
+func TestPermissionExplain_RolePath(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	superuserToken, err := generateSuperuserToken("testing_account@ministry-mapper.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	scopeConductorTo(t, testApp, "testterralpha01")
+	mux := buildTestMux(t, testApp)
+
+	if res := postJSON(t, mux, "/access/explain", conductorToken,
+		`{"user":"testuseralpha03","collection":"maps","record":"testmapalpha01a"}`); res.Code != http.StatusForbidden {
+		t.Errorf("conductor: want 403, got %d", res.Code)
+	}
+
+	got := explain(t, mux, adminToken, `{"user":"testuseralpha02","collection":"maps","record":"testmapalpha01a"}`)
+	if got.Decision != "allow" {
+		t.Errorf("scoped conductor viewing a map in their territory: want allow, got %+v", got)
+	}
+
+	got = explain(t, mux, adminToken, `{"user":"testuseralpha02","collection":"maps","record":"testmapalpha02a"}`)
+	if got.Decision != "deny" || failedCheck(got) != "role_coverage" {
+		t.Errorf("scoped conductor viewing a map outside their territory: want deny on role_coverage, got %+v", got)
+	}
+
+	for _, subject := range []string{`"user":"testuserbeta002"`, `"user":"nosuchuser00001"`, `"link_id":"testassignbeta001"`} {
+		if res := postJSON(t, mux, "/access/explain", adminToken,
+			`{`+subject+`,"collection":"maps","record":"testmapalpha01a"}`); res.Code != http.StatusNotFound {
+			t.Errorf("subject %s outside the congregation: want 404, got %d", subject, res.Code)
+		}
+	}
+	got = explain(t, mux, superuserToken, `{"user":"testuserbeta002","collection":"maps","record":"testmapalpha01a"}`)
+	if got.Decision != "deny" || failedCheck(got) != "role_lookup" {
+		t.Errorf("superuser explaining a member of another congregation: want deny on role_lookup, got %+v", got)
+	}
+
+	if res := postJSON(t, mux, "/access/explain", adminToken,
+		`{"user":"testuserbeta002","collection":"maps","record":"testmapbeta001a"}`); res.Code != http.StatusForbidden {
+		t.Errorf("explaining another congregation's record: want 403, got %d", res.Code)
+	}
+	got = explain(t, mux, superuserToken, `{"user":"testuserbeta002","collection":"maps","record":"testmapbeta001a","action":"edit"}`)
+	if got.Decision != "deny" || failedCheck(got) != "role_coverage" {
+		t.Errorf("a conductor editing a map: want deny on role_coverage, got %+v", got)
+	}
+}
+
+func TestPermissionExplain_LinkAndFilter(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	got := explain(t, mux, adminToken, `{"link_id":"testassignalpha01","collection":"maps","record":"testmapalpha01a"}`)
+	if got.Decision != "allow" {
+		t.Errorf("live link for the map: want allow, got %+v", got)
+	}
+
+	got = explain(t, mux, adminToken, `{"link_id":"testassignexprd01","collection":"maps","record":"testmapalpha01a"}`)
+	if got.Decision != "deny" || failedCheck(got) != "link_expiry" {
+		t.Errorf("expired link: want deny on link_expiry, got %+v", got)
+	}
+
+	got = explain(t, mux, adminToken, `{"link_id":"testassignalpha01","collection":"maps","record":"testmapalpha02a"}`)
+	if got.Decision != "deny" || failedCheck(got) != "link_coverage" {
+		t.Errorf("link for another map: want deny on link_coverage, got %+v", got)
+	}
+
+	got = explain(t, mux, adminToken, `{"link_id":"testassignalpha01","collection":"maps","record":"testmapalpha01a","action":"edit"}`)
+	if got.Decision != "deny" {
+		t.Errorf("links cannot edit maps, got %+v", got)
+	}
+
+	got = explain(t, mux, adminToken, `{"link_id":"testassignalpha01","collection":"addresses","record":"testalpha01a001","filter":"map = 'testmapalpha01a'"}`)
+	if got.Decision != "allow" {
+		t.Errorf("filter on the link's map: want allow, got %+v", got)
+	}
+
+	got = explain(t, mux, adminToken, `{"link_id":"testassignalpha01","collection":"addresses","record":"testalpha01a001","filter":"map = 'testmapalpha01a' || map != ''"}`)
+	if got.Decision != "deny" || failedCheck(got) != "filter_scope" {
+		t.Errorf("filter escaping the link's map: want deny on filter_scope, got %+v", got)
+	}
+}
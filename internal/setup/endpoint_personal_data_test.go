@@ -0,0 +1,255 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// attributeToReadOnly writes the alpha read-only user's name into free-text
+// attributions in alpha, and into one beta address where it must not match.
+// Only the assignment and the change request are tied to the user by id.
+func attributeToReadOnly(t testing.TB, app core.App) {
+	t.Helper()
+
+	for _, u := range []struct {
+		table, field, id string
+	}{
+		{"addresses", "updated_by", "testalpha01a001"},
+		{"addresses", "updated_by", "testbeta001a001"},
+		{"messages", "created_by", "testmsgalpha01a"},
+	} {
+		if _, err := app.DB().Update(u.table, dbx.Params{u.field: "Alpha ReadOnly"}, dbx.HashExp{"id": u.id}).Execute(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := app.DB().Update("assignments", dbx.Params{"user": "testuseralpha03"}, dbx.HashExp{"id": "testassignalpha01"}).Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A change request raised while signed in, under a different name.
+	requests, err := app.FindCollectionByNameOrId("change_requests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := core.NewRecord(requests)
+	request.Id = "testchgreqro001"
+	request.Set("congregation", "testcongalpha01")
+	request.Set("map", "testmapalpha01a")
+	request.Set("requested_by", "RO")
+	request.Set("requested_by_user", "testuseralpha03")
+	request.Set("kind", "remove_code")
+	request.Set("code", "13")
+	request.Set("status", "pending")
+	if err := app.Save(request); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPersonalData_ExportBundlesAttributedRecords(t *testing.T) {
+	token, err := generateToken("readonly@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	attributeToReadOnly(t, testApp)
+	mux := buildTestMux(t, testApp)
+
+	res := postJSON(t, mux, "/account/export", token, `{}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("export returned %d: %s", res.Code, res.Body)
+	}
+	var body struct {
+		Account struct {
+			Email string `json:"email"`
+		} `json:"account"`
+		Records map[string][]struct {
+			Id string `json:"id"`
+		} `json:"records"`
+		PossibleMatches map[string][]map[string]any `json:"possible_matches"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Account.Email != "readonly@alpha.test" {
+		t.Errorf("account email: got %q", body.Account.Email)
+	}
+
+	ids := func(collection string) []string {
+		var out []string
+		for _, r := range body.Records[collection] {
+			out = append(out, r.Id)
+		}
+		return out
+	}
+	// Name-only matches could be someone else's: listed, never exported.
+	if got := ids("addresses"); len(got) != 0 {
+		t.Errorf("addresses matched by name alone must not be exported, got %v", got)
+	}
+	if got := ids("messages"); len(got) != 0 {
+		t.Errorf("messages matched by name alone must not be exported, got %v", got)
+	}
+	if got := body.PossibleMatches["addresses"]; len(got) != 1 || got[0]["id"] != "testalpha01a001" {
+		t.Errorf("possible address matches: want only the alpha address, got %v", got)
+	} else if _, leaked := got[0]["updated_by"]; leaked {
+		t.Errorf("possible matches must not carry record contents, got %v", got[0])
+	}
+	if got := body.PossibleMatches["messages"]; len(got) != 1 || got[0]["id"] != "testmsgalpha01a" {
+		t.Errorf("possible message matches: got %v", got)
+	}
+	if got := ids("assignments"); len(got) != 1 || got[0] != "testassignalpha01" {
+		t.Errorf("assignments: got %v", got)
+	}
+	if got := ids("change_requests"); len(got) != 1 || got[0] != "testchgreqro001" {
+		t.Errorf("change_requests: want the signed-in request, got %v", got)
+	}
+	if got := ids("roles"); len(got) != 1 || got[0] != "testrolexcng01c" {
+		t.Errorf("roles: got %v", got)
+	}
+}
+
+func TestPersonalData_ErasurePseudonymisesAndDeletes(t *testing.T) {
+	userToken, err := generateToken("readonly@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	betaAdminToken, err := generateToken("admin@beta.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	attributeToReadOnly(t, testApp)
+	mux := buildTestMux(t, testApp)
+
+	mapBefore, err := testApp.FindRecordById("maps", "testmapalpha01a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := postJSON(t, mux, "/account/erasure/request", userToken, `{"reason":"moving away"}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("request returned %d: %s", res.Code, res.Body)
+	}
+	var created struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if res := postJSON(t, mux, "/account/erasure/request", userToken, `{}`); res.Code != http.StatusBadRequest {
+		t.Errorf("second pending request: want 400, got %d", res.Code)
+	}
+
+	res = postJSON(t, mux, "/account/erasure/requests", adminToken, `{"congregation":"testcongalpha01"}`)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), created.Id) {
+		t.Fatalf("alpha admin should see the request, got %d: %s", res.Code, res.Body)
+	}
+	var listed []struct {
+		Id          string `json:"id"`
+		NameMatches []struct {
+			Collection string   `json:"collection"`
+			Id         string   `json:"id"`
+			Fields     []string `json:"fields"`
+		} `json:"name_matches"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	matched := map[string]bool{}
+	for _, m := range listed[0].NameMatches {
+		matched[m.Collection+"/"+m.Id] = true
+	}
+	if len(matched) != 2 || !matched["addresses/testalpha01a001"] || !matched["messages/testmsgalpha01a"] {
+		t.Errorf("name matches: want the alpha address and message, got %+v", listed[0].NameMatches)
+	}
+
+	if res := postJSON(t, mux, "/account/erasure/confirm", adminToken,
+		`{"request":"`+created.Id+`","rewrite":[{"collection":"addresses","id":"testalpha01a002"}]}`); res.Code != http.StatusBadRequest {
+		t.Errorf("rewriting a record that is not a name match: want 400, got %d", res.Code)
+	}
+
+	// The message is left to stand for another member who shares the name.
+	confirm := `{"request":"` + created.Id + `","rewrite":[{"collection":"addresses","id":"testalpha01a001"}]}`
+	if res := postJSON(t, mux, "/account/erasure/confirm", conductorToken, confirm); res.Code != http.StatusForbidden {
+		t.Errorf("conductor: want 403, got %d", res.Code)
+	}
+	if res := postJSON(t, mux, "/account/erasure/confirm", betaAdminToken, confirm); res.Code != http.StatusForbidden {
+		t.Errorf("admin of another congregation: want 403, got %d", res.Code)
+	}
+	res = postJSON(t, mux, "/account/erasure/confirm", adminToken, confirm)
+	if res.Code != http.StatusOK {
+		t.Fatalf("confirm returned %d: %s", res.Code, res.Body)
+	}
+	var done struct {
+		Pseudonym string `json:"pseudonym"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &done); err != nil {
+		t.Fatal(err)
+	}
+	if done.Pseudonym == "" {
+		t.Fatal("want a pseudonym in the response")
+	}
+
+	if _, err := testApp.FindRecordById("users", "testuseralpha03"); err == nil {
+		t.Error("the account should be deleted")
+	}
+	if _, err := testApp.FindRecordById("roles", "testrolexcng01c"); err == nil {
+		t.Error("the account's roles should be deleted")
+	}
+
+	for _, c := range []struct {
+		collection, id, field, want string
+	}{
+		{"addresses", "testalpha01a001", "updated_by", done.Pseudonym},
+		{"addresses", "testbeta001a001", "updated_by", "Alpha ReadOnly"},
+		{"messages", "testmsgalpha01a", "created_by", "Alpha ReadOnly"},
+		{"assignments", "testassignalpha01", "publisher", done.Pseudonym},
+		{"change_requests", "testchgreqro001", "requested_by", done.Pseudonym},
+		{"assignments", "testassignalpha01", "user", ""},
+	} {
+		record, err := testApp.FindRecordById(c.collection, c.id)
+		if err != nil {
+			t.Fatalf("%s %s should survive erasure: %v", c.collection, c.id, err)
+		}
+		if got := record.GetString(c.field); got != c.want {
+			t.Errorf("%s %s.%s = %q, want %q", c.collection, c.id, c.field, got, c.want)
+		}
+	}
+
+	mapAfter, err := testApp.FindRecordById("maps", "testmapalpha01a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapAfter.GetString("aggregates") != mapBefore.GetString("aggregates") {
+		t.Errorf("map aggregates changed: %q -> %q", mapBefore.GetString("aggregates"), mapAfter.GetString("aggregates"))
+	}
+
+	request, err := testApp.FindRecordById("erasure_requests", created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.GetString("status") != "completed" || request.GetString("reason") != "" {
+		t.Errorf("request should be completed with its reason cleared, got %v", request.PublicExport())
+	}
+	if _, err := testApp.FindFirstRecordByFilter("roles_log", "action = 'erased' && congregation = 'testcongalpha01'"); err != nil {
+		t.Errorf("erasure should be logged to roles_log: %v", err)
+	}
+}
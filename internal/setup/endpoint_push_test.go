@@ -0,0 +1,325 @@
+//go:build testdata
+
+package setup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ministry-mapper/internal/handlers"
+	"ministry-mapper/internal/jobs"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// pushBrowser is a browser's push subscription together with the push
+// service it points at, which decrypts and records what it is sent.
+type pushBrowser struct {
+	*httptest.Server
+	private *ecdh.PrivateKey
+	auth    []byte
+	status  int
+
+	mu       sync.Mutex
+	received []handlers.PushNotification
+}
+
+// enablePush configures a fresh VAPID key and lets pushes reach test servers.
+func enablePush(t *testing.T) {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := private.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VAPID_PRIVATE_KEY", base64.RawURLEncoding.EncodeToString(raw))
+	t.Setenv("VAPID_SUBJECT", "mailto:admin@example.com")
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+}
+
+func newPushBrowser(t *testing.T) *pushBrowser {
+	t.Helper()
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &pushBrowser{private: private, auth: make([]byte, 16), status: http.StatusCreated}
+	rand.Read(b.auth)
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "vapid t=") || req.Header.Get("Content-Encoding") != "aes128gcm" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n, err := b.decrypt(body)
+		if err != nil {
+			t.Errorf("push payload does not decrypt: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b.mu.Lock()
+		b.received = append(b.received, n)
+		status := b.status
+		b.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(b.Close)
+	return b
+}
+
+// subscription is the body the browser's app posts to /push/subscribe.
+func (b *pushBrowser) subscription(path string) string {
+	body, _ := json.Marshal(handlers.PushSubscribeRequest{
+		Endpoint: b.URL + path,
+		Keys: handlers.PushKeys{
+			P256dh: base64.RawURLEncoding.EncodeToString(b.private.PublicKey().Bytes()),
+			Auth:   base64.RawURLEncoding.EncodeToString(b.auth),
+		},
+	})
+	return string(body)
+}
+
+// decrypt reverses RFC 8291 aes128gcm encryption as a browser would.
+func (b *pushBrowser) decrypt(body []byte) (handlers.PushNotification, error) {
+	var n handlers.PushNotification
+	salt, idLen := body[:16], int(body[20])
+	asPublic, err := ecdh.P256().NewPublicKey(body[21 : 21+idLen])
+	if err != nil {
+		return n, err
+	}
+	shared, err := b.private.ECDH(asPublic)
+	if err != nil {
+		return n, err
+	}
+	info := "WebPush: info\x00" + string(b.private.PublicKey().Bytes()) + string(asPublic.Bytes())
+	ikm, _ := hkdf.Key(sha256.New, shared, b.auth, info, 32)
+	prk, _ := hkdf.Extract(sha256.New, ikm, salt)
+	cek, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return n, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return n, err
+	}
+	plain, err := gcm.Open(nil, nonce, body[21+idLen:], nil)
+	if err != nil {
+		return n, err
+	}
+	err = json.Unmarshal(plain[:len(plain)-1], &n)
+	return n, err
+}
+
+// waitFor returns the first notification of kind, waiting for background
+// pushes to arrive.
+func (b *pushBrowser) waitFor(t *testing.T, kind string) handlers.PushNotification {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		for _, n := range b.received {
+			if n.Kind == kind {
+				b.mu.Unlock()
+				return n
+			}
+		}
+		b.mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("no %s notification received", kind)
+	return handlers.PushNotification{}
+}
+
+func TestPush_KeyIsPublishedWhenConfigured(t *testing.T) {
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	t.Setenv("VAPID_PRIVATE_KEY", "")
+	if res := postJSON(t, mux, "/push/key", "", `{}`); !strings.Contains(res.Body.String(), `"enabled":false`) {
+		t.Errorf("unconfigured: %s", res.Body)
+	}
+	if res := postWithLink(t, mux, "/push/subscribe", "testassignalpha01", newPushBrowser(t).subscription("/a")); res.Code != http.StatusBadRequest {
+		t.Errorf("subscribing without VAPID keys: want 400, got %d", res.Code)
+	}
+
+	enablePush(t)
+	res := postJSON(t, mux, "/push/key", "", `{}`)
+	var key struct {
+		Enabled   bool   `json:"enabled"`
+		PublicKey string `json:"public_key"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &key); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := base64.RawURLEncoding.DecodeString(key.PublicKey); !key.Enabled || len(raw) != 65 {
+		t.Errorf("want an uncompressed P-256 key, got %+v", key)
+	}
+}
+
+func TestPush_LinkPublisherReceivesBroadcastInstructions(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enablePush(t)
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	browser := newPushBrowser(t)
+	for _, tc := range []struct {
+		name, link, body string
+		want             int
+	}{
+		{"no link or sign-in", "", browser.subscription("/sub"), http.StatusUnauthorized},
+		{"expired link", "testassignexprd01", browser.subscription("/sub"), http.StatusForbidden},
+		{"bad keys", "testassignalpha01", `{"endpoint":"` + browser.URL + `/sub","keys":{"p256dh":"abc","auth":"def"}}`, http.StatusBadRequest},
+	} {
+		if res := postWithLink(t, mux, "/push/subscribe", tc.link, tc.body); res.Code != tc.want {
+			t.Errorf("%s: want %d, got %d", tc.name, tc.want, res.Code)
+		}
+	}
+
+	if res := postWithLink(t, mux, "/push/subscribe", "testassignalpha01", browser.subscription("/sub")); res.Code != http.StatusOK {
+		t.Fatalf("/push/subscribe returned %d: %s", res.Code, res.Body)
+	}
+	// Subscribing again refreshes rather than duplicates.
+	if res := postWithLink(t, mux, "/push/subscribe", "testassignalpha01", browser.subscription("/sub")); res.Code != http.StatusOK {
+		t.Fatalf("second /push/subscribe returned %d", res.Code)
+	}
+	if subs, _ := testApp.FindAllRecords("push_subscriptions"); len(subs) != 1 || subs[0].GetString("assignment") != "testassignalpha01" {
+		t.Fatalf("want one subscription for the link, got %d", len(subs))
+	}
+
+	// The title comes from the congregation's catalog, loaded relative to the
+	// repo root.
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(origDir) })
+	congregation, err := testApp.FindRecordById("congregations", "testcongalpha01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	congregation.Set("language", "es")
+	if err := testApp.Save(congregation); err != nil {
+		t.Fatal(err)
+	}
+	admin, err := testApp.FindAuthRecordByEmail("users", "admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := postJSON(t, mux, "/instruction/broadcast", adminToken,
+		`{"scope":"map","target":"testmapalpha01a","message":"Skip block 12 today: lift maintenance."}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("broadcast returned %d: %s", res.Code, res.Body)
+	}
+	got := browser.waitFor(t, handlers.PushInstruction)
+	if got.Body != "Skip block 12 today: lift maintenance." || got.Title != "Nueva instrucción de "+admin.GetString("name") {
+		t.Errorf("notification: %+v", got)
+	}
+
+	if res := postWithLink(t, mux, "/push/unsubscribe", "testassignrich1", `{"endpoint":"`+browser.URL+`/sub"}`); !strings.Contains(res.Body.String(), `"removed":false`) {
+		t.Errorf("another link removed the subscription: %s", res.Body)
+	}
+	if res := postWithLink(t, mux, "/push/unsubscribe", "testassignalpha01", `{"endpoint":"`+browser.URL+`/sub"}`); !strings.Contains(res.Body.String(), `"removed":true`) {
+		t.Errorf("/push/unsubscribe: %s", res.Body)
+	}
+}
+
+func TestPush_UserSubscriptionGoneIsDeleted(t *testing.T) {
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enablePush(t)
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	browser := newPushBrowser(t)
+	if res := postJSON(t, mux, "/push/subscribe", conductorToken, browser.subscription("/user")); res.Code != http.StatusOK {
+		t.Fatalf("/push/subscribe returned %d: %s", res.Code, res.Body)
+	}
+	user, err := testApp.FindAuthRecordByEmail("users", "conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := handlers.PushNotification{Kind: handlers.PushMessages, Title: "New messages", Body: "2 new message(s)"}
+	if sent := handlers.PushToUsers(testApp, []string{user.Id}, n); sent != 1 {
+		t.Fatalf("want 1 push sent, got %d", sent)
+	}
+	if got := browser.waitFor(t, handlers.PushMessages); got.Title != "New messages" {
+		t.Errorf("notification: %+v", got)
+	}
+
+	// The browser unsubscribed on its side; the push service says so.
+	browser.mu.Lock()
+	browser.status = http.StatusGone
+	browser.mu.Unlock()
+	if sent := handlers.PushToUsers(testApp, []string{user.Id}, n); sent != 0 {
+		t.Errorf("want nothing sent to a gone subscription, got %d", sent)
+	}
+	if subs, _ := testApp.FindAllRecords("push_subscriptions"); len(subs) != 0 {
+		t.Errorf("a gone subscription should be deleted, %d left", len(subs))
+	}
+}
+
+func TestPush_LinkSubscriptionsGoWithTheExpiredAssignment(t *testing.T) {
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	col, err := testApp.FindCollectionByNameOrId("push_subscriptions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{"testassignexprd01", "testassignalpha01"} {
+		sub := core.NewRecord(col)
+		sub.Set("assignment", link)
+		sub.Set("endpoint", "https://push.example.com/"+link)
+		sub.Set("p256dh", "key")
+		sub.Set("auth", "secret")
+		if err := testApp.Save(sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := jobs.RunAssignmentsCleanup(testApp); err != nil {
+		t.Fatal(err)
+	}
+	subs, err := testApp.FindAllRecords("push_subscriptions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].GetString("assignment") != "testassignalpha01" {
+		t.Errorf("want only the live link's subscription left, got %d", len(subs))
+	}
+}
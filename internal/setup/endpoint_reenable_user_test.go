@@ -0,0 +1,78 @@
+//go:build testdata
+
+package setup
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+)
+
+func TestReenableUser_RestoresAccountAndLogs(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	user, err := testApp.FindRecordById("users", "testuseralpha03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Set("disabled", true)
+	user.Set("last_login", time.Now().Add(-200*24*time.Hour))
+	user.Set("inactive_warning_sent_at", time.Now().Add(-100*24*time.Hour))
+	user.Set("inactive_final_warning_sent_at", time.Now().Add(-40*24*time.Hour))
+	if err := testApp.SaveNoValidate(user); err != nil {
+		t.Fatal(err)
+	}
+	mux := buildTestMux(t, testApp)
+
+	body := `{"congregation":"testcongalpha01","user":"testuseralpha03"}`
+	if res := postJSON(t, mux, "/user/reenable", conductorToken, body); res.Code != http.StatusForbidden {
+		t.Errorf("conductor: want 403, got %d", res.Code)
+	}
+	if res := postJSON(t, mux, "/user/reenable", adminToken, `{"congregation":"testcongalpha01","user":"testuserbeta002"}`); res.Code != http.StatusNotFound {
+		t.Errorf("member of another congregation: want 404, got %d", res.Code)
+	}
+
+	res := postJSON(t, mux, "/user/reenable", adminToken, body)
+	if res.Code != http.StatusOK {
+		t.Fatalf("re-enable returned %d: %s", res.Code, res.Body)
+	}
+
+	user, err = testApp.FindRecordById("users", "testuseralpha03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.GetBool("disabled") {
+		t.Error("account should be enabled")
+	}
+	if time.Since(user.GetDateTime("last_login").Time()) > time.Minute {
+		t.Errorf("last_login should restart the inactivity clock, got %v", user.GetDateTime("last_login"))
+	}
+	if !user.GetDateTime("inactive_warning_sent_at").IsZero() || !user.GetDateTime("inactive_final_warning_sent_at").IsZero() {
+		t.Error("inactivity warning stamps should be cleared")
+	}
+
+	entry, err := testApp.FindFirstRecordByFilter("roles_log",
+		"user = {:user} && action = 'reenabled'", dbx.Params{"user": "testuseralpha03"})
+	if err != nil {
+		t.Fatalf("re-enable should be written to roles_log: %v", err)
+	}
+	if entry.GetString("changed_by") != "testuseralpha01" || entry.GetString("congregation") != "testcongalpha01" {
+		t.Errorf("unexpected audit entry: %v", entry.PublicExport())
+	}
+
+	if res := postJSON(t, mux, "/user/reenable", adminToken, body); res.Code != http.StatusBadRequest {
+		t.Errorf("already enabled: want 400, got %d", res.Code)
+	}
+}
@@ -0,0 +1,255 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+// postJSON drives a single authenticated JSON POST through mux.
+func postJSON(t *testing.T, mux http.Handler, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("content-type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestResetSnapshot_MapResetCanBeRestored(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	mux := buildTestMux(t, testApp)
+
+	if res := postJSON(t, mux, "/map/reset", adminToken, `{"map":"testmapalpha01a"}`); res.Code != http.StatusOK {
+		t.Fatalf("reset returned %d: %s", res.Code, res.Body)
+	}
+
+	// Work one address after the reset: the restore must not clobber it.
+	worked, err := testApp.FindRecordById("addresses", "testalpha01a003")
+	if err != nil {
+		t.Fatal(err)
+	}
+	worked.Set("status", "do_not_call")
+	if err := testApp.SaveNoValidate(worked); err != nil {
+		t.Fatal(err)
+	}
+
+	res := postJSON(t, mux, "/reset/snapshots", adminToken, `{"map":"testmapalpha01a"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("list returned %d: %s", res.Code, res.Body)
+	}
+	var snapshots []struct {
+		Id           string `json:"id"`
+		Scope        string `json:"scope"`
+		AddressCount int    `json:"address_count"`
+		CreatedBy    string `json:"created_by"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &snapshots); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("expected 1 snapshot, got %d", len(snapshots))
+	}
+	if got := snapshots[0].AddressCount; got != 3 {
+		t.Errorf("address_count: want 3 (2 not_home + 1 done), got %d", got)
+	}
+	if got := snapshots[0].CreatedBy; got != "Alpha Admin" {
+		t.Errorf("created_by: want 'Alpha Admin', got %q", got)
+	}
+
+	res = postJSON(t, mux, "/reset/restore", adminToken, `{"snapshot":"`+snapshots[0].Id+`"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("restore returned %d: %s", res.Code, res.Body)
+	}
+	var counts struct {
+		Restored int `json:"restored"`
+		Skipped  int `json:"skipped"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &counts); err != nil {
+		t.Fatal(err)
+	}
+	if counts.Restored != 2 || counts.Skipped != 1 {
+		t.Errorf("want restored=2 skipped=1, got restored=%d skipped=%d", counts.Restored, counts.Skipped)
+	}
+
+	for id, want := range map[string]string{
+		"testalpha01a003": "do_not_call",
+		"testalpha01a004": "not_home",
+		"testalpha01a005": "done",
+	} {
+		addr, err := testApp.FindRecordById("addresses", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := addr.GetString("status"); got != want {
+			t.Errorf("%s status: want %s, got %s", id, want, got)
+		}
+	}
+
+	mapRecord, err := testApp.FindRecordById("maps", "testmapalpha01a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var aggs map[string]any
+	if err := json.Unmarshal([]byte(mapRecord.GetString("aggregates")), &aggs); err != nil {
+		t.Fatal(err)
+	}
+	// Only 003 and 004 carry a countable option; 003 is now do_not_call.
+	if got := int(aggs["notHome"].(float64)); got != 1 {
+		t.Errorf("map aggregates.notHome after restore: want 1, got %d", got)
+	}
+
+	res = postJSON(t, mux, "/reset/restore", adminToken, `{"snapshot":"`+snapshots[0].Id+`"}`)
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("second restore: want 400, got %d", res.Code)
+	}
+}
+
+func TestResetSnapshot_TerritoryResetIsSnapshotted(t *testing.T) {
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	mux := buildTestMux(t, testApp)
+
+	if res := postJSON(t, mux, "/territory/reset", conductorToken, `{"territory":"testterralpha01"}`); res.Code != http.StatusOK {
+		t.Fatalf("reset returned %d: %s", res.Code, res.Body)
+	}
+
+	snapshots, err := testApp.FindRecordsByFilter("reset_snapshots", "territory = 'testterralpha01'", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("expected 1 territory snapshot, got %d", len(snapshots))
+	}
+	if got := snapshots[0].GetString("scope"); got != "territory" {
+		t.Errorf("scope: want territory, got %q", got)
+	}
+
+	// Conductors may restore a territory reset, matching who may perform one.
+	res := postJSON(t, mux, "/reset/restore", conductorToken, `{"snapshot":"`+snapshots[0].Id+`"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("restore returned %d: %s", res.Code, res.Body)
+	}
+
+	mapRecord, err := testApp.FindRecordById("maps", "testmapalpha01a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var aggs map[string]any
+	if err := json.Unmarshal([]byte(mapRecord.GetString("aggregates")), &aggs); err != nil {
+		t.Fatal(err)
+	}
+	if got := int(aggs["notHome"].(float64)); got != 2 {
+		t.Errorf("map aggregates.notHome after territory restore: want 2, got %d", got)
+	}
+}
+
+func TestResetSnapshot_Validation(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	betaAdminToken, err := generateToken("admin@beta.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:   "list requires exactly one of map or territory",
+			Method: http.MethodPost,
+			URL:    "/reset/snapshots",
+			Body:   strings.NewReader(`{"map":"testmapalpha01a","territory":"testterralpha01"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": adminToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"Exactly one of map or territory is required."`},
+		},
+		{
+			Name:   "conductor cannot list map reset snapshots",
+			Method: http.MethodPost,
+			URL:    "/reset/snapshots",
+			Body:   strings.NewReader(`{"map":"testmapalpha01a"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": conductorToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"Administrator access required."`},
+		},
+		{
+			Name:   "admin from another congregation cannot list territory snapshots",
+			Method: http.MethodPost,
+			URL:    "/reset/snapshots",
+			Body:   strings.NewReader(`{"territory":"testterralpha01"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": betaAdminToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"Administrator or conductor access required."`},
+		},
+		{
+			Name:   "restoring an unknown snapshot returns 404",
+			Method: http.MethodPost,
+			URL:    "/reset/restore",
+			Body:   strings.NewReader(`{"snapshot":"doesnotexist01"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": adminToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  404,
+			ExpectedContent: []string{`"Snapshot not found."`},
+		},
+		{
+			Name:   "guest cannot restore",
+			Method: http.MethodPost,
+			URL:    "/reset/restore",
+			Body:   strings.NewReader(`{"snapshot":"doesnotexist01"}`),
+			Headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  401,
+			ExpectedContent: []string{`"status":401`},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
@@ -0,0 +1,147 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// scopeConductorTo narrows the seeded alpha conductor's role to territories.
+func scopeConductorTo(t testing.TB, app core.App, territories ...string) {
+	t.Helper()
+
+	role, err := app.FindRecordById("roles", "testrolexcng01b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role.Set("territories", territories)
+	if err := app.Save(role); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// getJSON drives a single authenticated GET through mux.
+func getJSON(t *testing.T, mux http.Handler, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", token)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestRoleScope_ConductorLimitedToOwnTerritories(t *testing.T) {
+	token, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	scopeConductorTo(t, testApp, "testterralpha01")
+	mux := buildTestMux(t, testApp)
+
+	if res := postJSON(t, mux, "/territory/reset", token, `{"territory":"testterralpha01"}`); res.Code != http.StatusOK {
+		t.Errorf("reset of own territory: want 200, got %d: %s", res.Code, res.Body)
+	}
+	if res := postJSON(t, mux, "/territory/reset", token, `{"territory":"testterralpha02"}`); res.Code != http.StatusForbidden {
+		t.Errorf("reset of another territory: want 403, got %d", res.Code)
+	}
+
+	if res := getJSON(t, mux, "/api/collections/maps/records/testmapalpha01a", token); res.Code != http.StatusOK {
+		t.Errorf("view of own map: want 200, got %d", res.Code)
+	}
+	if res := getJSON(t, mux, "/api/collections/maps/records/testmapalpha02a", token); res.Code != http.StatusForbidden {
+		t.Errorf("view of map outside scope: want 403, got %d", res.Code)
+	}
+
+	list := getJSON(t, mux, "/api/collections/maps/records?fields=*&perPage=100&filter="+
+		url.QueryEscape(`congregation="testcongalpha01"`), token)
+	if list.Code != http.StatusOK {
+		t.Fatalf("maps list: want 200, got %d: %s", list.Code, list.Body)
+	}
+	var page struct {
+		Items []struct {
+			Territory string `json:"territory"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(list.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) == 0 {
+		t.Fatal("maps list should include the conductor's own territory")
+	}
+	for _, m := range page.Items {
+		if m.Territory != "testterralpha01" {
+			t.Errorf("maps list leaked a map in territory %s", m.Territory)
+		}
+	}
+
+	// A scoped conductor is not a conductor for the whole congregation.
+	if res := postJSON(t, mux, "/territory/coverage", token, `{"congregation":"testcongalpha01"}`); res.Code != http.StatusForbidden {
+		t.Errorf("congregation-wide coverage: want 403, got %d", res.Code)
+	}
+}
+
+func TestRoleScope_RealtimeSubscriptionLimitedToScope(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.Cleanup()
+	scopeConductorTo(t, app, "testterralpha01")
+
+	conductor, err := app.FindAuthRecordByEmail("users", "conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	own := realtimeSub("addresses", "*", `map="testmapalpha01a"`, "")
+	other := realtimeSub("addresses", "*", `map="testmapalpha02a"`, "")
+	got := runSubscribeHook(t, app, conductor, []string{own, other})
+	if len(got) != 1 || got[0] != own {
+		t.Errorf("want only the in-scope subscription kept, got %v", got)
+	}
+}
+
+func TestRoleScope_ForeignTerritoryRejected(t *testing.T) {
+	app := setupTestApp(t)
+	defer app.Cleanup()
+
+	role, err := app.FindRecordById("roles", "testrolexcng01b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role.Set("territories", []string{"testterrbeta001"})
+	if err := app.Save(role); err == nil {
+		t.Error("scoping a role to another congregation's territory should fail")
+	}
+}
+
+func TestRoleScope_DeletingOnlyTerritoryRevokesRole(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	scopeConductorTo(t, testApp, "testterralpha02")
+	mux := buildTestMux(t, testApp)
+
+	if res := postJSON(t, mux, "/territory/delete", adminToken, `{"territory":"testterralpha02"}`); res.Code != http.StatusOK {
+		t.Fatalf("delete returned %d: %s", res.Code, res.Body)
+	}
+
+	if _, err := testApp.FindRecordById("roles", "testrolexcng01b"); err == nil {
+		t.Error("a role scoped only to the deleted territory must be revoked, not widened")
+	}
+	if _, err := testApp.FindFirstRecordByFilter("roles_log",
+		"user = 'testuseralpha02' && action = 'revoked'"); err != nil {
+		t.Errorf("revocation should be logged: %v", err)
+	}
+}
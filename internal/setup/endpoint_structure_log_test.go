@@ -0,0 +1,172 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/tests"
+)
+
+type structureLogResponse struct {
+	Action     string         `json:"action"`
+	TargetType string         `json:"target_type"`
+	Target     string         `json:"target"`
+	Diff       map[string]any `json:"diff"`
+	ChangedBy  string         `json:"changed_by"`
+}
+
+func fetchStructureLog(t *testing.T, mux http.Handler, token, body string) []structureLogResponse {
+	t.Helper()
+
+	res := postJSON(t, mux, "/structure/log", token, body)
+	if res.Code != http.StatusOK {
+		t.Fatalf("structure/log returned %d: %s", res.Code, res.Body)
+	}
+	var entries []structureLogResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// Every structural handler leaves one entry naming the actor, the target and
+// what changed.
+func TestStructureLog_RecordsStructuralEdits(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+
+	mux := buildTestMux(t, testApp)
+
+	steps := []struct{ path, body string }{
+		{"/map/floor/add", `{"map":"testmapalphcf01","add_higher":true}`},
+		{"/map/floor/remove", `{"map":"testmapalphcf01","floor":1}`},
+		{"/map/code/add", `{"map":"testmapalpha01b","codes":["25"]}`},
+		{"/map/code/delete", `{"map":"testmapalpha01b","code":"20"}`},
+		{"/map/territory/update", `{"map":"testmapalpha01b","new_territory":"testterralpha02"}`},
+		{"/options/update", `{
+			"congregation":"testcongalpha01",
+			"options":[
+				{"id":"testoptialpha01","code":"NH","description":"Not Home","sequence":1,"is_default":false,"is_countable":true},
+				{"id":"testoptialpha02","code":"DNC","description":"Do Not Call","sequence":2,"is_default":false,"is_countable":false},
+				{"id":"testoptialpha03","code":"LN","description":"Language Note Updated","sequence":3,"is_default":true,"is_countable":true}
+			]
+		}`},
+	}
+	for _, step := range steps {
+		if res := postJSON(t, mux, step.path, adminToken, step.body); res.Code != http.StatusOK {
+			t.Fatalf("%s returned %d: %s", step.path, res.Code, res.Body)
+		}
+	}
+
+	entries := fetchStructureLog(t, mux, adminToken, `{"congregation":"testcongalpha01"}`)
+	byAction := map[string]structureLogResponse{}
+	for _, entry := range entries {
+		byAction[entry.Action] = entry
+		if entry.ChangedBy != "Alpha Admin" {
+			t.Errorf("%s: changed_by want Alpha Admin, got %q", entry.Action, entry.ChangedBy)
+		}
+	}
+
+	for _, action := range []string{"floor_added", "floor_removed", "codes_added", "code_deleted", "map_moved", "options_updated"} {
+		if _, ok := byAction[action]; !ok {
+			t.Errorf("missing %s entry; got %v", action, entries)
+		}
+	}
+
+	if got := byAction["floor_added"].Diff["floor"]; got != float64(3) {
+		t.Errorf("floor_added floor: want 3, got %v", got)
+	}
+	if got := byAction["code_deleted"].Diff["code"]; got != "20" {
+		t.Errorf("code_deleted code: want 20, got %v", got)
+	}
+
+	moved := byAction["map_moved"]
+	if moved.TargetType != "map" || moved.Target != "testmapalpha01b" {
+		t.Errorf("map_moved target: got %s %s", moved.TargetType, moved.Target)
+	}
+	territory, _ := moved.Diff["territory"].(map[string]any)
+	if territory["from"] != "testterralpha01" || territory["to"] != "testterralpha02" {
+		t.Errorf("map_moved territory diff: got %v", moved.Diff["territory"])
+	}
+
+	updated, _ := byAction["options_updated"].Diff["updated"].([]any)
+	if len(updated) != 1 {
+		t.Fatalf("options_updated should record only the changed option, got %v", byAction["options_updated"].Diff)
+	}
+	description, _ := updated[0].(map[string]any)["description"].(map[string]any)
+	if description["from"] != "Language Note" || description["to"] != "Language Note Updated" {
+		t.Errorf("option description diff: got %v", updated[0])
+	}
+
+	// Narrowing to one target only returns that target's history.
+	forMap := fetchStructureLog(t, mux, adminToken, `{"congregation":"testcongalpha01","target":"testmapalphcf01"}`)
+	if len(forMap) != 2 {
+		t.Errorf("expected 2 entries for testmapalphcf01, got %d", len(forMap))
+	}
+}
+
+func TestStructureLog_Endpoint(t *testing.T) {
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	betaAdminToken, err := generateToken("admin@beta.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:   "conductor cannot read the structure log",
+			Method: http.MethodPost,
+			URL:    "/structure/log",
+			Body:   strings.NewReader(`{"congregation":"testcongalpha01"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": conductorToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"Administrator access required."`},
+		},
+		{
+			Name:   "admin of another congregation cannot read it",
+			Method: http.MethodPost,
+			URL:    "/structure/log",
+			Body:   strings.NewReader(`{"congregation":"testcongalpha01"}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": betaAdminToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"Administrator access required."`},
+		},
+		{
+			Name:   "congregation is required",
+			Method: http.MethodPost,
+			URL:    "/structure/log",
+			Body:   strings.NewReader(`{}`),
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": betaAdminToken,
+			},
+			TestAppFactory:  setupTestApp,
+			ExpectedStatus:  400,
+			ExpectedContent: []string{`"Congregation is required."`},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
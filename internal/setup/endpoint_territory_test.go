@@ -212,11 +212,48 @@ func TestHandleDeleteTerritory(t *testing.T) {
 			TestAppFactory:  setupTestApp,
 			ExpectedStatus:  200,
 			ExpectedContent: []string{`"Territory deleted successfully"`},
+			BeforeTestFunc: func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+				assignments, err := app.FindCollectionByNameOrId("assignments")
+				if err != nil {
+					t.Fatal(err)
+				}
+				link := core.NewRecord(assignments)
+				link.Set("map", "testmapalpha02a")
+				link.Set("congregation", "testcongalpha01")
+				link.Set("publisher", "Territory Publisher")
+				link.Set("expiry_date", "2099-01-01 00:00:00.000Z")
+				link.Set("type", "normal")
+				if err := app.Save(link); err != nil {
+					t.Fatal(err)
+				}
+
+				subscriptions, err := app.FindCollectionByNameOrId("push_subscriptions")
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, assignment := range []string{link.Id, "testassignalpha01"} {
+					sub := core.NewRecord(subscriptions)
+					sub.Set("assignment", assignment)
+					sub.Set("endpoint", "https://push.example.com/"+assignment)
+					sub.Set("p256dh", "key")
+					sub.Set("auth", "secret")
+					if err := app.Save(sub); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
 			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
 				_, err := app.FindRecordById("territories", "testterralpha02")
 				if err == nil {
 					t.Error("expected territory testterralpha02 to be deleted, but it still exists")
 				}
+				subs, err := app.FindAllRecords("push_subscriptions")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(subs) != 1 || subs[0].GetString("assignment") != "testassignalpha01" {
+					t.Errorf("want only the other territory's link subscription left, got %d", len(subs))
+				}
 			},
 		},
 	}
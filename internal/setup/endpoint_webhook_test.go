@@ -0,0 +1,225 @@
+//go:build testdata
+
+package setup
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ministry-mapper/internal/handlers"
+)
+
+type receivedWebhook struct {
+	Event     string
+	Signature string
+	Body      []byte
+}
+
+// webhookReceiver is an endpoint recording the deliveries posted to it.
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	received []receivedWebhook
+}
+
+func newWebhookReceiver(t *testing.T) *webhookReceiver {
+	t.Helper()
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+	r := &webhookReceiver{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.received = append(r.received, receivedWebhook{
+			Event:     req.Header.Get("X-Ministry-Mapper-Event"),
+			Signature: req.Header.Get("X-Ministry-Mapper-Signature"),
+			Body:      body,
+		})
+		r.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// waitFor returns the first delivery of event, waiting for background
+// deliveries to arrive.
+func (r *webhookReceiver) waitFor(t *testing.T, event string) receivedWebhook {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		for _, got := range r.received {
+			if got.Event == event {
+				r.mu.Unlock()
+				return got
+			}
+		}
+		r.mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("no %s delivery received", event)
+	return receivedWebhook{}
+}
+
+// verifySignature checks a delivery was signed with secret.
+func verifySignature(t *testing.T, got receivedWebhook, secret string) {
+	t.Helper()
+	parts := strings.SplitN(strings.TrimPrefix(got.Signature, "t="), ",", 2)
+	timestamp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		t.Fatalf("signature %q has no timestamp", got.Signature)
+	}
+	if want := handlers.SignWebhook(secret, timestamp, got.Body); got.Signature != want {
+		t.Errorf("signature %q, want %q", got.Signature, want)
+	}
+}
+
+func TestWebhooks_AdministratorRegistersAndReceivesEvents(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conductorToken, err := generateToken("conductor@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	betaToken, err := generateToken("admin@beta.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receiver := newWebhookReceiver(t)
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	create := `{"congregation":"testcongalpha01","url":"` + receiver.URL + `/hook","events":["address.status_changed","role.granted"]}`
+	for _, tc := range []struct {
+		name, token, body string
+		want              int
+	}{
+		{"conductor", conductorToken, create, http.StatusForbidden},
+		{"other congregation's administrator", betaToken, create, http.StatusForbidden},
+		{"unknown event", adminToken, `{"congregation":"testcongalpha01","url":"https://example.com","events":["map.deleted"]}`, http.StatusBadRequest},
+		{"not http", adminToken, `{"congregation":"testcongalpha01","url":"ftp://example.com","events":["role.granted"]}`, http.StatusBadRequest},
+	} {
+		if res := postJSON(t, mux, "/webhook/save", tc.token, tc.body); res.Code != tc.want {
+			t.Errorf("%s: want %d, got %d", tc.name, tc.want, res.Code)
+		}
+	}
+
+	res := postJSON(t, mux, "/webhook/save", adminToken, create)
+	if res.Code != http.StatusOK {
+		t.Fatalf("/webhook/save returned %d: %s", res.Code, res.Body)
+	}
+	var created struct {
+		Id     string `json:"id"`
+		Secret string `json:"secret"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Secret, "whsec_") {
+		t.Fatalf("the secret should be returned on creation, got %q", created.Secret)
+	}
+	if res := postJSON(t, mux, "/webhook/list", adminToken, `{"congregation":"testcongalpha01"}`); strings.Contains(res.Body.String(), created.Secret) {
+		t.Error("the secret must not be listed")
+	}
+
+	res = postJSON(t, mux, "/webhook/test", adminToken, `{"id":"`+created.Id+`"}`)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"delivered":true`) {
+		t.Fatalf("/webhook/test returned %d: %s", res.Code, res.Body)
+	}
+	verifySignature(t, receiver.waitFor(t, "ping"), created.Secret)
+
+	address, err := testApp.FindRecordById("addresses", "testalpha01a001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address.Set("status", "done")
+	address.Set("updated_by", "Alpha Admin")
+	if err := testApp.Save(address); err != nil {
+		t.Fatal(err)
+	}
+	got := receiver.waitFor(t, "address.status_changed")
+	verifySignature(t, got, created.Secret)
+	var payload struct {
+		Event        string         `json:"event"`
+		Congregation string         `json:"congregation"`
+		Data         map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(got.Body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Congregation != "testcongalpha01" || payload.Data["address"] != "testalpha01a001" ||
+		payload.Data["old_status"] != "not_done" || payload.Data["new_status"] != "done" {
+		t.Errorf("payload: %+v", payload)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	var deliveries []struct {
+		Event  string `json:"event"`
+		Status string `json:"status"`
+	}
+	for {
+		res = postJSON(t, mux, "/webhook/deliveries", adminToken, `{"id":"`+created.Id+`","status":"delivered"}`)
+		if res.Code != http.StatusOK {
+			t.Fatalf("/webhook/deliveries returned %d: %s", res.Code, res.Body)
+		}
+		if err := json.Unmarshal(res.Body.Bytes(), &deliveries); err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(deliveries) != 2 {
+		t.Errorf("want the ping and the status change delivered, got %+v", deliveries)
+	}
+	if res := postJSON(t, mux, "/webhook/deliveries", betaToken, `{"id":"`+created.Id+`"}`); res.Code != http.StatusForbidden {
+		t.Errorf("another congregation's delivery log: want 403, got %d", res.Code)
+	}
+
+	if res := postJSON(t, mux, "/webhook/delete", adminToken, `{"id":"`+created.Id+`"}`); res.Code != http.StatusOK {
+		t.Fatalf("/webhook/delete returned %d", res.Code)
+	}
+	if _, err := testApp.FindRecordById("webhooks", created.Id); err == nil {
+		t.Error("webhook should be deleted")
+	}
+}
+
+func TestWebhooks_RefusesPrivateTargets(t *testing.T) {
+	adminToken, err := generateToken("admin@alpha.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp := setupTestApp(t)
+	defer testApp.Cleanup()
+	mux := buildTestMux(t, testApp)
+
+	res := postJSON(t, mux, "/webhook/save", adminToken,
+		`{"congregation":"testcongalpha01","url":"http://127.0.0.1:9/hook","events":["role.granted"]}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("/webhook/save returned %d: %s", res.Code, res.Body)
+	}
+	var created struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	res = postJSON(t, mux, "/webhook/test", adminToken, `{"id":"`+created.Id+`"}`)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "not a public address") {
+		t.Errorf("a loopback target should be refused, got %d: %s", res.Code, res.Body)
+	}
+}
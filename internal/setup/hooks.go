@@ -43,7 +43,10 @@ func RegisterDomainHooks(app core.App) {
 		return e.Next()
 	})
 
-	// Track last login and reset inactive warnings
+	// Inactivity and unprovisioned thresholds must warn before they disable
+	app.OnRecordValidate("congregations").BindFunc(handlers.ValidateCongregationAccountPolicy)
+
+	// Track last login, reset inactive warnings and provision pending invitations
 	app.OnRecordAuthRequest("users").BindFunc(func(e *core.RecordAuthRequestEvent) error {
 		e.Record.Set("last_login", time.Now())
 		e.Record.Set("inactive_warning_sent_at", nil)
@@ -51,6 +54,7 @@ func RegisterDomainHooks(app core.App) {
 		if err := e.App.SaveNoValidate(e.Record); err != nil {
 			log.Printf("warning: error saving last_login for user %s: %v", e.Record.Id, err)
 		}
+		handlers.AcceptPendingInvitations(e.App, e.Record)
 		return e.Next()
 	})
 
@@ -103,9 +107,77 @@ func RegisterDomainHooks(app core.App) {
 		return nil
 	})
 
+	// A moved or cleared expiry is warned about afresh
+	app.OnRecordUpdate("roles").BindFunc(func(e *core.RecordEvent) error {
+		if !e.Record.GetDateTime("expires_at").Equal(e.Record.Original().GetDateTime("expires_at")) {
+			e.Record.Set("expiry_warning_sent_at", nil)
+		}
+		return e.Next()
+	})
+
+	// Territory scopes must stay within the role's own congregation
+	app.OnRecordValidate("roles").BindFunc(handlers.ValidateRoleTerritories)
+
+	// Revoke roles scoped only to a deleted territory rather than letting the
+	// emptied scope widen them to the whole congregation
+	app.OnRecordDelete("territories").BindFunc(handlers.RevokeRolesScopedToTerritory)
+
+	// Replies attach to a root message on the same map
+	app.OnRecordValidate("messages").BindFunc(handlers.ValidateMessageParent)
+
+	// publish_at and pin_until are for administrator instructions only
+	app.OnRecordValidate("messages").BindFunc(handlers.ValidateMessageSchedule)
+
+	// A moved publish_at is published afresh, and re-pinning drops a lapsed pin_until
+	app.OnRecordUpdate("messages").BindFunc(func(e *core.RecordEvent) error {
+		handlers.ResetMessageSchedule(e)
+		return e.Next()
+	})
+
+	// A new reply reopens a resolved thread
+	app.OnRecordAfterCreateSuccess("messages").BindFunc(func(e *core.RecordEvent) error {
+		handlers.ReopenMessageThread(e)
+		return e.Next()
+	})
+
 	// Stamp unprovisioned_since when a user's last role is deleted
 	app.OnRecordAfterDeleteSuccess("roles").BindFunc(func(e *core.RecordEvent) error {
 		handlers.HandleRoleDelete(e)
 		return e.Next()
 	})
+
+	// Outgoing webhooks. Model hooks rather than request hooks, so changes made
+	// by jobs, quicklinks, invitations and access requests are sent too.
+	app.OnRecordAfterUpdateSuccess("addresses").BindFunc(func(e *core.RecordEvent) error {
+		handlers.EmitAddressStatusWebhook(app, e)
+		return e.Next()
+	})
+	app.OnRecordAfterCreateSuccess("assignments").BindFunc(func(e *core.RecordEvent) error {
+		handlers.EmitAssignmentCreatedWebhook(app, e)
+		return e.Next()
+	})
+	app.OnRecordAfterDeleteSuccess("assignments").BindFunc(func(e *core.RecordEvent) error {
+		handlers.EmitAssignmentExpiredWebhook(app, e)
+		return e.Next()
+	})
+	app.OnRecordAfterCreateSuccess("roles").BindFunc(func(e *core.RecordEvent) error {
+		handlers.EmitRoleGrantedWebhook(app, e)
+		return e.Next()
+	})
+	app.OnRecordAfterDeleteSuccess("roles").BindFunc(func(e *core.RecordEvent) error {
+		handlers.EmitRoleRevokedWebhook(app, e)
+		return e.Next()
+	})
+	app.OnRecordAfterUpdateSuccess("maps").BindFunc(func(e *core.RecordEvent) error {
+		handlers.EmitMapCompletedWebhook(app, e)
+		return e.Next()
+	})
+	app.OnRecordAfterCreateSuccess("messages").BindFunc(func(e *core.RecordEvent) error {
+		handlers.EmitMessageCreatedWebhook(app, e)
+		return e.Next()
+	})
+	app.OnRecordAfterUpdateSuccess("messages").BindFunc(func(e *core.RecordEvent) error {
+		handlers.EmitMessagePublishedWebhook(app, e)
+		return e.Next()
+	})
 }
@@ -39,6 +39,36 @@ func RegisterRoutes(app core.App) {
 		e.Router.POST("/address/add", middleware.WrapHandler(func(c *core.RequestEvent) error {
 			return handlers.HandleCreateAddress(c, app)
 		}))
+		e.Router.POST("/message/reply", middleware.WrapHandler(func(c *core.RequestEvent) error {
+			return handlers.HandleReplyMessage(c, app)
+		}))
+		e.Router.POST("/message/read", middleware.WrapHandler(func(c *core.RequestEvent) error {
+			return handlers.HandleMarkThreadRead(c, app)
+		}))
+		e.Router.POST("/message/thread", middleware.WrapHandler(func(c *core.RequestEvent) error {
+			return handlers.HandleGetThread(c, app)
+		}))
+		e.Router.POST("/change/request", middleware.WrapHandler(func(c *core.RequestEvent) error {
+			return handlers.HandleCreateChangeRequest(c, app)
+		}))
+		e.Router.POST("/instruction/pending", middleware.WrapHandler(func(c *core.RequestEvent) error {
+			return handlers.HandlePendingInstructions(c, app)
+		}))
+		e.Router.POST("/instruction/ack", middleware.WrapHandler(func(c *core.RequestEvent) error {
+			return handlers.HandleAcknowledgeInstruction(c, app)
+		}))
+		e.Router.POST("/notification/unsubscribe", middleware.WrapHandler(func(c *core.RequestEvent) error {
+			return handlers.HandleUnsubscribe(c, app)
+		}))
+		e.Router.POST("/push/key", middleware.WrapHandler(func(c *core.RequestEvent) error {
+			return handlers.HandlePushKey(c, app)
+		}))
+		e.Router.POST("/push/subscribe", middleware.WrapHandler(func(c *core.RequestEvent) error {
+			return handlers.HandlePushSubscribe(c, app)
+		}))
+		e.Router.POST("/push/unsubscribe", middleware.WrapHandler(func(c *core.RequestEvent) error {
+			return handlers.HandlePushUnsubscribe(c, app)
+		}))
 
 		// Map operations
 		authRoute("/map/codes", func(c *core.RequestEvent) error {
@@ -53,6 +83,9 @@ func RegisterRoutes(app core.App) {
 		authRoute("/map/code/delete", func(c *core.RequestEvent) error {
 			return handlers.HandleMapDelete(c, app)
 		})
+		authRoute("/map/codes/preview", func(c *core.RequestEvent) error {
+			return handlers.HandlePreviewCodePattern(c, app)
+		})
 		authRoute("/map/floor/add", func(c *core.RequestEvent) error {
 			return handlers.HandleMapFloor(c, app)
 		})
@@ -72,6 +105,60 @@ func RegisterRoutes(app core.App) {
 			return handlers.HandleUpdateTerritoryMapSequence(c, app)
 		})
 
+		// Messages
+		authRoute("/message/resolve", func(c *core.RequestEvent) error {
+			return handlers.HandleResolveThread(c, app)
+		})
+
+		// Instruction broadcasts
+		authRoute("/instruction/broadcast", func(c *core.RequestEvent) error {
+			return handlers.HandleBroadcastInstruction(c, app, jobs.InstructionPushTitle)
+		})
+		authRoute("/instruction/status", func(c *core.RequestEvent) error {
+			return handlers.HandleInstructionStatus(c, app)
+		})
+
+		// Change requests
+		authRoute("/change/requests", func(c *core.RequestEvent) error {
+			return handlers.HandleListChangeRequests(c, app)
+		})
+		authRoute("/change/decide", func(c *core.RequestEvent) error {
+			return handlers.HandleDecideChangeRequest(c, app, jobs.SendChangeRequestDecidedEmail)
+		})
+
+		// Email outbox
+		authRoute("/email/failures", func(c *core.RequestEvent) error {
+			return handlers.HandleListEmailFailures(c, app)
+		})
+		authRoute("/email/retry", func(c *core.RequestEvent) error {
+			return handlers.HandleRetryEmail(c, app)
+		})
+
+		// Webhooks
+		authRoute("/webhook/list", func(c *core.RequestEvent) error {
+			return handlers.HandleListWebhooks(c, app)
+		})
+		authRoute("/webhook/save", func(c *core.RequestEvent) error {
+			return handlers.HandleSaveWebhook(c, app)
+		})
+		authRoute("/webhook/delete", func(c *core.RequestEvent) error {
+			return handlers.HandleDeleteWebhook(c, app)
+		})
+		authRoute("/webhook/test", func(c *core.RequestEvent) error {
+			return handlers.HandleTestWebhook(c, app)
+		})
+		authRoute("/webhook/deliveries", func(c *core.RequestEvent) error {
+			return handlers.HandleListWebhookDeliveries(c, app)
+		})
+
+		// Notification preferences
+		authRoute("/notification/preferences", func(c *core.RequestEvent) error {
+			return handlers.HandleGetNotificationPreferences(c, app)
+		})
+		authRoute("/notification/update", func(c *core.RequestEvent) error {
+			return handlers.HandleUpdateNotificationPreferences(c, app)
+		})
+
 		// Territory operations
 		authRoute("/territory/reset", func(c *core.RequestEvent) error {
 			return handlers.HandleResetTerritory(c, app)
@@ -82,12 +169,84 @@ func RegisterRoutes(app core.App) {
 		authRoute("/territory/link", func(c *core.RequestEvent) error {
 			return handlers.HandleTerritoryQuicklink(c, app)
 		})
+		authRoute("/territory/coverage", func(c *core.RequestEvent) error {
+			return handlers.HandleTerritoryCoverage(c, app)
+		})
+
+		// Reset snapshots
+		authRoute("/reset/snapshots", func(c *core.RequestEvent) error {
+			return handlers.HandleListResetSnapshots(c, app)
+		})
+		authRoute("/reset/restore", func(c *core.RequestEvent) error {
+			return handlers.HandleRestoreResetSnapshot(c, app)
+		})
 
 		// Options
 		authRoute("/options/update", func(c *core.RequestEvent) error {
 			return handlers.HandleOptionUpdate(c, app)
 		})
 
+		// Invitations
+		authRoute("/invitation/create", func(c *core.RequestEvent) error {
+			return handlers.HandleCreateInvitation(c, app, jobs.SendInvitationEmail)
+		})
+		authRoute("/invitation/revoke", func(c *core.RequestEvent) error {
+			return handlers.HandleRevokeInvitation(c, app)
+		})
+		authRoute("/invitation/accept", func(c *core.RequestEvent) error {
+			return handlers.HandleAcceptInvitation(c, app)
+		})
+		authRoute("/invitations", func(c *core.RequestEvent) error {
+			return handlers.HandleListInvitations(c, app)
+		})
+
+		// Access requests
+		authRoute("/access/request", func(c *core.RequestEvent) error {
+			return handlers.HandleCreateAccessRequest(c, app)
+		})
+		authRoute("/access/requests", func(c *core.RequestEvent) error {
+			return handlers.HandleListAccessRequests(c, app)
+		})
+		authRoute("/access/decide", func(c *core.RequestEvent) error {
+			return handlers.HandleDecideAccessRequest(c, app)
+		})
+
+		// Account policy
+		authRoute("/account-policy/dry-run", func(c *core.RequestEvent) error {
+			return handlers.HandleAccountPolicyDryRun(c, app, jobs.PlanAccountActions)
+		})
+		authRoute("/user/reenable", func(c *core.RequestEvent) error {
+			return handlers.HandleReenableUser(c, app, jobs.SendUserReenabledEmail)
+		})
+
+		// Personal data
+		authRoute("/account/export", func(c *core.RequestEvent) error {
+			return handlers.HandleExportPersonalData(c, app)
+		})
+		authRoute("/account/erasure/request", func(c *core.RequestEvent) error {
+			return handlers.HandleRequestErasure(c, app)
+		})
+		authRoute("/account/erasure/cancel", func(c *core.RequestEvent) error {
+			return handlers.HandleCancelErasure(c, app)
+		})
+		authRoute("/account/erasure/requests", func(c *core.RequestEvent) error {
+			return handlers.HandleListErasureRequests(c, app)
+		})
+		authRoute("/account/erasure/confirm", func(c *core.RequestEvent) error {
+			return handlers.HandleConfirmErasure(c, app)
+		})
+
+		// Audit
+		authRoute("/structure/log", func(c *core.RequestEvent) error {
+			return handlers.HandleStructureLog(c, app)
+		})
+		authRoute("/audit/query", func(c *core.RequestEvent) error {
+			return handlers.HandleAuditQuery(c, app)
+		})
+		authRoute("/access/explain", func(c *core.RequestEvent) error {
+			return handlers.HandlePermissionExplain(c, app)
+		})
+
 		// Reports
 		authRoute("/report/generate", func(c *core.RequestEvent) error {
 			return handlers.HandleGenerateReport(c, app, jobs.GenerateAndSendCongregationReportToUser)
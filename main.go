@@ -38,6 +38,7 @@ func main() {
 	registerSentryLogForwarding(app)
 
 	app.RootCmd.AddCommand(commands.NewFixSequences(app))
+	app.RootCmd.AddCommand(commands.NewRestoreLogArchive(app))
 
 	isGoRun := strings.HasPrefix(os.Args[0], os.TempDir())
 	migratecmd.MustRegister(app, app.RootCmd, migratecmd.Config{
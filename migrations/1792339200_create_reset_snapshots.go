@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Creates reset_snapshots, which records every address a map or territory
+// reset is about to flip back to not_done together with its prior status and
+// not_home_tries, so an accidental reset can be restored. No API rules: the
+// collection is only read and written through the /reset/* endpoints.
+func init() {
+	m.Register(func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		congregationsCol, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+		territoriesCol, err := app.FindCollectionByNameOrId("territories")
+		if err != nil {
+			return err
+		}
+		mapsCol, err := app.FindCollectionByNameOrId("maps")
+		if err != nil {
+			return err
+		}
+
+		snapshots := core.NewBaseCollection("reset_snapshots")
+		snapshots.Fields.Add(
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: true},
+			&core.RelationField{Name: "territory", CollectionId: territoriesCol.Id, CascadeDelete: true},
+			&core.RelationField{Name: "map", CollectionId: mapsCol.Id, CascadeDelete: true},
+			&core.SelectField{Name: "scope", Values: []string{"map", "territory"}, MaxSelect: 1},
+			// One {address, map, status, not_home_tries} entry per reset address.
+			// 10 MB comfortably covers the largest territories in production.
+			&core.JSONField{Name: "addresses", MaxSize: 10 << 20},
+			&core.NumberField{Name: "address_count"},
+			&core.RelationField{Name: "created_by", CollectionId: usersCol.Id, CascadeDelete: false},
+			&core.DateField{Name: "restored_at"},
+			&core.RelationField{Name: "restored_by", CollectionId: usersCol.Id, CascadeDelete: false},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		snapshots.AddIndex("idx_reset_snapshots_map_created", false, "map, created", "")
+		snapshots.AddIndex("idx_reset_snapshots_territory_created", false, "territory, created", "")
+
+		return app.Save(snapshots)
+	}, func(app core.App) error {
+		col, err := app.FindCollectionByNameOrId("reset_snapshots")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(col)
+	})
+}
@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Creates coverage_cycles, one record per pass over a map or territory. A
+// cycle opens on reset or on the first activity after the previous one
+// closed, and closes when progress reaches 100% (outcome "completed") or when
+// another reset cuts it short (outcome "reset"). No API rules: cycles are
+// written by the aggregate recalculation and read through /territory/coverage.
+func init() {
+	m.Register(func(app core.App) error {
+		congregationsCol, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+		territoriesCol, err := app.FindCollectionByNameOrId("territories")
+		if err != nil {
+			return err
+		}
+		mapsCol, err := app.FindCollectionByNameOrId("maps")
+		if err != nil {
+			return err
+		}
+
+		cycles := core.NewBaseCollection("coverage_cycles")
+		cycles.Fields.Add(
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: true},
+			&core.RelationField{Name: "territory", CollectionId: territoriesCol.Id, CascadeDelete: true},
+			// Empty for territory-scope cycles.
+			&core.RelationField{Name: "map", CollectionId: mapsCol.Id, CascadeDelete: true},
+			&core.SelectField{Name: "scope", Values: []string{"map", "territory"}, MaxSelect: 1},
+			&core.SelectField{Name: "opened_by", Values: []string{"reset", "activity"}, MaxSelect: 1},
+			&core.DateField{Name: "started_at"},
+			&core.DateField{Name: "ended_at"},
+			&core.SelectField{Name: "outcome", Values: []string{"completed", "reset"}, MaxSelect: 1},
+			&core.NumberField{Name: "duration_days"},
+			&core.NumberField{Name: "publishers"},
+			// Status counts at the moment the cycle completed.
+			&core.JSONField{Name: "breakdown"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		cycles.AddIndex("idx_coverage_cycles_map_started", false, "map, started_at", "")
+		cycles.AddIndex("idx_coverage_cycles_territory_scope_started", false, "territory, scope, started_at", "")
+
+		return app.Save(cycles)
+	}, func(app core.App) error {
+		col, err := app.FindCollectionByNameOrId("coverage_cycles")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(col)
+	})
+}
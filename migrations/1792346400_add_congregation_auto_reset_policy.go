@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds the per-congregation auto-reset policy read by the processAutoResets
+// job. Both fields default to 0, which leaves the policy off:
+//   - auto_reset_after_days: reset a map this many days after it reached 100%.
+//   - auto_reset_done_after_months: reset individual done addresses whose
+//     status is older than this many months.
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+
+		minZero := 0.0
+		collection.Fields.Add(
+			&core.NumberField{Name: "auto_reset_after_days", Min: &minZero, OnlyInt: true},
+			&core.NumberField{Name: "auto_reset_done_after_months", Min: &minZero, OnlyInt: true},
+		)
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return nil
+		}
+
+		collection.Fields.RemoveByName("auto_reset_after_days")
+		collection.Fields.RemoveByName("auto_reset_done_after_months")
+
+		return app.Save(collection)
+	})
+}
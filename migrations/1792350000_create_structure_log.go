@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Creates structure_log, the audit trail for structural edits — floors, codes,
+// sequences, map moves and option changes — alongside addresses_log,
+// assignments_log and roles_log. target is plain text rather than a relation
+// because deleted maps and territories must stay traceable. No API rules: the
+// collection is only read through /structure/log.
+func init() {
+	m.Register(func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		congregationsCol, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+
+		sLog := core.NewBaseCollection("structure_log")
+		sLog.Fields.Add(
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: false},
+			&core.TextField{Name: "action"},
+			&core.SelectField{Name: "target_type", Values: []string{"map", "territory", "congregation"}, MaxSelect: 1},
+			&core.TextField{Name: "target"},
+			&core.JSONField{Name: "diff", MaxSize: 1 << 20},
+			&core.RelationField{Name: "changed_by", CollectionId: usersCol.Id, CascadeDelete: false},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		sLog.AddIndex("idx_structure_log_congregation_created", false, "congregation, created", "")
+		sLog.AddIndex("idx_structure_log_target_created", false, "target, created", "")
+
+		return app.Save(sLog)
+	}, func(app core.App) error {
+		col, err := app.FindCollectionByNameOrId("structure_log")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(col)
+	})
+}
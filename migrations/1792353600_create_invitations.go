@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Creates invitations, the tokenized email invites administrators send to
+// onboard someone into a congregation with a given role. Only a SHA-256 of
+// the token is stored; the token itself exists only in the email. An invite
+// is pending until accepted_at, revoked_at or expires_at is reached. No API
+// rules: invitations are managed through the /invitation/* routes.
+//
+// Also adds roles_log.invitation so grants made by accepting an invite, and
+// the invite and revoke events themselves, can be traced back to the invite.
+func init() {
+	m.Register(func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		congregationsCol, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+
+		invitations := core.NewBaseCollection("invitations")
+		invitations.Fields.Add(
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: true, Required: true},
+			&core.EmailField{Name: "email", Required: true},
+			&core.SelectField{Name: "role", Values: []string{"read_only", "conductor", "administrator"}, MaxSelect: 1, Required: true},
+			&core.TextField{Name: "token_hash", Hidden: true, Required: true},
+			&core.RelationField{Name: "invited_by", CollectionId: usersCol.Id, CascadeDelete: false},
+			&core.DateField{Name: "expires_at", Required: true},
+			&core.DateField{Name: "accepted_at"},
+			&core.RelationField{Name: "accepted_by", CollectionId: usersCol.Id, CascadeDelete: false},
+			&core.DateField{Name: "revoked_at"},
+			&core.RelationField{Name: "revoked_by", CollectionId: usersCol.Id, CascadeDelete: false},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		invitations.AddIndex("idx_invitations_token_hash", true, "token_hash", "")
+		invitations.AddIndex("idx_invitations_email", false, "email", "")
+		invitations.AddIndex("idx_invitations_congregation_created", false, "congregation, created", "")
+		if err := app.Save(invitations); err != nil {
+			return err
+		}
+
+		rolesLog, err := app.FindCollectionByNameOrId("roles_log")
+		if err != nil {
+			return err
+		}
+		rolesLog.Fields.Add(&core.TextField{Name: "invitation"})
+		return app.Save(rolesLog)
+	}, func(app core.App) error {
+		if rolesLog, err := app.FindCollectionByNameOrId("roles_log"); err == nil {
+			rolesLog.Fields.RemoveByName("invitation")
+			if err := app.Save(rolesLog); err != nil {
+				return err
+			}
+		}
+
+		col, err := app.FindCollectionByNameOrId("invitations")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(col)
+	})
+}
@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Creates access_requests, raised by a signed-in user who has no role yet and
+// names their congregation by its code. Administrators are emailed a digest of
+// pending requests (digest_sent_at marks the ones already included) and
+// approve or deny them through /access/decide. No API rules: requests are
+// managed through the /access/* routes.
+func init() {
+	m.Register(func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		congregationsCol, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+
+		requests := core.NewBaseCollection("access_requests")
+		requests.Fields.Add(
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: true, Required: true},
+			&core.RelationField{Name: "user", CollectionId: usersCol.Id, CascadeDelete: true, Required: true},
+			&core.TextField{Name: "message", Max: 500},
+			&core.SelectField{Name: "status", Values: []string{"pending", "approved", "denied"}, MaxSelect: 1, Required: true},
+			&core.SelectField{Name: "role", Values: []string{"read_only", "conductor", "administrator"}, MaxSelect: 1},
+			&core.RelationField{Name: "decided_by", CollectionId: usersCol.Id, CascadeDelete: false},
+			&core.DateField{Name: "decided_at"},
+			&core.DateField{Name: "digest_sent_at"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		requests.AddIndex("idx_access_requests_user_congregation", false, "user, congregation", "")
+		requests.AddIndex("idx_access_requests_congregation_status", false, "congregation, status", "")
+
+		return app.Save(requests)
+	}, func(app core.App) error {
+		col, err := app.FindCollectionByNameOrId("access_requests")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(col)
+	})
+}
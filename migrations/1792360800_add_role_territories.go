@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds roles.territories, the optional territory scope of a role. Empty keeps
+// the role congregation-wide; otherwise the role applies only to the listed
+// territories and the maps in them. Deleting a territory revokes roles scoped
+// to nothing else (see handlers.RevokeRolesScopedToTerritory) rather than
+// letting PocketBase empty the list, which would widen them to the whole
+// congregation.
+func init() {
+	m.Register(func(app core.App) error {
+		roles, err := app.FindCollectionByNameOrId("roles")
+		if err != nil {
+			return err
+		}
+		territories, err := app.FindCollectionByNameOrId("territories")
+		if err != nil {
+			return err
+		}
+
+		roles.Fields.Add(&core.RelationField{
+			Name:          "territories",
+			CollectionId:  territories.Id,
+			CascadeDelete: false,
+			MaxSelect:     100,
+		})
+
+		return app.Save(roles)
+	}, func(app core.App) error {
+		roles, err := app.FindCollectionByNameOrId("roles")
+		if err != nil {
+			return nil
+		}
+
+		roles.Fields.RemoveByName("territories")
+
+		return app.Save(roles)
+	})
+}
@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds roles.expires_at, an optional time after which processRoleExpiry
+// revokes the role, and roles.expiry_warning_sent_at, stamped once the user
+// and the congregation's administrators have been told the role is about to
+// expire. Moving expires_at clears the stamp so a renewed role is warned
+// about again.
+func init() {
+	m.Register(func(app core.App) error {
+		roles, err := app.FindCollectionByNameOrId("roles")
+		if err != nil {
+			return err
+		}
+
+		roles.Fields.Add(
+			&core.DateField{Name: "expires_at"},
+			&core.DateField{Name: "expiry_warning_sent_at"},
+		)
+		roles.AddIndex("idx_roles_expires_at", false, "expires_at", "expires_at != ''")
+
+		return app.Save(roles)
+	}, func(app core.App) error {
+		roles, err := app.FindCollectionByNameOrId("roles")
+		if err != nil {
+			return nil
+		}
+
+		roles.RemoveIndex("idx_roles_expires_at")
+		roles.Fields.RemoveByName("expires_at")
+		roles.Fields.RemoveByName("expiry_warning_sent_at")
+
+		return app.Save(roles)
+	})
+}
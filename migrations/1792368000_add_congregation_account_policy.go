@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds the per-congregation account policy read by processInactiveUsers and
+// processUnprovisionedUsers. Each field is a day count; 0 keeps the built-in
+// default. A user in several congregations gets the strictest value of each.
+//   - inactivity_*_days: days since last login before the first warning, the
+//     final warning and disabling (defaults 91 / 152 / 183).
+//   - unprovisioned_*_days: days without any role before the same three steps
+//     (defaults 3 / 6 / 7).
+//
+// Warn < final warn < disable is checked on save by
+// handlers.ValidateCongregationAccountPolicy, against the effective values.
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+
+		bound := func(v float64) *float64 { return &v }
+		collection.Fields.Add(
+			&core.NumberField{Name: "inactivity_warn_days", Min: bound(14), Max: bound(700), OnlyInt: true},
+			&core.NumberField{Name: "inactivity_final_warn_days", Min: bound(21), Max: bound(720), OnlyInt: true},
+			&core.NumberField{Name: "inactivity_disable_days", Min: bound(30), Max: bound(730), OnlyInt: true},
+			&core.NumberField{Name: "unprovisioned_warn_days", Min: bound(1), Max: bound(28), OnlyInt: true},
+			&core.NumberField{Name: "unprovisioned_final_warn_days", Min: bound(2), Max: bound(29), OnlyInt: true},
+			&core.NumberField{Name: "unprovisioned_disable_days", Min: bound(3), Max: bound(30), OnlyInt: true},
+		)
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return nil
+		}
+
+		for _, name := range []string{
+			"inactivity_warn_days", "inactivity_final_warn_days", "inactivity_disable_days",
+			"unprovisioned_warn_days", "unprovisioned_final_warn_days", "unprovisioned_disable_days",
+		} {
+			collection.Fields.RemoveByName(name)
+		}
+
+		return app.Save(collection)
+	})
+}
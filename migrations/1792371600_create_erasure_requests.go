@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Creates erasure_requests, raised by a user asking for their account and
+// personal data to be removed. congregations snapshots the congregations the
+// user belonged to when asking, whose administrators confirm the request
+// through /account/erasure/confirm. Once completed the user relation is
+// unlinked by the account deletion and only the pseudonym remains. No API
+// rules: requests are managed through the /account/* routes.
+func init() {
+	m.Register(func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		congregationsCol, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+
+		requests := core.NewBaseCollection("erasure_requests")
+		requests.Fields.Add(
+			&core.RelationField{Name: "user", CollectionId: usersCol.Id, CascadeDelete: false},
+			&core.RelationField{Name: "congregations", CollectionId: congregationsCol.Id, CascadeDelete: false, MaxSelect: 999},
+			&core.TextField{Name: "reason", Max: 500},
+			&core.SelectField{Name: "status", Values: []string{"pending", "cancelled", "completed"}, MaxSelect: 1, Required: true},
+			&core.TextField{Name: "pseudonym"},
+			&core.RelationField{Name: "decided_by", CollectionId: usersCol.Id, CascadeDelete: false},
+			&core.DateField{Name: "decided_at"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		requests.AddIndex("idx_erasure_requests_user", false, "user", "")
+		requests.AddIndex("idx_erasure_requests_status", false, "status", "")
+
+		return app.Save(requests)
+	}, func(app core.App) error {
+		col, err := app.FindCollectionByNameOrId("erasure_requests")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(col)
+	})
+}
@@ -0,0 +1,70 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds threading to messages and per-recipient read receipts.
+//
+// messages.parent points a reply at the root message of its thread (replies
+// are never nested); resolved_at/resolved_by mark a root's thread resolved,
+// which keeps it out of the messages digest until someone replies again.
+//
+// message_reads holds one receipt per message and reader: a signed-in user,
+// or a publisher identified by the assignment behind their link-id. No API
+// rules: receipts are written and read through the /message/* routes.
+func init() {
+	m.Register(func(app core.App) error {
+		messages, err := app.FindCollectionByNameOrId("messages")
+		if err != nil {
+			return err
+		}
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		assignmentsCol, err := app.FindCollectionByNameOrId("assignments")
+		if err != nil {
+			return err
+		}
+
+		messages.Fields.Add(
+			&core.RelationField{Name: "parent", CollectionId: messages.Id, CascadeDelete: true, MaxSelect: 1},
+			&core.DateField{Name: "resolved_at"},
+			&core.RelationField{Name: "resolved_by", CollectionId: usersCol.Id, CascadeDelete: false},
+		)
+		messages.AddIndex("idx_messages_parent", false, "parent", "")
+		if err := app.Save(messages); err != nil {
+			return err
+		}
+
+		reads := core.NewBaseCollection("message_reads")
+		reads.Fields.Add(
+			&core.RelationField{Name: "message", CollectionId: messages.Id, CascadeDelete: true, Required: true},
+			&core.RelationField{Name: "user", CollectionId: usersCol.Id, CascadeDelete: true},
+			&core.RelationField{Name: "assignment", CollectionId: assignmentsCol.Id, CascadeDelete: true},
+			&core.DateField{Name: "read_at", Required: true},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		reads.AddIndex("idx_message_reads_reader", true, "message, user, assignment", "")
+		return app.Save(reads)
+	}, func(app core.App) error {
+		if col, err := app.FindCollectionByNameOrId("message_reads"); err == nil {
+			if err := app.Delete(col); err != nil {
+				return err
+			}
+		}
+
+		messages, err := app.FindCollectionByNameOrId("messages")
+		if err != nil {
+			return nil
+		}
+		messages.RemoveIndex("idx_messages_parent")
+		messages.Fields.RemoveByName("parent")
+		messages.Fields.RemoveByName("resolved_at")
+		messages.Fields.RemoveByName("resolved_by")
+		return app.Save(messages)
+	})
+}
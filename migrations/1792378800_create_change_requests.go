@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Creates change_requests, structured address corrections raised by a
+// publisher on their map: add a code, remove a code, rename a code, or flag
+// one address (code and floor) do-not-call. Each request opens a message
+// thread on the map (message) so administrators see it in the messages digest
+// and the publisher sees the decision as a reply. Administrators approve or
+// deny requests through /change/decide, which applies approved ones. No API
+// rules: requests are managed through the /change/* routes.
+func init() {
+	m.Register(func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		congregationsCol, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+		mapsCol, err := app.FindCollectionByNameOrId("maps")
+		if err != nil {
+			return err
+		}
+		assignmentsCol, err := app.FindCollectionByNameOrId("assignments")
+		if err != nil {
+			return err
+		}
+		messagesCol, err := app.FindCollectionByNameOrId("messages")
+		if err != nil {
+			return err
+		}
+
+		requests := core.NewBaseCollection("change_requests")
+		requests.Fields.Add(
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: true, Required: true},
+			&core.RelationField{Name: "map", CollectionId: mapsCol.Id, CascadeDelete: true, Required: true},
+			&core.RelationField{Name: "assignment", CollectionId: assignmentsCol.Id, CascadeDelete: false},
+			&core.TextField{Name: "requested_by"},
+			&core.SelectField{Name: "kind", Values: []string{"add_code", "remove_code", "rename_code", "flag_dnc"}, MaxSelect: 1, Required: true},
+			&core.TextField{Name: "code", Required: true},
+			&core.TextField{Name: "new_code"},
+			&core.NumberField{Name: "floor", OnlyInt: true},
+			&core.TextField{Name: "note", Max: 500},
+			&core.RelationField{Name: "message", CollectionId: messagesCol.Id, CascadeDelete: false, MaxSelect: 1},
+			&core.SelectField{Name: "status", Values: []string{"pending", "approved", "denied"}, MaxSelect: 1, Required: true},
+			&core.RelationField{Name: "decided_by", CollectionId: usersCol.Id, CascadeDelete: false},
+			&core.DateField{Name: "decided_at"},
+			&core.TextField{Name: "decision_note", Max: 500},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		requests.AddIndex("idx_change_requests_congregation_status", false, "congregation, status", "")
+		requests.AddIndex("idx_change_requests_map_status", false, "map, status", "")
+
+		return app.Save(requests)
+	}, func(app core.App) error {
+		col, err := app.FindCollectionByNameOrId("change_requests")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(col)
+	})
+}
@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Creates broadcasts, instructions pushed straight to the publishers holding a
+// live link on a map, a territory or the whole congregation, and
+// broadcast_receipts, one per assignment reached, whose acknowledged_at shows
+// who has seen it. Receipts keep the publisher and map so they stay readable
+// after the assignment expires and is cleaned up. No API rules: broadcasts
+// are sent and tracked through the /instruction/* routes.
+func init() {
+	m.Register(func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		congregationsCol, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+		mapsCol, err := app.FindCollectionByNameOrId("maps")
+		if err != nil {
+			return err
+		}
+		assignmentsCol, err := app.FindCollectionByNameOrId("assignments")
+		if err != nil {
+			return err
+		}
+
+		broadcasts := core.NewBaseCollection("broadcasts")
+		broadcasts.Fields.Add(
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: true, Required: true},
+			&core.SelectField{Name: "scope", Values: []string{"map", "territory", "congregation"}, MaxSelect: 1, Required: true},
+			&core.TextField{Name: "target", Required: true},
+			&core.TextField{Name: "message", Required: true, Max: 2000},
+			&core.RelationField{Name: "created_by", CollectionId: usersCol.Id, CascadeDelete: false},
+			&core.TextField{Name: "sender"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		broadcasts.AddIndex("idx_broadcasts_congregation_created", false, "congregation, created", "")
+		if err := app.Save(broadcasts); err != nil {
+			return err
+		}
+
+		receipts := core.NewBaseCollection("broadcast_receipts")
+		receipts.Fields.Add(
+			&core.RelationField{Name: "broadcast", CollectionId: broadcasts.Id, CascadeDelete: true, Required: true},
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: true, Required: true},
+			&core.RelationField{Name: "assignment", CollectionId: assignmentsCol.Id, CascadeDelete: false},
+			&core.TextField{Name: "link_id", Required: true},
+			&core.RelationField{Name: "map", CollectionId: mapsCol.Id, CascadeDelete: true},
+			&core.TextField{Name: "publisher"},
+			&core.DateField{Name: "acknowledged_at"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		receipts.AddIndex("idx_broadcast_receipts_link", true, "broadcast, link_id", "")
+		receipts.AddIndex("idx_broadcast_receipts_pending", false, "link_id, acknowledged_at", "")
+		return app.Save(receipts)
+	}, func(app core.App) error {
+		for _, name := range []string{"broadcast_receipts", "broadcasts"} {
+			col, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			if err := app.Delete(col); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// messagesScheduleRule hides a scheduled message from link-id publishers
+// until processMessageSchedule stamps published_at. Signed-in members still
+// list it so administrators can review what is queued.
+const messagesScheduleRule = ` && (@request.auth.id != "" || publish_at = "" || published_at != "")`
+
+// Adds scheduling to administrator messages.
+//
+// messages.publish_at holds an instruction back until that time;
+// processMessageSchedule stamps published_at once it has passed, which is
+// when link-id publishers start seeing it and when the instructions digest
+// picks it up. Moving publish_at clears the stamp. messages.pin_until is the
+// time after which the job unpins the message.
+func init() {
+	m.Register(func(app core.App) error {
+		messages, err := app.FindCollectionByNameOrId("messages")
+		if err != nil {
+			return err
+		}
+
+		messages.Fields.Add(
+			&core.DateField{Name: "publish_at"},
+			&core.DateField{Name: "published_at"},
+			&core.DateField{Name: "pin_until"},
+		)
+		messages.AddIndex("idx_messages_publish_at", false, "publish_at", "publish_at != '' AND published_at = ''")
+		messages.AddIndex("idx_messages_pin_until", false, "pin_until", "pin_until != '' AND pinned = 1")
+
+		if messages.ListRule != nil && !strings.HasSuffix(*messages.ListRule, messagesScheduleRule) {
+			rule := *messages.ListRule + messagesScheduleRule
+			messages.ListRule = &rule
+		}
+
+		return app.Save(messages)
+	}, func(app core.App) error {
+		messages, err := app.FindCollectionByNameOrId("messages")
+		if err != nil {
+			return nil
+		}
+
+		if messages.ListRule != nil {
+			rule := strings.TrimSuffix(*messages.ListRule, messagesScheduleRule)
+			messages.ListRule = &rule
+		}
+		messages.RemoveIndex("idx_messages_publish_at")
+		messages.RemoveIndex("idx_messages_pin_until")
+		messages.Fields.RemoveByName("publish_at")
+		messages.Fields.RemoveByName("published_at")
+		messages.Fields.RemoveByName("pin_until")
+
+		return app.Save(messages)
+	})
+}
@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Creates email_outbox, the persistent queue every job email goes through.
+// A row is pending until the outbox worker delivers it (sent) or gives up
+// after repeated failures (dead). effect and effect_refs name the bookkeeping
+// to apply once the email is delivered, such as marking digested messages
+// read, so nothing is recorded as sent before it was. Attachments are kept in
+// a protected file field under generated names; attachment_names holds the
+// filenames the recipient sees. No API rules: failures are listed and retried
+// through the /email/* routes.
+func init() {
+	m.Register(func(app core.App) error {
+		congregationsCol, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+
+		outbox := core.NewBaseCollection("email_outbox")
+		outbox.Fields.Add(
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: true, MaxSelect: 1},
+			&core.JSONField{Name: "recipients", Required: true},
+			&core.TextField{Name: "subject", Required: true},
+			&core.TextField{Name: "html", Max: 2000000},
+			&core.FileField{Name: "attachments", MaxSelect: 5, MaxSize: 25 << 20, Protected: true},
+			&core.JSONField{Name: "attachment_names"},
+			&core.SelectField{Name: "status", Values: []string{"pending", "sending", "sent", "dead"}, MaxSelect: 1, Required: true},
+			&core.NumberField{Name: "attempts", OnlyInt: true},
+			&core.DateField{Name: "next_attempt_at"},
+			&core.TextField{Name: "last_error", Max: 1000},
+			&core.DateField{Name: "sent_at"},
+			&core.TextField{Name: "effect"},
+			&core.JSONField{Name: "effect_refs"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		outbox.AddIndex("idx_email_outbox_status_next_attempt", false, "status, next_attempt_at", "")
+		outbox.AddIndex("idx_email_outbox_congregation_status", false, "congregation, status", "")
+
+		return app.Save(outbox)
+	}, func(app core.App) error {
+		col, err := app.FindCollectionByNameOrId("email_outbox")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(col)
+	})
+}
@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// notificationKinds are the digest emails a user can mute or batch.
+var notificationKinds = []string{"messages", "instructions", "notes", "new_addresses", "access_requests", "auto_reset"}
+
+// Creates notification_preferences, one row per user and congregation:
+// which digests are muted, whether the rest arrive as they happen
+// (immediate) or batched daily or weekly, and quiet hours ("HH:MM", in the
+// congregation's timezone) during which nothing is delivered. A user without
+// a row gets every digest immediately. unsubscribe_token is the one-click
+// unsubscribe credential carried by each digest email.
+//
+// Also creates notification_batch_items, the digests held for users on
+// daily or weekly batching until processNotificationBatches sends them.
+//
+// No API rules: preferences are managed through the /notification/* routes.
+func init() {
+	m.Register(func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		congregationsCol, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+
+		const quietPattern = `^([01][0-9]|2[0-3]):[0-5][0-9]$`
+		preferences := core.NewBaseCollection("notification_preferences")
+		preferences.Fields.Add(
+			&core.RelationField{Name: "user", CollectionId: usersCol.Id, CascadeDelete: true, Required: true, MaxSelect: 1},
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: true, Required: true, MaxSelect: 1},
+			&core.SelectField{Name: "muted", Values: notificationKinds, MaxSelect: len(notificationKinds)},
+			&core.SelectField{Name: "frequency", Values: []string{"immediate", "daily", "weekly"}, MaxSelect: 1},
+			&core.TextField{Name: "quiet_start", Pattern: quietPattern},
+			&core.TextField{Name: "quiet_end", Pattern: quietPattern},
+			&core.TextField{Name: "unsubscribe_token", Required: true, Hidden: true},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		preferences.AddIndex("idx_notification_preferences_user_congregation", true, "user, congregation", "")
+		preferences.AddIndex("idx_notification_preferences_token", true, "unsubscribe_token", "")
+		if err := app.Save(preferences); err != nil {
+			return err
+		}
+
+		items := core.NewBaseCollection("notification_batch_items")
+		items.Fields.Add(
+			&core.RelationField{Name: "user", CollectionId: usersCol.Id, CascadeDelete: true, Required: true, MaxSelect: 1},
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: true, Required: true, MaxSelect: 1},
+			&core.SelectField{Name: "kind", Values: notificationKinds, MaxSelect: 1, Required: true},
+			&core.TextField{Name: "subject", Required: true},
+			&core.TextField{Name: "html", Max: 2000000},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		items.AddIndex("idx_notification_batch_items_user_congregation", false, "user, congregation, created", "")
+
+		return app.Save(items)
+	}, func(app core.App) error {
+		for _, name := range []string{"notification_batch_items", "notification_preferences"} {
+			col, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			if err := app.Delete(col); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+var webhookEvents = []string{
+	"address.status_changed",
+	"assignment.created",
+	"assignment.expired",
+	"role.granted",
+	"role.revoked",
+	"map.completed",
+	"message.created",
+}
+
+// Creates webhooks, the endpoints a congregation's administrators register to
+// be told about domain events, and webhook_deliveries, one row per event sent
+// to an endpoint. A delivery is pending until the endpoint answers 2xx
+// (delivered) or repeated failures give up on it (failed); the rows double as
+// the delivery log. secret signs each delivery and is never returned after
+// the webhook is created. No API rules: webhooks are managed through the
+// /webhook/* routes.
+func init() {
+	m.Register(func(app core.App) error {
+		congregationsCol, err := app.FindCollectionByNameOrId("congregations")
+		if err != nil {
+			return err
+		}
+
+		webhooks := core.NewBaseCollection("webhooks")
+		webhooks.Fields.Add(
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: true, Required: true, MaxSelect: 1},
+			&core.URLField{Name: "url", Required: true},
+			&core.TextField{Name: "description", Max: 200},
+			&core.SelectField{Name: "events", Values: webhookEvents, MaxSelect: len(webhookEvents), Required: true},
+			&core.BoolField{Name: "active"},
+			&core.TextField{Name: "secret", Required: true, Hidden: true},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		webhooks.AddIndex("idx_webhooks_congregation", false, "congregation", "")
+		if err := app.Save(webhooks); err != nil {
+			return err
+		}
+
+		deliveries := core.NewBaseCollection("webhook_deliveries")
+		deliveries.Fields.Add(
+			&core.RelationField{Name: "webhook", CollectionId: webhooks.Id, CascadeDelete: true, Required: true, MaxSelect: 1},
+			&core.RelationField{Name: "congregation", CollectionId: congregationsCol.Id, CascadeDelete: true, Required: true, MaxSelect: 1},
+			&core.SelectField{Name: "event", Values: append([]string{"ping"}, webhookEvents...), MaxSelect: 1, Required: true},
+			&core.JSONField{Name: "payload", Required: true, MaxSize: 1 << 20},
+			&core.SelectField{Name: "status", Values: []string{"pending", "sending", "delivered", "failed"}, MaxSelect: 1, Required: true},
+			&core.NumberField{Name: "attempts", OnlyInt: true},
+			&core.DateField{Name: "next_attempt_at"},
+			&core.NumberField{Name: "response_status", OnlyInt: true},
+			&core.TextField{Name: "last_error", Max: 1000},
+			&core.DateField{Name: "delivered_at"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		deliveries.AddIndex("idx_webhook_deliveries_status_next_attempt", false, "status, next_attempt_at", "")
+		deliveries.AddIndex("idx_webhook_deliveries_webhook_created", false, "webhook, created", "")
+
+		return app.Save(deliveries)
+	}, func(app core.App) error {
+		for _, name := range []string{"webhook_deliveries", "webhooks"} {
+			col, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			if err := app.Delete(col); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
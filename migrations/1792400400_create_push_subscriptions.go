@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Creates push_subscriptions, the Web Push subscriptions browsers registered
+// through /push/subscribe. Each belongs to either a signed-in user or a
+// publisher's link-id (assignment), and goes with it: a link's subscriptions
+// are deleted along with the assignment when assignmentsCleanup expires it.
+// endpoint is the push service URL; p256dh and auth are the browser's keys
+// for encrypting payloads to it. expiry_warned_at records that a link's
+// subscription was warned its assignment is about to expire.
+//
+// No API rules: subscriptions are managed through the /push/* routes.
+func init() {
+	m.Register(func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		assignmentsCol, err := app.FindCollectionByNameOrId("assignments")
+		if err != nil {
+			return err
+		}
+
+		subscriptions := core.NewBaseCollection("push_subscriptions")
+		subscriptions.Fields.Add(
+			&core.RelationField{Name: "user", CollectionId: usersCol.Id, CascadeDelete: true, MaxSelect: 1},
+			&core.RelationField{Name: "assignment", CollectionId: assignmentsCol.Id, CascadeDelete: true, MaxSelect: 1},
+			&core.URLField{Name: "endpoint", Required: true},
+			&core.TextField{Name: "p256dh", Required: true, Hidden: true, Max: 200},
+			&core.TextField{Name: "auth", Required: true, Hidden: true, Max: 100},
+			&core.TextField{Name: "user_agent", Max: 300},
+			&core.DateField{Name: "expiry_warned_at"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		subscriptions.AddIndex("idx_push_subscriptions_endpoint", true, "endpoint", "")
+		subscriptions.AddIndex("idx_push_subscriptions_user", false, "user", "")
+		subscriptions.AddIndex("idx_push_subscriptions_assignment", false, "assignment", "")
+
+		return app.Save(subscriptions)
+	}, func(app core.App) error {
+		col, err := app.FindCollectionByNameOrId("push_subscriptions")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(col)
+	})
+}
@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// emailLanguages are the languages with a catalog in templates/locales.
+var emailLanguages = []string{"en", "zh", "es", "pt", "ar"}
+
+// Adds the language emails and AI summaries are written in.
+//
+// congregations.language applies to everything sent on behalf of the
+// congregation; left empty, the jobs derive it from origin. users.language
+// overrides it for emails addressed to that user alone.
+func init() {
+	m.Register(func(app core.App) error {
+		for _, name := range []string{"congregations", "users"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			collection.Fields.Add(&core.SelectField{Name: "language", Values: emailLanguages, MaxSelect: 1})
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for _, name := range []string{"congregations", "users"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			collection.Fields.RemoveByName("language")
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
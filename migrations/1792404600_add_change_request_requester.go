@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds change_requests.requested_by_user, the signed-in account that raised a
+// request. Requests raised without a link-id have no assignment to trace the
+// requester through, so the decision email goes to this account instead.
+func init() {
+	m.Register(func(app core.App) error {
+		usersCol, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		requests, err := app.FindCollectionByNameOrId("change_requests")
+		if err != nil {
+			return err
+		}
+		requests.Fields.Add(&core.RelationField{Name: "requested_by_user", CollectionId: usersCol.Id, CascadeDelete: false, MaxSelect: 1})
+		return app.Save(requests)
+	}, func(app core.App) error {
+		requests, err := app.FindCollectionByNameOrId("change_requests")
+		if err != nil {
+			return nil
+		}
+		requests.Fields.RemoveByName("requested_by_user")
+		return app.Save(requests)
+	})
+}
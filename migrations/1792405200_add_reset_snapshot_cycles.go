@@ -0,0 +1,27 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds reset_snapshots.cycles, the coverage cycles a reset closed and opened,
+// so restoring the snapshot can reopen the closed cycle and drop the new one.
+func init() {
+	m.Register(func(app core.App) error {
+		snapshots, err := app.FindCollectionByNameOrId("reset_snapshots")
+		if err != nil {
+			return err
+		}
+		// One {closed, opened} entry per map or territory whose cycle restarted.
+		snapshots.Fields.Add(&core.JSONField{Name: "cycles"})
+		return app.Save(snapshots)
+	}, func(app core.App) error {
+		snapshots, err := app.FindCollectionByNameOrId("reset_snapshots")
+		if err != nil {
+			return nil
+		}
+		snapshots.Fields.RemoveByName("cycles")
+		return app.Save(snapshots)
+	})
+}
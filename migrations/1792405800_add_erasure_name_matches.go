@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds erasure_requests.name_matches, the records naming the user only by
+// display name when the request was raised. Names are not unique, so the
+// confirming administrator picks which of them to pseudonymise.
+func init() {
+	m.Register(func(app core.App) error {
+		requests, err := app.FindCollectionByNameOrId("erasure_requests")
+		if err != nil {
+			return err
+		}
+		// One {collection, id, fields, congregation, created} entry per record.
+		requests.Fields.Add(&core.JSONField{Name: "name_matches", MaxSize: 10 << 20})
+		return app.Save(requests)
+	}, func(app core.App) error {
+		requests, err := app.FindCollectionByNameOrId("erasure_requests")
+		if err != nil {
+			return nil
+		}
+		requests.Fields.RemoveByName("name_matches")
+		return app.Save(requests)
+	})
+}
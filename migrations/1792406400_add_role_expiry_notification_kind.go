@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Adds the role_expiry digest, the administrators' list of expiring roles, to
+// the kinds notification_preferences.muted and notification_batch_items.kind
+// accept.
+func init() {
+	setKinds := func(app core.App, kinds []string) error {
+		for _, target := range []struct{ collection, field string }{
+			{"notification_preferences", "muted"},
+			{"notification_batch_items", "kind"},
+		} {
+			collection, err := app.FindCollectionByNameOrId(target.collection)
+			if err != nil {
+				return err
+			}
+			field, ok := collection.Fields.GetByName(target.field).(*core.SelectField)
+			if !ok {
+				continue
+			}
+			field.Values = kinds
+			if field.MaxSelect > 1 {
+				field.MaxSelect = len(kinds)
+			}
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	m.Register(func(app core.App) error {
+		return setKinds(app, append(slices.Clone(notificationKinds), "role_expiry"))
+	}, func(app core.App) error {
+		return setKinds(app, notificationKinds)
+	})
+}